@@ -13,9 +13,43 @@
 #ifndef BPF_MAP_TYPE_HASH
 #define BPF_MAP_TYPE_HASH 1
 #endif
+#ifndef BPF_MAP_TYPE_ARRAY
+#define BPF_MAP_TYPE_ARRAY 2
+#endif
+#ifndef BPF_MAP_TYPE_LRU_HASH
+#define BPF_MAP_TYPE_LRU_HASH 9
+#endif
+#ifndef BPF_MAP_TYPE_PERCPU_ARRAY
+#define BPF_MAP_TYPE_PERCPU_ARRAY 6
+#endif
+#ifndef BPF_MAP_TYPE_STACK_TRACE
+#define BPF_MAP_TYPE_STACK_TRACE 7
+#endif
 #ifndef BPF_ANY
 #define BPF_ANY 0
 #endif
+#ifndef BPF_NOEXIST
+#define BPF_NOEXIST 1
+#endif
+#ifndef BPF_F_USER_STACK
+#define BPF_F_USER_STACK (1ULL << 8)
+#endif
+#ifndef BPF_F_REUSE_STACKID
+#define BPF_F_REUSE_STACKID (1ULL << 10)
+#endif
+
+#ifndef KERNEL_VERSION
+#define KERNEL_VERSION(a, b, c) (((a) << 16) + ((b) << 8) + ((c) > 255 ? 255 : (c)))
+#endif
+
+#ifndef container_of
+#define container_of(ptr, type, member) \
+	((type *)((void *)(ptr) - __builtin_offsetof(type, member)))
+#endif
+
+#define MAX_STACK_DEPTH 127
+
+extern int LINUX_KERNEL_VERSION __kconfig;
 
 enum event_type {
 	EVENT_DNS,
@@ -26,6 +60,30 @@ enum event_type {
 	EVENT_READ,
 	EVENT_FSYNC,
 	EVENT_SCHED_SWITCH,
+	EVENT_TCP_RETRANSMIT,
+	EVENT_TCP_SEND_RESET,
+	EVENT_TCP_RECV_RESET,
+	EVENT_TCP_RTT,
+	EVENT_RUNQ_LATENCY,
+	EVENT_CPU_TIME,   /* sampled in userspace from oncpu_threads */
+	EVENT_CGROUP_CPU, /* sampled in userspace from cpu.stat */
+	EVENT_PROCESS_EXEC,
+	EVENT_PROCESS_FORK,
+	EVENT_PROCESS_EXIT,
+	EVENT_OOM_KILL,
+	EVENT_CGROUP_MEMORY, /* sampled in userspace from the memory controller */
+	EVENT_BLOCK_IO,
+	EVENT_PAGE_FAULT,
+	EVENT_PAGE_FAULT_COUNT, /* sampled in userspace from page_fault_counts */
+	EVENT_FUTEX_WAIT,
+	EVENT_SYSCALL, /* sampled in userspace from syscall_stats */
+	EVENT_ACCEPT,
+	EVENT_NETSTAT, /* sampled in userspace from /proc/<pid>/net/netstat */
+	EVENT_TCP_CONNECTION,
+	EVENT_UDP_SEND,
+	EVENT_UDP_RECV,
+	EVENT_UDP_DROP,
+	EVENT_DNS_QUERY, /* a query on the wire, as opposed to a getaddrinfo call */
 };
 
 struct event {
@@ -33,9 +91,71 @@ struct event {
 	u32 pid;
 	u32 type;
 	u64 latency_ns;
+	u64 cgroup_id;
 	s32 error;
+	u32 state;
+	u64 bytes;
 	char target[MAX_STRING_LEN];
 	char details[MAX_STRING_LEN];
+	/* type-specific values */
+	union {
+		struct {
+			u32 rttvar_us;
+			u32 snd_cwnd;
+			u32 total_retrans;
+		} tcp;
+		struct {
+			u64 bytes_requested;
+			u64 bytes_returned;
+			u64 ino;
+			u32 dev;
+		} fs;
+		struct {
+			s32 kernel_stack_id;
+			s32 user_stack_id;
+			u32 tid;
+			u32 waker_pid;
+		} sched;
+		struct {
+			u32 ppid;
+			u32 exit_code;
+			u32 child_pid;
+		} proc;
+		struct {
+			u64 total_pages;
+			s64 points;
+			u32 trigger_pid;
+		} oom;
+		struct {
+			u64 sector;
+			u64 queue_ns;
+			u32 bytes;
+			u32 dev;
+			u32 op;
+		} block;
+		struct {
+			u64 address;
+			u64 offset;
+			u32 write;
+		} fault;
+		struct {
+			u64 uaddr;
+			s32 user_stack_id;
+			u32 tid;
+			u32 waker_pid;
+			u32 op;
+		} futex;
+		struct {
+			u32 backlog;
+			u32 max_backlog;
+		} accept;
+		struct {
+			u64 bytes_sent;
+			u64 bytes_received;
+			u32 flags;
+		} conn;
+		u64 raw[4];
+	} info;
 };
 
 struct {
@@ -57,6 +177,423 @@ struct {
 	__type(value, char[MAX_STRING_LEN]);
 } dns_targets SEC(".maps");
 
+#define DNS_PORT 53
+#define DNS_HEADER_LEN 12
+/* header, a question name of up to MAX_STRING_LEN bytes, qtype and qclass */
+#define DNS_MSG_LEN (DNS_HEADER_LEN + MAX_STRING_LEN + 4)
+
+struct dns_key {
+	u64 cgroup_id;
+	u16 id;
+	u16 port;
+	u32 pad;
+};
+
+struct dns_query {
+	u64 start;
+	u32 pid;
+	u32 qtype;
+	char name[MAX_STRING_LEN];
+};
+
+/* outstanding DNS queries, matched to responses by transaction ID and client port */
+struct {
+	__uint(type, BPF_MAP_TYPE_LRU_HASH);
+	__uint(max_entries, 4096);
+	__type(key, struct dns_key);
+	__type(value, struct dns_query);
+} dns_queries SEC(".maps");
+
+struct dns_tcp_read {
+	u64 buf;
+	u16 port;
+};
+
+/* user buffers passed to tcp_recvmsg on port 53 connections */
+struct {
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__uint(max_entries, 1024);
+	__type(key, u64);
+	__type(value, struct dns_tcp_read);
+} dns_tcp_reads SEC(".maps");
+
+/* socket passed to tcp_sendmsg and tcp_recvmsg, keyed by PID/TID */
+struct {
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__uint(max_entries, 10240);
+	__type(key, u64);
+	__type(value, u64);
+} tcp_msg_socks SEC(".maps");
+
+struct udp_msg {
+	u64 sk;
+	u64 msg;
+};
+
+/* socket and message passed to udp_sendmsg and udp_recvmsg, keyed by PID/TID */
+struct {
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__uint(max_entries, 10240);
+	__type(key, u64);
+	__type(value, struct udp_msg);
+} udp_msgs SEC(".maps");
+
+/* socket of the target cgroups that each CPU is queueing a received datagram
+ * on, 0 when none */
+struct {
+	__uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+	__uint(max_entries, 1);
+	__type(key, u32);
+	__type(value, u64);
+} udp_rcv_socks SEC(".maps");
+
+/* UDP drop reasons, reported in event.state */
+#define UDP_DROP_UNKNOWN 0   /* kernel without drop reasons */
+#define UDP_DROP_RCVBUF 1    /* socket receive buffer full */
+#define UDP_DROP_PROTO_MEM 2 /* net.ipv4.udp_mem exhausted */
+#define UDP_DROP_CSUM 3      /* bad checksum */
+#define UDP_DROP_FILTER 4    /* socket filter or XFRM policy */
+#define UDP_DROP_OTHER 5
+
+struct fs_entry {
+	u64 start;
+	u64 file;
+	u64 count;
+};
+
+/* in-flight vfs_read/vfs_write/vfs_fsync calls per thread */
+struct {
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__uint(max_entries, 1024);
+	__type(key, u64);
+	__type(value, struct fs_entry);
+} fs_entries SEC(".maps");
+
+/* kernel and user stacks of threads switched out, referenced by stack ID.
+ * Nothing frees the IDs, so they are taken with BPF_F_REUSE_STACKID and new
+ * stacks replace old ones that hash to the same bucket instead of failing
+ * once the map is full. */
+struct {
+	__uint(type, BPF_MAP_TYPE_STACK_TRACE);
+	__uint(max_entries, 8192);
+	__uint(key_size, sizeof(u32));
+	__uint(value_size, MAX_STACK_DEPTH * sizeof(u64));
+} stack_traces SEC(".maps");
+
+struct offcpu_entry {
+	u64 start;
+	u64 wakeup;
+	u64 cgroup_id;
+	u32 pid;
+	u32 state;
+	s32 kernel_stack_id;
+	s32 user_stack_id;
+	u32 waker_pid;
+	char comm[16];
+	char waker_comm[16];
+};
+
+/* threads of the target cgroups that are currently off-CPU, keyed by TID */
+struct {
+	__uint(type, BPF_MAP_TYPE_LRU_HASH);
+	__uint(max_entries, 10240);
+	__type(key, u32);
+	__type(value, struct offcpu_entry);
+} offcpu_threads SEC(".maps");
+
+/* futex waits shorter than this are not reported */
+#define FUTEX_MIN_WAIT_NS 100000ULL
+
+struct futex_entry {
+	u64 start;
+	u64 uaddr;
+	u32 op;
+	s32 user_stack_id;
+	u32 waker_pid;
+	char waker_comm[16];
+};
+
+/* futex waits in progress in the target cgroups, keyed by TID */
+struct {
+	__uint(type, BPF_MAP_TYPE_LRU_HASH);
+	__uint(max_entries, 10240);
+	__type(key, u32);
+	__type(value, struct futex_entry);
+} futex_waits SEC(".maps");
+
+/* index 0: non-zero to record the user stacks of futex waiters, set from
+ * userspace */
+struct {
+	__uint(type, BPF_MAP_TYPE_ARRAY);
+	__uint(max_entries, 1);
+	__type(key, u32);
+	__type(value, u32);
+} futex_stacks_enabled SEC(".maps");
+
+struct syscall_entry {
+	u64 start;
+	u64 nr;
+};
+
+/* system calls in progress in the target cgroups, keyed by TID */
+struct {
+	__uint(type, BPF_MAP_TYPE_LRU_HASH);
+	__uint(max_entries, 10240);
+	__type(key, u32);
+	__type(value, struct syscall_entry);
+} syscall_starts SEC(".maps");
+
+/* slot 0 counts calls under 1µs, slot i calls of [2^(i-1), 2^i) µs and the
+ * last slot everything slower */
+#define SYSCALL_HIST_SLOTS 24
+
+struct syscall_key {
+	u64 cgroup_id;
+	u32 nr;
+	s32 err;
+};
+
+struct syscall_stat {
+	u64 count;
+	u64 total_ns;
+	u64 hist[SYSCALL_HIST_SLOTS];
+};
+
+/* cumulative system call counts and latencies of the target cgroups per
+ * cgroup, system call and errno, read periodically from userspace */
+struct {
+	__uint(type, BPF_MAP_TYPE_LRU_HASH);
+	__uint(max_entries, 10240);
+	__type(key, struct syscall_key);
+	__type(value, struct syscall_stat);
+} syscall_stats SEC(".maps");
+
+struct oncpu_time {
+	u64 ns;
+	u64 cgroup_id;
+	u32 pid;
+};
+
+/* cumulative on-CPU time of the target cgroups' threads, keyed by TID and
+ * read periodically from userspace */
+struct {
+	__uint(type, BPF_MAP_TYPE_LRU_HASH);
+	__uint(max_entries, 10240);
+	__type(key, u32);
+	__type(value, struct oncpu_time);
+} oncpu_threads SEC(".maps");
+
+/* when the task currently running on each CPU was switched in */
+struct {
+	__uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+	__uint(max_entries, 1);
+	__type(key, u32);
+	__type(value, u64);
+} cpu_switch_in SEC(".maps");
+
+struct profile_key {
+	u64 cgroup_id;
+	u32 pid;
+	s32 kernel_stack_id;
+	s32 user_stack_id;
+	u32 pad;
+};
+
+/* stacks sampled by the CPU profiler, kept apart from stack_traces so that
+ * profiling cannot crowd out off-CPU stacks */
+struct {
+	__uint(type, BPF_MAP_TYPE_STACK_TRACE);
+	__uint(max_entries, 16384);
+	__uint(key_size, sizeof(u32));
+	__uint(value_size, MAX_STACK_DEPTH * sizeof(u64));
+} profile_stacks SEC(".maps");
+
+/* number of profiler samples per process and stack */
+struct {
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__uint(max_entries, 16384);
+	__type(key, struct profile_key);
+	__type(value, u64);
+} profile_counts SEC(".maps");
+
+struct block_rq_entry {
+	u64 insert;
+	u64 issue;
+	u64 cgroup_id;
+	u32 pid;
+	u32 bytes;
+};
+
+struct fault_entry {
+	u64 start;
+	u64 address;
+	u64 file;
+	u64 vm_start;
+	u64 vm_end;
+	u64 pgoff;
+	u32 write;
+	u32 major;
+	u32 retry;
+};
+
+/* in-flight user page faults per thread, kept across VM_FAULT_RETRY so that
+ * a retried fault is counted once */
+struct {
+	__uint(type, BPF_MAP_TYPE_LRU_HASH);
+	__uint(max_entries, 10240);
+	__type(key, u64);
+	__type(value, struct fault_entry);
+} fault_entries SEC(".maps");
+
+struct fault_count {
+	u64 minor;
+	u64 major;
+	u64 cgroup_id;
+};
+
+/* cumulative page faults of the target cgroups' processes, keyed by PID and
+ * read periodically from userspace */
+struct {
+	__uint(type, BPF_MAP_TYPE_LRU_HASH);
+	__uint(max_entries, 10240);
+	__type(key, u32);
+	__type(value, struct fault_count);
+} page_fault_counts SEC(".maps");
+
+/* block requests of the target cgroups from insertion into the I/O scheduler
+ * until completion, keyed by struct request pointer */
+struct {
+	__uint(type, BPF_MAP_TYPE_LRU_HASH);
+	__uint(max_entries, 10240);
+	__type(key, u64);
+	__type(value, struct block_rq_entry);
+} block_requests SEC(".maps");
+
+/* run-queue waits shorter than this are not reported */
+#define RUNQ_MIN_LATENCY_NS 100000ULL
+
+struct runq_entry {
+	u64 start;
+	u64 cgroup_id;
+	u32 pid;
+};
+
+/* runnable threads of the target cgroups waiting for a CPU, keyed by TID */
+struct {
+	__uint(type, BPF_MAP_TYPE_LRU_HASH);
+	__uint(max_entries, 10240);
+	__type(key, u32);
+	__type(value, struct runq_entry);
+} runq_threads SEC(".maps");
+
+/* minimum interval between RTT samples of the same socket */
+#define RTT_SAMPLE_INTERVAL_NS 1000000000ULL
+
+/* last RTT sample time per socket */
+struct {
+	__uint(type, BPF_MAP_TYPE_LRU_HASH);
+	__uint(max_entries, 8192);
+	__type(key, u64);
+	__type(value, u64);
+} rtt_samples SEC(".maps");
+
+/* time each passively opened connection of the target cgroups became
+ * established and joined its listener's accept queue, keyed by struct sock
+ * pointer */
+struct {
+	__uint(type, BPF_MAP_TYPE_LRU_HASH);
+	__uint(max_entries, 10240);
+	__type(key, u64);
+	__type(value, u64);
+} accept_queue SEC(".maps");
+
+/* tcp_conn flags */
+#define CONN_PASSIVE 0x1        /* accepted rather than connected */
+#define CONN_LOCAL_CLOSE 0x2    /* the local side sent the first FIN */
+#define CONN_REMOTE_CLOSE 0x4   /* the peer sent the first FIN */
+#define CONN_RESET_SENT 0x8
+#define CONN_RESET_RECEIVED 0x10
+#define CONN_CLOSED 0x20        /* in CLOSE, reported when the socket is destroyed */
+
+struct tcp_conn {
+	u64 start;
+	u64 cgroup_id;
+	u32 pid;
+	u32 flags;
+	u32 close_state;        /* the state the connection was closed from */
+};
+
+/* open TCP connections of the target cgroups, keyed by struct sock pointer */
+struct {
+	__uint(type, BPF_MAP_TYPE_LRU_HASH);
+	__uint(max_entries, 65536);
+	__type(key, u64);
+	__type(value, struct tcp_conn);
+} tcp_conns SEC(".maps");
+
+/* index 0: non-zero when the tcp_send_active_reset and tcp_v4_destroy_sock
+ * probes are attached, set from userspace */
+struct {
+	__uint(type, BPF_MAP_TYPE_ARRAY);
+	__uint(max_entries, 1);
+	__type(key, u32);
+	__type(value, u32);
+} tcp_close_deferred SEC(".maps");
+
+/* listening socket passed to inet_csk_accept, keyed by PID/TID */
+struct {
+	__uint(type, BPF_MAP_TYPE_LRU_HASH);
+	__uint(max_entries, 10240);
+	__type(key, u64);
+	__type(value, u64);
+} accept_listeners SEC(".maps");
+
+/* cgroup IDs of the traced pod, filled in from userspace by AttachToCgroup */
+struct {
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__uint(max_entries, 256);
+	__type(key, u64);
+	__type(value, u8);
+} target_cgroups SEC(".maps");
+
+/* index 0: non-zero once target_cgroups is populated */
+struct {
+	__uint(type, BPF_MAP_TYPE_ARRAY);
+	__uint(max_entries, 1);
+	__type(key, u32);
+	__type(value, u32);
+} cgroup_filter_enabled SEC(".maps");
+
+static inline int is_target_cgroup(u64 cgroup_id) {
+	u32 zero = 0;
+	u32 *enabled = bpf_map_lookup_elem(&cgroup_filter_enabled, &zero);
+	if (!enabled || *enabled == 0) {
+		return 1;
+	}
+	
+	return bpf_map_lookup_elem(&target_cgroups, &cgroup_id) ? 1 : 0;
+}
+
+static inline int in_target_cgroup(void) {
+	return is_target_cgroup(bpf_get_current_cgroup_id());
+}
+
+/* sock_cgroup_id returns the cgroup that owns sk, for probes that run in
+ * softirq context where the current task is unrelated to the socket */
+static inline u64 sock_cgroup_id(struct sock *sk) {
+	struct cgroup *cgrp;
+	
+	if (bpf_core_field_exists(sk->sk_cgrp_data.cgroup)) {
+		cgrp = BPF_CORE_READ(sk, sk_cgrp_data.cgroup);
+	} else {
+		cgrp = (struct cgroup *)BPF_CORE_READ(sk, sk_cgrp_data.val); // before 5.15
+	}
+	if (!cgrp) {
+		return 0;
+	}
+	return BPF_CORE_READ(cgrp, kn, id);
+}
+
 static inline u64 get_key(u32 pid, u32 tid) {
 	return ((u64)pid << 32) | tid;
 }
@@ -140,8 +677,292 @@ static inline void format_ipv6_port(const u8 *ipv6, u16 port, char *buf) {
 	buf[idx] = '\0';
 }
 
+/* dns_decode_question converts the wire-format QNAME at q into dotted form and
+ * returns the QTYPE following it, or 0 if the name does not fit */
+static inline u16 dns_decode_question(const u8 *q, char *name) {
+	u32 next_label = 0;
+	u32 end = 0;
+	
+	for (u32 i = 0; i < MAX_STRING_LEN; i++) {
+		u8 c = q[i];
+		if (i == next_label) {
+			if (c == 0) {
+				end = i + 1;
+				break;
+			}
+			if (c > 63) { // compression pointers never appear in the question
+				return 0;
+			}
+			next_label = i + c + 1;
+			c = '.';
+		}
+		if (i > 0) {
+			name[i - 1] = c;
+		}
+	}
+	
+	if (end == 0 || end > MAX_STRING_LEN) {
+		return 0;
+	}
+	return ((u16)q[end] << 8) | q[end + 1];
+}
+
+static inline void format_dns_type(u16 qtype, char *buf) {
+	switch (qtype) {
+	case 1:
+		__builtin_memcpy(buf, "A", 2);
+		return;
+	case 2:
+		__builtin_memcpy(buf, "NS", 3);
+		return;
+	case 5:
+		__builtin_memcpy(buf, "CNAME", 6);
+		return;
+	case 6:
+		__builtin_memcpy(buf, "SOA", 4);
+		return;
+	case 12:
+		__builtin_memcpy(buf, "PTR", 4);
+		return;
+	case 15:
+		__builtin_memcpy(buf, "MX", 3);
+		return;
+	case 16:
+		__builtin_memcpy(buf, "TXT", 4);
+		return;
+	case 28:
+		__builtin_memcpy(buf, "AAAA", 5);
+		return;
+	case 33:
+		__builtin_memcpy(buf, "SRV", 4);
+		return;
+	case 64:
+		__builtin_memcpy(buf, "SVCB", 5);
+		return;
+	case 65:
+		__builtin_memcpy(buf, "HTTPS", 6);
+		return;
+	case 255:
+		__builtin_memcpy(buf, "ANY", 4);
+		return;
+	}
+	
+	__builtin_memcpy(buf, "TYPE", 4);
+	buf[4] = '0' + (qtype / 10000) % 10;
+	buf[5] = '0' + (qtype / 1000) % 10;
+	buf[6] = '0' + (qtype / 100) % 10;
+	buf[7] = '0' + (qtype / 10) % 10;
+	buf[8] = '0' + qtype % 10;
+	buf[9] = '\0';
+}
+
+/* dns_track_query remembers an outgoing query until its response arrives */
+static inline void dns_track_query(const u8 *msg, u16 client_port) {
+	if (msg[2] & 0x80) { // QR set: this is a response
+		return;
+	}
+	
+	struct dns_query q = {};
+	q.qtype = dns_decode_question(msg + DNS_HEADER_LEN, q.name);
+	if (q.qtype == 0) {
+		return;
+	}
+	q.start = bpf_ktime_get_ns();
+	q.pid = bpf_get_current_pid_tgid() >> 32;
+	
+	struct dns_key key = {};
+	key.cgroup_id = bpf_get_current_cgroup_id();
+	key.id = ((u16)msg[0] << 8) | msg[1];
+	key.port = client_port;
+	bpf_map_update_elem(&dns_queries, &key, &q, BPF_ANY);
+}
+
+/* dns_complete_query emits an EVENT_DNS_QUERY for a response to a tracked
+ * query, with the rcode as the error */
+static inline void dns_complete_query(const u8 *msg, u16 client_port) {
+	if (!(msg[2] & 0x80)) {
+		return;
+	}
+	
+	struct dns_key key = {};
+	key.cgroup_id = bpf_get_current_cgroup_id();
+	key.id = ((u16)msg[0] << 8) | msg[1];
+	key.port = client_port;
+	
+	struct dns_query *q = bpf_map_lookup_elem(&dns_queries, &key);
+	if (!q) {
+		return;
+	}
+	
+	/* reserved rather than built on the stack: the TCP receive path already
+	 * holds an event and the message buffer */
+	struct event *e = bpf_ringbuf_reserve(&events, sizeof(*e), 0);
+	if (e) {
+		__builtin_memset(e, 0, sizeof(*e));
+		e->timestamp = bpf_ktime_get_ns();
+		e->pid = q->pid;
+		e->cgroup_id = key.cgroup_id;
+		e->type = EVENT_DNS_QUERY;
+		e->latency_ns = calc_latency(q->start);
+		e->error = msg[3] & 0x0F;
+		__builtin_memcpy(e->target, q->name, MAX_STRING_LEN);
+		format_dns_type(q->qtype, e->details);
+		bpf_ringbuf_submit(e, 0);
+	}
+	
+	bpf_map_delete_elem(&dns_queries, &key);
+}
+
+/* dns_read_udp copies the UDP header and DNS message of skb, returning -1 if
+ * the datagram is not to or from port 53 */
+static inline int dns_read_udp(struct sk_buff *skb, struct udphdr *udp, u8 *msg) {
+	unsigned char *head = BPF_CORE_READ(skb, head);
+	u16 offset = BPF_CORE_READ(skb, transport_header);
+	
+	if (bpf_probe_read_kernel(udp, sizeof(*udp), head + offset) < 0) {
+		return -1;
+	}
+	if (udp->source != __builtin_bswap16(DNS_PORT) && udp->dest != __builtin_bswap16(DNS_PORT)) {
+		return -1;
+	}
+	if (bpf_probe_read_kernel(msg, DNS_MSG_LEN, head + offset + sizeof(*udp)) < 0) {
+		return -1;
+	}
+	return 0;
+}
+
+/* dns_trace_udp_send handles an outgoing IPv4/IPv6 packet; proto_offset is
+ * the offset of the protocol/next header field in the IP header */
+static inline void dns_trace_udp_send(struct sk_buff *skb, u32 proto_offset) {
+	unsigned char *head = BPF_CORE_READ(skb, head);
+	u16 network = BPF_CORE_READ(skb, network_header);
+	u8 protocol = 0;
+	
+	bpf_probe_read_kernel(&protocol, sizeof(protocol), head + network + proto_offset);
+	if (protocol != 17) { // IPPROTO_UDP
+		return;
+	}
+	
+	struct udphdr udp = {};
+	u8 msg[DNS_MSG_LEN] = {};
+	if (dns_read_udp(skb, &udp, msg) < 0 || udp.dest != __builtin_bswap16(DNS_PORT)) {
+		return;
+	}
+	dns_track_query(msg, __builtin_bswap16(udp.source));
+}
+
+/* msg_user_buf returns the first user buffer described by msg's iterator */
+static inline const void *msg_user_buf(struct msghdr *msg) {
+	if (bpf_core_field_exists(msg->msg_iter.ubuf) &&
+	    BPF_CORE_READ(msg, msg_iter.iter_type) == bpf_core_enum_value(enum iter_type, ITER_UBUF)) {
+		return BPF_CORE_READ(msg, msg_iter.ubuf);
+	}
+	
+	const struct iovec *iov;
+	if (bpf_core_field_exists(msg->msg_iter.__iov)) {
+		iov = BPF_CORE_READ(msg, msg_iter.__iov);
+	} else {
+		iov = BPF_CORE_READ(msg, msg_iter.iov);
+	}
+	return BPF_CORE_READ(iov, iov_base);
+}
+
+/* dns_trace_tcp handles a DNS message in a user buffer of len bytes, sent or
+ * received with or without its two-byte length prefix */
+static inline void dns_trace_tcp(const void *buf, u64 len, u16 client_port, int query) {
+	u8 msg[DNS_MSG_LEN + 2] = {};
+	
+	if (!buf || len < DNS_HEADER_LEN) {
+		return;
+	}
+	u32 size = len < sizeof(msg) ? len : sizeof(msg);
+	if (bpf_probe_read_user(msg, size, buf) < 0) {
+		return;
+	}
+	
+	u16 prefix = ((u16)msg[0] << 8) | msg[1];
+	if (prefix == len - 2) {
+		if (query) {
+			dns_track_query(msg + 2, client_port);
+		} else {
+			dns_complete_query(msg + 2, client_port);
+		}
+	} else if (query) {
+		dns_track_query(msg, client_port);
+	} else {
+		dns_complete_query(msg, client_port);
+	}
+}
+
+/* format_sock_addrs writes the remote and local endpoints of sk */
+static inline void format_sock_addrs(struct sock *sk, char *remote, char *local) {
+	u16 family = BPF_CORE_READ(sk, __sk_common.skc_family);
+	u16 dport = __builtin_bswap16(BPF_CORE_READ(sk, __sk_common.skc_dport));
+	u16 sport = BPF_CORE_READ(sk, __sk_common.skc_num);
+	
+	if (family == 2) { // AF_INET
+		format_ip_port(__builtin_bswap32(BPF_CORE_READ(sk, __sk_common.skc_daddr)), dport, remote);
+		format_ip_port(__builtin_bswap32(BPF_CORE_READ(sk, __sk_common.skc_rcv_saddr)), sport, local);
+	} else if (family == 10) { // AF_INET6
+		u8 addr[16];
+		BPF_CORE_READ_INTO(&addr, sk, __sk_common.skc_v6_daddr.in6_u.u6_addr8);
+		format_ipv6_port(addr, dport, remote);
+		BPF_CORE_READ_INTO(&addr, sk, __sk_common.skc_v6_rcv_saddr.in6_u.u6_addr8);
+		format_ipv6_port(addr, sport, local);
+	}
+}
+
+/* fill_tcp_sock_event sets up an event on sk with its 4-tuple and state, and
+ * returns 0 if sk does not belong to the traced pod. The PID is only known
+ * when the socket's owner is the current task. */
+static inline int fill_tcp_sock_event(struct sock *sk, u32 type, struct event *e) {
+	if (!sk) {
+		return 0;
+	}
+	
+	u64 cgroup_id = sock_cgroup_id(sk);
+	if (!is_target_cgroup(cgroup_id)) {
+		return 0;
+	}
+	
+	e->timestamp = bpf_ktime_get_ns();
+	if (bpf_get_current_cgroup_id() == cgroup_id) {
+		e->pid = bpf_get_current_pid_tgid() >> 32;
+	}
+	e->cgroup_id = cgroup_id;
+	e->type = type;
+	e->state = BPF_CORE_READ(sk, __sk_common.skc_state);
+	format_sock_addrs(sk, e->target, e->details);
+	return 1;
+}
+
+static inline void emit_tcp_sock_event(struct sock *sk, u32 type) {
+	struct event e = {};
+	if (fill_tcp_sock_event(sk, type, &e)) {
+		bpf_ringbuf_output(&events, &e, sizeof(e), 0);
+	}
+}
+
+/* mark_tcp_conn sets flags on a tracked connection. A plain OR since atomic
+ * OR needs 5.12+, and losing a racing update of the same socket is harmless. */
+static inline void mark_tcp_conn(struct sock *sk, u32 flags) {
+	u64 sk_key = (u64)sk;
+	struct tcp_conn *conn = bpf_map_lookup_elem(&tcp_conns, &sk_key);
+	if (conn) {
+		conn->flags |= flags;
+	}
+}
+
+static inline int is_dns_sock(struct sock *sk) {
+	return BPF_CORE_READ(sk, __sk_common.skc_dport) == __builtin_bswap16(DNS_PORT);
+}
+
 SEC("kprobe/tcp_v4_connect")
 int kprobe_tcp_connect(struct pt_regs *ctx) {
+	if (!in_target_cgroup()) {
+		return 0;
+	}
+	
 	u32 pid = bpf_get_current_pid_tgid() >> 32;
 	u32 tid = (u32)bpf_get_current_pid_tgid();
 	u64 key = get_key(pid, tid);
@@ -153,6 +974,10 @@ int kprobe_tcp_connect(struct pt_regs *ctx) {
 
 SEC("kprobe/tcp_v6_connect")
 int kprobe_tcp_v6_connect(struct pt_regs *ctx) {
+	if (!in_target_cgroup()) {
+		return 0;
+	}
+	
 	u32 pid = bpf_get_current_pid_tgid() >> 32;
 	u32 tid = (u32)bpf_get_current_pid_tgid();
 	u64 key = get_key(pid, tid);
@@ -184,6 +1009,7 @@ int kretprobe_tcp_v6_connect(struct pt_regs *ctx) {
 	struct event e = {};
 	e.timestamp = bpf_ktime_get_ns();
 	e.pid = pid;
+	e.cgroup_id = bpf_get_current_cgroup_id();
 	e.type = EVENT_CONNECT;
 	e.latency_ns = calc_latency(*start_ts);
 	e.error = PT_REGS_RC(ctx);
@@ -221,6 +1047,7 @@ int kretprobe_tcp_connect(struct pt_regs *ctx) {
 	struct event e = {};
 	e.timestamp = bpf_ktime_get_ns();
 	e.pid = pid;
+	e.cgroup_id = bpf_get_current_cgroup_id();
 	e.type = EVENT_CONNECT;
 	e.latency_ns = calc_latency(*start_ts);
 	e.error = PT_REGS_RC(ctx);
@@ -247,14 +1074,37 @@ int kretprobe_tcp_connect(struct pt_regs *ctx) {
 	return 0;
 }
 
+/* format_msg_sock writes the endpoints of the socket recorded at entry to
+ * tcp_sendmsg or tcp_recvmsg */
+static inline void format_msg_sock(u64 key, char *remote, char *local) {
+	u64 *sk = bpf_map_lookup_elem(&tcp_msg_socks, &key);
+	if (!sk) {
+		return;
+	}
+	format_sock_addrs((struct sock *)*sk, remote, local);
+	bpf_map_delete_elem(&tcp_msg_socks, &key);
+}
+
 SEC("kprobe/tcp_sendmsg")
 int kprobe_tcp_sendmsg(struct pt_regs *ctx) {
+	if (!in_target_cgroup()) {
+		return 0;
+	}
+	
 	u32 pid = bpf_get_current_pid_tgid() >> 32;
 	u32 tid = (u32)bpf_get_current_pid_tgid();
 	u64 key = get_key(pid, tid);
 	u64 ts = bpf_ktime_get_ns();
 	
 	bpf_map_update_elem(&start_times, &key, &ts, BPF_ANY);
+	
+	struct sock *sk = (struct sock *)PT_REGS_PARM1(ctx);
+	u64 sk_ptr = (u64)sk;
+	bpf_map_update_elem(&tcp_msg_socks, &key, &sk_ptr, BPF_ANY);
+	if (is_dns_sock(sk)) {
+		struct msghdr *msg = (struct msghdr *)PT_REGS_PARM2(ctx);
+		dns_trace_tcp(msg_user_buf(msg), PT_REGS_PARM3(ctx), BPF_CORE_READ(sk, __sk_common.skc_num), 1);
+	}
 	return 0;
 }
 
@@ -272,10 +1122,16 @@ int kretprobe_tcp_sendmsg(struct pt_regs *ctx) {
 	struct event e = {};
 	e.timestamp = bpf_ktime_get_ns();
 	e.pid = pid;
+	e.cgroup_id = bpf_get_current_cgroup_id();
 	e.type = EVENT_TCP_SEND;
 	e.latency_ns = calc_latency(*start_ts);
-	e.error = PT_REGS_RC(ctx);
-	e.target[0] = '\0';
+	s64 ret = PT_REGS_RC(ctx);
+	if (ret < 0) {
+		e.error = ret;
+	} else {
+		e.bytes = ret;
+	}
+	format_msg_sock(key, e.target, e.details);
 	
 	bpf_ringbuf_output(&events, &e, sizeof(e), 0);
 	bpf_map_delete_elem(&start_times, &key);
@@ -284,12 +1140,26 @@ int kretprobe_tcp_sendmsg(struct pt_regs *ctx) {
 
 SEC("kprobe/tcp_recvmsg")
 int kprobe_tcp_recvmsg(struct pt_regs *ctx) {
-	u32 pid = bpf_get_current_pid_tgid() >> 32;
-	u32 tid = (u32)bpf_get_current_pid_tgid();
+	if (!in_target_cgroup()) {
+		return 0;
+	}
+	
+	u32 pid = bpf_get_current_pid_tgid() >> 32;
+	u32 tid = (u32)bpf_get_current_pid_tgid();
 	u64 key = get_key(pid, tid);
 	u64 ts = bpf_ktime_get_ns();
 	
 	bpf_map_update_elem(&start_times, &key, &ts, BPF_ANY);
+	
+	struct sock *sk = (struct sock *)PT_REGS_PARM1(ctx);
+	u64 sk_ptr = (u64)sk;
+	bpf_map_update_elem(&tcp_msg_socks, &key, &sk_ptr, BPF_ANY);
+	if (is_dns_sock(sk)) {
+		struct dns_tcp_read read = {};
+		read.buf = (u64)msg_user_buf((struct msghdr *)PT_REGS_PARM2(ctx));
+		read.port = BPF_CORE_READ(sk, __sk_common.skc_num);
+		bpf_map_update_elem(&dns_tcp_reads, &key, &read, BPF_ANY);
+	}
 	return 0;
 }
 
@@ -298,6 +1168,16 @@ int kretprobe_tcp_recvmsg(struct pt_regs *ctx) {
 	u32 pid = bpf_get_current_pid_tgid() >> 32;
 	u32 tid = (u32)bpf_get_current_pid_tgid();
 	u64 key = get_key(pid, tid);
+	
+	struct dns_tcp_read *read = bpf_map_lookup_elem(&dns_tcp_reads, &key);
+	if (read) {
+		s64 ret = PT_REGS_RC(ctx);
+		if (ret > 0) {
+			dns_trace_tcp((const void *)read->buf, ret, read->port, 0);
+		}
+		bpf_map_delete_elem(&dns_tcp_reads, &key);
+	}
+	
 	u64 *start_ts = bpf_map_lookup_elem(&start_times, &key);
 	
 	if (!start_ts) {
@@ -307,38 +1187,61 @@ int kretprobe_tcp_recvmsg(struct pt_regs *ctx) {
 	struct event e = {};
 	e.timestamp = bpf_ktime_get_ns();
 	e.pid = pid;
+	e.cgroup_id = bpf_get_current_cgroup_id();
 	e.type = EVENT_TCP_RECV;
 	e.latency_ns = calc_latency(*start_ts);
-	e.error = PT_REGS_RC(ctx);
-	e.target[0] = '\0';
+	s64 ret = PT_REGS_RC(ctx);
+	if (ret < 0) {
+		e.error = ret;
+	} else {
+		e.bytes = ret;
+	}
+	format_msg_sock(key, e.target, e.details);
 	
 	bpf_ringbuf_output(&events, &e, sizeof(e), 0);
 	bpf_map_delete_elem(&start_times, &key);
 	return 0;
 }
 
-SEC("kprobe/vfs_write")
-int kprobe_vfs_write(struct pt_regs *ctx) {
-	u32 pid = bpf_get_current_pid_tgid() >> 32;
-	u32 tid = (u32)bpf_get_current_pid_tgid();
-	u64 key = get_key(pid, tid);
-	u64 ts = bpf_ktime_get_ns();
-	bpf_map_update_elem(&start_times, &key, &ts, BPF_ANY);
-	return 0;
+/* format_sockaddr writes the endpoint of a kernel copy of a sockaddr_in or
+ * sockaddr_in6 */
+static inline void format_sockaddr(const void *addr, char *buf) {
+	u16 family = 0;
+	bpf_probe_read_kernel(&family, sizeof(family), addr);
+	if (family == 2) { // AF_INET
+		struct sockaddr_in sin = {};
+		bpf_probe_read_kernel(&sin, sizeof(sin), addr);
+		format_ip_port(__builtin_bswap32(sin.sin_addr.s_addr), __builtin_bswap16(sin.sin_port), buf);
+	} else if (family == 10) { // AF_INET6
+		struct sockaddr_in6_simple sin6 = {};
+		bpf_probe_read_kernel(&sin6, sizeof(sin6), addr);
+		format_ipv6_port(sin6.sin6_addr, __builtin_bswap16(sin6.sin6_port), buf);
+	}
 }
 
-SEC("kprobe/vfs_read")
-int kprobe_vfs_read(struct pt_regs *ctx) {
+static inline int udp_msg_entry(struct pt_regs *ctx) {
+	if (!in_target_cgroup()) {
+		return 0;
+	}
+	
 	u32 pid = bpf_get_current_pid_tgid() >> 32;
 	u32 tid = (u32)bpf_get_current_pid_tgid();
 	u64 key = get_key(pid, tid);
 	u64 ts = bpf_ktime_get_ns();
+	
 	bpf_map_update_elem(&start_times, &key, &ts, BPF_ANY);
+	
+	struct udp_msg m = {};
+	m.sk = PT_REGS_PARM1(ctx);
+	m.msg = PT_REGS_PARM2(ctx);
+	bpf_map_update_elem(&udp_msgs, &key, &m, BPF_ANY);
 	return 0;
 }
 
-SEC("kretprobe/vfs_read")
-int kretprobe_vfs_read(struct pt_regs *ctx) {
+/* udp_msg_return emits a send or receive event with the socket's endpoints.
+ * Unconnected sockets name the peer in msg_name instead, which is a kernel
+ * copy of the caller's address and only filled in by successful receives. */
+static inline int udp_msg_return(struct pt_regs *ctx, u32 type) {
 	u32 pid = bpf_get_current_pid_tgid() >> 32;
 	u32 tid = (u32)bpf_get_current_pid_tgid();
 	u64 key = get_key(pid, tid);
@@ -348,92 +1251,382 @@ int kretprobe_vfs_read(struct pt_regs *ctx) {
 		return 0;
 	}
 	
-	u64 latency = calc_latency(*start_ts);
-	if (latency < 1000000) {
-		bpf_map_delete_elem(&start_times, &key);
-		return 0;
-	}
-	
 	struct event e = {};
 	e.timestamp = bpf_ktime_get_ns();
 	e.pid = pid;
-	e.type = EVENT_READ;
-	e.latency_ns = latency;
-	e.error = PT_REGS_RC(ctx);
-	e.target[0] = '\0';
+	e.cgroup_id = bpf_get_current_cgroup_id();
+	e.type = type;
+	e.latency_ns = calc_latency(*start_ts);
+	s64 ret = PT_REGS_RC(ctx);
+	if (ret < 0) {
+		e.error = ret;
+	} else {
+		e.bytes = ret;
+	}
+	
+	struct udp_msg *m = bpf_map_lookup_elem(&udp_msgs, &key);
+	if (m) {
+		format_sock_addrs((struct sock *)m->sk, e.target, e.details);
+		void *name = BPF_CORE_READ((struct msghdr *)m->msg, msg_name);
+		if (name && (type == EVENT_UDP_SEND || ret >= 0)) {
+			format_sockaddr(name, e.target);
+		}
+		bpf_map_delete_elem(&udp_msgs, &key);
+	}
+	
 	bpf_ringbuf_output(&events, &e, sizeof(e), 0);
 	bpf_map_delete_elem(&start_times, &key);
 	return 0;
 }
 
-SEC("kretprobe/vfs_write")
-int kretprobe_vfs_write(struct pt_regs *ctx) {
-	u32 pid = bpf_get_current_pid_tgid() >> 32;
-	u32 tid = (u32)bpf_get_current_pid_tgid();
-	u64 key = get_key(pid, tid);
-	u64 *start_ts = bpf_map_lookup_elem(&start_times, &key);
-	
-	if (!start_ts) {
-		return 0;
+SEC("kprobe/udp_sendmsg")
+int kprobe_udp_sendmsg(struct pt_regs *ctx) {
+	return udp_msg_entry(ctx);
+}
+
+SEC("kretprobe/udp_sendmsg")
+int kretprobe_udp_sendmsg(struct pt_regs *ctx) {
+	return udp_msg_return(ctx, EVENT_UDP_SEND);
+}
+
+SEC("kprobe/udpv6_sendmsg")
+int kprobe_udpv6_sendmsg(struct pt_regs *ctx) {
+	return udp_msg_entry(ctx);
+}
+
+SEC("kretprobe/udpv6_sendmsg")
+int kretprobe_udpv6_sendmsg(struct pt_regs *ctx) {
+	return udp_msg_return(ctx, EVENT_UDP_SEND);
+}
+
+SEC("kprobe/udp_recvmsg")
+int kprobe_udp_recvmsg(struct pt_regs *ctx) {
+	return udp_msg_entry(ctx);
+}
+
+SEC("kretprobe/udp_recvmsg")
+int kretprobe_udp_recvmsg(struct pt_regs *ctx) {
+	return udp_msg_return(ctx, EVENT_UDP_RECV);
+}
+
+SEC("kprobe/udpv6_recvmsg")
+int kprobe_udpv6_recvmsg(struct pt_regs *ctx) {
+	return udp_msg_entry(ctx);
+}
+
+SEC("kretprobe/udpv6_recvmsg")
+int kretprobe_udpv6_recvmsg(struct pt_regs *ctx) {
+	return udp_msg_return(ctx, EVENT_UDP_RECV);
+}
+
+/* set_udp_rcv_sock records the socket a datagram is being queued on, so that
+ * a kfree_skb on this CPU until the queueing returns counts as its drop */
+static inline void set_udp_rcv_sock(struct sock *sk) {
+	u32 zero = 0;
+	u64 sk_ptr = 0;
+	if (sk && is_target_cgroup(sock_cgroup_id(sk))) {
+		sk_ptr = (u64)sk;
+	}
+	bpf_map_update_elem(&udp_rcv_socks, &zero, &sk_ptr, BPF_ANY);
+}
+
+SEC("kprobe/udp_queue_rcv_skb")
+int kprobe_udp_queue_rcv_skb(struct pt_regs *ctx) {
+	set_udp_rcv_sock((struct sock *)PT_REGS_PARM1(ctx));
+	return 0;
+}
+
+SEC("kretprobe/udp_queue_rcv_skb")
+int kretprobe_udp_queue_rcv_skb(struct pt_regs *ctx) {
+	set_udp_rcv_sock(0);
+	return 0;
+}
+
+SEC("kprobe/udpv6_queue_rcv_skb")
+int kprobe_udpv6_queue_rcv_skb(struct pt_regs *ctx) {
+	set_udp_rcv_sock((struct sock *)PT_REGS_PARM1(ctx));
+	return 0;
+}
+
+SEC("kretprobe/udpv6_queue_rcv_skb")
+int kretprobe_udpv6_queue_rcv_skb(struct pt_regs *ctx) {
+	set_udp_rcv_sock(0);
+	return 0;
+}
+
+/* udp_drop_reason maps the kernel's drop reason, whose values differ between
+ * kernel versions, to a UDP_DROP_* value */
+static inline u32 udp_drop_reason(struct trace_event_raw_kfree_skb *ctx) {
+	if (!bpf_core_field_exists(ctx->reason)) {
+		return UDP_DROP_UNKNOWN;
 	}
 	
-	u64 latency = calc_latency(*start_ts);
-	if (latency < 1000000) {
-		bpf_map_delete_elem(&start_times, &key);
+	u32 reason = BPF_CORE_READ(ctx, reason);
+	if (bpf_core_enum_value_exists(enum skb_drop_reason, SKB_DROP_REASON_SOCKET_RCVBUFF) &&
+	    reason == bpf_core_enum_value(enum skb_drop_reason, SKB_DROP_REASON_SOCKET_RCVBUFF)) {
+		return UDP_DROP_RCVBUF;
+	}
+	if (bpf_core_enum_value_exists(enum skb_drop_reason, SKB_DROP_REASON_PROTO_MEM) &&
+	    reason == bpf_core_enum_value(enum skb_drop_reason, SKB_DROP_REASON_PROTO_MEM)) {
+		return UDP_DROP_PROTO_MEM;
+	}
+	if (bpf_core_enum_value_exists(enum skb_drop_reason, SKB_DROP_REASON_UDP_CSUM) &&
+	    reason == bpf_core_enum_value(enum skb_drop_reason, SKB_DROP_REASON_UDP_CSUM)) {
+		return UDP_DROP_CSUM;
+	}
+	if ((bpf_core_enum_value_exists(enum skb_drop_reason, SKB_DROP_REASON_SOCKET_FILTER) &&
+	     reason == bpf_core_enum_value(enum skb_drop_reason, SKB_DROP_REASON_SOCKET_FILTER)) ||
+	    (bpf_core_enum_value_exists(enum skb_drop_reason, SKB_DROP_REASON_XFRM_POLICY) &&
+	     reason == bpf_core_enum_value(enum skb_drop_reason, SKB_DROP_REASON_XFRM_POLICY))) {
+		return UDP_DROP_FILTER;
+	}
+	if (bpf_core_enum_value_exists(enum skb_drop_reason, SKB_DROP_REASON_NOT_SPECIFIED) &&
+	    reason == bpf_core_enum_value(enum skb_drop_reason, SKB_DROP_REASON_NOT_SPECIFIED)) {
+		return UDP_DROP_UNKNOWN;
+	}
+	return UDP_DROP_OTHER;
+}
+
+SEC("tracepoint/skb/kfree_skb")
+int tracepoint_kfree_skb(struct trace_event_raw_kfree_skb *ctx) {
+	u32 zero = 0;
+	u64 *sk_ptr = bpf_map_lookup_elem(&udp_rcv_socks, &zero);
+	if (!sk_ptr || !*sk_ptr) {
 		return 0;
 	}
 	
+	struct sock *sk = (struct sock *)*sk_ptr;
 	struct event e = {};
 	e.timestamp = bpf_ktime_get_ns();
-	e.pid = pid;
-	e.type = EVENT_WRITE;
-	e.latency_ns = latency;
-	e.error = PT_REGS_RC(ctx);
-	e.target[0] = '\0';
+	e.cgroup_id = sock_cgroup_id(sk);
+	e.type = EVENT_UDP_DROP;
+	e.state = udp_drop_reason(ctx);
+	format_sock_addrs(sk, e.target, e.details);
+	
 	bpf_ringbuf_output(&events, &e, sizeof(e), 0);
-	bpf_map_delete_elem(&start_times, &key);
 	return 0;
 }
 
-SEC("kprobe/vfs_fsync")
-int kprobe_vfs_fsync(struct pt_regs *ctx) {
+/* PATH_STEPS bounds the dentries and mount points walked per path */
+#define PATH_STEPS 12
+
+/* format_file_path writes file's path as seen from the current task's root,
+ * crossing mount points on the way up. The path is built from the leaf so
+ * that when it does not fit, the leading components are replaced by "..."
+ * and the file name is kept. */
+static inline void format_file_path(struct file *file, char *buf) {
+	struct dentry *dentry = BPF_CORE_READ(file, f_path.dentry);
+	struct vfsmount *vfsmnt = BPF_CORE_READ(file, f_path.mnt);
+	struct mount *mnt = container_of(vfsmnt, struct mount, mnt);
+	struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+	struct dentry *root_dentry = BPF_CORE_READ(task, fs, root.dentry);
+	struct vfsmount *root_mnt = BPF_CORE_READ(task, fs, root.mnt);
+	
+	/* the path ends at path[MAX_STRING_LEN - 1] and grows to the left;
+	 * twice the output size so every write below stays in bounds */
+	char path[MAX_STRING_LEN * 2] = {};
+	u32 off = MAX_STRING_LEN - 1;
+	int complete = 0;
+	
+#pragma unroll
+	for (int i = 0; i < PATH_STEPS; i++) {
+		if (!dentry || (dentry == root_dentry && vfsmnt == root_mnt)) {
+			complete = 1;
+			break;
+		}
+		
+		struct dentry *parent = BPF_CORE_READ(dentry, d_parent);
+		if (dentry == BPF_CORE_READ(vfsmnt, mnt_root) || dentry == parent) {
+			struct mount *mnt_parent = BPF_CORE_READ(mnt, mnt_parent);
+			if (mnt_parent == mnt) {
+				complete = 1;
+				break;
+			}
+			/* continue from where this filesystem is mounted */
+			dentry = BPF_CORE_READ(mnt, mnt_mountpoint);
+			mnt = mnt_parent;
+			vfsmnt = &mnt_parent->mnt;
+			continue;
+		}
+		
+		const unsigned char *name = BPF_CORE_READ(dentry, d_name.name);
+		u32 len = BPF_CORE_READ(dentry, d_name.len);
+		if (len + 1 > off) {
+			/* keep what fits of the tail of this component */
+			if (off > 0) {
+				bpf_probe_read_kernel(path, off & (MAX_STRING_LEN - 1), name + len - off);
+			}
+			off = 0;
+			break;
+		}
+		off -= len;
+		bpf_probe_read_kernel(&path[off & (MAX_STRING_LEN - 1)], len & (MAX_STRING_LEN - 1), name);
+		off--;
+		path[off & (MAX_STRING_LEN - 1)] = '/';
+		dentry = parent;
+	}
+	
+	if (!complete) {
+		if (off >= 3) {
+			off -= 3;
+		} else {
+			off = 0;
+		}
+		__builtin_memcpy(&path[off & (MAX_STRING_LEN - 1)], "...", 3);
+	}
+	
+	bpf_probe_read_kernel(buf, MAX_STRING_LEN, &path[off & (MAX_STRING_LEN - 1)]);
+}
+
+static inline int trace_fs_entry(struct pt_regs *ctx, u64 count) {
+	if (!in_target_cgroup()) {
+		return 0;
+	}
+	
 	u32 pid = bpf_get_current_pid_tgid() >> 32;
 	u32 tid = (u32)bpf_get_current_pid_tgid();
 	u64 key = get_key(pid, tid);
-	u64 ts = bpf_ktime_get_ns();
-	bpf_map_update_elem(&start_times, &key, &ts, BPF_ANY);
+	
+	struct fs_entry entry = {};
+	entry.start = bpf_ktime_get_ns();
+	entry.file = PT_REGS_PARM1(ctx);
+	entry.count = count;
+	bpf_map_update_elem(&fs_entries, &key, &entry, BPF_ANY);
 	return 0;
 }
 
-SEC("kretprobe/vfs_fsync")
-int kretprobe_vfs_fsync(struct pt_regs *ctx) {
+/* trace_fs_return reports file operations slower than 1ms with the file's
+ * path, filesystem type and device */
+static inline int trace_fs_return(struct pt_regs *ctx, u32 type) {
 	u32 pid = bpf_get_current_pid_tgid() >> 32;
 	u32 tid = (u32)bpf_get_current_pid_tgid();
 	u64 key = get_key(pid, tid);
-	u64 *start_ts = bpf_map_lookup_elem(&start_times, &key);
+	struct fs_entry *entry = bpf_map_lookup_elem(&fs_entries, &key);
 	
-	if (!start_ts) {
+	if (!entry) {
 		return 0;
 	}
 	
-	u64 latency = calc_latency(*start_ts);
+	u64 latency = calc_latency(entry->start);
 	if (latency < 1000000) {
-		bpf_map_delete_elem(&start_times, &key);
+		bpf_map_delete_elem(&fs_entries, &key);
 		return 0;
 	}
 	
 	struct event e = {};
 	e.timestamp = bpf_ktime_get_ns();
 	e.pid = pid;
-	e.type = EVENT_FSYNC;
+	e.cgroup_id = bpf_get_current_cgroup_id();
+	e.type = type;
 	e.latency_ns = latency;
-	e.error = PT_REGS_RC(ctx);
-	e.target[0] = '\0';
+	
+	s64 ret = PT_REGS_RC(ctx);
+	if (ret < 0) {
+		e.error = ret;
+	} else if (type != EVENT_FSYNC) {
+		e.info.fs.bytes_returned = ret;
+	}
+	e.info.fs.bytes_requested = entry->count;
+	
+	struct file *file = (struct file *)entry->file;
+	if (file) {
+		format_file_path(file, e.target);
+		e.info.fs.ino = BPF_CORE_READ(file, f_inode, i_ino);
+		e.info.fs.dev = BPF_CORE_READ(file, f_inode, i_sb, s_dev);
+		bpf_probe_read_kernel_str(e.details, sizeof(e.details), BPF_CORE_READ(file, f_inode, i_sb, s_type, name));
+	}
+	
 	bpf_ringbuf_output(&events, &e, sizeof(e), 0);
-	bpf_map_delete_elem(&start_times, &key);
+	bpf_map_delete_elem(&fs_entries, &key);
 	return 0;
 }
 
+SEC("kprobe/vfs_write")
+int kprobe_vfs_write(struct pt_regs *ctx) {
+	return trace_fs_entry(ctx, PT_REGS_PARM3(ctx));
+}
+
+SEC("kprobe/vfs_read")
+int kprobe_vfs_read(struct pt_regs *ctx) {
+	return trace_fs_entry(ctx, PT_REGS_PARM3(ctx));
+}
+
+SEC("kretprobe/vfs_read")
+int kretprobe_vfs_read(struct pt_regs *ctx) {
+	return trace_fs_return(ctx, EVENT_READ);
+}
+
+SEC("kretprobe/vfs_write")
+int kretprobe_vfs_write(struct pt_regs *ctx) {
+	return trace_fs_return(ctx, EVENT_WRITE);
+}
+
+SEC("kprobe/vfs_fsync")
+int kprobe_vfs_fsync(struct pt_regs *ctx) {
+	return trace_fs_entry(ctx, 0);
+}
+
+SEC("kretprobe/vfs_fsync")
+int kretprobe_vfs_fsync(struct pt_regs *ctx) {
+	return trace_fs_return(ctx, EVENT_FSYNC);
+}
+
+/* sched_wakeup and sched_wakeup_new share this layout */
+struct sched_wakeup_args {
+	unsigned short common_type;
+	unsigned char common_flags;
+	unsigned char common_preempt_count;
+	int common_pid;
+	char comm[16];
+	u32 pid;
+	int prio;
+	int target_cpu;
+};
+
+/* task states reported by sched_switch's prev_state for a task that is still
+ * runnable: TASK_RUNNING, or TASK_REPORT_MAX when preempted on 4.14+ */
+static inline int is_preempted(long state) {
+	return state == 0 || (state & 0x100);
+}
+
+/* account_oncpu adds delta to the current thread's on-CPU time */
+static inline void account_oncpu(u32 tid, u64 delta) {
+	struct oncpu_time *t = bpf_map_lookup_elem(&oncpu_threads, &tid);
+	if (t) {
+		__sync_fetch_and_add(&t->ns, delta);
+		return;
+	}
+	
+	struct oncpu_time init = {};
+	init.ns = delta;
+	init.cgroup_id = bpf_get_current_cgroup_id();
+	init.pid = bpf_get_current_pid_tgid() >> 32;
+	bpf_map_update_elem(&oncpu_threads, &tid, &init, BPF_ANY);
+}
+
+static inline void emit_runq_latency(u32 tid) {
+	struct runq_entry *entry = bpf_map_lookup_elem(&runq_threads, &tid);
+	if (!entry) {
+		return;
+	}
+	
+	u64 latency = calc_latency(entry->start);
+	if (latency >= RUNQ_MIN_LATENCY_NS) {
+		struct event e = {};
+		e.timestamp = bpf_ktime_get_ns();
+		e.pid = entry->pid;
+		e.cgroup_id = entry->cgroup_id;
+		e.type = EVENT_RUNQ_LATENCY;
+		e.latency_ns = latency;
+		e.info.sched.tid = tid;
+		e.info.sched.kernel_stack_id = -1;
+		e.info.sched.user_stack_id = -1;
+		
+		bpf_ringbuf_output(&events, &e, sizeof(e), 0);
+	}
+	bpf_map_delete_elem(&runq_threads, &tid);
+}
+
 SEC("tp/sched/sched_switch")
 int tracepoint_sched_switch(void *ctx) {
 	struct {
@@ -450,88 +1643,800 @@ int tracepoint_sched_switch(void *ctx) {
 		int next_prio;
 	} *args = (typeof(args))ctx;
 	
-	u32 prev_pid = args->prev_pid;
-	u32 next_pid = args->next_pid;
-	u64 timestamp = bpf_ktime_get_ns();
+	u32 prev_tid = args->prev_pid;
+	u32 next_tid = args->next_pid;
+	int prev_traced = prev_tid > 0 && in_target_cgroup();
 	
-	if (prev_pid > 0) {
-		u64 key = get_key(prev_pid, 0);
-		u64 *block_start = bpf_map_lookup_elem(&start_times, &key);
-		
-		if (block_start) {
-			u64 block_time = calc_latency(*block_start);
-			if (block_time > 1000000) { // Only track blocks > 1ms
-				struct event e = {};
-				e.timestamp = timestamp;
-				e.pid = prev_pid;
-				e.type = EVENT_SCHED_SWITCH;
-				e.latency_ns = block_time;
-				e.error = 0;
-				e.target[0] = '\0';
-				e.details[0] = '\0';
-				
-				bpf_ringbuf_output(&events, &e, sizeof(e), 0);
-			}
-			bpf_map_delete_elem(&start_times, &key);
+	u32 zero = 0;
+	u64 now = bpf_ktime_get_ns();
+	u64 *switched_in = bpf_map_lookup_elem(&cpu_switch_in, &zero);
+	if (switched_in) {
+		if (prev_traced && *switched_in && now > *switched_in) {
+			account_oncpu(prev_tid, now - *switched_in);
+		}
+		*switched_in = now;
+	}
+	
+	/* the switched-out thread is still current, so its stacks and cgroup
+	 * can be read here. A preempted thread goes straight back to the run
+	 * queue, one that blocks is off-CPU until it is woken up. */
+	if (prev_traced) {
+		if (is_preempted(args->prev_state)) {
+			struct runq_entry runq = {};
+			runq.start = bpf_ktime_get_ns();
+			runq.cgroup_id = bpf_get_current_cgroup_id();
+			runq.pid = bpf_get_current_pid_tgid() >> 32;
+			bpf_map_update_elem(&runq_threads, &prev_tid, &runq, BPF_ANY);
+		} else {
+			struct offcpu_entry entry = {};
+			entry.start = bpf_ktime_get_ns();
+			entry.cgroup_id = bpf_get_current_cgroup_id();
+			entry.pid = bpf_get_current_pid_tgid() >> 32;
+			entry.state = args->prev_state;
+			entry.kernel_stack_id = bpf_get_stackid(ctx, &stack_traces, BPF_F_REUSE_STACKID);
+			entry.user_stack_id = bpf_get_stackid(ctx, &stack_traces, BPF_F_USER_STACK | BPF_F_REUSE_STACKID);
+			__builtin_memcpy(entry.comm, args->prev_comm, sizeof(entry.comm));
+			bpf_map_update_elem(&offcpu_threads, &prev_tid, &entry, BPF_ANY);
 		}
 	}
 	
-	if (next_pid > 0) {
-		u64 new_key = get_key(next_pid, 0);
-		u64 now = bpf_ktime_get_ns();
-		bpf_map_update_elem(&start_times, &new_key, &now, BPF_ANY);
+	if (next_tid == 0) {
+		return 0;
+	}
+	
+	emit_runq_latency(next_tid);
+	
+	struct offcpu_entry *entry = bpf_map_lookup_elem(&offcpu_threads, &next_tid);
+	if (!entry) {
+		return 0;
+	}
+	
+	/* blocked time ends at the wakeup, the wait for a CPU after it is
+	 * reported as run-queue latency */
+	u64 end = entry->wakeup ? entry->wakeup : bpf_ktime_get_ns();
+	u64 block_time = end > entry->start ? end - entry->start : 0;
+	if (block_time > 1000000) { // Only track blocks > 1ms
+		struct event e = {};
+		e.timestamp = bpf_ktime_get_ns();
+		e.pid = entry->pid;
+		e.cgroup_id = entry->cgroup_id;
+		e.type = EVENT_SCHED_SWITCH;
+		e.latency_ns = block_time;
+		e.state = entry->state;
+		e.info.sched.kernel_stack_id = entry->kernel_stack_id;
+		e.info.sched.user_stack_id = entry->user_stack_id;
+		e.info.sched.tid = next_tid;
+		e.info.sched.waker_pid = entry->waker_pid;
+		__builtin_memcpy(e.target, entry->waker_comm, sizeof(entry->waker_comm));
+		__builtin_memcpy(e.details, entry->comm, sizeof(entry->comm));
+		
+		bpf_ringbuf_output(&events, &e, sizeof(e), 0);
 	}
+	bpf_map_delete_elem(&offcpu_threads, &next_tid);
 	
 	return 0;
 }
 
-SEC("uprobe/getaddrinfo")
-int uprobe_getaddrinfo(struct pt_regs *ctx) {
-	u32 pid = bpf_get_current_pid_tgid() >> 32;
-	u32 tid = (u32)bpf_get_current_pid_tgid();
-	u64 key = get_key(pid, tid);
-	u64 ts = bpf_ktime_get_ns();
-	bpf_map_update_elem(&start_times, &key, &ts, BPF_ANY);
+/* sched_wakeup runs in the context of the waker, so it records which task
+ * (or, from interrupt context, whichever task was interrupted) woke a thread,
+ * and starts the thread's wait on the run queue */
+SEC("tp/sched/sched_wakeup")
+int tracepoint_sched_wakeup(struct sched_wakeup_args *args) {
+	u32 tid = args->pid;
+	struct futex_entry *futex = bpf_map_lookup_elem(&futex_waits, &tid);
+	if (futex) {
+		futex->waker_pid = bpf_get_current_pid_tgid() >> 32;
+		bpf_get_current_comm(futex->waker_comm, sizeof(futex->waker_comm));
+	}
 	
-	void *node_ptr = (void *)PT_REGS_PARM1(ctx);
-	if (node_ptr) {
-		char target[MAX_STRING_LEN] = {};
-		bpf_probe_read_user_str(target, sizeof(target), node_ptr);
-		bpf_map_update_elem(&dns_targets, &key, target, BPF_ANY);
+	struct offcpu_entry *entry = bpf_map_lookup_elem(&offcpu_threads, &tid);
+	if (!entry) {
+		return 0;
 	}
 	
+	entry->wakeup = bpf_ktime_get_ns();
+	entry->waker_pid = bpf_get_current_pid_tgid() >> 32;
+	bpf_get_current_comm(entry->waker_comm, sizeof(entry->waker_comm));
+	
+	struct runq_entry runq = {};
+	runq.start = entry->wakeup;
+	runq.cgroup_id = entry->cgroup_id;
+	runq.pid = entry->pid;
+	bpf_map_update_elem(&runq_threads, &tid, &runq, BPF_ANY);
 	return 0;
 }
 
-SEC("uretprobe/getaddrinfo")
-int uretprobe_getaddrinfo(struct pt_regs *ctx) {
-	u32 pid = bpf_get_current_pid_tgid() >> 32;
-	u32 tid = (u32)bpf_get_current_pid_tgid();
-	u64 key = get_key(pid, tid);
-	u64 *start_ts = bpf_map_lookup_elem(&start_times, &key);
+#define FUTEX_CMD_MASK 0x7f
+#define FUTEX_WAIT 0
+#define FUTEX_LOCK_PI 6
+#define FUTEX_WAIT_BITSET 9
+#define FUTEX_WAIT_REQUEUE_PI 11
+#define FUTEX_LOCK_PI2 13
+
+static inline int is_futex_wait(u32 cmd) {
+	return cmd == FUTEX_WAIT || cmd == FUTEX_WAIT_BITSET || cmd == FUTEX_LOCK_PI ||
+		cmd == FUTEX_LOCK_PI2 || cmd == FUTEX_WAIT_REQUEUE_PI;
+}
+
+SEC("tp/syscalls/sys_enter_futex")
+int tracepoint_sys_enter_futex(void *ctx) {
+	struct {
+		unsigned short common_type;
+		unsigned char common_flags;
+		unsigned char common_preempt_count;
+		int common_pid;
+		int syscall_nr;
+		u64 uaddr;
+		u64 op;
+		u64 val;
+		u64 utime;
+		u64 uaddr2;
+		u64 val3;
+	} *args = (typeof(args))ctx;
 	
-	if (!start_ts) {
+	u32 op = (u32)args->op;
+	if (!is_futex_wait(op & FUTEX_CMD_MASK) || !in_target_cgroup()) {
 		return 0;
 	}
 	
-	u64 latency = calc_latency(*start_ts);
-	
-	struct event e = {};
-	e.timestamp = bpf_ktime_get_ns();
-	e.pid = pid;
-	e.type = EVENT_DNS;
-	e.latency_ns = latency;
+	u32 tid = (u32)bpf_get_current_pid_tgid();
+	struct futex_entry entry = {};
+	entry.start = bpf_ktime_get_ns();
+	entry.uaddr = args->uaddr;
+	entry.op = op;
+	entry.user_stack_id = -1;
+	u32 zero = 0;
+	u32 *stacks = bpf_map_lookup_elem(&futex_stacks_enabled, &zero);
+	if (stacks && *stacks) {
+		entry.user_stack_id = bpf_get_stackid(ctx, &stack_traces, BPF_F_USER_STACK | BPF_F_REUSE_STACKID);
+	}
+	bpf_map_update_elem(&futex_waits, &tid, &entry, BPF_ANY);
+	return 0;
+}
+
+/* sys_exit_futex reports futex waits of at least FUTEX_MIN_WAIT_NS with the
+ * lock word's address and the task that woke the waiter */
+SEC("tp/syscalls/sys_exit_futex")
+int tracepoint_sys_exit_futex(void *ctx) {
+	struct {
+		unsigned short common_type;
+		unsigned char common_flags;
+		unsigned char common_preempt_count;
+		int common_pid;
+		int syscall_nr;
+		long ret;
+	} *args = (typeof(args))ctx;
 	
-	s64 ret = PT_REGS_RC(ctx);
-	if (ret == 0) {
-		e.error = 0;
-	} else {
-		e.error = ret;
+	u64 pid_tgid = bpf_get_current_pid_tgid();
+	u32 tid = (u32)pid_tgid;
+	struct futex_entry *entry = bpf_map_lookup_elem(&futex_waits, &tid);
+	if (!entry) {
+		return 0;
 	}
 	
-	char *target_ptr = bpf_map_lookup_elem(&dns_targets, &key);
-	if (target_ptr) {
-		bpf_probe_read_kernel_str(e.target, sizeof(e.target), target_ptr);
+	u64 latency = calc_latency(entry->start);
+	if (latency >= FUTEX_MIN_WAIT_NS) {
+		struct event e = {};
+		e.timestamp = bpf_ktime_get_ns();
+		e.pid = pid_tgid >> 32;
+		e.cgroup_id = bpf_get_current_cgroup_id();
+		e.type = EVENT_FUTEX_WAIT;
+		e.latency_ns = latency;
+		if (args->ret < 0) {
+			e.error = args->ret;
+		}
+		e.info.futex.uaddr = entry->uaddr;
+		e.info.futex.user_stack_id = entry->user_stack_id;
+		e.info.futex.tid = tid;
+		e.info.futex.waker_pid = entry->waker_pid;
+		e.info.futex.op = entry->op;
+		__builtin_memcpy(e.target, entry->waker_comm, sizeof(entry->waker_comm));
+		bpf_get_current_comm(e.details, sizeof(e.details));
+		bpf_ringbuf_output(&events, &e, sizeof(e), 0);
+	}
+	bpf_map_delete_elem(&futex_waits, &tid);
+	return 0;
+}
+
+SEC("tp/raw_syscalls/sys_enter")
+int tracepoint_sys_enter(void *ctx) {
+	struct {
+		unsigned short common_type;
+		unsigned char common_flags;
+		unsigned char common_preempt_count;
+		int common_pid;
+		long id;
+		unsigned long args[6];
+	} *args = (typeof(args))ctx;
+	
+	if (!in_target_cgroup()) {
+		return 0;
+	}
+	
+	u32 tid = (u32)bpf_get_current_pid_tgid();
+	struct syscall_entry entry = {};
+	entry.start = bpf_ktime_get_ns();
+	entry.nr = args->id;
+	bpf_map_update_elem(&syscall_starts, &tid, &entry, BPF_ANY);
+	return 0;
+}
+
+static inline u32 syscall_hist_slot(u64 latency_ns) {
+	u64 us = latency_ns / 1000;
+	u32 slot = 0;
+	
+#pragma unroll
+	for (int i = 0; i < SYSCALL_HIST_SLOTS - 1; i++) {
+		if (us == 0) {
+			break;
+		}
+		us >>= 1;
+		slot++;
+	}
+	return slot;
+}
+
+/* sys_exit adds the call to the totals of its system call and errno */
+SEC("tp/raw_syscalls/sys_exit")
+int tracepoint_sys_exit(void *ctx) {
+	struct {
+		unsigned short common_type;
+		unsigned char common_flags;
+		unsigned char common_preempt_count;
+		int common_pid;
+		long id;
+		long ret;
+	} *args = (typeof(args))ctx;
+	
+	u32 tid = (u32)bpf_get_current_pid_tgid();
+	struct syscall_entry *entry = bpf_map_lookup_elem(&syscall_starts, &tid);
+	if (!entry) {
+		return 0;
+	}
+	
+	u64 latency = calc_latency(entry->start);
+	struct syscall_key key = {};
+	key.cgroup_id = bpf_get_current_cgroup_id();
+	key.nr = entry->nr;
+	if (args->ret < 0 && args->ret >= -4095) {
+		key.err = -args->ret;
+	}
+	bpf_map_delete_elem(&syscall_starts, &tid);
+	
+	u32 slot = syscall_hist_slot(latency);
+	if (slot >= SYSCALL_HIST_SLOTS) {
+		slot = SYSCALL_HIST_SLOTS - 1;
+	}
+	
+	struct syscall_stat *stat = bpf_map_lookup_elem(&syscall_stats, &key);
+	if (stat) {
+		__sync_fetch_and_add(&stat->count, 1);
+		__sync_fetch_and_add(&stat->total_ns, latency);
+		__sync_fetch_and_add(&stat->hist[slot], 1);
+		return 0;
+	}
+	
+	struct syscall_stat init = {};
+	init.count = 1;
+	init.total_ns = latency;
+	init.hist[slot] = 1;
+	if (bpf_map_update_elem(&syscall_stats, &key, &init, BPF_NOEXIST) == 0) {
+		return 0;
+	}
+	
+	/* another CPU added the key first */
+	stat = bpf_map_lookup_elem(&syscall_stats, &key);
+	if (stat) {
+		__sync_fetch_and_add(&stat->count, 1);
+		__sync_fetch_and_add(&stat->total_ns, latency);
+		__sync_fetch_and_add(&stat->hist[slot], 1);
+	}
+	return 0;
+}
+
+/* sched_wakeup_new fires in the parent's context, whose cgroup the new task
+ * inherits. Its process ID is resolved in userspace since the tracepoint
+ * does not say whether the new task is a thread or a process. */
+SEC("tp/sched/sched_wakeup_new")
+int tracepoint_sched_wakeup_new(struct sched_wakeup_args *args) {
+	if (!in_target_cgroup()) {
+		return 0;
+	}
+	
+	u32 tid = args->pid;
+	struct runq_entry runq = {};
+	runq.start = bpf_ktime_get_ns();
+	runq.cgroup_id = bpf_get_current_cgroup_id();
+	bpf_map_update_elem(&runq_threads, &tid, &runq, BPF_ANY);
+	return 0;
+}
+
+/* parent_tgid returns the process ID of the task's parent */
+static inline u32 parent_tgid(struct task_struct *task) {
+	return BPF_CORE_READ(task, real_parent, tgid);
+}
+
+SEC("tp/sched/sched_process_exec")
+int tracepoint_sched_process_exec(void *ctx) {
+	struct {
+		unsigned short common_type;
+		unsigned char common_flags;
+		unsigned char common_preempt_count;
+		int common_pid;
+		u32 data_loc_filename;
+		u32 pid;
+		u32 old_pid;
+	} *args = (typeof(args))ctx;
+	
+	if (!in_target_cgroup()) {
+		return 0;
+	}
+	
+	struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+	struct event e = {};
+	e.timestamp = bpf_ktime_get_ns();
+	e.pid = bpf_get_current_pid_tgid() >> 32;
+	e.cgroup_id = bpf_get_current_cgroup_id();
+	e.type = EVENT_PROCESS_EXEC;
+	e.info.proc.ppid = parent_tgid(task);
+	/* the low 16 bits of a __data_loc field are the offset of the string
+	 * from the start of the record */
+	bpf_probe_read_kernel_str(e.target, sizeof(e.target), (void *)args + (args->data_loc_filename & 0xffff));
+	bpf_get_current_comm(e.details, sizeof(e.details));
+	
+	bpf_ringbuf_output(&events, &e, sizeof(e), 0);
+	return 0;
+}
+
+/* sched_process_fork also fires for new threads, which are skipped. The BTF
+ * tracepoint gives access to the child's task to tell them apart. */
+SEC("tp_btf/sched_process_fork")
+int BPF_PROG(tp_btf_sched_process_fork, struct task_struct *parent, struct task_struct *child) {
+	u32 child_pid = BPF_CORE_READ(child, pid);
+	if (BPF_CORE_READ(child, tgid) != child_pid || !in_target_cgroup()) {
+		return 0;
+	}
+	
+	struct event e = {};
+	e.timestamp = bpf_ktime_get_ns();
+	e.pid = BPF_CORE_READ(parent, tgid);
+	e.cgroup_id = bpf_get_current_cgroup_id();
+	e.type = EVENT_PROCESS_FORK;
+	e.info.proc.ppid = parent_tgid(parent);
+	e.info.proc.child_pid = child_pid;
+	BPF_CORE_READ_STR_INTO(&e.target, child, comm);
+	
+	bpf_ringbuf_output(&events, &e, sizeof(e), 0);
+	return 0;
+}
+
+/* sched_process_exit fires for every exiting thread, only the last thread of
+ * a process is reported. exit_code is in wait(2) status form and latency_ns
+ * is how long the process lived. */
+SEC("tp/sched/sched_process_exit")
+int tracepoint_sched_process_exit(void *ctx) {
+	if (!in_target_cgroup()) {
+		return 0;
+	}
+	
+	struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+	if (BPF_CORE_READ(task, signal, live.counter) != 0) {
+		return 0;
+	}
+	
+	u64 now = bpf_ktime_get_ns();
+	u64 start = BPF_CORE_READ(task, group_leader, start_time);
+	
+	struct event e = {};
+	e.timestamp = now;
+	e.pid = bpf_get_current_pid_tgid() >> 32;
+	e.cgroup_id = bpf_get_current_cgroup_id();
+	e.type = EVENT_PROCESS_EXIT;
+	e.latency_ns = now > start ? now - start : 0;
+	e.info.proc.ppid = parent_tgid(task);
+	e.info.proc.exit_code = BPF_CORE_READ(task, exit_code);
+	bpf_get_current_comm(e.details, sizeof(e.details));
+	
+	bpf_ringbuf_output(&events, &e, sizeof(e), 0);
+	return 0;
+}
+
+/* task_cgroup_id returns the cgroup v2 ID of a task other than the current one */
+static inline u64 task_cgroup_id(struct task_struct *task) {
+	return BPF_CORE_READ(task, cgroups, dfl_cgrp, kn, id);
+}
+
+/* oom_kill_process runs in the task that triggered the OOM killer, which for
+ * a global OOM may be in another pod, so the victim's cgroup is checked.
+ * details says whether the OOM was within a memory cgroup's limit. */
+SEC("kprobe/oom_kill_process")
+int kprobe_oom_kill_process(struct pt_regs *ctx) {
+	struct oom_control *oc = (struct oom_control *)PT_REGS_PARM1(ctx);
+	struct task_struct *victim = BPF_CORE_READ(oc, chosen);
+	if (!victim) {
+		return 0;
+	}
+	
+	u64 cgroup_id = task_cgroup_id(victim);
+	if (!is_target_cgroup(cgroup_id)) {
+		return 0;
+	}
+	
+	struct event e = {};
+	e.timestamp = bpf_ktime_get_ns();
+	e.pid = BPF_CORE_READ(victim, tgid);
+	e.cgroup_id = cgroup_id;
+	e.type = EVENT_OOM_KILL;
+	e.info.oom.total_pages = BPF_CORE_READ(oc, totalpages);
+	e.info.oom.points = BPF_CORE_READ(oc, chosen_points);
+	e.info.oom.trigger_pid = bpf_get_current_pid_tgid() >> 32;
+	BPF_CORE_READ_STR_INTO(&e.target, victim, comm);
+	if (BPF_CORE_READ(oc, memcg)) {
+		__builtin_memcpy(e.details, "memcg", 6);
+	} else {
+		__builtin_memcpy(e.details, "global", 7);
+	}
+	
+	bpf_ringbuf_output(&events, &e, sizeof(e), 0);
+	return 0;
+}
+
+/* mark_victim is the fallback when oom_kill_process cannot be probed. Its
+ * only stable field is the victim's PID, so the cgroup checked is that of
+ * the task that ran out of memory, which is the victim's for cgroup OOMs. */
+SEC("tp/oom/mark_victim")
+int tracepoint_mark_victim(void *ctx) {
+	struct {
+		unsigned short common_type;
+		unsigned char common_flags;
+		unsigned char common_preempt_count;
+		int common_pid;
+		int pid;
+	} *args = (typeof(args))ctx;
+	
+	if (!in_target_cgroup()) {
+		return 0;
+	}
+	
+	struct event e = {};
+	e.timestamp = bpf_ktime_get_ns();
+	e.pid = args->pid;
+	e.cgroup_id = bpf_get_current_cgroup_id();
+	e.type = EVENT_OOM_KILL;
+	e.info.oom.trigger_pid = bpf_get_current_pid_tgid() >> 32;
+	
+	bpf_ringbuf_output(&events, &e, sizeof(e), 0);
+	return 0;
+}
+
+#define REQ_OP_MASK 0xff
+
+/* block_rq_insert and block_rq_issue lost their request_queue argument in
+ * 5.11 */
+static inline struct request *block_rq_arg(u64 *ctx) {
+	if (LINUX_KERNEL_VERSION < KERNEL_VERSION(5, 11, 0)) {
+		return (struct request *)ctx[1];
+	}
+	return (struct request *)ctx[0];
+}
+
+/* request_cgroup_id returns the cgroup a block request is charged to, which
+ * for writeback is the cgroup that dirtied the pages rather than the flusher
+ * thread that submits them */
+static inline u64 request_cgroup_id(struct request *rq) {
+	if (bpf_core_field_exists(((struct bio *)0)->bi_blkg)) {
+		struct blkcg_gq *blkg = BPF_CORE_READ(rq, bio, bi_blkg);
+		if (blkg) {
+			struct cgroup *cgrp = BPF_CORE_READ(blkg, blkcg, css.cgroup);
+			if (cgrp) {
+				return BPF_CORE_READ(cgrp, kn, id);
+			}
+		}
+	}
+	return bpf_get_current_cgroup_id();
+}
+
+/* trace_block_rq_start records when a request was inserted or issued.
+ * Requests dispatched directly to the driver are never inserted. */
+static inline int trace_block_rq_start(struct request *rq, int issue) {
+	u64 key = (u64)rq;
+	u64 now = bpf_ktime_get_ns();
+	struct block_rq_entry *entry = bpf_map_lookup_elem(&block_requests, &key);
+	if (entry) {
+		if (issue) {
+			entry->issue = now;
+			entry->bytes = BPF_CORE_READ(rq, __data_len);
+		}
+		return 0;
+	}
+	
+	u64 cgroup_id = request_cgroup_id(rq);
+	if (!is_target_cgroup(cgroup_id)) {
+		return 0;
+	}
+	
+	struct block_rq_entry new_entry = {};
+	if (issue) {
+		new_entry.issue = now;
+		new_entry.bytes = BPF_CORE_READ(rq, __data_len);
+	} else {
+		new_entry.insert = now;
+	}
+	new_entry.cgroup_id = cgroup_id;
+	/* the submitting task is only known when it runs in the charged cgroup */
+	if (bpf_get_current_cgroup_id() == cgroup_id) {
+		new_entry.pid = bpf_get_current_pid_tgid() >> 32;
+	}
+	bpf_map_update_elem(&block_requests, &key, &new_entry, BPF_ANY);
+	return 0;
+}
+
+SEC("tp_btf/block_rq_insert")
+int tp_btf_block_rq_insert(u64 *ctx) {
+	return trace_block_rq_start(block_rq_arg(ctx), 0);
+}
+
+SEC("tp_btf/block_rq_issue")
+int tp_btf_block_rq_issue(u64 *ctx) {
+	return trace_block_rq_start(block_rq_arg(ctx), 1);
+}
+
+/* block_rq_complete splits the request's latency into the time queued in
+ * the I/O scheduler and the time the device took to service it */
+SEC("tp_btf/block_rq_complete")
+int BPF_PROG(tp_btf_block_rq_complete, struct request *rq, int error, unsigned int nr_bytes) {
+	u64 key = (u64)rq;
+	struct block_rq_entry *entry = bpf_map_lookup_elem(&block_requests, &key);
+	if (!entry) {
+		return 0;
+	}
+	if (!entry->issue) {
+		bpf_map_delete_elem(&block_requests, &key);
+		return 0;
+	}
+	
+	u64 now = bpf_ktime_get_ns();
+	u64 service = now > entry->issue ? now - entry->issue : 0;
+	u64 queue = entry->insert && entry->issue > entry->insert ? entry->issue - entry->insert : 0;
+	
+	struct gendisk *disk;
+	if (bpf_core_field_exists(rq->rq_disk)) {
+		disk = BPF_CORE_READ(rq, rq_disk); // before 5.19
+	} else {
+		disk = BPF_CORE_READ(rq, q, disk);
+	}
+	
+	struct event e = {};
+	e.timestamp = now;
+	e.pid = entry->pid;
+	e.cgroup_id = entry->cgroup_id;
+	e.type = EVENT_BLOCK_IO;
+	e.latency_ns = queue + service;
+	/* error is a blk_status_t, which userspace never sees, so any failure
+	 * is reported as EIO */
+	if (error & 0xff) {
+		e.error = -5;
+	}
+	e.info.block.sector = BPF_CORE_READ(rq, __sector);
+	e.info.block.queue_ns = queue;
+	e.info.block.bytes = entry->bytes;
+	e.info.block.op = BPF_CORE_READ(rq, cmd_flags) & REQ_OP_MASK;
+	if (disk) {
+		u32 major = BPF_CORE_READ(disk, major);
+		u32 minor = BPF_CORE_READ(disk, first_minor);
+		e.info.block.dev = (major << 20) | minor;
+		BPF_CORE_READ_STR_INTO(&e.target, disk, disk_name);
+	}
+	
+	bpf_ringbuf_output(&events, &e, sizeof(e), 0);
+	bpf_map_delete_elem(&block_requests, &key);
+	return 0;
+}
+
+#define FAULT_FLAG_WRITE 0x01
+#define FAULT_FLAG_USER 0x40
+#define VM_FAULT_MAJOR 0x004
+#define VM_FAULT_RETRY 0x400
+#define PAGE_SHIFT 12
+
+SEC("kprobe/handle_mm_fault")
+int kprobe_handle_mm_fault(struct pt_regs *ctx) {
+	u32 flags = (u32)PT_REGS_PARM3(ctx);
+	if (!(flags & FAULT_FLAG_USER) || !in_target_cgroup()) {
+		return 0;
+	}
+	
+	u64 key = bpf_get_current_pid_tgid();
+	struct fault_entry *pending = bpf_map_lookup_elem(&fault_entries, &key);
+	if (pending && pending->retry) {
+		pending->retry = 0;
+		return 0;
+	}
+	
+	struct vm_area_struct *vma = (struct vm_area_struct *)PT_REGS_PARM1(ctx);
+	struct fault_entry entry = {};
+	entry.start = bpf_ktime_get_ns();
+	entry.address = PT_REGS_PARM2(ctx);
+	entry.file = (u64)BPF_CORE_READ(vma, vm_file);
+	entry.vm_start = BPF_CORE_READ(vma, vm_start);
+	entry.vm_end = BPF_CORE_READ(vma, vm_end);
+	entry.pgoff = BPF_CORE_READ(vma, vm_pgoff);
+	entry.write = (flags & FAULT_FLAG_WRITE) != 0;
+	bpf_map_update_elem(&fault_entries, &key, &entry, BPF_ANY);
+	return 0;
+}
+
+static inline void count_page_fault(u32 pid, int major) {
+	struct fault_count *count = bpf_map_lookup_elem(&page_fault_counts, &pid);
+	if (count) {
+		if (major) {
+			__sync_fetch_and_add(&count->major, 1);
+		} else {
+			__sync_fetch_and_add(&count->minor, 1);
+		}
+		return;
+	}
+	
+	struct fault_count init = {};
+	if (major) {
+		init.major = 1;
+	} else {
+		init.minor = 1;
+	}
+	init.cgroup_id = bpf_get_current_cgroup_id();
+	bpf_map_update_elem(&page_fault_counts, &pid, &init, BPF_ANY);
+}
+
+/* format_fault_mapping names the mapping an anonymous fault hit */
+static inline void format_fault_mapping(struct fault_entry *entry, char *buf) {
+	struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+	struct mm_struct *mm = BPF_CORE_READ(task, mm);
+	u64 start_brk = BPF_CORE_READ(mm, start_brk);
+	u64 brk = BPF_CORE_READ(mm, brk);
+	u64 start_stack = BPF_CORE_READ(mm, start_stack);
+	
+	if (entry->vm_start <= brk && entry->vm_end >= start_brk) {
+		__builtin_memcpy(buf, "[heap]", 7);
+	} else if (entry->vm_start <= start_stack && entry->vm_end >= start_stack) {
+		__builtin_memcpy(buf, "[stack]", 8);
+	} else {
+		__builtin_memcpy(buf, "[anon]", 7);
+	}
+}
+
+/* kretprobe_handle_mm_fault counts every completed user page fault and
+ * reports major faults, and minor faults slower than 1ms, with the mapping
+ * the faulting address belongs to */
+SEC("kretprobe/handle_mm_fault")
+int kretprobe_handle_mm_fault(struct pt_regs *ctx) {
+	u64 key = bpf_get_current_pid_tgid();
+	struct fault_entry *entry = bpf_map_lookup_elem(&fault_entries, &key);
+	if (!entry) {
+		return 0;
+	}
+	
+	u32 ret = (u32)PT_REGS_RC(ctx);
+	if (ret & VM_FAULT_MAJOR) {
+		entry->major = 1;
+	}
+	if (ret & VM_FAULT_RETRY) {
+		entry->retry = 1;
+		return 0;
+	}
+	
+	u32 pid = key >> 32;
+	count_page_fault(pid, entry->major);
+	
+	u64 latency = calc_latency(entry->start);
+	if (!entry->major && latency < 1000000) {
+		bpf_map_delete_elem(&fault_entries, &key);
+		return 0;
+	}
+	
+	struct event e = {};
+	e.timestamp = bpf_ktime_get_ns();
+	e.pid = pid;
+	e.cgroup_id = bpf_get_current_cgroup_id();
+	e.type = EVENT_PAGE_FAULT;
+	e.latency_ns = latency;
+	e.info.fault.address = entry->address;
+	e.info.fault.write = entry->write;
+	if (entry->major) {
+		__builtin_memcpy(e.details, "major", 6);
+	} else {
+		__builtin_memcpy(e.details, "minor", 6);
+	}
+	
+	struct file *file = (struct file *)entry->file;
+	if (file) {
+		format_file_path(file, e.target);
+		e.info.fault.offset = (entry->address - entry->vm_start) + (entry->pgoff << PAGE_SHIFT);
+	} else {
+		format_fault_mapping(entry, e.target);
+	}
+	
+	bpf_ringbuf_output(&events, &e, sizeof(e), 0);
+	bpf_map_delete_elem(&fault_entries, &key);
+	return 0;
+}
+
+/* perf_event_profile runs on every CPU clock sample while profiling and
+ * counts the stack of the task that was running */
+SEC("perf_event")
+int perf_event_profile(void *ctx) {
+	u32 pid = bpf_get_current_pid_tgid() >> 32;
+	if (pid == 0 || !in_target_cgroup()) {
+		return 0;
+	}
+	
+	struct profile_key key = {};
+	key.cgroup_id = bpf_get_current_cgroup_id();
+	key.pid = pid;
+	key.kernel_stack_id = bpf_get_stackid(ctx, &profile_stacks, 0);
+	key.user_stack_id = bpf_get_stackid(ctx, &profile_stacks, BPF_F_USER_STACK);
+	
+	u64 *count = bpf_map_lookup_elem(&profile_counts, &key);
+	if (count) {
+		__sync_fetch_and_add(count, 1);
+	} else {
+		u64 one = 1;
+		bpf_map_update_elem(&profile_counts, &key, &one, BPF_NOEXIST);
+	}
+	return 0;
+}
+
+SEC("uprobe/getaddrinfo")
+int uprobe_getaddrinfo(struct pt_regs *ctx) {
+	if (!in_target_cgroup()) {
+		return 0;
+	}
+	
+	u32 pid = bpf_get_current_pid_tgid() >> 32;
+	u32 tid = (u32)bpf_get_current_pid_tgid();
+	u64 key = get_key(pid, tid);
+	u64 ts = bpf_ktime_get_ns();
+	bpf_map_update_elem(&start_times, &key, &ts, BPF_ANY);
+	
+	void *node_ptr = (void *)PT_REGS_PARM1(ctx);
+	if (node_ptr) {
+		char target[MAX_STRING_LEN] = {};
+		bpf_probe_read_user_str(target, sizeof(target), node_ptr);
+		bpf_map_update_elem(&dns_targets, &key, target, BPF_ANY);
+	}
+	
+	return 0;
+}
+
+SEC("uretprobe/getaddrinfo")
+int uretprobe_getaddrinfo(struct pt_regs *ctx) {
+	u32 pid = bpf_get_current_pid_tgid() >> 32;
+	u32 tid = (u32)bpf_get_current_pid_tgid();
+	u64 key = get_key(pid, tid);
+	u64 *start_ts = bpf_map_lookup_elem(&start_times, &key);
+	
+	if (!start_ts) {
+		return 0;
+	}
+	
+	u64 latency = calc_latency(*start_ts);
+	
+	struct event e = {};
+	e.timestamp = bpf_ktime_get_ns();
+	e.pid = pid;
+	e.cgroup_id = bpf_get_current_cgroup_id();
+	e.type = EVENT_DNS;
+	e.latency_ns = latency;
+	
+	s64 ret = PT_REGS_RC(ctx);
+	if (ret == 0) {
+		e.error = 0;
+	} else {
+		e.error = ret;
+	}
+	
+	char *target_ptr = bpf_map_lookup_elem(&dns_targets, &key);
+	if (target_ptr) {
+		bpf_probe_read_kernel_str(e.target, sizeof(e.target), target_ptr);
 		bpf_map_delete_elem(&dns_targets, &key);
 	} else {
 		e.target[0] = '\0';
@@ -542,5 +2447,284 @@ int uretprobe_getaddrinfo(struct pt_regs *ctx) {
 	return 0;
 }
 
+SEC("tp/tcp/tcp_retransmit_skb")
+int tracepoint_tcp_retransmit_skb(struct trace_event_raw_tcp_event_sk_skb *ctx) {
+	emit_tcp_sock_event((struct sock *)BPF_CORE_READ(ctx, skaddr), EVENT_TCP_RETRANSMIT);
+	return 0;
+}
+
+/* fallback for kernels without the tcp_retransmit_skb tracepoint */
+SEC("kprobe/tcp_retransmit_skb")
+int kprobe_tcp_retransmit_skb(struct pt_regs *ctx) {
+	emit_tcp_sock_event((struct sock *)PT_REGS_PARM1(ctx), EVENT_TCP_RETRANSMIT);
+	return 0;
+}
+
+SEC("tp/tcp/tcp_send_reset")
+int tracepoint_tcp_send_reset(struct trace_event_raw_tcp_event_sk_skb *ctx) {
+	struct sock *sk = (struct sock *)BPF_CORE_READ(ctx, skaddr);
+	emit_tcp_sock_event(sk, EVENT_TCP_SEND_RESET);
+	mark_tcp_conn(sk, CONN_RESET_SENT);
+	return 0;
+}
+
+SEC("tp/tcp/tcp_receive_reset")
+int tracepoint_tcp_receive_reset(struct trace_event_raw_tcp_event_sk *ctx) {
+	struct sock *sk = (struct sock *)BPF_CORE_READ(ctx, skaddr);
+	emit_tcp_sock_event(sk, EVENT_TCP_RECV_RESET);
+	mark_tcp_conn(sk, CONN_RESET_RECEIVED);
+	return 0;
+}
+
+/* samples the kernel's smoothed RTT estimate of established connections,
+ * at most once per RTT_SAMPLE_INTERVAL_NS per socket */
+SEC("kprobe/tcp_rcv_established")
+int kprobe_tcp_rcv_established(struct pt_regs *ctx) {
+	struct sock *sk = (struct sock *)PT_REGS_PARM1(ctx);
+	u64 sk_key = (u64)sk;
+	u64 now = bpf_ktime_get_ns();
+	
+	u64 *last = bpf_map_lookup_elem(&rtt_samples, &sk_key);
+	if (last && now - *last < RTT_SAMPLE_INTERVAL_NS) {
+		return 0;
+	}
+	
+	struct event e = {};
+	if (!fill_tcp_sock_event(sk, EVENT_TCP_RTT, &e)) {
+		return 0;
+	}
+	bpf_map_update_elem(&rtt_samples, &sk_key, &now, BPF_ANY);
+	
+	struct tcp_sock *tp = (struct tcp_sock *)sk;
+	u32 srtt_us = BPF_CORE_READ(tp, srtt_us) >> 3;
+	if (srtt_us == 0) {
+		return 0;
+	}
+	e.latency_ns = (u64)srtt_us * 1000;
+	e.info.tcp.rttvar_us = BPF_CORE_READ(tp, mdev_us) >> 2;
+	e.info.tcp.snd_cwnd = BPF_CORE_READ(tp, snd_cwnd);
+	e.info.tcp.total_retrans = BPF_CORE_READ(tp, total_retrans);
+	
+	bpf_ringbuf_output(&events, &e, sizeof(e), 0);
+	return 0;
+}
+
+#define TCP_ESTABLISHED 1
+#define TCP_SYN_SENT 2
+#define TCP_SYN_RECV 3
+#define TCP_FIN_WAIT1 4
+#define TCP_CLOSE 7
+#define TCP_CLOSE_WAIT 8
+
+/* emit_tcp_conn reports a connection that just closed from state oldstate,
+ * with its lifetime and the bytes it moved */
+static inline void emit_tcp_conn(struct sock *sk, struct tcp_conn *conn, int oldstate) {
+	struct event e = {};
+	e.timestamp = bpf_ktime_get_ns();
+	e.pid = conn->pid;
+	e.cgroup_id = conn->cgroup_id;
+	e.type = EVENT_TCP_CONNECTION;
+	e.latency_ns = calc_latency(conn->start);
+	e.state = oldstate;
+	format_sock_addrs(sk, e.target, e.details);
+	
+	struct tcp_sock *tp = (struct tcp_sock *)sk;
+	e.info.conn.bytes_sent = BPF_CORE_READ(tp, bytes_acked);
+	e.info.conn.bytes_received = BPF_CORE_READ(tp, bytes_received);
+	e.info.conn.flags = conn->flags;
+	
+	bpf_ringbuf_output(&events, &e, sizeof(e), 0);
+}
+
+/* close_tcp_conn reports a closed connection and stops tracking it */
+static inline void close_tcp_conn(struct sock *sk, struct tcp_conn *conn, int oldstate) {
+	u64 sk_key = (u64)sk;
+	emit_tcp_conn(sk, conn, oldstate);
+	bpf_map_delete_elem(&tcp_conns, &sk_key);
+	bpf_map_delete_elem(&accept_queue, &sk_key);
+}
+
+/* follows the TCP connections of the target cgroups from the SYN (or, for
+ * accepted connections, the end of the handshake) to the close, recording
+ * which side closed first, and starts the accept queue wait of passively
+ * opened connections */
+SEC("tp/sock/inet_sock_set_state")
+int tracepoint_inet_sock_set_state(struct trace_event_raw_inet_sock_set_state *ctx) {
+	if (BPF_CORE_READ(ctx, protocol) != 6) { // IPPROTO_TCP
+		return 0;
+	}
+	
+	struct sock *sk = (struct sock *)BPF_CORE_READ(ctx, skaddr);
+	int oldstate = BPF_CORE_READ(ctx, oldstate);
+	int newstate = BPF_CORE_READ(ctx, newstate);
+	u64 sk_key = (u64)sk;
+	
+	int passive = oldstate == TCP_SYN_RECV && newstate == TCP_ESTABLISHED;
+	if (passive || newstate == TCP_SYN_SENT) {
+		u64 cgroup_id = sock_cgroup_id(sk);
+		if (!is_target_cgroup(cgroup_id)) {
+			return 0;
+		}
+		struct tcp_conn conn = {};
+		conn.start = bpf_ktime_get_ns();
+		conn.cgroup_id = cgroup_id;
+		if (passive) {
+			conn.flags = CONN_PASSIVE;
+			/* the connection waits in its listener's accept queue from now on */
+			bpf_map_update_elem(&accept_queue, &sk_key, &conn.start, BPF_ANY);
+		} else if (bpf_get_current_cgroup_id() == cgroup_id) {
+			conn.pid = bpf_get_current_pid_tgid() >> 32;
+		}
+		bpf_map_update_elem(&tcp_conns, &sk_key, &conn, BPF_ANY);
+		return 0;
+	}
+	
+	struct tcp_conn *conn = bpf_map_lookup_elem(&tcp_conns, &sk_key);
+	if (!conn) {
+		return 0;
+	}
+	if (oldstate == TCP_ESTABLISHED && newstate == TCP_FIN_WAIT1) {
+		conn->flags |= CONN_LOCAL_CLOSE;
+	} else if (oldstate == TCP_ESTABLISHED && newstate == TCP_CLOSE_WAIT) {
+		conn->flags |= CONN_REMOTE_CLOSE;
+	} else if (newstate == TCP_CLOSE) {
+		u32 zero = 0;
+		u32 *deferred = bpf_map_lookup_elem(&tcp_close_deferred, &zero);
+		int abortive = oldstate == TCP_ESTABLISHED || oldstate == TCP_FIN_WAIT1 || oldstate == TCP_CLOSE_WAIT;
+		if (abortive && deferred && *deferred && !(conn->flags & (CONN_RESET_SENT | CONN_RESET_RECEIVED))) {
+			/* an abortive close sends its RST only after the move to
+			 * CLOSE, so wait for tcp_send_active_reset or the socket's
+			 * destruction to tell it from a timeout */
+			conn->flags |= CONN_CLOSED;
+			conn->close_state = oldstate;
+			return 0;
+		}
+		close_tcp_conn(sk, conn, oldstate);
+	}
+	return 0;
+}
+
+/* marks connections that send a RST. A deferred connection summary is
+ * reported right away, since the RST is the last thing a socket sends. */
+SEC("kprobe/tcp_send_active_reset")
+int kprobe_tcp_send_active_reset(struct pt_regs *ctx) {
+	struct sock *sk = (struct sock *)PT_REGS_PARM1(ctx);
+	u64 sk_key = (u64)sk;
+	struct tcp_conn *conn = bpf_map_lookup_elem(&tcp_conns, &sk_key);
+	if (!conn) {
+		return 0;
+	}
+	conn->flags |= CONN_RESET_SENT;
+	if (conn->flags & CONN_CLOSED) {
+		close_tcp_conn(sk, conn, conn->close_state);
+	}
+	return 0;
+}
+
+/* reports connections that reached CLOSE without a RST, e.g. after a
+ * retransmission or keepalive timeout. IPv6 sockets are destroyed here too. */
+SEC("kprobe/tcp_v4_destroy_sock")
+int kprobe_tcp_v4_destroy_sock(struct pt_regs *ctx) {
+	struct sock *sk = (struct sock *)PT_REGS_PARM1(ctx);
+	u64 sk_key = (u64)sk;
+	struct tcp_conn *conn = bpf_map_lookup_elem(&tcp_conns, &sk_key);
+	if (conn && (conn->flags & CONN_CLOSED)) {
+		close_tcp_conn(sk, conn, conn->close_state);
+	}
+	return 0;
+}
+
+SEC("kprobe/inet_csk_accept")
+int kprobe_inet_csk_accept(struct pt_regs *ctx) {
+	if (!in_target_cgroup()) {
+		return 0;
+	}
+	
+	u64 key = bpf_get_current_pid_tgid();
+	u64 listener = (u64)PT_REGS_PARM1(ctx);
+	bpf_map_update_elem(&accept_listeners, &key, &listener, BPF_ANY);
+	return 0;
+}
+
+/* reports each accepted connection with the time it spent in the accept
+ * queue, when its handshake was seen, and the listener's remaining backlog */
+SEC("kretprobe/inet_csk_accept")
+int kretprobe_inet_csk_accept(struct pt_regs *ctx) {
+	u64 key = bpf_get_current_pid_tgid();
+	u64 *listener = bpf_map_lookup_elem(&accept_listeners, &key);
+	if (!listener) {
+		return 0;
+	}
+	struct sock *lsk = (struct sock *)*listener;
+	bpf_map_delete_elem(&accept_listeners, &key);
+	
+	struct sock *sk = (struct sock *)PT_REGS_RC(ctx);
+	if (!sk) {
+		return 0;
+	}
+	
+	struct event e = {};
+	e.timestamp = bpf_ktime_get_ns();
+	e.pid = key >> 32;
+	e.cgroup_id = bpf_get_current_cgroup_id();
+	e.type = EVENT_ACCEPT;
+	e.state = BPF_CORE_READ(sk, __sk_common.skc_state);
+	format_sock_addrs(sk, e.target, e.details);
+	
+	u64 sk_key = (u64)sk;
+	u64 *queued = bpf_map_lookup_elem(&accept_queue, &sk_key);
+	if (queued) {
+		e.latency_ns = calc_latency(*queued);
+		bpf_map_delete_elem(&accept_queue, &sk_key);
+	}
+	struct tcp_conn *conn = bpf_map_lookup_elem(&tcp_conns, &sk_key);
+	if (conn) {
+		conn->pid = e.pid;
+	}
+	e.info.accept.backlog = BPF_CORE_READ(lsk, sk_ack_backlog);
+	e.info.accept.max_backlog = BPF_CORE_READ(lsk, sk_max_ack_backlog);
+	
+	bpf_ringbuf_output(&events, &e, sizeof(e), 0);
+	return 0;
+}
+
+SEC("kprobe/ip_send_skb")
+int kprobe_ip_send_skb(struct pt_regs *ctx) {
+	if (!in_target_cgroup()) {
+		return 0;
+	}
+	
+	struct sk_buff *skb = (struct sk_buff *)PT_REGS_PARM2(ctx);
+	dns_trace_udp_send(skb, 9); // iphdr.protocol
+	return 0;
+}
+
+SEC("kprobe/ip6_send_skb")
+int kprobe_ip6_send_skb(struct pt_regs *ctx) {
+	if (!in_target_cgroup()) {
+		return 0;
+	}
+	
+	struct sk_buff *skb = (struct sk_buff *)PT_REGS_PARM1(ctx);
+	dns_trace_udp_send(skb, 6); // ipv6hdr.nexthdr
+	return 0;
+}
+
+SEC("kprobe/skb_consume_udp")
+int kprobe_skb_consume_udp(struct pt_regs *ctx) {
+	if (!in_target_cgroup()) {
+		return 0;
+	}
+	
+	struct sk_buff *skb = (struct sk_buff *)PT_REGS_PARM2(ctx);
+	struct udphdr udp = {};
+	u8 msg[DNS_MSG_LEN] = {};
+	if (dns_read_udp(skb, &udp, msg) < 0 || udp.source != __builtin_bswap16(DNS_PORT)) {
+		return 0;
+	}
+	dns_complete_query(msg, __builtin_bswap16(udp.dest));
+	return 0;
+}
+
 char LICENSE[] SEC("license") = "GPL";
 
@@ -30,6 +30,8 @@ typedef __u64 u64;
 typedef __u16 __be16;
 typedef __u32 __be32;
 typedef __u32 __wsum;
+typedef __u32 dev_t;
+typedef int pid_t;
 
 struct pt_regs {
     unsigned long r15;
@@ -55,17 +57,6 @@ struct pt_regs {
     unsigned long ss;
 };
 
-struct path {
-    struct dentry *dentry;
-    struct vfsmount *mnt;
-};
-
-struct file {};
-struct dentry {};
-struct qstr {
-    const char *name;
-};
-
 struct in_addr {
     u32 s_addr;
 };
@@ -77,5 +68,285 @@ struct sockaddr_in {
     char sin_zero[8];
 };
 
+/*
+ * Kernel structures below are accessed with CO-RE relocations, so only the
+ * fields podtrace reads are declared and their layout is resolved against
+ * the running kernel's BTF at load time.
+ */
+#pragma clang attribute push (__attribute__((preserve_access_index)), apply_to = record)
+
+struct qstr {
+    u32 hash;
+    u32 len;
+    const unsigned char *name;
+};
+
+struct dentry {
+    struct dentry *d_parent;
+    struct qstr d_name;
+};
+
+struct path {
+    struct vfsmount *mnt;
+    struct dentry *dentry;
+};
+
+struct vfsmount {
+    struct dentry *mnt_root;
+};
+
+struct mount {
+    struct mount *mnt_parent;
+    struct dentry *mnt_mountpoint;
+    struct vfsmount mnt;
+};
+
+struct fs_struct {
+    struct path root;
+};
+
+struct file_system_type {
+    const char *name;
+};
+
+struct super_block {
+    dev_t s_dev;
+    struct file_system_type *s_type;
+};
+
+struct inode {
+    unsigned long i_ino;
+    struct super_block *i_sb;
+};
+
+struct file {
+    struct path f_path;
+    struct inode *f_inode;
+};
+
+typedef struct {
+    int counter;
+} atomic_t;
+
+struct signal_struct {
+    atomic_t live;
+};
+
+struct css_set {
+    struct cgroup *dfl_cgrp;
+};
+
+struct task_struct {
+    pid_t pid;
+    pid_t tgid;
+    int exit_code;
+    u64 start_time;
+    struct task_struct *real_parent;
+    struct task_struct *group_leader;
+    struct signal_struct *signal;
+    struct css_set *cgroups;
+    struct mm_struct *mm;
+    struct fs_struct *fs;
+    char comm[16];
+};
+
+struct mm_struct {
+    unsigned long start_brk;
+    unsigned long brk;
+    unsigned long start_stack;
+};
+
+struct vm_area_struct {
+    unsigned long vm_start;
+    unsigned long vm_end;
+    unsigned long vm_pgoff;
+    struct file *vm_file;
+};
+
+struct oom_control {
+    struct mem_cgroup *memcg;
+    unsigned long totalpages;
+    struct task_struct *chosen;
+    long chosen_points;
+};
+
+struct gendisk {
+    int major;
+    int first_minor;
+    char disk_name[32];
+};
+
+struct request_queue {
+    struct gendisk *disk;
+};
+
+struct cgroup_subsys_state {
+    struct cgroup *cgroup;
+};
+
+struct blkcg {
+    struct cgroup_subsys_state css;
+};
+
+struct blkcg_gq {
+    struct blkcg *blkcg;
+};
+
+struct bio {
+    struct blkcg_gq *bi_blkg;
+};
+
+struct request {
+    struct request_queue *q;
+    struct gendisk *rq_disk;
+    unsigned int cmd_flags;
+    unsigned int __data_len;
+    u64 __sector;
+    struct bio *bio;
+};
+
+struct in6_addr {
+    union {
+        u8 u6_addr8[16];
+        __be32 u6_addr32[4];
+    } in6_u;
+};
+
+struct sock_common {
+    __be32 skc_daddr;
+    __be32 skc_rcv_saddr;
+    __be16 skc_dport;
+    u16 skc_num;
+    unsigned short skc_family;
+    volatile unsigned char skc_state;
+    struct in6_addr skc_v6_daddr;
+    struct in6_addr skc_v6_rcv_saddr;
+};
+
+struct kernfs_node {
+    u64 id;
+};
+
+struct cgroup {
+    struct kernfs_node *kn;
+};
+
+struct sock_cgroup_data {
+    struct cgroup *cgroup;
+    u64 val;
+};
+
+struct sock {
+    struct sock_common __sk_common;
+    struct sock_cgroup_data sk_cgrp_data;
+    u32 sk_ack_backlog;
+    u32 sk_max_ack_backlog;
+};
+
+struct tcp_sock {
+    u32 srtt_us;
+    u32 mdev_us;
+    u32 snd_cwnd;
+    u32 total_retrans;
+    u64 bytes_received;
+    u64 bytes_acked;
+};
+
+struct sk_buff {
+    struct sock *sk;
+    unsigned char *head;
+    u16 transport_header;
+    u16 network_header;
+};
+
+struct udphdr {
+    __be16 source;
+    __be16 dest;
+    __be16 len;
+    u16 check;
+};
+
+struct iovec {
+    void *iov_base;
+    unsigned long iov_len;
+};
+
+enum iter_type {
+    ITER_IOVEC,
+    ITER_KVEC,
+    ITER_BVEC,
+    ITER_PIPE,
+    ITER_XARRAY,
+    ITER_DISCARD,
+    ITER_UBUF,
+};
+
+struct iov_iter {
+    u8 iter_type;
+    union {
+        const struct iovec *__iov;
+        const struct iovec *iov;
+        void *ubuf;
+    };
+};
+
+struct msghdr {
+    void *msg_name;
+    struct iov_iter msg_iter;
+};
+
+struct trace_entry {
+    unsigned short type;
+    unsigned char flags;
+    unsigned char preempt_count;
+    int pid;
+};
+
+struct trace_event_raw_tcp_event_sk_skb {
+    struct trace_entry ent;
+    const void *skbaddr;
+    const void *skaddr;
+    int state;
+};
+
+struct trace_event_raw_tcp_event_sk {
+    struct trace_entry ent;
+    const void *skaddr;
+};
+
+struct trace_event_raw_inet_sock_set_state {
+    struct trace_entry ent;
+    const void *skaddr;
+    int oldstate;
+    int newstate;
+    u16 sport;
+    u16 dport;
+    u16 family;
+    u16 protocol;
+    u8 saddr[4];
+    u8 daddr[4];
+    u8 saddr_v6[16];
+    u8 daddr_v6[16];
+};
+
+enum skb_drop_reason {
+    SKB_DROP_REASON_NOT_SPECIFIED,
+    SKB_DROP_REASON_SOCKET_FILTER,
+    SKB_DROP_REASON_UDP_CSUM,
+    SKB_DROP_REASON_XFRM_POLICY,
+    SKB_DROP_REASON_SOCKET_RCVBUFF,
+    SKB_DROP_REASON_PROTO_MEM,
+};
+
+struct trace_event_raw_kfree_skb {
+    struct trace_entry ent;
+    void *skbaddr;
+    void *location;
+    unsigned short protocol;
+    enum skb_drop_reason reason;
+};
+
+#pragma clang attribute pop
+
 #endif /* __VMLINUX_H__ */
 
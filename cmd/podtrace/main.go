@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sync/atomic"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -18,6 +19,10 @@ import (
 var (
 	namespace        string
 	diagnoseDuration string
+	containerNames   []string
+	outputFormat     string
+	reportFormat     string
+	lockStacks       bool
 )
 
 func main() {
@@ -31,7 +36,13 @@ func main() {
 	}
 
 	rootCmd.Flags().StringVarP(&namespace, "namespace", "n", "default", "Kubernetes namespace")
+	rootCmd.Flags().StringSliceVarP(&containerNames, "container", "c", nil, "Container(s) to trace (default: all containers in the pod)")
 	rootCmd.Flags().StringVar(&diagnoseDuration, "diagnose", "", "Run in diagnose mode for the specified duration (e.g., 10s, 5m)")
+	rootCmd.Flags().StringVar(&reportFormat, "report-format", diagnose.ReportFormatText, "Diagnostic report format: text, json or yaml")
+	rootCmd.Flags().StringVarP(&outputFormat, "output", "o", "text", "Output format: text (diagnostic report) or json (one event per line)")
+	rootCmd.Flags().BoolVar(&lockStacks, "lock-stacks", false, "Record the user stacks of threads waiting on contended locks (futexes)")
+
+	rootCmd.AddCommand(newRecordCmd(), newReplayCmd(), newProfileCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -40,59 +51,111 @@ func main() {
 }
 
 func runPodtrace(cmd *cobra.Command, args []string) error {
+	if err := validateFormats(); err != nil {
+		return err
+	}
+
 	metricsexporter.StartServer()
-	podName := args[0]
 
+	tracerChan := make(chan *events.Event, 100)
+	tracer, _, err := startTracer(args[0], tracerChan)
+	if err != nil {
+		return err
+	}
+	defer tracer.Stop()
+
+	metricsChan := make(chan *events.Event, metricsQueueSize)
+	eventChan := make(chan *events.Event, 100)
+	go teeEvents(tracerChan, eventChan, metricsChan)
+	go metricsexporter.HandleEvents(metricsChan)
+	defer reportDroppedMetricsEvents()
+
+	if outputFormat == "json" {
+		return runJSONMode(eventChan, diagnoseDuration)
+	}
+
+	if diagnoseDuration != "" {
+		return runDiagnoseMode(eventChan, diagnoseDuration)
+	}
+
+	return runNormalMode(eventChan)
+}
+
+func validateFormats() error {
+	if outputFormat != "text" && outputFormat != "json" {
+		return fmt.Errorf("invalid output format %q (expected text or json)", outputFormat)
+	}
+	switch reportFormat {
+	case diagnose.ReportFormatText, diagnose.ReportFormatJSON, diagnose.ReportFormatYAML:
+	default:
+		return fmt.Errorf("invalid report format %q (expected text, json or yaml)", reportFormat)
+	}
+	return nil
+}
+
+// startTracer resolves the pod, attaches a tracer to its containers and starts
+// sending events to eventChan. The caller must Stop the returned tracer.
+func startTracer(podName string, eventChan chan<- *events.Event) (*ebpf.Tracer, *kubernetes.PodInfo, error) {
 	resolver, err := kubernetes.NewPodResolver()
 	if err != nil {
-		return fmt.Errorf("failed to create pod resolver: %w", err)
+		return nil, nil, fmt.Errorf("failed to create pod resolver: %w", err)
 	}
 
 	ctx := context.Background()
-	podInfo, err := resolver.ResolvePod(ctx, podName, namespace)
+	podInfo, err := resolver.ResolvePod(ctx, podName, namespace, containerNames)
 	if err != nil {
-		return fmt.Errorf("failed to resolve pod: %w", err)
+		return nil, nil, fmt.Errorf("failed to resolve pod: %w", err)
 	}
 
 	fmt.Fprintf(os.Stderr, "Resolved pod %s/%s:\n", namespace, podName)
-	fmt.Fprintf(os.Stderr, "  Container ID: %s\n", podInfo.ContainerID)
-	fmt.Fprintf(os.Stderr, "  Cgroup path: %s\n", podInfo.CgroupPath)
+	for _, container := range podInfo.Containers {
+		fmt.Fprintf(os.Stderr, "  Container %s (%s):\n", container.Name, container.Kind)
+		fmt.Fprintf(os.Stderr, "    Container ID: %s\n", container.ContainerID)
+		fmt.Fprintf(os.Stderr, "    Cgroup path: %s\n", container.CgroupPath)
+	}
 	fmt.Fprintf(os.Stderr, "\n")
 
 	tracer, err := ebpf.NewTracer()
 	if err != nil {
-		return fmt.Errorf("failed to create tracer: %w", err)
+		return nil, nil, fmt.Errorf("failed to create tracer: %w", err)
 	}
-	defer tracer.Stop()
 
-	if err := tracer.AttachToCgroup(podInfo.CgroupPath); err != nil {
-		return fmt.Errorf("failed to attach to cgroup: %w", err)
+	if err := tracer.AttachToCgroups(podInfo.CgroupPaths()); err != nil {
+		tracer.Stop()
+		return nil, nil, fmt.Errorf("failed to attach to cgroup: %w", err)
 	}
 
-	eventChan := make(chan *events.Event, 100)
-	go metricsexporter.HandleEvents(eventChan)
-
-	if err := tracer.Start(eventChan); err != nil {
-		return fmt.Errorf("failed to start tracer: %w", err)
+	if lockStacks {
+		if err := tracer.EnableLockStacks(); err != nil {
+			fmt.Fprintf(os.Stderr, "Note: lock waiter stacks unavailable: %v\n", err)
+		}
 	}
 
-	if diagnoseDuration != "" {
-		return runDiagnoseMode(eventChan, diagnoseDuration, podInfo.CgroupPath)
+	if err := tracer.Start(eventChan); err != nil {
+		tracer.Stop()
+		return nil, nil, fmt.Errorf("failed to start tracer: %w", err)
 	}
 
-	return runNormalMode(eventChan)
+	return tracer, podInfo, nil
 }
 
 func runNormalMode(eventChan <-chan *events.Event) error {
-	fmt.Println("Tracing started. Press Ctrl+C to stop.")
-	fmt.Println("Real-time diagnostic updates every 5 seconds...")
-	fmt.Println()
+	textReport := reportFormat == diagnose.ReportFormatText
+
+	if textReport {
+		fmt.Println("Tracing started. Press Ctrl+C to stop.")
+		fmt.Println("Real-time diagnostic updates every 5 seconds...")
+		fmt.Println()
+	} else {
+		fmt.Fprintln(os.Stderr, "Tracing started. Press Ctrl+C to stop and print the report.")
+	}
 
 	diagnostician := diagnose.NewDiagnostician()
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
 	hasPrintedReport := false
+	interrupt := interruptChan()
 
 	for {
 		select {
@@ -100,6 +163,10 @@ func runNormalMode(eventChan <-chan *events.Event) error {
 			diagnostician.AddEvent(event)
 
 		case <-ticker.C:
+			if !textReport {
+				continue
+			}
+
 			diagnostician.Finish()
 
 			if hasPrintedReport {
@@ -113,30 +180,35 @@ func runNormalMode(eventChan <-chan *events.Event) error {
 			fmt.Println(report)
 			hasPrintedReport = true
 
-		case <-interruptChan():
+		case <-interrupt:
 			diagnostician.Finish()
 			if hasPrintedReport {
 				fmt.Print("\033[2J\033[H")
 			}
-			fmt.Println("=== Final Diagnostic Report ===")
-			fmt.Println()
-			report := diagnostician.GenerateReport()
-			fmt.Println(report)
-			return nil
+			if textReport {
+				fmt.Println("=== Final Diagnostic Report ===")
+				fmt.Println()
+			}
+			return printReport(diagnostician)
 		}
 	}
 }
 
-func runDiagnoseMode(eventChan <-chan *events.Event, durationStr string, cgroupPath string) error {
+func runDiagnoseMode(eventChan <-chan *events.Event, durationStr string) error {
 	duration, err := time.ParseDuration(durationStr)
 	if err != nil {
 		return fmt.Errorf("invalid duration: %w", err)
 	}
 
-	fmt.Printf("Running diagnose mode for %v...\n\n", duration)
+	if reportFormat == diagnose.ReportFormatText {
+		fmt.Printf("Running diagnose mode for %v...\n\n", duration)
+	} else {
+		fmt.Fprintf(os.Stderr, "Running diagnose mode for %v...\n", duration)
+	}
 
 	diagnostician := diagnose.NewDiagnostician()
 	timeout := time.After(duration)
+	interrupt := interruptChan()
 
 	for {
 		select {
@@ -144,18 +216,89 @@ func runDiagnoseMode(eventChan <-chan *events.Event, durationStr string, cgroupP
 			diagnostician.AddEvent(event)
 		case <-timeout:
 			diagnostician.Finish()
-			report := diagnostician.GenerateReport()
-			fmt.Println(report)
-			return nil
-		case <-interruptChan():
+			return printReport(diagnostician)
+		case <-interrupt:
 			diagnostician.Finish()
-			report := diagnostician.GenerateReport()
-			fmt.Println(report)
+			return printReport(diagnostician)
+		}
+	}
+}
+
+// printReport writes the diagnostician's report to stdout in the selected
+// --report-format
+func printReport(diagnostician *diagnose.Diagnostician) error {
+	report, err := diagnostician.BuildReport().Render(reportFormat)
+	if err != nil {
+		return err
+	}
+
+	if reportFormat == diagnose.ReportFormatText {
+		fmt.Println(report)
+	} else {
+		fmt.Print(report)
+	}
+	return nil
+}
+
+// runJSONMode writes every event to stdout as newline-delimited JSON until
+// interrupted or, if durationStr is set, until the duration elapses
+func runJSONMode(eventChan <-chan *events.Event, durationStr string) error {
+	var timeout <-chan time.Time
+	if durationStr != "" {
+		duration, err := time.ParseDuration(durationStr)
+		if err != nil {
+			return fmt.Errorf("invalid duration: %w", err)
+		}
+		timeout = time.After(duration)
+	}
+
+	fmt.Fprintln(os.Stderr, "Streaming events as JSON. Press Ctrl+C to stop.")
+
+	writer := events.NewJSONWriter(os.Stdout)
+	interrupt := interruptChan()
+
+	for {
+		select {
+		case event := <-eventChan:
+			if err := writer.Write(event); err != nil {
+				return fmt.Errorf("failed to write event: %w", err)
+			}
+		case <-timeout:
+			return nil
+		case <-interrupt:
 			return nil
 		}
 	}
 }
 
+// metricsQueueSize bounds the events waiting for the metrics exporter
+const metricsQueueSize = 4096
+
+// droppedMetricsEvents counts the events the metrics exporter missed
+var droppedMetricsEvents atomic.Uint64
+
+// teeEvents forwards every event from in to out, and to metrics when it has
+// room. Metrics are best effort, so a slow exporter never stalls the tracer
+// or the report; the events it misses are counted instead.
+func teeEvents(in <-chan *events.Event, out, metrics chan<- *events.Event) {
+	for e := range in {
+		select {
+		case metrics <- e:
+		default:
+			droppedMetricsEvents.Add(1)
+		}
+		out <- e
+	}
+	close(out)
+	close(metrics)
+}
+
+func reportDroppedMetricsEvents() {
+	if n := droppedMetricsEvents.Load(); n > 0 {
+		fmt.Fprintf(os.Stderr, "Note: %d events were not exported as metrics because the exporter fell behind\n", n)
+	}
+}
+
 func interruptChan() <-chan os.Signal {
 	sigChan := make(chan os.Signal, 1)
 	go func() {
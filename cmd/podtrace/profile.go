@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/podtrace/podtrace/internal/ebpf"
+	"github.com/podtrace/podtrace/internal/events"
+)
+
+var (
+	profileDuration  string
+	profileFrequency uint64
+	profilePprof     string
+	profileFolded    string
+)
+
+func newProfileCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "profile -n <namespace> <pod-name>",
+		Short:        "Sample a pod's on-CPU stacks and write a pprof profile and folded stacks",
+		Args:         cobra.ExactArgs(1),
+		RunE:         runProfile,
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "default", "Kubernetes namespace")
+	cmd.Flags().StringSliceVarP(&containerNames, "container", "c", nil, "Container(s) to profile (default: all containers in the pod)")
+	cmd.Flags().StringVar(&profileDuration, "duration", "30s", "How long to profile; Ctrl+C stops early")
+	cmd.Flags().Uint64Var(&profileFrequency, "frequency", ebpf.DefaultProfileFrequency, "Samples per second on each CPU")
+	cmd.Flags().StringVar(&profilePprof, "pprof", "podtrace.pb.gz", "pprof profile to write, for go tool pprof (empty to skip)")
+	cmd.Flags().StringVar(&profileFolded, "folded", "", "Folded stacks file to write, for flamegraph.pl")
+
+	return cmd
+}
+
+func runProfile(cmd *cobra.Command, args []string) error {
+	duration, err := time.ParseDuration(profileDuration)
+	if err != nil {
+		return fmt.Errorf("invalid duration: %w", err)
+	}
+	if profilePprof == "" && profileFolded == "" {
+		return fmt.Errorf("nothing to write: set --pprof or --folded")
+	}
+
+	eventChan := make(chan *events.Event, 100)
+	tracer, _, err := startTracer(args[0], eventChan)
+	if err != nil {
+		return err
+	}
+	defer tracer.Stop()
+
+	// events are not reported while profiling, but must be read so that the
+	// tracer does not block
+	go func() {
+		for range eventChan {
+		}
+	}()
+
+	if err := tracer.StartProfiling(profileFrequency); err != nil {
+		return fmt.Errorf("failed to start profiling: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Profiling at %d Hz for %s. Press Ctrl+C to stop early.\n", profileFrequency, duration)
+
+	select {
+	case <-time.After(duration):
+	case <-interruptChan():
+	}
+
+	prof, err := tracer.StopProfiling()
+	if err != nil {
+		return err
+	}
+
+	if profilePprof != "" {
+		if err := writeProfile(profilePprof, prof.WritePprof); err != nil {
+			return err
+		}
+	}
+	if profileFolded != "" {
+		if err := writeProfile(profileFolded, prof.WriteFolded); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Collected %d samples in %d stacks\n", prof.TotalSamples(), len(prof.Samples))
+	if profilePprof != "" {
+		fmt.Fprintf(os.Stderr, "  go tool pprof -http=:8080 %s\n", profilePprof)
+	}
+	if profileFolded != "" {
+		fmt.Fprintf(os.Stderr, "  flamegraph.pl %s > flamegraph.svg\n", profileFolded)
+	}
+	return nil
+}
+
+func writeProfile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return f.Close()
+}
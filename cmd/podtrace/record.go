@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/podtrace/podtrace/internal/capture"
+	"github.com/podtrace/podtrace/internal/events"
+	"github.com/podtrace/podtrace/internal/kubernetes"
+)
+
+var (
+	recordFile     string
+	recordDuration string
+)
+
+func newRecordCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "record -n <namespace> <pod-name> -f <file>",
+		Short:        "Record a pod's events to a capture file for offline replay",
+		Args:         cobra.ExactArgs(1),
+		RunE:         runRecord,
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "default", "Kubernetes namespace")
+	cmd.Flags().StringSliceVarP(&containerNames, "container", "c", nil, "Container(s) to trace (default: all containers in the pod)")
+	cmd.Flags().StringVarP(&recordFile, "file", "f", "", "Capture file to write")
+	cmd.Flags().StringVar(&recordDuration, "duration", "", "Stop recording after the specified duration (e.g., 30s, 5m); default is until Ctrl+C")
+	cmd.MarkFlagRequired("file")
+
+	return cmd
+}
+
+func runRecord(cmd *cobra.Command, args []string) error {
+	var timeout <-chan time.Time
+	if recordDuration != "" {
+		duration, err := time.ParseDuration(recordDuration)
+		if err != nil {
+			return fmt.Errorf("invalid duration: %w", err)
+		}
+		timeout = time.After(duration)
+	}
+
+	f, err := os.Create(recordFile)
+	if err != nil {
+		return fmt.Errorf("failed to create capture file: %w", err)
+	}
+	defer f.Close()
+
+	eventChan := make(chan *events.Event, 100)
+	startTime := time.Now()
+	tracer, podInfo, err := startTracer(args[0], eventChan)
+	if err != nil {
+		return err
+	}
+	defer tracer.Stop()
+
+	writer, err := capture.NewWriter(f, captureHeader(podInfo, startTime))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Recording to %s. Press Ctrl+C to stop.\n", recordFile)
+
+	interrupt := interruptChan()
+	for {
+		select {
+		case event := <-eventChan:
+			if err := writer.WriteEvent(event); err != nil {
+				return err
+			}
+		case <-timeout:
+			return finishRecording(writer, f)
+		case <-interrupt:
+			return finishRecording(writer, f)
+		}
+	}
+}
+
+func finishRecording(writer *capture.Writer, f *os.File) error {
+	if err := writer.Close(time.Now()); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to write capture file: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Recorded %d events to %s\n", writer.Events(), f.Name())
+	return nil
+}
+
+func captureHeader(podInfo *kubernetes.PodInfo, startTime time.Time) capture.Header {
+	hostname, _ := os.Hostname()
+	header := capture.Header{
+		PodName:   podInfo.PodName,
+		Namespace: podInfo.Namespace,
+		Hostname:  hostname,
+		StartTime: startTime,
+	}
+	for _, c := range podInfo.Containers {
+		header.Containers = append(header.Containers, capture.ContainerMetadata{
+			Name:        c.Name,
+			Kind:        string(c.Kind),
+			ContainerID: c.ContainerID,
+			CgroupPath:  c.CgroupPath,
+		})
+	}
+	return header
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/podtrace/podtrace/internal/capture"
+	"github.com/podtrace/podtrace/internal/diagnose"
+	"github.com/podtrace/podtrace/internal/events"
+	"github.com/podtrace/podtrace/internal/metricsexporter"
+)
+
+var (
+	replaySpeed   float64
+	replayMetrics bool
+)
+
+func newReplayCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "replay <file>",
+		Short:        "Replay a capture file through the diagnose report, JSON stream or metrics exporter",
+		Args:         cobra.ExactArgs(1),
+		RunE:         runReplay,
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVar(&reportFormat, "report-format", diagnose.ReportFormatText, "Diagnostic report format: text, json or yaml")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "text", "Output format: text (diagnostic report) or json (one event per line)")
+	cmd.Flags().Float64Var(&replaySpeed, "speed", 0, "Replay at this multiple of the recorded pace (e.g., 1 for real time); 0 replays as fast as possible")
+	cmd.Flags().BoolVar(&replayMetrics, "metrics", false, "Export replayed events as Prometheus metrics and keep serving until Ctrl+C")
+
+	return cmd
+}
+
+func runReplay(cmd *cobra.Command, args []string) error {
+	if err := validateFormats(); err != nil {
+		return err
+	}
+	if replaySpeed < 0 {
+		return fmt.Errorf("invalid speed %v (must be >= 0)", replaySpeed)
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to open capture file: %w", err)
+	}
+	defer f.Close()
+
+	reader, err := capture.NewReader(f)
+	if err != nil {
+		return err
+	}
+
+	header := reader.Header()
+	fmt.Fprintf(os.Stderr, "Replaying capture of pod %s/%s recorded at %s",
+		header.Namespace, header.PodName, header.StartTime.Format(time.RFC3339))
+	if header.Hostname != "" {
+		fmt.Fprintf(os.Stderr, " on %s", header.Hostname)
+	}
+	fmt.Fprintf(os.Stderr, "\n")
+	for _, c := range header.Containers {
+		fmt.Fprintf(os.Stderr, "  Container %s (%s): %s\n", c.Name, c.Kind, c.ContainerID)
+	}
+	fmt.Fprintf(os.Stderr, "\n")
+
+	if replayMetrics {
+		metricsexporter.StartServer()
+	}
+
+	var jsonWriter *events.JSONWriter
+	if outputFormat == "json" {
+		jsonWriter = events.NewJSONWriter(os.Stdout)
+	}
+
+	diagnostician := diagnose.NewDiagnosticianAt(header.StartTime)
+	var lastTimestamp uint64
+
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, capture.ErrTruncated) {
+			fmt.Fprintf(os.Stderr, "Warning: %v, replaying the events read so far\n", err)
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if replaySpeed > 0 && lastTimestamp != 0 && event.Timestamp > lastTimestamp {
+			time.Sleep(time.Duration(float64(event.Timestamp-lastTimestamp) / replaySpeed))
+		}
+		lastTimestamp = event.Timestamp
+
+		if replayMetrics {
+			metricsexporter.HandleEvent(event)
+		}
+
+		if jsonWriter != nil {
+			if err := jsonWriter.Write(event); err != nil {
+				return fmt.Errorf("failed to write event: %w", err)
+			}
+		} else {
+			diagnostician.AddEvent(event)
+		}
+	}
+
+	if jsonWriter == nil {
+		endTime := time.Unix(0, int64(lastTimestamp))
+		if footer := reader.Footer(); footer != nil {
+			endTime = footer.EndTime
+		}
+		diagnostician.FinishAt(endTime)
+
+		if err := printReport(diagnostician); err != nil {
+			return err
+		}
+	}
+
+	if replayMetrics {
+		fmt.Fprintln(os.Stderr, "Replay finished. Serving metrics until Ctrl+C.")
+		<-interruptChan()
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package capture
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/podtrace/podtrace/internal/events"
+)
+
+// magic identifies podtrace capture files
+const magic = "PODTRACE-CAPTURE"
+
+// Version is the capture format version written by this build. Readers accept
+// any version up to and including it.
+const Version uint16 = 1
+
+// ContainerMetadata describes one traced container at record time
+type ContainerMetadata struct {
+	Name        string
+	Kind        string
+	ContainerID string
+	CgroupPath  string
+}
+
+// Header is written once at the start of every capture
+type Header struct {
+	Version    uint16
+	PodName    string
+	Namespace  string
+	Containers []ContainerMetadata
+	Hostname   string
+	StartTime  time.Time
+}
+
+// Footer is written when a recording is closed cleanly
+type Footer struct {
+	EndTime time.Time
+	Events  int
+}
+
+// record is the unit of the gob stream following the header. Exactly one
+// field is set.
+type record struct {
+	Event  *events.Event
+	Footer *Footer
+}
+
+// Writer serializes an event stream into a gzip-compressed capture file
+type Writer struct {
+	gz     *gzip.Writer
+	buf    *bufio.Writer
+	enc    *gob.Encoder
+	events int
+}
+
+// NewWriter writes the file header and returns a Writer for the events
+func NewWriter(w io.Writer, header Header) (*Writer, error) {
+	buf := bufio.NewWriter(w)
+	if _, err := buf.WriteString(magic); err != nil {
+		return nil, fmt.Errorf("failed to write capture header: %w", err)
+	}
+
+	gz := gzip.NewWriter(buf)
+	enc := gob.NewEncoder(gz)
+
+	header.Version = Version
+	if err := enc.Encode(header); err != nil {
+		return nil, fmt.Errorf("failed to write capture header: %w", err)
+	}
+
+	return &Writer{gz: gz, buf: buf, enc: enc}, nil
+}
+
+// WriteEvent appends a single event to the capture
+func (w *Writer) WriteEvent(e *events.Event) error {
+	if err := w.enc.Encode(record{Event: e}); err != nil {
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+	w.events++
+	return nil
+}
+
+// Events returns the number of events written so far
+func (w *Writer) Events() int {
+	return w.events
+}
+
+// Close writes the footer and flushes the capture. It does not close the
+// underlying writer.
+func (w *Writer) Close(endTime time.Time) error {
+	if err := w.enc.Encode(record{Footer: &Footer{EndTime: endTime, Events: w.events}}); err != nil {
+		return fmt.Errorf("failed to write capture footer: %w", err)
+	}
+	if err := w.gz.Close(); err != nil {
+		return fmt.Errorf("failed to flush capture: %w", err)
+	}
+	return w.buf.Flush()
+}
+
+// Reader reads events back from a capture file
+type Reader struct {
+	dec    *gob.Decoder
+	header Header
+	footer *Footer
+}
+
+// NewReader validates the file header and returns a Reader positioned at the
+// first event
+func NewReader(r io.Reader) (*Reader, error) {
+	buf := bufio.NewReader(r)
+
+	prefix := make([]byte, len(magic))
+	if _, err := io.ReadFull(buf, prefix); err != nil || string(prefix) != magic {
+		return nil, fmt.Errorf("not a podtrace capture file")
+	}
+
+	gz, err := gzip.NewReader(buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open capture: %w", err)
+	}
+
+	dec := gob.NewDecoder(gz)
+	var header Header
+	if err := dec.Decode(&header); err != nil {
+		return nil, fmt.Errorf("failed to read capture header: %w", err)
+	}
+	if header.Version == 0 || header.Version > Version {
+		return nil, fmt.Errorf("unsupported capture version %d (this build reads up to %d)", header.Version, Version)
+	}
+
+	return &Reader{dec: dec, header: header}, nil
+}
+
+// Header returns the capture's header
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+// Footer returns the capture's footer once Next has returned io.EOF, or nil
+// if the recording was not closed cleanly
+func (r *Reader) Footer() *Footer {
+	return r.footer
+}
+
+// ErrTruncated is returned by Next when the capture ends without a footer
+var ErrTruncated = errors.New("capture file is truncated")
+
+// Next returns the next event, or io.EOF after the last one
+func (r *Reader) Next() (*events.Event, error) {
+	if r.footer != nil {
+		return nil, io.EOF
+	}
+
+	var rec record
+	if err := r.dec.Decode(&rec); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrTruncated
+		}
+		return nil, fmt.Errorf("failed to read event: %w", err)
+	}
+
+	if rec.Footer != nil {
+		r.footer = rec.Footer
+		return nil, io.EOF
+	}
+	if rec.Event == nil {
+		return nil, fmt.Errorf("failed to read event: empty record")
+	}
+
+	return rec.Event, nil
+}
@@ -0,0 +1,115 @@
+package capture
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/podtrace/podtrace/internal/events"
+)
+
+func TestCaptureRoundTrip(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	header := Header{
+		PodName:   "web-0",
+		Namespace: "prod",
+		Containers: []ContainerMetadata{
+			{Name: "app", Kind: "container", ContainerID: "abc", CgroupPath: "/sys/fs/cgroup/pod/abc"},
+		},
+		StartTime: start,
+	}
+
+	input := []*events.Event{
+		{Timestamp: uint64(start.UnixNano()), PID: 10, ProcessName: "app", Container: "app", Type: events.EventDNS, LatencyNS: 1500000, Target: "example.com"},
+		{Timestamp: uint64(start.Add(time.Second).UnixNano()), PID: 11, Type: events.EventConnect, Error: -111, Target: "10.0.0.1:00443"},
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, header)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	for _, e := range input {
+		if err := w.WriteEvent(e); err != nil {
+			t.Fatalf("WriteEvent: %v", err)
+		}
+	}
+	end := start.Add(5 * time.Second)
+	if err := w.Close(end); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	got := r.Header()
+	if got.Version != Version || got.PodName != "web-0" || got.Namespace != "prod" || len(got.Containers) != 1 {
+		t.Errorf("unexpected header: %+v", got)
+	}
+	if !got.StartTime.Equal(start) {
+		t.Errorf("start time = %v, expected %v", got.StartTime, start)
+	}
+
+	var output []*events.Event
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		output = append(output, e)
+	}
+
+	if len(output) != len(input) {
+		t.Fatalf("read %d events, expected %d", len(output), len(input))
+	}
+	for i := range input {
+		if *output[i] != *input[i] {
+			t.Errorf("event %d = %+v, expected %+v", i, *output[i], *input[i])
+		}
+	}
+
+	footer := r.Footer()
+	if footer == nil || !footer.EndTime.Equal(end) || footer.Events != 2 {
+		t.Errorf("unexpected footer: %+v", footer)
+	}
+}
+
+func TestCaptureTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, Header{PodName: "web-0"})
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	if err := w.WriteEvent(&events.Event{PID: 1}); err != nil {
+		t.Fatalf("WriteEvent: %v", err)
+	}
+	// Flush without a footer, as if the recorder was killed
+	w.gz.Flush()
+	w.buf.Flush()
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	if _, err := r.Next(); err != nil {
+		t.Fatalf("first Next: %v", err)
+	}
+	if _, err := r.Next(); !errors.Is(err, ErrTruncated) {
+		t.Errorf("expected ErrTruncated, got %v", err)
+	}
+	if r.Footer() != nil {
+		t.Error("truncated capture should have no footer")
+	}
+}
+
+func TestNewReaderRejectsOtherFiles(t *testing.T) {
+	if _, err := NewReader(bytes.NewReader([]byte("{\"type\":\"dns\"}\n"))); err == nil {
+		t.Error("expected error for non-capture input")
+	}
+}
@@ -0,0 +1,113 @@
+package diagnose
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/podtrace/podtrace/internal/events"
+)
+
+func analyzeInbound(acceptEvents, netstatSamples []*events.Event, duration time.Duration) *InboundStats {
+	stats := &InboundStats{
+		Accepts:   len(acceptEvents),
+		PerSecond: perSecond(len(acceptEvents), duration),
+	}
+
+	clients := make(map[string]int)
+	ports := make(map[string]int)
+	var waits []float64
+	for _, e := range acceptEvents {
+		host, _ := splitEndpoint(e.Target)
+		clients[host]++
+		if _, port := splitEndpoint(e.Details); port != "" {
+			ports[port]++
+		}
+		if e.LatencyNS > 0 {
+			waits = append(waits, float64(e.LatencyNS)/1e6)
+		}
+		if e.Accept != nil && e.Accept.Backlog >= stats.PeakBacklog {
+			stats.PeakBacklog = e.Accept.Backlog
+			stats.BacklogLimit = e.Accept.MaxBacklog
+		}
+	}
+	stats.QueuedAccepts = len(waits)
+	stats.QueueWait = latencyStatsMS(waits)
+	stats.TopClients = topTargets(clients)
+	stats.LocalPorts = topTargets(ports)
+
+	// the counters are cumulative per network namespace
+	first := make(map[uint64]*events.NetStats)
+	last := make(map[uint64]*events.NetStats)
+	for _, e := range netstatSamples {
+		if e.NetStat == nil {
+			continue
+		}
+		if _, ok := first[e.NetStat.Namespace]; !ok {
+			first[e.NetStat.Namespace] = e.NetStat
+		}
+		last[e.NetStat.Namespace] = e.NetStat
+	}
+	for ns, end := range last {
+		start := first[ns]
+		if end.ListenOverflows >= start.ListenOverflows {
+			stats.ListenOverflows += end.ListenOverflows - start.ListenOverflows
+		}
+		if end.ListenDrops >= start.ListenDrops {
+			stats.ListenDrops += end.ListenDrops - start.ListenDrops
+		}
+	}
+
+	if stats.Accepts == 0 && stats.ListenDrops == 0 && stats.ListenOverflows == 0 {
+		return nil
+	}
+	return stats
+}
+
+// splitEndpoint splits an "address:port" endpoint as formatted by the eBPF
+// programs, where IPv6 addresses are not bracketed
+func splitEndpoint(endpoint string) (host, port string) {
+	if i := strings.LastIndex(endpoint, ":"); i >= 0 {
+		return endpoint[:i], strings.TrimLeft(endpoint[i+1:], "0")
+	}
+	return endpoint, ""
+}
+
+// inboundIssues reports connection requests that listening sockets dropped,
+// usually because the application does not accept connections fast enough
+func inboundIssues(stats *InboundStats) []Issue {
+	if stats == nil || stats.ListenDrops+stats.ListenOverflows == 0 {
+		return nil
+	}
+
+	drops := stats.ListenDrops
+	if drops < stats.ListenOverflows {
+		drops = stats.ListenOverflows
+	}
+	message := fmt.Sprintf("Listen drops: %d connection requests dropped by listening sockets, %d of them because the accept queue was full",
+		drops, stats.ListenOverflows)
+	if stats.BacklogLimit > 0 {
+		message += fmt.Sprintf(" (peak backlog %d/%d)", stats.PeakBacklog, stats.BacklogLimit)
+	}
+	return []Issue{{Kind: "listen_drops", Message: message}}
+}
+
+func (s *InboundStats) text() string {
+	var report string
+	report += fmt.Sprintf("Inbound Connections:\n")
+	report += fmt.Sprintf("  Accepted: %d (%.1f/sec)\n", s.Accepts, s.PerSecond)
+	if s.QueuedAccepts > 0 {
+		report += fmt.Sprintf("  Accept queue wait: avg %.2fms, P50=%.2fms, P95=%.2fms, P99=%.2fms, max %.2fms\n",
+			s.QueueWait.AvgMS, s.QueueWait.P50MS, s.QueueWait.P95MS, s.QueueWait.P99MS, s.QueueWait.MaxMS)
+	}
+	if s.BacklogLimit > 0 {
+		report += fmt.Sprintf("  Peak backlog: %d of %d\n", s.PeakBacklog, s.BacklogLimit)
+	}
+	if s.ListenDrops > 0 || s.ListenOverflows > 0 {
+		report += fmt.Sprintf("  Listen drops: %d (%d accept queue overflows)\n", s.ListenDrops, s.ListenOverflows)
+	}
+	report += topTargetsText("Top clients", "connections", s.TopClients)
+	report += topTargetsText("Local ports", "connections", s.LocalPorts)
+	report += "\n"
+	return report
+}
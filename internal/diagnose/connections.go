@@ -0,0 +1,200 @@
+package diagnose
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/podtrace/podtrace/internal/events"
+)
+
+const (
+	// shortLivedConnection is the lifetime under which a connection counts
+	// towards connection churn
+	shortLivedConnection = time.Second
+	// minChurnConnections is how many short-lived connections are needed
+	// before the connection churn rule fires
+	minChurnConnections = 100
+	// churnPerSecond is the rate of short-lived connections reported as churn
+	churnPerSecond = 10.0
+)
+
+func analyzeTCPConnections(connEvents []*events.Event, duration time.Duration) *TCPConnectionStats {
+	type peerKey struct {
+		peer    string
+		inbound bool
+	}
+	type peerConns struct {
+		stats       *PeerConnections
+		durationsMS []float64
+	}
+
+	stats := &TCPConnectionStats{
+		Closed:    len(connEvents),
+		PerSecond: perSecond(len(connEvents), duration),
+	}
+
+	durations := make([]float64, 0, len(connEvents))
+	ends := make(map[string]int)
+	byPeer := make(map[peerKey]*peerConns)
+	for _, e := range connEvents {
+		durationMS := float64(e.LatencyNS) / 1e6
+		durations = append(durations, durationMS)
+		shortLived := e.Latency() < shortLivedConnection
+		if shortLived {
+			stats.ShortLived++
+		}
+
+		// inbound connections come from ephemeral ports, so their peer is
+		// the client's address alone
+		key := peerKey{peer: e.Target}
+		if e.Connection != nil && e.Connection.Passive {
+			key = peerKey{inbound: true}
+			key.peer, _ = splitEndpoint(e.Target)
+		}
+		p, ok := byPeer[key]
+		if !ok {
+			direction := "outbound"
+			if key.inbound {
+				direction = "inbound"
+			}
+			p = &peerConns{stats: &PeerConnections{Peer: key.peer, Direction: direction}}
+			byPeer[key] = p
+		}
+		p.stats.Connections++
+		p.durationsMS = append(p.durationsMS, durationMS)
+		if shortLived {
+			p.stats.ShortLived++
+		}
+		if key.inbound {
+			stats.Inbound++
+		} else {
+			stats.Outbound++
+		}
+
+		c := e.Connection
+		if c == nil {
+			continue
+		}
+		stats.BytesSent += c.BytesSent
+		stats.BytesReceived += c.BytesReceived
+		p.stats.BytesSent += c.BytesSent
+		p.stats.BytesReceived += c.BytesReceived
+		switch c.ClosedBy {
+		case "local":
+			stats.ClosedLocally++
+		case "remote":
+			stats.ClosedRemotely++
+		}
+		ends[c.End]++
+		if c.End == "reset_sent" || c.End == "reset_received" {
+			p.stats.Resets++
+		}
+	}
+	stats.Duration = latencyStatsMS(durations)
+	stats.ShortLivedPerSecond = perSecond(stats.ShortLived, duration)
+	stats.Ends = topTargets(ends)
+
+	peers := make([]PeerConnections, 0, len(byPeer))
+	for _, p := range byPeer {
+		latency := latencyStatsMS(p.durationsMS)
+		p.stats.AvgDurationMS = latency.AvgMS
+		p.stats.MaxDurationMS = latency.MaxMS
+		peers = append(peers, *p.stats)
+	}
+	stats.ByBytes = topPeers(peers, func(a, b PeerConnections) bool {
+		return a.BytesSent+a.BytesReceived > b.BytesSent+b.BytesReceived
+	})
+	stats.ByDuration = topPeers(peers, func(a, b PeerConnections) bool {
+		return a.MaxDurationMS > b.MaxDurationMS
+	})
+	var churning []PeerConnections
+	for _, p := range peers {
+		if p.ShortLived > 0 {
+			churning = append(churning, p)
+		}
+	}
+	stats.Churn = topPeers(churning, func(a, b PeerConnections) bool {
+		return a.ShortLived > b.ShortLived
+	})
+	return stats
+}
+
+// topPeers returns the first maxTopEntries peers in the given order, breaking
+// ties by connection count and then by name
+func topPeers(peers []PeerConnections, less func(a, b PeerConnections) bool) []PeerConnections {
+	sorted := append([]PeerConnections(nil), peers...)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if less(a, b) != less(b, a) {
+			return less(a, b)
+		}
+		if a.Connections != b.Connections {
+			return a.Connections > b.Connections
+		}
+		return a.Peer < b.Peer
+	})
+	if len(sorted) > maxTopEntries {
+		sorted = sorted[:maxTopEntries]
+	}
+	return sorted
+}
+
+// tcpConnectionIssues reports a high rate of short-lived connections, which
+// usually means clients do not reuse connections
+func tcpConnectionIssues(stats *TCPConnectionStats) []Issue {
+	if stats == nil || stats.ShortLived < minChurnConnections || stats.ShortLivedPerSecond < churnPerSecond {
+		return nil
+	}
+
+	message := fmt.Sprintf("Connection churn: %d connections (%.1f/sec) lived less than %v",
+		stats.ShortLived, stats.ShortLivedPerSecond, shortLivedConnection)
+	if len(stats.Churn) > 0 {
+		top := stats.Churn[0]
+		direction := "to"
+		if top.Direction == "inbound" {
+			direction = "from"
+		}
+		message += fmt.Sprintf(", %d of them %s %s; consider connection pooling or keep-alive",
+			top.ShortLived, direction, top.Peer)
+	}
+	return []Issue{{Kind: "connection_churn", Message: message}}
+}
+
+func (s *TCPConnectionStats) text() string {
+	var report string
+	report += fmt.Sprintf("Connections:\n")
+	report += fmt.Sprintf("  Closed: %d (%.1f/sec), %d outbound, %d inbound\n", s.Closed, s.PerSecond, s.Outbound, s.Inbound)
+	report += fmt.Sprintf("  Duration: P50=%.2fms, P95=%.2fms, P99=%.2fms, max %.2fms\n",
+		s.Duration.P50MS, s.Duration.P95MS, s.Duration.P99MS, s.Duration.MaxMS)
+	report += fmt.Sprintf("  Transferred: sent %s, received %s\n", formatBytes(float64(s.BytesSent)), formatBytes(float64(s.BytesReceived)))
+	report += fmt.Sprintf("  Closed first by: local %d, remote %d\n", s.ClosedLocally, s.ClosedRemotely)
+	if len(s.Ends) > 0 {
+		report += fmt.Sprintf("  Endings: %s\n", targetList(s.Ends))
+	}
+	report += fmt.Sprintf("  Short-lived (<%v): %d (%.1f/sec)\n", shortLivedConnection, s.ShortLived, s.ShortLivedPerSecond)
+	report += peerTableText("Top peers by bytes", s.ByBytes)
+	report += peerTableText("Longest connections", s.ByDuration)
+	report += peerTableText("Connection churn", s.Churn)
+	report += "\n"
+	return report
+}
+
+func peerTableText(header string, peers []PeerConnections) string {
+	if len(peers) == 0 {
+		return ""
+	}
+
+	report := fmt.Sprintf("  %s:\n", header)
+	report += fmt.Sprintf("    %-40s %-8s %6s %6s %10s %10s %12s %12s %6s\n",
+		"peer", "dir", "conns", "short", "sent", "received", "avg", "max", "resets")
+	for i, p := range peers {
+		if i >= 5 {
+			break
+		}
+		report += fmt.Sprintf("    %-40s %-8s %6d %6d %10s %10s %10.2fms %10.2fms %6d\n",
+			p.Peer, p.Direction, p.Connections, p.ShortLived, formatBytes(float64(p.BytesSent)),
+			formatBytes(float64(p.BytesReceived)), p.AvgDurationMS, p.MaxDurationMS, p.Resets)
+	}
+	return report
+}
@@ -5,99 +5,157 @@ import (
 	"sort"
 	"strings"
 	"time"
+
+	"github.com/podtrace/podtrace/internal/events"
 )
 
 func (d *Diagnostician) generateCPUUsageReport(duration time.Duration) string {
-
-	pidActivity := d.analyzeProcessActivity()
-	if len(pidActivity) == 0 {
-		return d.generateCPUUsageFromProc(duration)
+	usage := d.analyzeCPUUsage(duration)
+	if usage == nil {
+		return cpuUsageUnavailableText()
 	}
+	return usage.text(duration)
+}
 
-	totalActivity := 0
-	for _, info := range pidActivity {
-		totalActivity += info.count
+// analyzeCPUUsage attributes on-CPU time to processes and containers, or
+// returns nil if no CPU samples were recorded
+func (d *Diagnostician) analyzeCPUUsage(duration time.Duration) *CPUUsage {
+	cpuEvents := d.filterEvents(events.EventCPUTime)
+	containers := analyzeContainerCPU(d.filterEvents(events.EventCgroupCPU))
+	if len(cpuEvents) == 0 && len(containers) == 0 {
+		return nil
 	}
 
-	if totalActivity == 0 {
-		return d.generateCPUUsageFromProc(duration)
+	type processTime struct {
+		name    string
+		threads map[uint32]bool
+		ns      uint64
+	}
+	byPID := make(map[uint32]*processTime)
+	for _, e := range cpuEvents {
+		proc, ok := byPID[e.PID]
+		if !ok {
+			proc = &processTime{threads: make(map[uint32]bool)}
+			byPID[e.PID] = proc
+		}
+		proc.threads[e.TID] = true
+		proc.ns += e.LatencyNS
+		if proc.name == "" {
+			proc.name = e.ProcessName
+		}
 	}
 
-	var report string
-	report += fmt.Sprintf("CPU Usage by Process:\n")
-
-	totalDurationNS := uint64(duration.Nanoseconds())
-	totalCPUPercent := 0.0
+	usage := &CPUUsage{Containers: containers}
+	durationSec := duration.Seconds()
 
-	sort.Slice(pidActivity, func(i, j int) bool {
-		return pidActivity[i].count > pidActivity[j].count
-	})
+	var podProcesses []ProcessCPU
+	var kernelProcesses []ProcessCPU
+	for pid, proc := range byPID {
+		name := proc.name
+		if name == "" {
+			name = getProcessName(pid)
+		}
+		if name == "" {
+			name = "unknown"
+		}
 
-	var podProcesses []pidInfo
-	var kernelProcesses []pidInfo
+		cpu := ProcessCPU{
+			PID:        pid,
+			Name:       name,
+			Threads:    len(proc.threads),
+			CPUSeconds: float64(proc.ns) / 1e9,
+		}
+		if durationSec > 0 {
+			cpu.CPUPercent = cpu.CPUSeconds / durationSec * 100
+		}
+		usage.TotalSeconds += cpu.CPUSeconds
 
-	for _, info := range pidActivity {
-		if isKernelThread(info.pid, info.name) {
-			kernelProcesses = append(kernelProcesses, info)
+		if isKernelThread(pid, name) {
+			kernelProcesses = append(kernelProcesses, cpu)
 		} else {
-			podProcesses = append(podProcesses, info)
+			podProcesses = append(podProcesses, cpu)
 		}
 	}
 
-	podCPUPercent := 0.0
-	if len(podProcesses) > 0 {
-		report += fmt.Sprintf("  Pod Processes:\n")
-		for i, info := range podProcesses {
-			if i >= 10 {
-				break
-			}
-
-			cpuTimeNS := uint64(float64(totalDurationNS) * info.percentage / 100.0)
-			cpuPercent := info.percentage
-			cpuTimeSec := float64(cpuTimeNS) / 1e9
-			durationSec := duration.Seconds()
-
-			report += fmt.Sprintf("    PID %d (%s):      %5.1f%% CPU (%.2fs / %.2fs)\n",
-				info.pid, info.name, cpuPercent, cpuTimeSec, durationSec)
+	byCPUTime := func(procs []ProcessCPU) {
+		sort.Slice(procs, func(i, j int) bool {
+			return procs[i].CPUSeconds > procs[j].CPUSeconds
+		})
+	}
+	byCPUTime(podProcesses)
+	byCPUTime(kernelProcesses)
 
-			podCPUPercent += cpuPercent
-		}
-		report += "\n"
+	if len(podProcesses) > 10 {
+		podProcesses = podProcesses[:10]
+	}
+	if len(kernelProcesses) > 5 {
+		usage.KernelProcessesOmitted = len(kernelProcesses) - 5
+		kernelProcesses = kernelProcesses[:5]
 	}
+	usage.PodProcesses = podProcesses
+	usage.KernelProcesses = kernelProcesses
 
-	if len(kernelProcesses) > 0 {
-		kernelCPUPercent := 0.0
-		report += fmt.Sprintf("  System/Kernel Processes:\n")
-		for i, info := range kernelProcesses {
-			if i >= 5 {
-				break
-			}
+	if durationSec > 0 {
+		usage.TotalPercent = usage.TotalSeconds / durationSec * 100
+	}
 
-			cpuTimeNS := uint64(float64(totalDurationNS) * info.percentage / 100.0)
-			cpuPercent := info.percentage
-			cpuTimeSec := float64(cpuTimeNS) / 1e9
-			durationSec := duration.Seconds()
+	return usage
+}
 
-			report += fmt.Sprintf("    PID %d (%s):      %5.1f%% CPU (%.2fs / %.2fs)\n",
-				info.pid, info.name, cpuPercent, cpuTimeSec, durationSec)
+// analyzeContainerCPU turns each container's first and last cpu.stat samples
+// into usage and throttling over the period between them
+func analyzeContainerCPU(samples []*events.Event) []ContainerCPU {
+	first := make(map[string]*events.Event)
+	last := make(map[string]*events.Event)
+	for _, e := range samples {
+		if e.CgroupCPU == nil {
+			continue
+		}
+		if _, ok := first[e.Container]; !ok {
+			first[e.Container] = e
+		}
+		last[e.Container] = e
+	}
 
-			kernelCPUPercent += cpuPercent
+	var containers []ContainerCPU
+	for name, start := range first {
+		end := last[name]
+		if end == start || end.Timestamp <= start.Timestamp {
+			continue
+		}
+		from, to := start.CgroupCPU, end.CgroupCPU
+		windowSec := float64(end.Timestamp-start.Timestamp) / 1e9
+
+		cpu := ContainerCPU{
+			Container:        name,
+			CPUSeconds:       float64(counterDelta(from.UsageUSec, to.UsageUSec)) / 1e6,
+			Periods:          counterDelta(from.NrPeriods, to.NrPeriods),
+			ThrottledPeriods: counterDelta(from.NrThrottled, to.NrThrottled),
+			ThrottledSeconds: float64(counterDelta(from.ThrottledUSec, to.ThrottledUSec)) / 1e6,
 		}
-		if len(kernelProcesses) > 5 {
-			report += fmt.Sprintf("    ... and %d more system processes\n", len(kernelProcesses)-5)
+		if cpu.Periods > 0 {
+			cpu.ThrottledPercent = float64(cpu.ThrottledPeriods) / float64(cpu.Periods) * 100
 		}
-		report += "\n"
-		totalCPUPercent = podCPUPercent + kernelCPUPercent
-	} else {
-		totalCPUPercent = podCPUPercent
+		if to.QuotaUSec > 0 && to.PeriodUSec > 0 {
+			cpu.LimitCores = float64(to.QuotaUSec) / float64(to.PeriodUSec)
+			cpu.LimitUtilizationPercent = cpu.CPUSeconds / (cpu.LimitCores * windowSec) * 100
+		}
+		containers = append(containers, cpu)
 	}
 
-	report += fmt.Sprintf("\n  Total CPU usage: %.1f%% (%.2fs / %.2fs)\n",
-		totalCPUPercent, totalCPUPercent*duration.Seconds()/100.0, duration.Seconds())
-	report += fmt.Sprintf("  Idle time: %.1f%% (%.2fs / %.2fs)\n\n",
-		100.0-totalCPUPercent, (100.0-totalCPUPercent)*duration.Seconds()/100.0, duration.Seconds())
+	sort.Slice(containers, func(i, j int) bool {
+		return containers[i].Container < containers[j].Container
+	})
+	return containers
+}
 
-	return report
+// counterDelta returns how much a cumulative counter grew, or 0 if it was
+// reset in between
+func counterDelta(from, to uint64) uint64 {
+	if to < from {
+		return 0
+	}
+	return to - from
 }
 
 func isKernelThread(pid uint32, name string) bool {
@@ -133,7 +191,7 @@ func isKernelThread(pid uint32, name string) bool {
 	return false
 }
 
-func (d *Diagnostician) generateCPUUsageFromProc(duration time.Duration) string {
+func cpuUsageUnavailableText() string {
 	var report string
 	report += fmt.Sprintf("CPU Usage by Process:\n")
 	report += fmt.Sprintf("  No CPU events collected during diagnostic period.\n")
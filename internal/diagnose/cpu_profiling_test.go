@@ -21,15 +21,19 @@ func TestGenerateCPUUsageReport(t *testing.T) {
 
 	d.AddEvent(&events.Event{
 		PID:         1234,
+		TID:         1234,
 		ProcessName: "test-process",
-		Type:        events.EventDNS,
+		Type:        events.EventCPUTime,
+		LatencyNS:   500e6,
 		Timestamp:   uint64(time.Now().UnixNano()),
 	})
 
 	d.AddEvent(&events.Event{
 		PID:         1234,
+		TID:         1235,
 		ProcessName: "test-process",
-		Type:        events.EventConnect,
+		Type:        events.EventCPUTime,
+		LatencyNS:   500e6,
 		Timestamp:   uint64(time.Now().UnixNano()),
 	})
 
@@ -47,6 +51,12 @@ func TestGenerateCPUUsageReport(t *testing.T) {
 	if !contains(report, "Pod Processes") {
 		t.Error("Report should contain 'Pod Processes' section")
 	}
+	if !contains(report, "PID 1234 (test-process):       10.0% CPU (1.00s / 10.00s, 2 threads)") {
+		t.Errorf("Report should attribute on-CPU time to test-process:\n%s", report)
+	}
+	if contains(report, "another-process") {
+		t.Error("Processes without CPU samples should not be listed")
+	}
 }
 
 func TestIsKernelThread(t *testing.T) {
@@ -75,13 +85,13 @@ func TestIsKernelThread(t *testing.T) {
 	}
 }
 
-func TestGenerateCPUUsageFromProc(t *testing.T) {
+func TestCPUUsageReportWithoutSamples(t *testing.T) {
 	d := NewDiagnostician()
 	duration := 10 * time.Second
 
-	report := d.generateCPUUsageFromProc(duration)
+	report := d.generateCPUUsageReport(duration)
 	if report == "" {
-		t.Error("generateCPUUsageFromProc should return a report")
+		t.Error("generateCPUUsageReport should return a report")
 	}
 	if !contains(report, "CPU Usage by Process") {
 		t.Error("Report should contain 'CPU Usage by Process'")
@@ -98,14 +108,16 @@ func TestCPUUsageReportWithKernelThreads(t *testing.T) {
 	d.AddEvent(&events.Event{
 		PID:         1234,
 		ProcessName: "nginx",
-		Type:        events.EventDNS,
+		Type:        events.EventCPUTime,
+		LatencyNS:   1e9,
 		Timestamp:   uint64(time.Now().UnixNano()),
 	})
 
 	d.AddEvent(&events.Event{
 		PID:         10,
 		ProcessName: "kworker/0:0",
-		Type:        events.EventSchedSwitch,
+		Type:        events.EventCPUTime,
+		LatencyNS:   1e6,
 		Timestamp:   uint64(time.Now().UnixNano()),
 	})
 
@@ -113,7 +125,39 @@ func TestCPUUsageReportWithKernelThreads(t *testing.T) {
 	if !contains(report, "Pod Processes") {
 		t.Error("Report should have Pod Processes section")
 	}
-	_ = report
+	if !contains(report, "System/Kernel Processes") {
+		t.Error("Report should have System/Kernel Processes section")
+	}
+}
+
+func TestContainerCPUThrottling(t *testing.T) {
+	d := NewDiagnostician()
+	start := uint64(time.Now().UnixNano())
+
+	d.AddEvent(&events.Event{
+		Type:      events.EventCgroupCPU,
+		Container: "app",
+		Timestamp: start,
+		CgroupCPU: &events.CgroupCPU{UsageUSec: 1000000, NrPeriods: 100, NrThrottled: 10, ThrottledUSec: 50000, QuotaUSec: 50000, PeriodUSec: 100000},
+	})
+	d.AddEvent(&events.Event{
+		Type:      events.EventCgroupCPU,
+		Container: "app",
+		Timestamp: start + 10e9,
+		CgroupCPU: &events.CgroupCPU{UsageUSec: 5000000, NrPeriods: 200, NrThrottled: 60, ThrottledUSec: 2050000, QuotaUSec: 50000, PeriodUSec: 100000},
+	})
+
+	usage := d.analyzeCPUUsage(10 * time.Second)
+	if usage == nil || len(usage.Containers) != 1 {
+		t.Fatalf("expected one container, got %+v", usage)
+	}
+	c := usage.Containers[0]
+	if c.CPUSeconds != 4 || c.LimitCores != 0.5 || c.LimitUtilizationPercent != 80 {
+		t.Errorf("usage = %+v, expected 4s CPU at 80%% of a 0.5 core limit", c)
+	}
+	if c.Periods != 100 || c.ThrottledPeriods != 50 || c.ThrottledPercent != 50 || c.ThrottledSeconds != 2 {
+		t.Errorf("throttling = %+v, expected 50/100 periods and 2s", c)
+	}
 }
 
 func contains(s, substr string) bool {
@@ -11,9 +11,13 @@ import (
 	"github.com/podtrace/podtrace/internal/events"
 )
 
+// maxTopEntries caps the top-N lists carried in a Report
+const maxTopEntries = 10
+
 // Diagnostician collects and analyzes events
 type Diagnostician struct {
 	events    []*events.Event
+	samples   []*events.Event
 	startTime time.Time
 	endTime   time.Time
 }
@@ -25,7 +29,22 @@ func NewDiagnostician() *Diagnostician {
 	}
 }
 
+// NewDiagnosticianAt creates a Diagnostician whose collection period starts at
+// the given time, for analyzing previously recorded events
+func NewDiagnosticianAt(startTime time.Time) *Diagnostician {
+	return &Diagnostician{
+		events:    make([]*events.Event, 0),
+		startTime: startTime,
+	}
+}
+
+// AddEvent records an event. Periodic samples are kept apart from traced
+// operations so they do not skew event counts, the timeline or bursts.
 func (d *Diagnostician) AddEvent(event *events.Event) {
+	if event.Type.IsSample() {
+		d.samples = append(d.samples, event)
+		return
+	}
 	d.events = append(d.events, event)
 }
 
@@ -33,175 +52,137 @@ func (d *Diagnostician) Finish() {
 	d.endTime = time.Now()
 }
 
+// FinishAt ends the collection period at the given time
+func (d *Diagnostician) FinishAt(endTime time.Time) {
+	d.endTime = endTime
+}
+
 // Generate the diagnostic report
 func (d *Diagnostician) GenerateReport() string {
-	if len(d.events) == 0 {
-		return "No events collected during the diagnostic period.\n"
-	}
+	return d.BuildReport().Text()
+}
 
+// BuildReport analyzes the collected events and returns the structured report
+func (d *Diagnostician) BuildReport() *Report {
 	duration := d.endTime.Sub(d.startTime)
-	eventsPerSec := float64(len(d.events)) / duration.Seconds()
-
-	var report string
-	report += fmt.Sprintf("=== Diagnostic Report (collected over %v) ===\n\n", duration)
-	report += fmt.Sprintf("Summary:\n")
-	report += fmt.Sprintf("  Total events: %d\n", len(d.events))
-	report += fmt.Sprintf("  Events per second: %.1f\n", eventsPerSec)
-	report += fmt.Sprintf("  Collection period: %v to %v\n\n", d.startTime.Format("15:04:05"), d.endTime.Format("15:04:05"))
-
-	// DNS statistics
-	dnsEvents := d.filterEvents(events.EventDNS)
-	if len(dnsEvents) > 0 {
-
-		avgLatency, maxLatency, errors, p50, p95, p99, topTargets := d.analyzeDNS(dnsEvents)
-		report += fmt.Sprintf("DNS Statistics:\n")
-		report += fmt.Sprintf("  Total lookups: %d (%.1f/sec)\n", len(dnsEvents), float64(len(dnsEvents))/duration.Seconds())
-		report += fmt.Sprintf("  Average latency: %.2fms\n", avgLatency)
-		report += fmt.Sprintf("  Max latency: %.2fms\n", maxLatency)
-		report += fmt.Sprintf("  Percentiles: P50=%.2fms, P95=%.2fms, P99=%.2fms\n", p50, p95, p99)
-		report += fmt.Sprintf("  Errors: %d (%.1f%%)\n", errors, float64(errors)*100/float64(len(dnsEvents)))
-		if len(topTargets) > 0 {
-			report += fmt.Sprintf("  Top targets:\n")
-			for i, target := range topTargets {
-				if i >= 5 {
-					break
-				}
-				report += fmt.Sprintf("    - %s (%d lookups)\n", target.target, target.count)
-			}
-		}
-		report += "\n"
+	report := &Report{
+		StartTime:       d.startTime,
+		EndTime:         d.endTime,
+		DurationSeconds: duration.Seconds(),
+		Summary: Summary{
+			TotalEvents:     len(d.events),
+			EventsPerSecond: perSecond(len(d.events), duration),
+			TotalSamples:    len(d.samples),
+		},
+	}
+
+	if dnsEvents := d.filterEvents(events.EventDNS); len(dnsEvents) > 0 {
+		report.DNS = d.analyzeDNS(dnsEvents, duration)
+	}
+	if queryEvents := d.filterEvents(events.EventDNSQuery); len(queryEvents) > 0 {
+		report.DNSQueries = d.analyzeDNS(queryEvents, duration)
 	}
 
-	// TCP RTT statistics
 	tcpSendEvents := d.filterEvents(events.EventTCPSend)
 	tcpRecvEvents := d.filterEvents(events.EventTCPRecv)
 	if len(tcpSendEvents) > 0 || len(tcpRecvEvents) > 0 {
-		report += fmt.Sprintf("TCP Statistics:\n")
-		report += fmt.Sprintf("  Send operations: %d (%.1f/sec)\n", len(tcpSendEvents), float64(len(tcpSendEvents))/duration.Seconds())
-		report += fmt.Sprintf("  Receive operations: %d (%.1f/sec)\n", len(tcpRecvEvents), float64(len(tcpRecvEvents))/duration.Seconds())
-
-		allTCP := append(tcpSendEvents, tcpRecvEvents...)
-		if len(allTCP) > 0 {
-			avgRTT, maxRTT, spikes, p50, p95, p99, errors := d.analyzeTCP(allTCP)
-			report += fmt.Sprintf("  Average RTT: %.2fms\n", avgRTT)
-			report += fmt.Sprintf("  Max RTT: %.2fms\n", maxRTT)
-			report += fmt.Sprintf("  Percentiles: P50=%.2fms, P95=%.2fms, P99=%.2fms\n", p50, p95, p99)
-			report += fmt.Sprintf("  RTT spikes (>100ms): %d\n", spikes)
-			report += fmt.Sprintf("  Errors: %d (%.1f%%)\n", errors, float64(errors)*100/float64(len(allTCP)))
-		}
-		report += "\n"
+		report.TCP = d.analyzeTCP(tcpSendEvents, tcpRecvEvents, duration)
 	}
-
-	// Connection statistics
-	connectEvents := d.filterEvents(events.EventConnect)
-	if len(connectEvents) > 0 {
-		avgLatency, maxLatency, errors, p50, p95, p99, topTargets, errorBreakdown := d.analyzeConnections(connectEvents)
-		report += fmt.Sprintf("Connection Statistics:\n")
-		report += fmt.Sprintf("  Total connections: %d (%.1f/sec)\n", len(connectEvents), float64(len(connectEvents))/duration.Seconds())
-		report += fmt.Sprintf("  Average latency: %.2fms\n", avgLatency)
-		report += fmt.Sprintf("  Max latency: %.2fms\n", maxLatency)
-		report += fmt.Sprintf("  Percentiles: P50=%.2fms, P95=%.2fms, P99=%.2fms\n", p50, p95, p99)
-		report += fmt.Sprintf("  Failed connections: %d (%.1f%%)\n", errors, float64(errors)*100/float64(len(connectEvents)))
-		if len(errorBreakdown) > 0 {
-			report += fmt.Sprintf("  Error breakdown:\n")
-			for errCode, count := range errorBreakdown {
-				report += fmt.Sprintf("    - Error %d: %d occurrences\n", errCode, count)
-			}
+	if rttEvents := d.filterEvents(events.EventTCPRTT); len(rttEvents) > 0 {
+		if report.TCP == nil {
+			report.TCP = &TCPStats{}
 		}
-		if len(topTargets) > 0 {
-			report += fmt.Sprintf("  Top connection targets:\n")
-			for i, target := range topTargets {
-				if i >= 5 {
-					break
-				}
-				report += fmt.Sprintf("    - %s (%d connections)\n", target.target, target.count)
-			}
+		report.TCP.addRTT(rttEvents)
+	}
+	if report.TCP != nil {
+		report.TCP.addPeers(append(append([]*events.Event{}, tcpSendEvents...), tcpRecvEvents...), d.filterEvents(events.EventTCPRTT))
+	}
+	if endpoints := d.analyzeTCPEndpoints(duration); len(endpoints) > 0 {
+		if report.TCP == nil {
+			report.TCP = &TCPStats{}
 		}
-		report += "\n"
+		report.TCP.addEndpoints(endpoints, duration)
+	}
+
+	if connectEvents := d.filterEvents(events.EventConnect); len(connectEvents) > 0 {
+		report.Connections = d.analyzeConnections(connectEvents, duration)
+		pattern := d.analyzeConnectionPattern(connectEvents, duration)
+		report.ConnectionPattern = &pattern
+	}
+
+	report.Inbound = analyzeInbound(d.filterEvents(events.EventAccept), d.filterEvents(events.EventNetStat), duration)
+
+	if connEvents := d.filterEvents(events.EventTCPConnection); len(connEvents) > 0 {
+		report.TCPConnections = analyzeTCPConnections(connEvents, duration)
+	}
+
+	udpSendEvents := d.filterEvents(events.EventUDPSend)
+	udpRecvEvents := d.filterEvents(events.EventUDPRecv)
+	udpDropEvents := d.filterEvents(events.EventUDPDrop)
+	if len(udpSendEvents) > 0 || len(udpRecvEvents) > 0 || len(udpDropEvents) > 0 {
+		report.UDP = analyzeUDP(udpSendEvents, udpRecvEvents, udpDropEvents, duration)
 	}
 
-	// File system statistics
 	writeEvents := d.filterEvents(events.EventWrite)
 	readEvents := d.filterEvents(events.EventRead)
 	fsyncEvents := d.filterEvents(events.EventFsync)
 	if len(writeEvents) > 0 || len(readEvents) > 0 || len(fsyncEvents) > 0 {
-		report += fmt.Sprintf("File System Statistics:\n")
-		report += fmt.Sprintf("  Write operations: %d (%.1f/sec)\n", len(writeEvents), float64(len(writeEvents))/duration.Seconds())
-		report += fmt.Sprintf("  Read operations: %d (%.1f/sec)\n", len(readEvents), float64(len(readEvents))/duration.Seconds())
-		report += fmt.Sprintf("  Fsync operations: %d (%.1f/sec)\n", len(fsyncEvents), float64(len(fsyncEvents))/duration.Seconds())
-
-		allFS := append(append(writeEvents, readEvents...), fsyncEvents...)
-		if len(allFS) > 0 {
-			avgLatency, maxLatency, slowOps, p50, p95, p99 := d.analyzeFS(allFS)
-			report += fmt.Sprintf("  Average latency: %.2fms\n", avgLatency)
-			report += fmt.Sprintf("  Max latency: %.2fms\n", maxLatency)
-			report += fmt.Sprintf("  Percentiles: P50=%.2fms, P95=%.2fms, P99=%.2fms\n", p50, p95, p99)
-			report += fmt.Sprintf("  Slow operations (>10ms): %d\n", slowOps)
-
-			// Top files by operation count
-			fileMap := make(map[string]int)
-			for _, e := range allFS {
-				if e.Target != "" && e.Target != "?" && e.Target != "unknown" && e.Target != "file" {
-					fileMap[e.Target]++
-				}
-			}
-			if len(fileMap) > 0 {
-				type fileCount struct {
-					file  string
-					count int
-				}
-				var fileCounts []fileCount
-				for file, count := range fileMap {
-					fileCounts = append(fileCounts, fileCount{file: file, count: count})
-				}
-				sort.Slice(fileCounts, func(i, j int) bool {
-					return fileCounts[i].count > fileCounts[j].count
-				})
-				report += fmt.Sprintf("  Top accessed files:\n")
-				for i, fc := range fileCounts {
-					if i >= 5 {
-						break
-					}
-					report += fmt.Sprintf("    - %s (%d operations)\n", fc.file, fc.count)
-				}
-			}
-		}
-		report += "\n"
+		report.FileSystem = d.analyzeFS(writeEvents, readEvents, fsyncEvents, duration)
 	}
 
-	// CPU statistics
-	schedEvents := d.filterEvents(events.EventSchedSwitch)
-	if len(schedEvents) > 0 {
-		avgBlock, maxBlock, p50, p95, p99 := d.analyzeCPU(schedEvents)
-		report += fmt.Sprintf("CPU Statistics:\n")
-		report += fmt.Sprintf("  Thread switches: %d (%.1f/sec)\n", len(schedEvents), float64(len(schedEvents))/duration.Seconds())
-		report += fmt.Sprintf("  Average block time: %.2fms\n", avgBlock)
-		report += fmt.Sprintf("  Max block time: %.2fms\n", maxBlock)
-		report += fmt.Sprintf("  Percentiles: P50=%.2fms, P95=%.2fms, P99=%.2fms\n", p50, p95, p99)
-		report += "\n"
+	if schedEvents := d.filterEvents(events.EventSchedSwitch); len(schedEvents) > 0 {
+		report.CPU = d.analyzeCPU(schedEvents, duration)
 	}
 
-	// CPU Usage by Process
-	report += d.generateCPUUsageReport(duration)
+	if runqEvents := d.filterEvents(events.EventRunQueue); len(runqEvents) > 0 {
+		report.RunQueue = analyzeRunQueue(runqEvents, duration)
+	}
 
-	report += d.generateApplicationTracing(duration)
+	report.Memory = analyzeMemory(d.filterEvents(events.EventOOMKill), d.filterEvents(events.EventCgroupMemory))
 
-	// Issues summary
-	issues := d.detectIssues()
-	if len(issues) > 0 {
-		report += fmt.Sprintf("Potential Issues Detected:\n")
-		for _, issue := range issues {
-			report += fmt.Sprintf("  %s\n", issue)
-		}
-		report += "\n"
+	if blockEvents := d.filterEvents(events.EventBlockIO); len(blockEvents) > 0 {
+		report.Disk = analyzeDisk(blockEvents, duration)
+	}
+
+	if futexEvents := d.filterEvents(events.EventFutexWait); len(futexEvents) > 0 {
+		report.LockContention = analyzeLockContention(futexEvents, duration)
+	}
+
+	report.Syscalls = analyzeSyscalls(d.filterEvents(events.EventSyscall), duration)
+
+	report.PageFaults = analyzePageFaults(d.filterEvents(events.EventPageFault), d.filterEvents(events.EventPageFaultCount), duration)
+
+	execEvents := d.filterEvents(events.EventProcessExec)
+	forkEvents := d.filterEvents(events.EventProcessFork)
+	exitEvents := d.filterEvents(events.EventProcessExit)
+	if len(execEvents) > 0 || len(forkEvents) > 0 || len(exitEvents) > 0 {
+		report.Lifecycle = analyzeProcessLifecycle(execEvents, forkEvents, exitEvents)
 	}
 
+	report.CPUUsage = d.analyzeCPUUsage(duration)
+	report.Processes = d.analyzeProcessActivity()
+	report.Containers = d.analyzeContainerActivity()
+	report.Timeline = d.analyzeTimeline(duration)
+	report.Bursts = d.detectBursts(duration)
+
+	if tcpEvents := append(tcpSendEvents, tcpRecvEvents...); len(tcpEvents) > 0 {
+		pattern := d.analyzeIOPattern(tcpEvents, duration)
+		report.NetworkIO = &pattern
+	}
+
+	report.Issues = d.detectIssues()
+
 	return report
 }
 
 func (d *Diagnostician) filterEvents(eventType events.EventType) []*events.Event {
+	source := d.events
+	if eventType.IsSample() {
+		source = d.samples
+	}
+
 	var filtered []*events.Event
-	for _, e := range d.events {
+	for _, e := range source {
 		if e.Type == eventType {
 			filtered = append(filtered, e)
 		}
@@ -209,66 +190,141 @@ func (d *Diagnostician) filterEvents(eventType events.EventType) []*events.Event
 	return filtered
 }
 
-type targetCount struct {
-	target string
-	count  int
+// latencyStats computes average, max and percentiles of the events' latencies
+func latencyStats(events []*events.Event) LatencyStats {
+	latencies := make([]float64, 0, len(events))
+	for _, e := range events {
+		latencies = append(latencies, float64(e.LatencyNS)/1e6)
+	}
+	return latencyStatsMS(latencies)
 }
 
-func (d *Diagnostician) analyzeDNS(events []*events.Event) (avgLatency, maxLatency float64, errors int, p50, p95, p99 float64, topTargets []targetCount) {
-	var totalLatency float64
-	var latencies []float64
-	maxLatency = 0
-	errors = 0
-	targetMap := make(map[string]int)
+// latencyStatsMS summarizes latencies given in milliseconds, sorting them in
+// place
+func latencyStatsMS(latencies []float64) LatencyStats {
+	var stats LatencyStats
+	if len(latencies) == 0 {
+		return stats
+	}
 
-	for _, e := range events {
-		latencyMs := float64(e.LatencyNS) / 1e6
-		latencies = append(latencies, latencyMs)
-		totalLatency += latencyMs
-		if latencyMs > maxLatency {
-			maxLatency = latencyMs
+	var total float64
+	for _, latencyMs := range latencies {
+		total += latencyMs
+		if latencyMs > stats.MaxMS {
+			stats.MaxMS = latencyMs
 		}
+	}
+
+	sort.Float64s(latencies)
+	stats.AvgMS = total / float64(len(latencies))
+	stats.P50MS = percentile(latencies, 50)
+	stats.P95MS = percentile(latencies, 95)
+	stats.P99MS = percentile(latencies, 99)
+	return stats
+}
+
+// topTargets returns the most frequent keys of counts, highest first
+func topTargets(counts map[string]int) []TargetCount {
+	var top []TargetCount
+	for target, count := range counts {
+		top = append(top, TargetCount{Target: target, Count: count})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Target < top[j].Target
+	})
+	if len(top) > maxTopEntries {
+		top = top[:maxTopEntries]
+	}
+	return top
+}
+
+// errorBreakdown turns error code counts into a list ordered by frequency,
+// naming each code with name
+func errorBreakdown(counts map[int32]int, name func(int32) string) []ErrorCount {
+	var breakdown []ErrorCount
+	for code, count := range counts {
+		breakdown = append(breakdown, ErrorCount{
+			Code:  code,
+			Name:  name(code),
+			Count: count,
+		})
+	}
+	sort.Slice(breakdown, func(i, j int) bool {
+		if breakdown[i].Count != breakdown[j].Count {
+			return breakdown[i].Count > breakdown[j].Count
+		}
+		return breakdown[i].Code < breakdown[j].Code
+	})
+	return breakdown
+}
+
+// connectErrorName names the negative errno of a failed connect
+func connectErrorName(code int32) string {
+	if code < 0 {
+		return events.ErrnoName(-code)
+	}
+	return ""
+}
+
+func isKnownTarget(target string) bool {
+	return target != "" && target != "?" && target != "unknown" && target != "file"
+}
+
+func perSecond(count int, duration time.Duration) float64 {
+	if duration <= 0 {
+		return 0
+	}
+	return float64(count) / duration.Seconds()
+}
+
+func percentOf(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) * 100 / float64(total)
+}
+
+func (d *Diagnostician) analyzeDNS(dnsEvents []*events.Event, duration time.Duration) *DNSStats {
+	errors := 0
+	targetMap := make(map[string]int)
+	typeMap := make(map[string]int)
+	errorMap := make(map[int32]int)
+
+	for _, e := range dnsEvents {
 		if e.Error != 0 {
 			errors++
+			errorMap[e.Error]++
 		}
 		if e.Target != "" && e.Target != "?" {
 			targetMap[e.Target]++
 		}
+		if e.Details != "" {
+			typeMap[e.Details]++
+		}
 	}
 
-	if len(events) > 0 {
-		avgLatency = totalLatency / float64(len(events))
-		sort.Float64s(latencies)
-		p50 = percentile(latencies, 50)
-		p95 = percentile(latencies, 95)
-		p99 = percentile(latencies, 99)
-	}
-
-	for target, count := range targetMap {
-		topTargets = append(topTargets, targetCount{target: target, count: count})
+	return &DNSStats{
+		Lookups:        len(dnsEvents),
+		PerSecond:      perSecond(len(dnsEvents), duration),
+		Latency:        latencyStats(dnsEvents),
+		Errors:         errors,
+		ErrorPercent:   percentOf(errors, len(dnsEvents)),
+		ErrorBreakdown: errorBreakdown(errorMap, events.DNSErrorName),
+		QueryTypes:     topTargets(typeMap),
+		TopTargets:     topTargets(targetMap),
 	}
-	sort.Slice(topTargets, func(i, j int) bool {
-		return topTargets[i].count > topTargets[j].count
-	})
-
-	return
 }
 
-func (d *Diagnostician) analyzeTCP(events []*events.Event) (avgRTT, maxRTT float64, spikes int, p50, p95, p99 float64, errors int) {
-	var totalRTT float64
-	var rtts []float64
-	maxRTT = 0
-	spikes = 0
-	errors = 0
+func (d *Diagnostician) analyzeTCP(sendEvents, recvEvents []*events.Event, duration time.Duration) *TCPStats {
+	allTCP := append(append([]*events.Event{}, sendEvents...), recvEvents...)
+	spikes := 0
+	errors := 0
 
-	for _, e := range events {
-		rttMs := float64(e.LatencyNS) / 1e6
-		rtts = append(rtts, rttMs)
-		totalRTT += rttMs
-		if rttMs > maxRTT {
-			maxRTT = rttMs
-		}
-		if rttMs > 100 {
+	for _, e := range allTCP {
+		if float64(e.LatencyNS)/1e6 > 100 {
 			spikes++
 		}
 		if e.Error < 0 && e.Error != -11 {
@@ -276,108 +332,247 @@ func (d *Diagnostician) analyzeTCP(events []*events.Event) (avgRTT, maxRTT float
 		}
 	}
 
-	if len(events) > 0 {
-		avgRTT = totalRTT / float64(len(events))
-		sort.Float64s(rtts)
-		p50 = percentile(rtts, 50)
-		p95 = percentile(rtts, 95)
-		p99 = percentile(rtts, 99)
+	return &TCPStats{
+		SendOps:         len(sendEvents),
+		SendPerSecond:   perSecond(len(sendEvents), duration),
+		RecvOps:         len(recvEvents),
+		RecvPerSecond:   perSecond(len(recvEvents), duration),
+		SyscallLatency:  latencyStats(allTCP),
+		SpikesOver100MS: spikes,
+		Errors:          errors,
+		ErrorPercent:    percentOf(errors, len(allTCP)),
 	}
-	return
 }
 
-func (d *Diagnostician) analyzeConnections(events []*events.Event) (avgLatency, maxLatency float64, errors int, p50, p95, p99 float64, topTargets []targetCount, errorBreakdown map[int32]int) {
-	var totalLatency float64
-	var latencies []float64
-	maxLatency = 0
-	errors = 0
-	targetMap := make(map[string]int)
-	errorBreakdown = make(map[int32]int)
+// addRTT summarizes kernel RTT samples across all sampled connections
+func (s *TCPStats) addRTT(rttEvents []*events.Event) {
+	rtt := latencyStats(rttEvents)
+	s.NetworkRTT = &rtt
+	s.RTTSamples = len(rttEvents)
+
+	connections := make(map[string]bool)
+	for _, e := range rttEvents {
+		connections[e.Details+"->"+e.Target] = true
+		if e.TCPInfo == nil {
+			continue
+		}
+		if rttvar := float64(e.TCPInfo.RTTVarUS) / 1e3; rttvar > s.MaxRTTVarMS {
+			s.MaxRTTVarMS = rttvar
+		}
+		if s.MinCongestionWnd == 0 || e.TCPInfo.SndCwnd < s.MinCongestionWnd {
+			s.MinCongestionWnd = e.TCPInfo.SndCwnd
+		}
+	}
+	s.RTTConnections = len(connections)
+}
 
-	for _, e := range events {
-		latencyMs := float64(e.LatencyNS) / 1e6
-		latencies = append(latencies, latencyMs)
-		totalLatency += latencyMs
-		if latencyMs > maxLatency {
-			maxLatency = latencyMs
+// addPeers summarizes send and receive latency per remote host, along with
+// the kernel RTT towards it, slowest P95 first. Ports are dropped so that the
+// ephemeral ports of inbound connections do not split a client into many peers.
+func (s *TCPStats) addPeers(tcpEvents, rttEvents []*events.Event) {
+	byPeer := make(map[string][]*events.Event)
+	for _, e := range tcpEvents {
+		if host, _ := splitEndpoint(e.Target); host != "" {
+			byPeer[host] = append(byPeer[host], e)
 		}
-		if e.Error != 0 {
-			errors++
-			errorBreakdown[e.Error]++
+	}
+	rttByPeer := make(map[string][]*events.Event)
+	for _, e := range rttEvents {
+		host, _ := splitEndpoint(e.Target)
+		if _, ok := byPeer[host]; ok {
+			rttByPeer[host] = append(rttByPeer[host], e)
 		}
-		if e.Target != "" && e.Target != "?" && e.Target != "unknown" && e.Target != "file" {
-			targetMap[e.Target]++
+	}
+
+	peers := make([]PeerTCPLatency, 0, len(byPeer))
+	for peer, peerEvents := range byPeer {
+		p := PeerTCPLatency{Peer: peer, Ops: len(peerEvents), Latency: latencyStats(peerEvents)}
+		for _, e := range peerEvents {
+			if e.Error < 0 && e.Error != -11 {
+				p.Errors++
+			}
+		}
+		if samples := rttByPeer[peer]; len(samples) > 0 {
+			rtt := latencyStats(samples)
+			p.RTT = &rtt
+		}
+		peers = append(peers, p)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		if peers[i].Latency.P95MS != peers[j].Latency.P95MS {
+			return peers[i].Latency.P95MS > peers[j].Latency.P95MS
 		}
+		return peers[i].Peer < peers[j].Peer
+	})
+	if len(peers) > maxTopEntries {
+		peers = peers[:maxTopEntries]
 	}
+	s.Peers = peers
+}
 
-	if len(events) > 0 {
-		avgLatency = totalLatency / float64(len(events))
-		sort.Float64s(latencies)
-		p50 = percentile(latencies, 50)
-		p95 = percentile(latencies, 95)
-		p99 = percentile(latencies, 99)
+// analyzeTCPEndpoints counts retransmits and resets per remote endpoint, most
+// retransmits first
+func (d *Diagnostician) analyzeTCPEndpoints(duration time.Duration) []EndpointTCPStats {
+	byEndpoint := make(map[string]*EndpointTCPStats)
+	for _, e := range d.events {
+		if e.Type != events.EventTCPRetransmit && e.Type != events.EventTCPSendReset && e.Type != events.EventTCPRecvReset {
+			continue
+		}
+
+		stats, ok := byEndpoint[e.Target]
+		if !ok {
+			stats = &EndpointTCPStats{Endpoint: e.Target}
+			byEndpoint[e.Target] = stats
+		}
+		switch e.Type {
+		case events.EventTCPRetransmit:
+			stats.Retransmits++
+		case events.EventTCPSendReset:
+			stats.ResetsSent++
+		case events.EventTCPRecvReset:
+			stats.ResetsReceived++
+		}
 	}
 
-	for target, count := range targetMap {
-		topTargets = append(topTargets, targetCount{target: target, count: count})
+	endpoints := make([]EndpointTCPStats, 0, len(byEndpoint))
+	for _, stats := range byEndpoint {
+		stats.RetransmitsPerSecond = perSecond(stats.Retransmits, duration)
+		endpoints = append(endpoints, *stats)
 	}
-	sort.Slice(topTargets, func(i, j int) bool {
-		return topTargets[i].count > topTargets[j].count
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].Retransmits != endpoints[j].Retransmits {
+			return endpoints[i].Retransmits > endpoints[j].Retransmits
+		}
+		resetsI := endpoints[i].ResetsSent + endpoints[i].ResetsReceived
+		resetsJ := endpoints[j].ResetsSent + endpoints[j].ResetsReceived
+		if resetsI != resetsJ {
+			return resetsI > resetsJ
+		}
+		return endpoints[i].Endpoint < endpoints[j].Endpoint
 	})
+	return endpoints
+}
 
-	return
+// addEndpoints fills in the retransmit and reset totals from the per-endpoint
+// counts, keeping the top entries
+func (s *TCPStats) addEndpoints(endpoints []EndpointTCPStats, duration time.Duration) {
+	for _, e := range endpoints {
+		s.Retransmits += e.Retransmits
+		s.ResetsSent += e.ResetsSent
+		s.ResetsReceived += e.ResetsReceived
+	}
+	s.RetransmitsPerSecond = perSecond(s.Retransmits, duration)
+
+	if len(endpoints) > maxTopEntries {
+		endpoints = endpoints[:maxTopEntries]
+	}
+	s.RetransmitsByEndpoint = endpoints
 }
 
-func (d *Diagnostician) analyzeFS(events []*events.Event) (avgLatency, maxLatency float64, slowOps int, p50, p95, p99 float64) {
-	var totalLatency float64
-	var latencies []float64
-	maxLatency = 0
-	slowOps = 0
+func (d *Diagnostician) analyzeConnections(connectEvents []*events.Event, duration time.Duration) *ConnectionStats {
+	errors := 0
+	targetMap := make(map[string]int)
+	errorMap := make(map[int32]int)
 
-	for _, e := range events {
-		latencyMs := float64(e.LatencyNS) / 1e6
-		latencies = append(latencies, latencyMs)
-		totalLatency += latencyMs
-		if latencyMs > maxLatency {
-			maxLatency = latencyMs
+	for _, e := range connectEvents {
+		if e.Error != 0 {
+			errors++
+			errorMap[e.Error]++
 		}
-		if latencyMs > 10 {
+		if isKnownTarget(e.Target) {
+			targetMap[e.Target]++
+		}
+	}
+
+	return &ConnectionStats{
+		Total:          len(connectEvents),
+		PerSecond:      perSecond(len(connectEvents), duration),
+		Latency:        latencyStats(connectEvents),
+		Failed:         errors,
+		FailedPercent:  percentOf(errors, len(connectEvents)),
+		ErrorBreakdown: errorBreakdown(errorMap, connectErrorName),
+		TopTargets:     topTargets(targetMap),
+	}
+}
+
+func (d *Diagnostician) analyzeFS(writeEvents, readEvents, fsyncEvents []*events.Event, duration time.Duration) *FileSystemStats {
+	allFS := append(append(append([]*events.Event{}, writeEvents...), readEvents...), fsyncEvents...)
+	slowOps := 0
+	fileMap := make(map[string]int)
+
+	var bytesRead, bytesWritten uint64
+
+	for _, e := range allFS {
+		if float64(e.LatencyNS)/1e6 > 10 {
 			slowOps++
 		}
+		if isKnownTarget(e.Target) {
+			fileMap[e.Target]++
+		}
+		if e.FileInfo != nil {
+			switch e.Type {
+			case events.EventRead:
+				bytesRead += e.FileInfo.BytesReturned
+			case events.EventWrite:
+				bytesWritten += e.FileInfo.BytesReturned
+			}
+		}
 	}
 
-	if len(events) > 0 {
-		avgLatency = totalLatency / float64(len(events))
-		sort.Float64s(latencies)
-		p50 = percentile(latencies, 50)
-		p95 = percentile(latencies, 95)
-		p99 = percentile(latencies, 99)
+	return &FileSystemStats{
+		WriteOps:        len(writeEvents),
+		WritePerSecond:  perSecond(len(writeEvents), duration),
+		ReadOps:         len(readEvents),
+		ReadPerSecond:   perSecond(len(readEvents), duration),
+		FsyncOps:        len(fsyncEvents),
+		FsyncPerSecond:  perSecond(len(fsyncEvents), duration),
+		Latency:         latencyStats(allFS),
+		SlowOpsOver10MS: slowOps,
+		BytesRead:       bytesRead,
+		BytesWritten:    bytesWritten,
+		TopFiles:        topTargets(fileMap),
+		SlowestOps:      slowestFileOps(allFS, 5),
 	}
-	return
 }
 
-func (d *Diagnostician) analyzeCPU(events []*events.Event) (avgBlock, maxBlock float64, p50, p95, p99 float64) {
-	var totalBlock float64
-	var blocks []float64
-	maxBlock = 0
+// slowestFileOps returns the n slowest file operations, slowest first
+func slowestFileOps(fsEvents []*events.Event, n int) []FileOp {
+	sorted := append([]*events.Event{}, fsEvents...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].LatencyNS > sorted[j].LatencyNS
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
 
-	for _, e := range events {
-		blockMs := float64(e.LatencyNS) / 1e6
-		blocks = append(blocks, blockMs)
-		totalBlock += blockMs
-		if blockMs > maxBlock {
-			maxBlock = blockMs
+	ops := make([]FileOp, 0, len(sorted))
+	for _, e := range sorted {
+		op := FileOp{
+			Op:        e.Type.String(),
+			Path:      e.Target,
+			FSType:    e.Details,
+			LatencyMS: float64(e.LatencyNS) / 1e6,
+			Error:     e.ErrorName(),
 		}
+		if e.FileInfo != nil {
+			op.Device = e.FileInfo.DeviceString()
+			op.BytesRequested = e.FileInfo.BytesRequested
+			op.BytesReturned = e.FileInfo.BytesReturned
+		}
+		ops = append(ops, op)
 	}
+	return ops
+}
 
-	if len(events) > 0 {
-		avgBlock = totalBlock / float64(len(events))
-		sort.Float64s(blocks)
-		p50 = percentile(blocks, 50)
-		p95 = percentile(blocks, 95)
-		p99 = percentile(blocks, 99)
+func (d *Diagnostician) analyzeCPU(events []*events.Event, duration time.Duration) *CPUStats {
+	return &CPUStats{
+		Switches:  len(events),
+		PerSecond: perSecond(len(events), duration),
+		BlockTime: latencyStats(events),
+
+		BlockReasons:   offCPUReasons(events),
+		BlockingStacks: topBlockingStacks(events),
 	}
-	return
 }
 
 func percentile(sorted []float64, p float64) float64 {
@@ -389,8 +584,8 @@ func percentile(sorted []float64, p float64) float64 {
 }
 
 // detectIssues analyzes events and returns a list of potential issues
-func (d *Diagnostician) detectIssues() []string {
-	var issues []string
+func (d *Diagnostician) detectIssues() []Issue {
+	var issues []Issue
 
 	connectEvents := d.filterEvents(events.EventConnect)
 	if len(connectEvents) > 0 {
@@ -402,7 +597,10 @@ func (d *Diagnostician) detectIssues() []string {
 		}
 		errorRate := float64(errors) / float64(len(connectEvents)) * 100
 		if errorRate > 10 {
-			issues = append(issues, fmt.Sprintf("High connection failure rate: %.1f%% (%d/%d)", errorRate, errors, len(connectEvents)))
+			issues = append(issues, Issue{
+				Kind:    "connection_failures",
+				Message: fmt.Sprintf("High connection failure rate: %.1f%% (%d/%d)", errorRate, errors, len(connectEvents)),
+			})
 		}
 	}
 
@@ -416,123 +614,66 @@ func (d *Diagnostician) detectIssues() []string {
 		}
 		spikeRate := float64(spikes) / float64(len(tcpEvents)) * 100
 		if spikeRate > 5 {
-			issues = append(issues, fmt.Sprintf("High TCP RTT spike rate: %.1f%% (%d/%d)", spikeRate, spikes, len(tcpEvents)))
+			issues = append(issues, Issue{
+				Kind:    "tcp_rtt_spikes",
+				Message: fmt.Sprintf("High TCP send/receive latency spike rate: %.1f%% (%d/%d)", spikeRate, spikes, len(tcpEvents)),
+			})
 		}
 	}
 
-	return issues
-}
+	issues = append(issues, inboundIssues(analyzeInbound(d.filterEvents(events.EventAccept),
+		d.filterEvents(events.EventNetStat), d.endTime.Sub(d.startTime)))...)
 
-func (d *Diagnostician) generateApplicationTracing(duration time.Duration) string {
-	var report string
-
-	pidActivity := d.analyzeProcessActivity()
-	if len(pidActivity) > 0 {
-		report += fmt.Sprintf("Process Activity:\n")
-		report += fmt.Sprintf("  Active processes: %d\n", len(pidActivity))
-		report += fmt.Sprintf("  Top active processes:\n")
-		for i, pidInfo := range pidActivity {
-			if i >= 5 {
-				break
-			}
-			name := pidInfo.name
-			if name == "" {
-				name = "unknown"
-			}
-			report += fmt.Sprintf("    - PID %d (%s): %d events (%.1f%%)\n",
-				pidInfo.pid, name, pidInfo.count, pidInfo.percentage)
-		}
-		report += "\n"
+	if connEvents := d.filterEvents(events.EventTCPConnection); len(connEvents) > 0 {
+		issues = append(issues, tcpConnectionIssues(analyzeTCPConnections(connEvents, d.endTime.Sub(d.startTime)))...)
 	}
 
-	timeline := d.analyzeTimeline(duration)
-	if len(timeline) > 0 {
-		report += fmt.Sprintf("Activity Timeline:\n")
-		report += fmt.Sprintf("  Activity distribution:\n")
-		for _, bucket := range timeline {
-			report += fmt.Sprintf("    - %s: %d events (%.1f%%)\n",
-				bucket.period, bucket.count, bucket.percentage)
-		}
-		report += "\n"
+	if dropEvents := d.filterEvents(events.EventUDPDrop); len(dropEvents) > 0 {
+		issues = append(issues, udpIssues(analyzeUDP(nil, nil, dropEvents, d.endTime.Sub(d.startTime)))...)
 	}
 
-	bursts := d.detectBursts(duration)
-	if len(bursts) > 0 {
-		report += fmt.Sprintf("Activity Bursts:\n")
-		report += fmt.Sprintf("  Detected %d burst period(s):\n", len(bursts))
-		for i, burst := range bursts {
-			if i >= 3 {
-				break
-			}
-			report += fmt.Sprintf("    - %s: %.1f events/sec (%.1fx normal rate)\n",
-				burst.time.Format("15:04:05"), burst.rate, burst.multiplier)
+	for _, endpoint := range d.analyzeTCPEndpoints(d.endTime.Sub(d.startTime)) {
+		if endpoint.Retransmits < 5 || endpoint.RetransmitsPerSecond < 1 {
+			continue
 		}
-		report += "\n"
+		issues = append(issues, Issue{
+			Kind: "tcp_retransmits",
+			Message: fmt.Sprintf("High TCP retransmit rate to %s: %.1f/sec (%d retransmits)",
+				endpoint.Endpoint, endpoint.RetransmitsPerSecond, endpoint.Retransmits),
+		})
 	}
 
-	connectEvents := d.filterEvents(events.EventConnect)
-	if len(connectEvents) > 0 {
-		pattern := d.analyzeConnectionPattern(connectEvents, duration)
-		report += fmt.Sprintf("Connection Patterns:\n")
-		report += fmt.Sprintf("  Pattern: %s\n", pattern.pattern)
-		report += fmt.Sprintf("  Average rate: %.1f connections/sec\n", pattern.avgRate)
-		if pattern.burstRate > 0 {
-			report += fmt.Sprintf("  Peak rate: %.1f connections/sec\n", pattern.burstRate)
-		}
-		if pattern.uniqueTargets > 0 {
-			report += fmt.Sprintf("  Unique targets: %d\n", pattern.uniqueTargets)
+	if runqEvents := d.filterEvents(events.EventRunQueue); len(runqEvents) >= minStarvationSamples {
+		stats := latencyStats(runqEvents)
+		if stats.P95MS >= starvationP95MS {
+			issues = append(issues, Issue{
+				Kind: "cpu_starvation",
+				Message: fmt.Sprintf("CPU starvation: runnable threads waited P95=%.2fms (max %.2fms) for a CPU; check CPU limits and throttling",
+					stats.P95MS, stats.MaxMS),
+			})
 		}
-		report += "\n"
 	}
 
-	tcpEvents := append(d.filterEvents(events.EventTCPSend), d.filterEvents(events.EventTCPRecv)...)
-	if len(tcpEvents) > 0 {
-		ioPattern := d.analyzeIOPattern(tcpEvents, duration)
-		report += fmt.Sprintf("Network I/O Pattern:\n")
-		report += fmt.Sprintf("  Send/Receive ratio: %.2f:1\n", ioPattern.sendRecvRatio)
-		report += fmt.Sprintf("  Average throughput: %.1f ops/sec\n", ioPattern.avgThroughput)
-		if ioPattern.peakThroughput > 0 {
-			report += fmt.Sprintf("  Peak throughput: %.1f ops/sec\n", ioPattern.peakThroughput)
-		}
-		report += "\n"
+	if blockEvents := d.filterEvents(events.EventBlockIO); len(blockEvents) > 0 {
+		issues = append(issues, diskIssues(analyzeDisk(blockEvents, d.endTime.Sub(d.startTime)))...)
 	}
 
-	return report
-}
-
-type pidInfo struct {
-	pid        uint32
-	name       string
-	count      int
-	percentage float64
-}
+	issues = append(issues, pageFaultIssues(analyzePageFaults(d.filterEvents(events.EventPageFault),
+		d.filterEvents(events.EventPageFaultCount), d.endTime.Sub(d.startTime)))...)
 
-type timelineBucket struct {
-	period     string
-	count      int
-	percentage float64
-}
-
-type burstInfo struct {
-	time       time.Time
-	rate       float64
-	multiplier float64
-}
+	if futexEvents := d.filterEvents(events.EventFutexWait); len(futexEvents) > 0 {
+		duration := d.endTime.Sub(d.startTime)
+		issues = append(issues, lockContentionIssues(analyzeLockContention(futexEvents, duration), duration)...)
+	}
 
-type connectionPattern struct {
-	pattern       string
-	avgRate       float64
-	burstRate     float64
-	uniqueTargets int
-}
+	oomEvents := d.filterEvents(events.EventOOMKill)
+	issues = append(issues, memoryIssues(analyzeMemory(oomEvents, d.filterEvents(events.EventCgroupMemory)))...)
+	issues = append(issues, exitIssues(d.filterEvents(events.EventProcessExit), oomEvents)...)
 
-type ioPattern struct {
-	sendRecvRatio  float64
-	avgThroughput  float64
-	peakThroughput float64
+	return issues
 }
 
-func (d *Diagnostician) analyzeProcessActivity() []pidInfo {
+func (d *Diagnostician) analyzeProcessActivity() []ProcessActivity {
 	pidMap := make(map[uint32]int)
 	totalEvents := len(d.events)
 
@@ -540,9 +681,8 @@ func (d *Diagnostician) analyzeProcessActivity() []pidInfo {
 		pidMap[e.PID]++
 	}
 
-	var pidInfos []pidInfo
+	var activity []ProcessActivity
 	for pid, count := range pidMap {
-		percentage := float64(count) / float64(totalEvents) * 100
 		name := ""
 		for _, e := range d.events {
 			if e.PID == pid && e.ProcessName != "" {
@@ -556,19 +696,58 @@ func (d *Diagnostician) analyzeProcessActivity() []pidInfo {
 		if name == "" {
 			name = "unknown"
 		}
-		pidInfos = append(pidInfos, pidInfo{
-			pid:        pid,
-			name:       name,
-			count:      count,
-			percentage: percentage,
+		activity = append(activity, ProcessActivity{
+			PID:     pid,
+			Name:    name,
+			Events:  count,
+			Percent: float64(count) / float64(totalEvents) * 100,
 		})
 	}
 
-	sort.Slice(pidInfos, func(i, j int) bool {
-		return pidInfos[i].count > pidInfos[j].count
+	sort.Slice(activity, func(i, j int) bool {
+		return activity[i].Events > activity[j].Events
 	})
 
-	return pidInfos
+	return activity
+}
+
+// analyzeContainerActivity returns event counts per container, or nil if no
+// event carries a container name
+func (d *Diagnostician) analyzeContainerActivity() []ContainerActivity {
+	containerMap := make(map[string]int)
+	tagged := false
+	for _, e := range d.events {
+		if e.Container != "" {
+			tagged = true
+		}
+		containerMap[e.Container]++
+	}
+
+	if !tagged {
+		return nil
+	}
+
+	var activity []ContainerActivity
+	totalEvents := len(d.events)
+	for name, count := range containerMap {
+		if name == "" {
+			name = "unknown"
+		}
+		activity = append(activity, ContainerActivity{
+			Name:    name,
+			Events:  count,
+			Percent: float64(count) / float64(totalEvents) * 100,
+		})
+	}
+
+	sort.Slice(activity, func(i, j int) bool {
+		if activity[i].Events != activity[j].Events {
+			return activity[i].Events > activity[j].Events
+		}
+		return activity[i].Name < activity[j].Name
+	})
+
+	return activity
 }
 
 var processNameCache = make(map[uint32]string)
@@ -648,7 +827,7 @@ func getProcessName(pid uint32) string {
 	return name
 }
 
-func (d *Diagnostician) analyzeTimeline(duration time.Duration) []timelineBucket {
+func (d *Diagnostician) analyzeTimeline(duration time.Duration) []TimelineBucket {
 	if len(d.events) == 0 {
 		return nil
 	}
@@ -670,36 +849,33 @@ func (d *Diagnostician) analyzeTimeline(duration time.Duration) []timelineBucket
 		buckets[bucketIndex]++
 	}
 
-	var timeline []timelineBucket
+	var timeline []TimelineBucket
 	totalEvents := len(d.events)
 	for i, count := range buckets {
-		startTime := d.startTime.Add(time.Duration(i) * bucketDuration)
-		endTime := d.startTime.Add(time.Duration(i+1) * bucketDuration)
-		period := fmt.Sprintf("%s-%s", startTime.Format("15:04:05"), endTime.Format("15:04:05"))
-		percentage := float64(count) / float64(totalEvents) * 100
-		timeline = append(timeline, timelineBucket{
-			period:     period,
-			count:      count,
-			percentage: percentage,
+		timeline = append(timeline, TimelineBucket{
+			Start:   d.startTime.Add(time.Duration(i) * bucketDuration),
+			End:     d.startTime.Add(time.Duration(i+1) * bucketDuration),
+			Events:  count,
+			Percent: float64(count) / float64(totalEvents) * 100,
 		})
 	}
 
 	return timeline
 }
 
-func (d *Diagnostician) detectBursts(duration time.Duration) []burstInfo {
+func (d *Diagnostician) detectBursts(duration time.Duration) []Burst {
 	if len(d.events) < 10 {
 		return nil
 	}
 
-	avgRate := float64(len(d.events)) / duration.Seconds()
+	avgRate := perSecond(len(d.events), duration)
 	windowDuration := 1 * time.Second
 	numWindows := int(duration / windowDuration)
 	if numWindows < 2 {
 		return nil
 	}
 
-	var bursts []burstInfo
+	var bursts []Burst
 	windowStart := d.startTime
 
 	for i := 0; i < numWindows; i++ {
@@ -713,11 +889,10 @@ func (d *Diagnostician) detectBursts(duration time.Duration) []burstInfo {
 		}
 		rate := float64(count) / windowDuration.Seconds()
 		if rate > avgRate*2.0 {
-			multiplier := rate / avgRate
-			bursts = append(bursts, burstInfo{
-				time:       windowStart,
-				rate:       rate,
-				multiplier: multiplier,
+			bursts = append(bursts, Burst{
+				Time:       windowStart,
+				Rate:       rate,
+				Multiplier: rate / avgRate,
 			})
 		}
 		windowStart = windowEnd
@@ -726,12 +901,12 @@ func (d *Diagnostician) detectBursts(duration time.Duration) []burstInfo {
 	return bursts
 }
 
-func (d *Diagnostician) analyzeConnectionPattern(connectEvents []*events.Event, duration time.Duration) connectionPattern {
+func (d *Diagnostician) analyzeConnectionPattern(connectEvents []*events.Event, duration time.Duration) ConnectionPattern {
 	if len(connectEvents) == 0 {
-		return connectionPattern{}
+		return ConnectionPattern{}
 	}
 
-	avgRate := float64(len(connectEvents)) / duration.Seconds()
+	avgRate := perSecond(len(connectEvents), duration)
 	windowDuration := duration / 10
 	if windowDuration < 100*time.Millisecond {
 		windowDuration = 100 * time.Millisecond
@@ -780,59 +955,87 @@ func (d *Diagnostician) analyzeConnectionPattern(connectEvents []*events.Event,
 
 	targetMap := make(map[string]bool)
 	for _, e := range connectEvents {
-		if e.Target != "" && e.Target != "?" && e.Target != "unknown" && e.Target != "file" {
+		if isKnownTarget(e.Target) {
 			targetMap[e.Target] = true
 		}
 	}
 
-	return connectionPattern{
-		pattern:       pattern,
-		avgRate:       avgRate,
-		burstRate:     peakRate,
-		uniqueTargets: len(targetMap),
+	return ConnectionPattern{
+		Pattern:       pattern,
+		AvgRate:       avgRate,
+		PeakRate:      peakRate,
+		UniqueTargets: len(targetMap),
 	}
 }
 
-func (d *Diagnostician) analyzeIOPattern(tcpEvents []*events.Event, duration time.Duration) ioPattern {
-	sendEvents := d.filterEvents(events.EventTCPSend)
-	recvEvents := d.filterEvents(events.EventTCPRecv)
-
-	sendCount := len(sendEvents)
-	recvCount := len(recvEvents)
+// analyzeIOPattern measures TCP throughput from the bytes moved by send and
+// receive calls, overall and per peer host, with the peak over one-second
+// windows
+func (d *Diagnostician) analyzeIOPattern(tcpEvents []*events.Event, duration time.Duration) NetworkIOPattern {
+	var pattern NetworkIOPattern
+	byPeer := make(map[string]*PeerThroughput)
+	windows := make(map[int64]uint64)
+	for _, e := range tcpEvents {
+		peer, _ := splitEndpoint(e.Target)
+		if peer == "" {
+			peer = "unknown"
+		}
+		p, ok := byPeer[peer]
+		if !ok {
+			p = &PeerThroughput{Peer: peer}
+			byPeer[peer] = p
+		}
+		switch e.Type {
+		case events.EventTCPSend:
+			pattern.BytesSent += e.Bytes
+			p.Sends++
+			p.BytesSent += e.Bytes
+		case events.EventTCPRecv:
+			pattern.BytesReceived += e.Bytes
+			p.Receives++
+			p.BytesReceived += e.Bytes
+		}
 
-	sendRecvRatio := 1.0
-	if recvCount > 0 {
-		sendRecvRatio = float64(sendCount) / float64(recvCount)
+		ts := e.TimestampTime()
+		if !ts.Before(d.startTime) && ts.Before(d.endTime) {
+			windows[int64(ts.Sub(d.startTime)/time.Second)] += e.Bytes
+		}
 	}
 
-	avgThroughput := float64(len(tcpEvents)) / duration.Seconds()
-	windowDuration := 1 * time.Second
-	numWindows := int(duration / windowDuration)
-	if numWindows < 1 {
-		numWindows = 1
+	pattern.SendRecvRatio = 1.0
+	if pattern.BytesReceived > 0 {
+		pattern.SendRecvRatio = float64(pattern.BytesSent) / float64(pattern.BytesReceived)
 	}
-
-	peakThroughput := 0.0
-	windowStart := d.startTime
-	for i := 0; i < numWindows; i++ {
-		windowEnd := windowStart.Add(windowDuration)
-		count := 0
-		for _, e := range tcpEvents {
-			eventTime := time.Unix(0, int64(e.Timestamp))
-			if eventTime.After(windowStart) && eventTime.Before(windowEnd) {
-				count++
-			}
+	pattern.SendBytesPerSec = bytesPerSecond(pattern.BytesSent, duration)
+	pattern.RecvBytesPerSec = bytesPerSecond(pattern.BytesReceived, duration)
+	pattern.AvgThroughput = bytesPerSecond(pattern.BytesSent+pattern.BytesReceived, duration)
+	for _, bytes := range windows {
+		if float64(bytes) > pattern.PeakThroughput {
+			pattern.PeakThroughput = float64(bytes)
 		}
-		rate := float64(count) / windowDuration.Seconds()
-		if rate > peakThroughput {
-			peakThroughput = rate
+	}
+
+	for _, p := range byPeer {
+		p.SendBytesPerSec = bytesPerSecond(p.BytesSent, duration)
+		p.RecvBytesPerSec = bytesPerSecond(p.BytesReceived, duration)
+		pattern.Peers = append(pattern.Peers, *p)
+	}
+	sort.Slice(pattern.Peers, func(i, j int) bool {
+		a, b := pattern.Peers[i], pattern.Peers[j]
+		if a.BytesSent+a.BytesReceived != b.BytesSent+b.BytesReceived {
+			return a.BytesSent+a.BytesReceived > b.BytesSent+b.BytesReceived
 		}
-		windowStart = windowEnd
+		return a.Peer < b.Peer
+	})
+	if len(pattern.Peers) > maxTopEntries {
+		pattern.Peers = pattern.Peers[:maxTopEntries]
 	}
+	return pattern
+}
 
-	return ioPattern{
-		sendRecvRatio:  sendRecvRatio,
-		avgThroughput:  avgThroughput,
-		peakThroughput: peakThroughput,
+func bytesPerSecond(bytes uint64, duration time.Duration) float64 {
+	if duration <= 0 {
+		return 0
 	}
+	return float64(bytes) / duration.Seconds()
 }
@@ -0,0 +1,135 @@
+package diagnose
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/podtrace/podtrace/internal/events"
+)
+
+const (
+	// minSlowDiskSamples is how many requests to a device are needed before
+	// the slow disk rule fires
+	minSlowDiskSamples = 10
+	// slowDiskP95MS is the P95 service latency considered a slow device
+	slowDiskP95MS = 50.0
+)
+
+func analyzeDisk(blockEvents []*events.Event, duration time.Duration) *DiskStats {
+	type deviceLatencies struct {
+		io                    *DeviceIO
+		total, queue, service []float64
+	}
+
+	byDevice := make(map[string]*deviceLatencies)
+	var order []string
+	for _, e := range blockEvents {
+		if e.BlockIO == nil {
+			continue
+		}
+		dev := e.BlockIO.DeviceString()
+		d, ok := byDevice[dev]
+		if !ok {
+			d = &deviceLatencies{io: &DeviceIO{Device: dev}}
+			byDevice[dev] = d
+			order = append(order, dev)
+		}
+		if d.io.Name == "" {
+			d.io.Name = e.Target
+		}
+
+		d.io.Ops++
+		switch e.BlockIO.OpName() {
+		case "read":
+			d.io.Reads++
+			d.io.ReadBytes += uint64(e.BlockIO.Bytes)
+		case "write":
+			d.io.Writes++
+			d.io.WriteBytes += uint64(e.BlockIO.Bytes)
+		}
+		if e.Error < 0 {
+			d.io.Errors++
+		}
+		d.total = append(d.total, float64(e.LatencyNS)/1e6)
+		d.queue = append(d.queue, float64(e.BlockIO.QueueNS)/1e6)
+		d.service = append(d.service, float64(e.BlockIO.ServiceNS(e.LatencyNS))/1e6)
+	}
+	if len(byDevice) == 0 {
+		return nil
+	}
+
+	stats := &DiskStats{}
+	for _, dev := range order {
+		d := byDevice[dev]
+		d.io.IOPS = perSecond(d.io.Ops, duration)
+		if duration > 0 {
+			d.io.ReadBytesPerSec = float64(d.io.ReadBytes) / duration.Seconds()
+			d.io.WriteBytesPerSec = float64(d.io.WriteBytes) / duration.Seconds()
+		}
+		d.io.Latency = latencyStatsMS(d.total)
+		d.io.QueueLatency = latencyStatsMS(d.queue)
+		d.io.ServiceLatency = latencyStatsMS(d.service)
+		stats.Devices = append(stats.Devices, *d.io)
+	}
+	sort.SliceStable(stats.Devices, func(i, j int) bool {
+		return stats.Devices[i].Ops > stats.Devices[j].Ops
+	})
+	return stats
+}
+
+// diskIssues reports devices that are slow to service requests and devices
+// that returned I/O errors
+func diskIssues(stats *DiskStats) []Issue {
+	if stats == nil {
+		return nil
+	}
+
+	var issues []Issue
+	for _, d := range stats.Devices {
+		if d.Errors > 0 {
+			issues = append(issues, Issue{
+				Kind:    "disk_errors",
+				Message: fmt.Sprintf("Disk I/O errors: %d of %d requests to %s failed", d.Errors, d.Ops, d.label()),
+			})
+		}
+		if d.Ops >= minSlowDiskSamples && d.ServiceLatency.P95MS >= slowDiskP95MS {
+			issues = append(issues, Issue{
+				Kind: "slow_disk",
+				Message: fmt.Sprintf("Slow disk: %s took P95=%.2fms (max %.2fms) to service requests, plus P95=%.2fms queued",
+					d.label(), d.ServiceLatency.P95MS, d.ServiceLatency.MaxMS, d.QueueLatency.P95MS),
+			})
+		}
+	}
+	return issues
+}
+
+// label names a device, e.g. "nvme0n1 (259:0)"
+func (d *DeviceIO) label() string {
+	if d.Name == "" {
+		return d.Device
+	}
+	return fmt.Sprintf("%s (%s)", d.Name, d.Device)
+}
+
+func (s *DiskStats) text() string {
+	var report string
+	report += fmt.Sprintf("Disk I/O:\n")
+	for _, d := range s.Devices {
+		report += fmt.Sprintf("  Device %s:\n", d.label())
+		report += fmt.Sprintf("    Requests: %d (%.1f IOPS), %d reads, %d writes\n", d.Ops, d.IOPS, d.Reads, d.Writes)
+		report += fmt.Sprintf("    Throughput: read %s (%s/sec), write %s (%s/sec)\n",
+			formatBytes(float64(d.ReadBytes)), formatBytes(d.ReadBytesPerSec),
+			formatBytes(float64(d.WriteBytes)), formatBytes(d.WriteBytesPerSec))
+		report += indent(latencyText(d.Latency, "latency"))
+		report += fmt.Sprintf("    Queue: P50=%.2fms, P95=%.2fms, P99=%.2fms\n",
+			d.QueueLatency.P50MS, d.QueueLatency.P95MS, d.QueueLatency.P99MS)
+		report += fmt.Sprintf("    Service: P50=%.2fms, P95=%.2fms, P99=%.2fms\n",
+			d.ServiceLatency.P50MS, d.ServiceLatency.P95MS, d.ServiceLatency.P99MS)
+		if d.Errors > 0 {
+			report += fmt.Sprintf("    Errors: %d (%.1f%%)\n", d.Errors, percentOf(d.Errors, d.Ops))
+		}
+	}
+	report += "\n"
+	return report
+}
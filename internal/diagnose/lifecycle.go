@@ -0,0 +1,145 @@
+package diagnose
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/podtrace/podtrace/internal/events"
+)
+
+// crashLoopMinExits is how many abnormal exits of the same command in a
+// container are reported as a crash loop
+const crashLoopMinExits = 3
+
+func analyzeProcessLifecycle(execEvents, forkEvents, exitEvents []*events.Event) *ProcessLifecycleStats {
+	stats := &ProcessLifecycleStats{
+		Execs: len(execEvents),
+		Forks: len(forkEvents),
+		Exits: len(exitEvents),
+	}
+
+	reasons := make(map[string]int)
+	for _, e := range exitEvents {
+		if e.Process == nil || !e.Process.Abnormal() {
+			continue
+		}
+		stats.AbnormalExits++
+		reasons[e.Process.ExitReason()]++
+		stats.RecentAbnormalExits = append(stats.RecentAbnormalExits, processExit(e))
+	}
+	stats.ExitReasons = topTargets(reasons)
+
+	sort.Slice(stats.RecentAbnormalExits, func(i, j int) bool {
+		return stats.RecentAbnormalExits[i].Time.After(stats.RecentAbnormalExits[j].Time)
+	})
+	if len(stats.RecentAbnormalExits) > maxTopEntries {
+		stats.RecentAbnormalExits = stats.RecentAbnormalExits[:maxTopEntries]
+	}
+
+	return stats
+}
+
+func processExit(e *events.Event) ProcessExit {
+	name := e.ProcessName
+	if name == "" {
+		name = e.Details
+	}
+	if name == "" {
+		name = "unknown"
+	}
+	return ProcessExit{
+		Time:       e.TimestampTime(),
+		PID:        e.PID,
+		Name:       name,
+		Container:  e.Container,
+		Reason:     e.Process.ExitReason(),
+		LifetimeMS: float64(e.LatencyNS) / 1e6,
+	}
+}
+
+// exitIssues reports crash loops, i.e. the same command in a container
+// exiting abnormally again and again, and otherwise each command that exited
+// abnormally. Processes killed by the OOM killer are left to memoryIssues.
+func exitIssues(exitEvents, oomEvents []*events.Event) []Issue {
+	oomKilled := make(map[uint32]bool)
+	for _, e := range oomEvents {
+		oomKilled[e.PID] = true
+	}
+
+	type command struct {
+		container string
+		name      string
+	}
+	var order []command
+	exits := make(map[command][]ProcessExit)
+	for _, e := range exitEvents {
+		if e.Process == nil || !e.Process.Abnormal() || oomKilled[e.PID] {
+			continue
+		}
+		exit := processExit(e)
+		cmd := command{exit.Container, exit.Name}
+		if _, ok := exits[cmd]; !ok {
+			order = append(order, cmd)
+		}
+		exits[cmd] = append(exits[cmd], exit)
+	}
+
+	var issues []Issue
+	for _, cmd := range order {
+		list := exits[cmd]
+		last := list[len(list)-1]
+		where := last.Name
+		if cmd.container != "" {
+			where = fmt.Sprintf("%s in container %s", last.Name, cmd.container)
+		}
+
+		if len(list) >= crashLoopMinExits {
+			var lifetime float64
+			for _, exit := range list {
+				lifetime += exit.LifetimeMS
+			}
+			issues = append(issues, Issue{
+				Kind: "crash_loop",
+				Message: fmt.Sprintf("Crash loop: %s exited abnormally %d times, living %s on average (last: %s)",
+					where, len(list), msDuration(lifetime/float64(len(list))), last.Reason),
+			})
+			continue
+		}
+
+		issues = append(issues, Issue{
+			Kind: "abnormal_exit",
+			Message: fmt.Sprintf("Abnormal exit: %s (PID %d) %s after %s",
+				where, last.PID, last.Reason, msDuration(last.LifetimeMS)),
+		})
+	}
+	return issues
+}
+
+func msDuration(ms float64) time.Duration {
+	return (time.Duration(ms * float64(time.Millisecond))).Round(time.Millisecond)
+}
+
+func (s *ProcessLifecycleStats) text() string {
+	var report string
+	report += fmt.Sprintf("Process Lifecycle:\n")
+	report += fmt.Sprintf("  Processes started: %d exec, %d fork\n", s.Execs, s.Forks)
+	report += fmt.Sprintf("  Processes exited: %d (%d abnormally)\n", s.Exits, s.AbnormalExits)
+	report += topTargetsText("Exit reasons", "exits", s.ExitReasons)
+	if len(s.RecentAbnormalExits) > 0 {
+		report += fmt.Sprintf("  Recent abnormal exits:\n")
+		for i, exit := range s.RecentAbnormalExits {
+			if i >= 5 {
+				break
+			}
+			name := exit.Name
+			if exit.Container != "" {
+				name = fmt.Sprintf("%s/%s", exit.Container, exit.Name)
+			}
+			report += fmt.Sprintf("    - %s PID %d (%s): %s after %s\n", exit.Time.Format("15:04:05"),
+				exit.PID, name, exit.Reason, msDuration(exit.LifetimeMS))
+		}
+	}
+	report += "\n"
+	return report
+}
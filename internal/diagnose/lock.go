@@ -0,0 +1,186 @@
+package diagnose
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/podtrace/podtrace/internal/events"
+)
+
+const (
+	// minContendedWaits is how many waits on one futex are needed before the
+	// lock contention rule fires
+	minContendedWaits = 50
+	// contendedWaitShare is the summed wait time on one futex, as a share of
+	// the collection period, reported as lock contention
+	contendedWaitShare = 0.1
+	// maxLockStackFrames is how many of a waiter's innermost user frames are
+	// kept per futex
+	maxLockStackFrames = 8
+)
+
+func analyzeLockContention(futexEvents []*events.Event, duration time.Duration) *LockContentionStats {
+	type futexKey struct {
+		pid     uint32
+		address uint64
+	}
+	type futexWaits struct {
+		stats     *FutexContention
+		latencies []float64
+		wakers    map[string]int
+		waiters   map[string]int
+		stacks    map[string][]string
+		stackUses map[string]int
+	}
+
+	stats := &LockContentionStats{
+		Waits:     len(futexEvents),
+		PerSecond: perSecond(len(futexEvents), duration),
+		Latency:   latencyStats(futexEvents),
+	}
+
+	byFutex := make(map[futexKey]*futexWaits)
+	for _, e := range futexEvents {
+		waitMS := float64(e.LatencyNS) / 1e6
+		stats.TotalWaitMS += waitMS
+		if e.Error == -110 { // ETIMEDOUT
+			stats.Timeouts++
+		}
+		if e.Futex == nil {
+			continue
+		}
+
+		key := futexKey{pid: e.PID, address: e.Futex.Address}
+		f, ok := byFutex[key]
+		if !ok {
+			f = &futexWaits{
+				stats: &FutexContention{
+					PID:     e.PID,
+					Address: fmt.Sprintf("0x%x", e.Futex.Address),
+					Op:      e.Futex.OpName(),
+				},
+				wakers:    make(map[string]int),
+				waiters:   make(map[string]int),
+				stacks:    make(map[string][]string),
+				stackUses: make(map[string]int),
+			}
+			byFutex[key] = f
+		}
+		if f.stats.Process == "" {
+			f.stats.Process = e.ProcessName
+		}
+		f.stats.Waits++
+		f.stats.TotalWaitMS += waitMS
+		f.latencies = append(f.latencies, waitMS)
+		if e.Error == 0 && e.Target != "" {
+			f.wakers[e.Target]++
+		}
+		if e.Details != "" {
+			f.waiters[e.Details]++
+		}
+		if len(e.Futex.UserStack) > 0 {
+			stack := e.Futex.UserStack[:min(len(e.Futex.UserStack), maxLockStackFrames)]
+			id := strings.Join(stack, ";")
+			f.stacks[id] = stack
+			f.stackUses[id]++
+		}
+	}
+
+	for _, f := range byFutex {
+		latency := latencyStatsMS(f.latencies)
+		f.stats.MaxMS = latency.MaxMS
+		f.stats.P95MS = latency.P95MS
+		f.stats.Wakers = topTargets(f.wakers)
+		f.stats.Waiters = topTargets(f.waiters)
+		if top := topTargets(f.stackUses); len(top) > 0 {
+			f.stats.WaiterStack = f.stacks[top[0].Target]
+		}
+		if f.stats.Process == "" {
+			f.stats.Process = "unknown"
+		}
+		stats.Futexes = append(stats.Futexes, *f.stats)
+	}
+	sort.Slice(stats.Futexes, func(i, j int) bool {
+		a, b := stats.Futexes[i], stats.Futexes[j]
+		if a.Waits != b.Waits {
+			return a.Waits > b.Waits
+		}
+		return a.TotalWaitMS > b.TotalWaitMS
+	})
+	if len(stats.Futexes) > maxTopEntries {
+		stats.Futexes = stats.Futexes[:maxTopEntries]
+	}
+	return stats
+}
+
+// lockContentionIssues reports futexes that threads wait on often and, summed
+// over all waiters, for a significant part of the collection period
+func lockContentionIssues(stats *LockContentionStats, duration time.Duration) []Issue {
+	if stats == nil || duration <= 0 {
+		return nil
+	}
+
+	var issues []Issue
+	for _, f := range stats.Futexes {
+		share := f.TotalWaitMS / float64(duration.Milliseconds())
+		if f.Waits < minContendedWaits || share < contendedWaitShare {
+			continue
+		}
+		woken := ""
+		if len(f.Wakers) > 0 {
+			woken = fmt.Sprintf(", mostly released by %s", f.Wakers[0].Target)
+		}
+		issues = append(issues, Issue{
+			Kind: "lock_contention",
+			Message: fmt.Sprintf("Lock contention: %d waits (%.2fms total, P95=%.2fms) on futex %s in %s (PID %d)%s",
+				f.Waits, f.TotalWaitMS, f.P95MS, f.Address, f.Process, f.PID, woken),
+		})
+	}
+	return issues
+}
+
+func (s *LockContentionStats) text() string {
+	var report string
+	report += fmt.Sprintf("Lock Contention:\n")
+	report += fmt.Sprintf("  Futex waits (>100µs): %d (%.1f/sec)\n", s.Waits, s.PerSecond)
+	report += fmt.Sprintf("  Total wait time: %.2fms\n", s.TotalWaitMS)
+	if s.Timeouts > 0 {
+		report += fmt.Sprintf("  Timed out waits: %d\n", s.Timeouts)
+	}
+	report += latencyText(s.Latency, "wait")
+	if len(s.Futexes) > 0 {
+		report += fmt.Sprintf("  Most contended futexes:\n")
+		for i, f := range s.Futexes {
+			if i >= 5 {
+				break
+			}
+			report += fmt.Sprintf("    - %s in %s (PID %d): %d waits, %.2fms total, P95 %.2fms, max %.2fms\n",
+				f.Address, f.Process, f.PID, f.Waits, f.TotalWaitMS, f.P95MS, f.MaxMS)
+			if len(f.Waiters) > 0 {
+				report += fmt.Sprintf("        waiters: %s\n", targetList(f.Waiters))
+			}
+			if len(f.Wakers) > 0 {
+				report += fmt.Sprintf("        woken by: %s\n", targetList(f.Wakers))
+			}
+			for _, frame := range f.WaiterStack {
+				report += fmt.Sprintf("        %s\n", frame)
+			}
+		}
+	}
+	report += "\n"
+	return report
+}
+
+// targetList formats the first few targets on one line, e.g. "a (3), b (1)"
+func targetList(targets []TargetCount) string {
+	var parts []string
+	for i, target := range targets {
+		if i >= 3 {
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%s (%d)", target.Target, target.Count))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,210 @@
+package diagnose
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/podtrace/podtrace/internal/events"
+)
+
+const (
+	// memoryLimitPercent is the peak usage, as a percentage of the memory
+	// limit, reported as a container running close to its limit
+	memoryLimitPercent = 90.0
+	// memoryStallPercent is the share of time some tasks were stalled on
+	// memory that is reported as memory pressure
+	memoryStallPercent = 10.0
+)
+
+func analyzeMemory(oomEvents, samples []*events.Event) *MemoryStats {
+	stats := &MemoryStats{Containers: analyzeContainerMemory(samples)}
+	for _, e := range oomEvents {
+		name := e.Target
+		if name == "" {
+			name = e.ProcessName
+		}
+		if name == "" {
+			name = "unknown"
+		}
+		kill := OOMKill{
+			Time:       e.TimestampTime(),
+			PID:        e.PID,
+			Name:       name,
+			Container:  e.Container,
+			Constraint: e.Details,
+		}
+		if e.OOM != nil {
+			kill.TriggerPID = e.OOM.TriggerPID
+			kill.Points = e.OOM.Points
+		}
+		stats.OOMKills = append(stats.OOMKills, kill)
+	}
+
+	if len(stats.OOMKills) == 0 && len(stats.Containers) == 0 {
+		return nil
+	}
+	return stats
+}
+
+// analyzeContainerMemory compares the first and last memory sample of each
+// container and tracks the peaks in between
+func analyzeContainerMemory(samples []*events.Event) []ContainerMemory {
+	byContainer := make(map[string][]*events.Event)
+	for _, e := range samples {
+		if e.CgroupMemory != nil {
+			byContainer[e.Container] = append(byContainer[e.Container], e)
+		}
+	}
+
+	var containers []ContainerMemory
+	for name, list := range byContainer {
+		first, last := list[0], list[len(list)-1]
+		from, to := first.CgroupMemory, last.CgroupMemory
+
+		memory := ContainerMemory{
+			Container:     name,
+			LimitBytes:    to.LimitBytes,
+			StartBytes:    from.UsageBytes,
+			EndBytes:      to.UsageBytes,
+			RSSStartBytes: from.AnonBytes,
+			RSSEndBytes:   to.AnonBytes,
+			HighEvents:    counterDelta(from.High, to.High),
+			MaxEvents:     counterDelta(from.Max, to.Max),
+			OOMEvents:     counterDelta(from.OOM, to.OOM),
+			OOMKills:      counterDelta(from.OOMKill, to.OOMKill),
+		}
+		for _, e := range list {
+			memory.PeakBytes = max(memory.PeakBytes, e.CgroupMemory.UsageBytes)
+			memory.RSSPeakBytes = max(memory.RSSPeakBytes, e.CgroupMemory.AnonBytes)
+		}
+		if memory.LimitBytes > 0 {
+			memory.PeakLimitPercent = float64(memory.PeakBytes) / float64(memory.LimitBytes) * 100
+		}
+
+		if last.Timestamp > first.Timestamp {
+			windowSec := float64(last.Timestamp-first.Timestamp) / 1e9
+			memory.RSSGrowthBytesPerSec = (float64(to.AnonBytes) - float64(from.AnonBytes)) / windowSec
+			memory.StallSomeSeconds = float64(counterDelta(from.PressureSomeUSec, to.PressureSomeUSec)) / 1e6
+			memory.StallFullSeconds = float64(counterDelta(from.PressureFullUSec, to.PressureFullUSec)) / 1e6
+			memory.StallSomePercent = memory.StallSomeSeconds / windowSec * 100
+			memory.StallFullPercent = memory.StallFullSeconds / windowSec * 100
+		}
+		containers = append(containers, memory)
+	}
+
+	sort.Slice(containers, func(i, j int) bool {
+		return containers[i].Container < containers[j].Container
+	})
+	return containers
+}
+
+// memoryIssues reports OOM kills, containers close to their memory limit and
+// containers stalled on memory reclaim
+func memoryIssues(stats *MemoryStats) []Issue {
+	if stats == nil {
+		return nil
+	}
+
+	var issues []Issue
+	traced := make(map[string]int)
+	for _, kill := range stats.OOMKills {
+		traced[kill.Container]++
+		where := kill.Name
+		if kill.Container != "" {
+			where = fmt.Sprintf("%s in container %s", kill.Name, kill.Container)
+		}
+		cause := "the OOM killer"
+		switch kill.Constraint {
+		case "memcg":
+			cause = "the OOM killer for exceeding its cgroup memory limit"
+		case "global":
+			cause = "the OOM killer because the node ran out of memory"
+		}
+		issues = append(issues, Issue{
+			Kind:    "oom_kill",
+			Message: fmt.Sprintf("OOM kill: %s (PID %d) was killed by %s", where, kill.PID, cause),
+		})
+	}
+
+	for _, c := range stats.Containers {
+		// memory.events also counts kills the probes did not see
+		if missed := int(c.OOMKills) - traced[c.Container]; missed > 0 {
+			issues = append(issues, Issue{
+				Kind:    "oom_kill",
+				Message: fmt.Sprintf("OOM kill: %d process(es) in container %s were killed for exceeding the memory limit", missed, c.Container),
+			})
+		}
+		if c.PeakLimitPercent >= memoryLimitPercent {
+			issues = append(issues, Issue{
+				Kind: "memory_limit",
+				Message: fmt.Sprintf("Memory near limit: container %s peaked at %.1f%% of its %s limit (%d allocations hit the limit)",
+					c.Container, c.PeakLimitPercent, formatBytes(float64(c.LimitBytes)), c.MaxEvents),
+			})
+		}
+		if c.StallSomePercent >= memoryStallPercent {
+			issues = append(issues, Issue{
+				Kind: "memory_pressure",
+				Message: fmt.Sprintf("Memory pressure: tasks in container %s were stalled on memory %.1f%% of the time (all tasks %.1f%%)",
+					c.Container, c.StallSomePercent, c.StallFullPercent),
+			})
+		}
+	}
+	return issues
+}
+
+// formatBytes formats a byte count with a binary unit, e.g. "512.0MiB"
+func formatBytes(bytes float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	sign := ""
+	if bytes < 0 {
+		sign, bytes = "-", -bytes
+	}
+	i := 0
+	for bytes >= 1024 && i < len(units)-1 {
+		bytes /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%s%.0fB", sign, bytes)
+	}
+	return fmt.Sprintf("%s%.1f%s", sign, bytes, units[i])
+}
+
+func (s *MemoryStats) text() string {
+	var report string
+	report += fmt.Sprintf("Memory:\n")
+	if len(s.OOMKills) > 0 {
+		report += fmt.Sprintf("  OOM kills: %d\n", len(s.OOMKills))
+		for i, kill := range s.OOMKills {
+			if i >= 5 {
+				break
+			}
+			name := kill.Name
+			if kill.Container != "" {
+				name = fmt.Sprintf("%s/%s", kill.Container, kill.Name)
+			}
+			constraint := ""
+			if kill.Constraint != "" {
+				constraint = fmt.Sprintf(" [%s]", kill.Constraint)
+			}
+			report += fmt.Sprintf("    - %s PID %d (%s)%s\n", kill.Time.Format("15:04:05"), kill.PID, name, constraint)
+		}
+	}
+	for _, c := range s.Containers {
+		report += fmt.Sprintf("  Container %s:\n", c.Container)
+		usage := fmt.Sprintf("%s -> %s (peak %s)", formatBytes(float64(c.StartBytes)), formatBytes(float64(c.EndBytes)), formatBytes(float64(c.PeakBytes)))
+		if c.LimitBytes > 0 {
+			usage += fmt.Sprintf(", limit %s (peak %.1f%%)", formatBytes(float64(c.LimitBytes)), c.PeakLimitPercent)
+		}
+		report += fmt.Sprintf("    Usage: %s\n", usage)
+		report += fmt.Sprintf("    RSS (anon): %s -> %s (peak %s, %s/min)\n", formatBytes(float64(c.RSSStartBytes)),
+			formatBytes(float64(c.RSSEndBytes)), formatBytes(float64(c.RSSPeakBytes)), formatBytes(c.RSSGrowthBytesPerSec*60))
+		report += fmt.Sprintf("    Memory events: %d high, %d max, %d oom, %d oom_kill\n", c.HighEvents, c.MaxEvents, c.OOMEvents, c.OOMKills)
+		if c.StallSomeSeconds > 0 || c.StallFullSeconds > 0 {
+			report += fmt.Sprintf("    Reclaim stalls: some %.2fs (%.1f%%), full %.2fs (%.1f%%)\n",
+				c.StallSomeSeconds, c.StallSomePercent, c.StallFullSeconds, c.StallFullPercent)
+		}
+	}
+	report += "\n"
+	return report
+}
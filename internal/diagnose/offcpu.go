@@ -0,0 +1,142 @@
+package diagnose
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/podtrace/podtrace/internal/events"
+)
+
+// maxStackFrames is how many frames of each stack the text report prints
+const maxStackFrames = 8
+
+// offCPUReasons totals off-CPU time by the state threads were switched out in
+func offCPUReasons(schedEvents []*events.Event) []OffCPUReason {
+	byState := make(map[string]*OffCPUReason)
+	for _, e := range schedEvents {
+		state := e.StateName()
+		if state == "" {
+			continue
+		}
+		reason, ok := byState[state]
+		if !ok {
+			reason = &OffCPUReason{State: state}
+			byState[state] = reason
+		}
+		reason.Count++
+		reason.TotalMS += float64(e.LatencyNS) / 1e6
+	}
+
+	reasons := make([]OffCPUReason, 0, len(byState))
+	for _, reason := range byState {
+		reasons = append(reasons, *reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		return reasons[i].TotalMS > reasons[j].TotalMS
+	})
+	return reasons
+}
+
+// topBlockingStacks groups off-CPU events by state and stack and returns the
+// groups with the most total off-CPU time
+func topBlockingStacks(schedEvents []*events.Event) []BlockingStack {
+	type group struct {
+		stack  BlockingStack
+		wakers map[string]int
+	}
+	groups := make(map[string]*group)
+
+	for _, e := range schedEvents {
+		if e.OffCPU == nil || (len(e.OffCPU.KernelStack) == 0 && len(e.OffCPU.UserStack) == 0) {
+			continue
+		}
+		state := e.StateName()
+		key := state + "\x00" + strings.Join(e.OffCPU.KernelStack, ";") + "\x00" + strings.Join(e.OffCPU.UserStack, ";")
+
+		g, ok := groups[key]
+		if !ok {
+			g = &group{
+				stack: BlockingStack{
+					State:       state,
+					KernelStack: e.OffCPU.KernelStack,
+					UserStack:   e.OffCPU.UserStack,
+				},
+				wakers: make(map[string]int),
+			}
+			groups[key] = g
+		}
+
+		latencyMS := float64(e.LatencyNS) / 1e6
+		g.stack.Count++
+		g.stack.TotalMS += latencyMS
+		if latencyMS > g.stack.MaxMS {
+			g.stack.MaxMS = latencyMS
+		}
+		if e.Target != "" {
+			g.wakers[e.Target]++
+		}
+	}
+
+	stacks := make([]BlockingStack, 0, len(groups))
+	for _, g := range groups {
+		g.stack.Wakers = topTargets(g.wakers)
+		stacks = append(stacks, g.stack)
+	}
+	sort.Slice(stacks, func(i, j int) bool {
+		return stacks[i].TotalMS > stacks[j].TotalMS
+	})
+	if len(stacks) > maxTopEntries {
+		stacks = stacks[:maxTopEntries]
+	}
+	return stacks
+}
+
+func offCPUReasonsText(reasons []OffCPUReason) string {
+	if len(reasons) == 0 {
+		return ""
+	}
+
+	report := fmt.Sprintf("  Off-CPU time by state:\n")
+	for _, reason := range reasons {
+		report += fmt.Sprintf("    - %s: %.2fms (%d blocks)\n", reason.State, reason.TotalMS, reason.Count)
+	}
+	return report
+}
+
+func blockingStacksText(stacks []BlockingStack) string {
+	if len(stacks) == 0 {
+		return ""
+	}
+
+	report := fmt.Sprintf("  Top blocking stacks:\n")
+	for i, stack := range stacks {
+		if i >= 5 {
+			break
+		}
+		report += fmt.Sprintf("    %d. %.2fms total, %d blocks, max %.2fms (%s)\n",
+			i+1, stack.TotalMS, stack.Count, stack.MaxMS, stack.State)
+		if len(stack.Wakers) > 0 {
+			var wakers []string
+			for _, waker := range stack.Wakers {
+				wakers = append(wakers, fmt.Sprintf("%s (%d)", waker.Target, waker.Count))
+			}
+			report += fmt.Sprintf("       Woken by: %s\n", strings.Join(wakers, ", "))
+		}
+		report += stackFramesText(stack.KernelStack, "[k]")
+		report += stackFramesText(stack.UserStack, "[u]")
+	}
+	return report
+}
+
+func stackFramesText(frames []string, tag string) string {
+	var report string
+	for i, frame := range frames {
+		if i >= maxStackFrames {
+			report += fmt.Sprintf("       %s ... %d more\n", tag, len(frames)-maxStackFrames)
+			break
+		}
+		report += fmt.Sprintf("       %s %s\n", tag, frame)
+	}
+	return report
+}
@@ -0,0 +1,139 @@
+package diagnose
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/podtrace/podtrace/internal/events"
+)
+
+const (
+	// minMajorFaults is how many major faults are needed before the major
+	// fault rule fires
+	minMajorFaults = 10
+	// majorFaultsPerSecond is the major fault rate reported as an issue
+	majorFaultsPerSecond = 1.0
+)
+
+// analyzePageFaults totals the per-process fault counts sampled from the
+// kernel and summarizes the traced major and slow faults. Without samples the
+// totals fall back to the traced faults.
+func analyzePageFaults(faultEvents, samples []*events.Event, duration time.Duration) *PageFaultStats {
+	stats := &PageFaultStats{}
+	byPID := make(map[uint32]*ProcessPageFaults)
+	process := func(e *events.Event) *ProcessPageFaults {
+		proc, ok := byPID[e.PID]
+		if !ok {
+			proc = &ProcessPageFaults{PID: e.PID}
+			byPID[e.PID] = proc
+		}
+		if proc.Name == "" {
+			proc.Name = e.ProcessName
+		}
+		return proc
+	}
+
+	for _, e := range samples {
+		if e.PageFaults == nil {
+			continue
+		}
+		proc := process(e)
+		proc.Minor += e.PageFaults.Minor
+		proc.Major += e.PageFaults.Major
+		stats.Minor += e.PageFaults.Minor
+		stats.Major += e.PageFaults.Major
+	}
+
+	var majorLatencies []float64
+	mappings := make(map[string]int)
+	for _, e := range faultEvents {
+		latencyMs := float64(e.LatencyNS) / 1e6
+		proc := process(e)
+		if e.Details != "major" {
+			stats.SlowMinor++
+			continue
+		}
+		stats.TracedMajor++
+		majorLatencies = append(majorLatencies, latencyMs)
+		stats.MajorTimeMS += latencyMs
+		proc.MajorTimeMS += latencyMs
+		if len(samples) == 0 {
+			proc.Major++
+			stats.Major++
+		}
+		if e.Target != "" {
+			mappings[e.Target]++
+		}
+	}
+	if stats.Minor == 0 && stats.Major == 0 && stats.SlowMinor == 0 {
+		return nil
+	}
+
+	stats.MinorPerSecond = perSecond(int(stats.Minor), duration)
+	stats.MajorPerSecond = perSecond(int(stats.Major), duration)
+	stats.MajorLatency = latencyStatsMS(majorLatencies)
+	stats.Mappings = topTargets(mappings)
+
+	for _, proc := range byPID {
+		if proc.Name == "" {
+			proc.Name = "unknown"
+		}
+		stats.Processes = append(stats.Processes, *proc)
+	}
+	sort.Slice(stats.Processes, func(i, j int) bool {
+		a, b := stats.Processes[i], stats.Processes[j]
+		if a.Major != b.Major {
+			return a.Major > b.Major
+		}
+		return a.Minor > b.Minor
+	})
+	if len(stats.Processes) > maxTopEntries {
+		stats.Processes = stats.Processes[:maxTopEntries]
+	}
+	return stats
+}
+
+// pageFaultIssues reports a sustained rate of major faults, which stall
+// threads on disk reads
+func pageFaultIssues(stats *PageFaultStats) []Issue {
+	if stats == nil || stats.Major < minMajorFaults || stats.MajorPerSecond < majorFaultsPerSecond {
+		return nil
+	}
+	where := ""
+	if len(stats.Mappings) > 0 {
+		where = fmt.Sprintf(", most in %s", stats.Mappings[0].Target)
+	}
+	return []Issue{{
+		Kind: "major_faults",
+		Message: fmt.Sprintf("Major page faults: %.1f/sec (%d total, P95=%.2fms each)%s; pages are being read back from disk, check memory pressure against the limit",
+			stats.MajorPerSecond, stats.Major, stats.MajorLatency.P95MS, where),
+	}}
+}
+
+func (s *PageFaultStats) text() string {
+	var report string
+	report += fmt.Sprintf("Page Faults:\n")
+	report += fmt.Sprintf("  Minor faults: %d (%.1f/sec)\n", s.Minor, s.MinorPerSecond)
+	report += fmt.Sprintf("  Major faults: %d (%.1f/sec)\n", s.Major, s.MajorPerSecond)
+	if s.TracedMajor > 0 {
+		report += fmt.Sprintf("  Time in major faults: %.2fms\n", s.MajorTimeMS)
+		report += latencyText(s.MajorLatency, "major fault latency")
+	}
+	if s.SlowMinor > 0 {
+		report += fmt.Sprintf("  Minor faults slower than 1ms: %d\n", s.SlowMinor)
+	}
+	report += topTargetsText("Top major fault mappings", "faults", s.Mappings)
+	if len(s.Processes) > 0 {
+		report += fmt.Sprintf("  Top faulting processes:\n")
+		for i, proc := range s.Processes {
+			if i >= 5 {
+				break
+			}
+			report += fmt.Sprintf("    - PID %d (%s): %d major (%.2fms), %d minor\n",
+				proc.PID, proc.Name, proc.Major, proc.MajorTimeMS, proc.Minor)
+		}
+	}
+	report += "\n"
+	return report
+}
@@ -0,0 +1,608 @@
+package diagnose
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Report formats accepted by Render
+const (
+	ReportFormatText = "text"
+	ReportFormatJSON = "json"
+	ReportFormatYAML = "yaml"
+)
+
+// Report is the structured result of a diagnostic run. Sections without any
+// matching events are left nil/empty. Latencies are in milliseconds.
+type Report struct {
+	StartTime         time.Time              `json:"start_time"`
+	EndTime           time.Time              `json:"end_time"`
+	DurationSeconds   float64                `json:"duration_seconds"`
+	Summary           Summary                `json:"summary"`
+	DNS               *DNSStats              `json:"dns,omitempty"`
+	DNSQueries        *DNSStats              `json:"dns_queries,omitempty"`
+	TCP               *TCPStats              `json:"tcp,omitempty"`
+	Connections       *ConnectionStats       `json:"connections,omitempty"`
+	Inbound           *InboundStats          `json:"inbound,omitempty"`
+	TCPConnections    *TCPConnectionStats    `json:"tcp_connections,omitempty"`
+	UDP               *UDPStats              `json:"udp,omitempty"`
+	FileSystem        *FileSystemStats       `json:"file_system,omitempty"`
+	CPU               *CPUStats              `json:"cpu,omitempty"`
+	RunQueue          *RunQueueStats         `json:"run_queue,omitempty"`
+	LockContention    *LockContentionStats   `json:"lock_contention,omitempty"`
+	Syscalls          *SyscallSummary        `json:"syscalls,omitempty"`
+	Memory            *MemoryStats           `json:"memory,omitempty"`
+	Disk              *DiskStats             `json:"disk,omitempty"`
+	PageFaults        *PageFaultStats        `json:"page_faults,omitempty"`
+	Lifecycle         *ProcessLifecycleStats `json:"process_lifecycle,omitempty"`
+	CPUUsage          *CPUUsage              `json:"cpu_usage,omitempty"`
+	Processes         []ProcessActivity      `json:"processes,omitempty"`
+	Containers        []ContainerActivity    `json:"containers,omitempty"`
+	Timeline          []TimelineBucket       `json:"timeline,omitempty"`
+	Bursts            []Burst                `json:"bursts,omitempty"`
+	ConnectionPattern *ConnectionPattern     `json:"connection_pattern,omitempty"`
+	NetworkIO         *NetworkIOPattern      `json:"network_io,omitempty"`
+	Issues            []Issue                `json:"issues,omitempty"`
+}
+
+type Summary struct {
+	TotalEvents     int     `json:"total_events"`
+	EventsPerSecond float64 `json:"events_per_second"`
+	TotalSamples    int     `json:"total_samples"`
+}
+
+// LatencyStats summarizes a latency distribution in milliseconds
+type LatencyStats struct {
+	AvgMS float64 `json:"avg_ms"`
+	MaxMS float64 `json:"max_ms"`
+	P50MS float64 `json:"p50_ms"`
+	P95MS float64 `json:"p95_ms"`
+	P99MS float64 `json:"p99_ms"`
+}
+
+type TargetCount struct {
+	Target string `json:"target"`
+	Count  int    `json:"count"`
+}
+
+type ErrorCount struct {
+	Code  int32  `json:"code"`
+	Name  string `json:"name,omitempty"`
+	Count int    `json:"count"`
+}
+
+// DNSStats summarizes either getaddrinfo calls or the queries seen on the
+// wire, which are kept apart since one getaddrinfo call usually issues several
+// queries. Errors are EAI codes for the former and response codes for the
+// latter.
+type DNSStats struct {
+	Lookups        int           `json:"lookups"`
+	PerSecond      float64       `json:"per_second"`
+	Latency        LatencyStats  `json:"latency"`
+	Errors         int           `json:"errors"`
+	ErrorPercent   float64       `json:"error_percent"`
+	ErrorBreakdown []ErrorCount  `json:"error_breakdown,omitempty"`
+	QueryTypes     []TargetCount `json:"query_types,omitempty"`
+	TopTargets     []TargetCount `json:"top_targets,omitempty"`
+}
+
+// TCPStats separates how long send/receive calls took (SyscallLatency, which
+// includes waiting on the peer) from the kernel's smoothed RTT (NetworkRTT)
+type TCPStats struct {
+	SendOps         int          `json:"send_ops"`
+	SendPerSecond   float64      `json:"send_per_second"`
+	RecvOps         int          `json:"recv_ops"`
+	RecvPerSecond   float64      `json:"recv_per_second"`
+	SyscallLatency  LatencyStats `json:"syscall_latency"`
+	SpikesOver100MS int          `json:"spikes_over_100ms"`
+	Errors          int          `json:"errors"`
+	ErrorPercent    float64      `json:"error_percent"`
+
+	NetworkRTT       *LatencyStats `json:"network_rtt,omitempty"`
+	RTTSamples       int           `json:"rtt_samples,omitempty"`
+	RTTConnections   int           `json:"rtt_connections,omitempty"`
+	MaxRTTVarMS      float64       `json:"max_rttvar_ms,omitempty"`
+	MinCongestionWnd uint32        `json:"min_snd_cwnd,omitempty"`
+
+	Retransmits           int                `json:"retransmits"`
+	RetransmitsPerSecond  float64            `json:"retransmits_per_second"`
+	ResetsSent            int                `json:"resets_sent"`
+	ResetsReceived        int                `json:"resets_received"`
+	RetransmitsByEndpoint []EndpointTCPStats `json:"retransmits_by_endpoint,omitempty"`
+
+	Peers []PeerTCPLatency `json:"peers,omitempty"`
+}
+
+// PeerTCPLatency summarizes send and receive latency and kernel RTT for one
+// remote host
+type PeerTCPLatency struct {
+	Peer    string        `json:"peer"`
+	Ops     int           `json:"ops"`
+	Errors  int           `json:"errors"`
+	Latency LatencyStats  `json:"latency"`
+	RTT     *LatencyStats `json:"rtt,omitempty"`
+}
+
+// EndpointTCPStats counts retransmits and resets for one remote endpoint
+type EndpointTCPStats struct {
+	Endpoint             string  `json:"endpoint"`
+	Retransmits          int     `json:"retransmits"`
+	RetransmitsPerSecond float64 `json:"retransmits_per_second"`
+	ResetsSent           int     `json:"resets_sent"`
+	ResetsReceived       int     `json:"resets_received"`
+}
+
+type ConnectionStats struct {
+	Total          int           `json:"total"`
+	PerSecond      float64       `json:"per_second"`
+	Latency        LatencyStats  `json:"latency"`
+	Failed         int           `json:"failed"`
+	FailedPercent  float64       `json:"failed_percent"`
+	ErrorBreakdown []ErrorCount  `json:"error_breakdown,omitempty"`
+	TopTargets     []TargetCount `json:"top_targets,omitempty"`
+}
+
+// InboundStats summarizes the connections accepted by the pod's listening
+// sockets. QueueWait covers the QueuedAccepts whose handshake was seen, and
+// PeakBacklog is the most connections left waiting after an accept. Listen
+// drops and overflows are counted by the pod's network namespace.
+type InboundStats struct {
+	Accepts         int           `json:"accepts"`
+	PerSecond       float64       `json:"per_second"`
+	QueuedAccepts   int           `json:"queued_accepts"`
+	QueueWait       LatencyStats  `json:"queue_wait"`
+	PeakBacklog     uint32        `json:"peak_backlog"`
+	BacklogLimit    uint32        `json:"backlog_limit,omitempty"`
+	ListenOverflows uint64        `json:"listen_overflows"`
+	ListenDrops     uint64        `json:"listen_drops"`
+	TopClients      []TargetCount `json:"top_clients,omitempty"`
+	LocalPorts      []TargetCount `json:"local_ports,omitempty"`
+}
+
+// TCPConnectionStats summarizes the TCP connections that closed during the
+// collection period. Duration is how long they were open; ShortLived counts
+// those open for less than a second. Ends counts how connections ended, as
+// in events.ConnectionInfo.
+type TCPConnectionStats struct {
+	Closed              int               `json:"closed"`
+	PerSecond           float64           `json:"per_second"`
+	Outbound            int               `json:"outbound"`
+	Inbound             int               `json:"inbound"`
+	Duration            LatencyStats      `json:"duration"`
+	BytesSent           uint64            `json:"bytes_sent"`
+	BytesReceived       uint64            `json:"bytes_received"`
+	ClosedLocally       int               `json:"closed_locally"`
+	ClosedRemotely      int               `json:"closed_remotely"`
+	Ends                []TargetCount     `json:"ends,omitempty"`
+	ShortLived          int               `json:"short_lived"`
+	ShortLivedPerSecond float64           `json:"short_lived_per_second"`
+	ByBytes             []PeerConnections `json:"top_by_bytes,omitempty"`
+	ByDuration          []PeerConnections `json:"top_by_duration,omitempty"`
+	Churn               []PeerConnections `json:"churn,omitempty"`
+}
+
+// PeerConnections is the closed connections to or from one peer: the remote
+// endpoint of outbound connections, or the remote address of inbound ones
+type PeerConnections struct {
+	Peer          string  `json:"peer"`
+	Direction     string  `json:"direction"`
+	Connections   int     `json:"connections"`
+	ShortLived    int     `json:"short_lived"`
+	BytesSent     uint64  `json:"bytes_sent"`
+	BytesReceived uint64  `json:"bytes_received"`
+	AvgDurationMS float64 `json:"avg_duration_ms"`
+	MaxDurationMS float64 `json:"max_duration_ms"`
+	Resets        int     `json:"resets"`
+}
+
+// UDPStats summarizes the pod's UDP send and receive calls and the datagrams
+// the kernel dropped before they reached its sockets. Bytes only count
+// successful calls, and receive latency includes waiting for a datagram.
+type UDPStats struct {
+	Sends             int           `json:"sends"`
+	SendsPerSecond    float64       `json:"sends_per_second"`
+	Receives          int           `json:"receives"`
+	ReceivesPerSecond float64       `json:"receives_per_second"`
+	BytesSent         uint64        `json:"bytes_sent"`
+	BytesReceived     uint64        `json:"bytes_received"`
+	SendLatency       LatencyStats  `json:"send_latency"`
+	ReceiveLatency    LatencyStats  `json:"receive_latency"`
+	Errors            int           `json:"errors"`
+	ErrorPercent      float64       `json:"error_percent"`
+	ErrorBreakdown    []ErrorCount  `json:"error_breakdown,omitempty"`
+	Drops             int           `json:"drops"`
+	DropsPerSecond    float64       `json:"drops_per_second"`
+	DropReasons       []TargetCount `json:"drop_reasons,omitempty"`
+	DroppingSockets   []TargetCount `json:"dropping_sockets,omitempty"`
+	Peers             []PeerUDP     `json:"peers,omitempty"`
+}
+
+// PeerUDP is the UDP traffic exchanged with one remote endpoint
+type PeerUDP struct {
+	Peer          string `json:"peer"`
+	Sends         int    `json:"sends"`
+	Receives      int    `json:"receives"`
+	BytesSent     uint64 `json:"bytes_sent"`
+	BytesReceived uint64 `json:"bytes_received"`
+	Errors        int    `json:"errors"`
+}
+
+type FileSystemStats struct {
+	WriteOps        int           `json:"write_ops"`
+	WritePerSecond  float64       `json:"write_per_second"`
+	ReadOps         int           `json:"read_ops"`
+	ReadPerSecond   float64       `json:"read_per_second"`
+	FsyncOps        int           `json:"fsync_ops"`
+	FsyncPerSecond  float64       `json:"fsync_per_second"`
+	Latency         LatencyStats  `json:"latency"`
+	SlowOpsOver10MS int           `json:"slow_ops_over_10ms"`
+	BytesRead       uint64        `json:"bytes_read"`
+	BytesWritten    uint64        `json:"bytes_written"`
+	TopFiles        []TargetCount `json:"top_files,omitempty"`
+	SlowestOps      []FileOp      `json:"slowest_ops,omitempty"`
+}
+
+// FileOp is a single traced file operation
+type FileOp struct {
+	Op             string  `json:"op"`
+	Path           string  `json:"path"`
+	FSType         string  `json:"fs_type,omitempty"`
+	Device         string  `json:"device,omitempty"`
+	LatencyMS      float64 `json:"latency_ms"`
+	BytesRequested uint64  `json:"bytes_requested,omitempty"`
+	BytesReturned  uint64  `json:"bytes_returned,omitempty"`
+	Error          string  `json:"error,omitempty"`
+}
+
+// CPUStats summarizes the periods threads spent off-CPU for longer than 1ms
+type CPUStats struct {
+	Switches       int             `json:"switches"`
+	PerSecond      float64         `json:"per_second"`
+	BlockTime      LatencyStats    `json:"block_time"`
+	BlockReasons   []OffCPUReason  `json:"block_reasons,omitempty"`
+	BlockingStacks []BlockingStack `json:"blocking_stacks,omitempty"`
+}
+
+// RunQueueStats summarizes how long runnable threads waited for a CPU.
+// Waits shorter than 100µs are not traced.
+type RunQueueStats struct {
+	Waits       int               `json:"waits"`
+	PerSecond   float64           `json:"per_second"`
+	Latency     LatencyStats      `json:"latency"`
+	TotalWaitMS float64           `json:"total_wait_ms"`
+	Processes   []ProcessRunQueue `json:"processes,omitempty"`
+}
+
+// ProcessRunQueue is the run-queue latency of a single process
+type ProcessRunQueue struct {
+	PID         uint32  `json:"pid"`
+	Name        string  `json:"name"`
+	Waits       int     `json:"waits"`
+	TotalWaitMS float64 `json:"total_wait_ms"`
+	MaxMS       float64 `json:"max_ms"`
+}
+
+// MemoryStats holds the OOM kills in the pod and each container's memory
+// usage over the collection period
+type MemoryStats struct {
+	OOMKills   []OOMKill         `json:"oom_kills,omitempty"`
+	Containers []ContainerMemory `json:"containers,omitempty"`
+}
+
+// OOMKill is a process killed by the OOM killer. Constraint is "memcg" when
+// the cgroup hit its memory limit and "global" when the node ran out of
+// memory, or empty if unknown.
+type OOMKill struct {
+	Time       time.Time `json:"time"`
+	PID        uint32    `json:"pid"`
+	Name       string    `json:"name"`
+	Container  string    `json:"container,omitempty"`
+	Constraint string    `json:"constraint,omitempty"`
+	TriggerPID uint32    `json:"trigger_pid,omitempty"`
+	Points     int64     `json:"points,omitempty"`
+}
+
+// ContainerMemory is a container's memory usage from its cgroup: usage and
+// RSS (anonymous memory) at the start and end of the period and at their
+// peak, the memory.events raised in between and the time tasks were stalled
+// on memory according to PSI. LimitBytes is 0 when there is no limit.
+type ContainerMemory struct {
+	Container            string  `json:"container"`
+	LimitBytes           uint64  `json:"limit_bytes,omitempty"`
+	StartBytes           uint64  `json:"start_bytes"`
+	EndBytes             uint64  `json:"end_bytes"`
+	PeakBytes            uint64  `json:"peak_bytes"`
+	PeakLimitPercent     float64 `json:"peak_limit_percent,omitempty"`
+	RSSStartBytes        uint64  `json:"rss_start_bytes"`
+	RSSEndBytes          uint64  `json:"rss_end_bytes"`
+	RSSPeakBytes         uint64  `json:"rss_peak_bytes"`
+	RSSGrowthBytesPerSec float64 `json:"rss_growth_bytes_per_second"`
+	HighEvents           uint64  `json:"high_events"`
+	MaxEvents            uint64  `json:"max_events"`
+	OOMEvents            uint64  `json:"oom_events"`
+	OOMKills             uint64  `json:"oom_kills"`
+	StallSomeSeconds     float64 `json:"stall_some_seconds"`
+	StallFullSeconds     float64 `json:"stall_full_seconds"`
+	StallSomePercent     float64 `json:"stall_some_percent"`
+	StallFullPercent     float64 `json:"stall_full_percent"`
+}
+
+// DiskStats summarizes the block device requests issued on behalf of the pod
+type DiskStats struct {
+	Devices []DeviceIO `json:"devices"`
+}
+
+// DeviceIO is the I/O to a single block device. Latency is the full request
+// latency, split into the time queued in the I/O scheduler and the time the
+// device took to service it.
+type DeviceIO struct {
+	Device           string       `json:"device"`
+	Name             string       `json:"name,omitempty"`
+	Ops              int          `json:"ops"`
+	IOPS             float64      `json:"iops"`
+	Reads            int          `json:"reads"`
+	Writes           int          `json:"writes"`
+	ReadBytes        uint64       `json:"read_bytes"`
+	WriteBytes       uint64       `json:"write_bytes"`
+	ReadBytesPerSec  float64      `json:"read_bytes_per_second"`
+	WriteBytesPerSec float64      `json:"write_bytes_per_second"`
+	Latency          LatencyStats `json:"latency"`
+	QueueLatency     LatencyStats `json:"queue_latency"`
+	ServiceLatency   LatencyStats `json:"service_latency"`
+	Errors           int          `json:"errors"`
+}
+
+// PageFaultStats summarizes the user page faults of the pod. Minor and Major
+// count every fault; only major faults and minor faults slower than 1ms are
+// traced individually, and MajorLatency and Mappings cover those.
+type PageFaultStats struct {
+	Minor          uint64              `json:"minor"`
+	Major          uint64              `json:"major"`
+	MinorPerSecond float64             `json:"minor_per_second"`
+	MajorPerSecond float64             `json:"major_per_second"`
+	TracedMajor    int                 `json:"traced_major"`
+	MajorTimeMS    float64             `json:"major_time_ms"`
+	MajorLatency   LatencyStats        `json:"major_latency"`
+	SlowMinor      int                 `json:"slow_minor"`
+	Mappings       []TargetCount       `json:"mappings,omitempty"`
+	Processes      []ProcessPageFaults `json:"processes,omitempty"`
+}
+
+// ProcessPageFaults is the page faults of a single process
+type ProcessPageFaults struct {
+	PID         uint32  `json:"pid"`
+	Name        string  `json:"name"`
+	Minor       uint64  `json:"minor"`
+	Major       uint64  `json:"major"`
+	MajorTimeMS float64 `json:"major_time_ms"`
+}
+
+// LockContentionStats summarizes the futex waits of the pod's threads, which
+// are waits on contended mutexes and condition variables. Waits shorter than
+// 100µs are not traced.
+type LockContentionStats struct {
+	Waits       int               `json:"waits"`
+	PerSecond   float64           `json:"per_second"`
+	Latency     LatencyStats      `json:"latency"`
+	TotalWaitMS float64           `json:"total_wait_ms"`
+	Timeouts    int               `json:"timeouts"`
+	Futexes     []FutexContention `json:"futexes,omitempty"`
+}
+
+// FutexContention is the waits on a single futex, identified by its address
+// in a process. Waiters and Wakers are thread command names; WaiterStack is
+// the most common user stack of the waiters, when lock stacks are recorded.
+type FutexContention struct {
+	PID         uint32        `json:"pid"`
+	Process     string        `json:"process"`
+	Address     string        `json:"address"`
+	Op          string        `json:"op"`
+	Waits       int           `json:"waits"`
+	TotalWaitMS float64       `json:"total_wait_ms"`
+	P95MS       float64       `json:"p95_ms"`
+	MaxMS       float64       `json:"max_ms"`
+	Waiters     []TargetCount `json:"waiters,omitempty"`
+	Wakers      []TargetCount `json:"wakers,omitempty"`
+	WaiterStack []string      `json:"waiter_stack,omitempty"`
+}
+
+// SyscallSummary counts the system calls made in the pod and the time spent
+// in them, like strace -c. Syscalls are the ones with the most time, with
+// percentiles estimated from log2 histograms.
+type SyscallSummary struct {
+	Calls        int              `json:"calls"`
+	PerSecond    float64          `json:"per_second"`
+	Errors       int              `json:"errors"`
+	ErrorPercent float64          `json:"error_percent"`
+	TotalTimeMS  float64          `json:"total_time_ms"`
+	Syscalls     []SyscallUsage   `json:"syscalls,omitempty"`
+	Failures     []SyscallFailure `json:"failures,omitempty"`
+}
+
+// SyscallUsage is the calls to a single system call
+type SyscallUsage struct {
+	Name        string  `json:"name"`
+	Calls       int     `json:"calls"`
+	Errors      int     `json:"errors"`
+	TotalTimeMS float64 `json:"total_time_ms"`
+	TimePercent float64 `json:"time_percent"`
+	AvgUS       float64 `json:"avg_us"`
+	P50MS       float64 `json:"p50_ms"`
+	P95MS       float64 `json:"p95_ms"`
+	P99MS       float64 `json:"p99_ms"`
+}
+
+// SyscallFailure is how often a system call failed with an errno
+type SyscallFailure struct {
+	Syscall   string  `json:"syscall"`
+	Errno     string  `json:"errno"`
+	Count     int     `json:"count"`
+	PerSecond float64 `json:"per_second"`
+}
+
+// ProcessLifecycleStats counts the processes started and exited in the pod.
+// An exit is abnormal when the process was killed by a signal or exited with
+// a non-zero status.
+type ProcessLifecycleStats struct {
+	Execs               int           `json:"execs"`
+	Forks               int           `json:"forks"`
+	Exits               int           `json:"exits"`
+	AbnormalExits       int           `json:"abnormal_exits"`
+	ExitReasons         []TargetCount `json:"exit_reasons,omitempty"`
+	RecentAbnormalExits []ProcessExit `json:"recent_abnormal_exits,omitempty"`
+}
+
+// ProcessExit is a single abnormal process exit
+type ProcessExit struct {
+	Time       time.Time `json:"time"`
+	PID        uint32    `json:"pid"`
+	Name       string    `json:"name"`
+	Container  string    `json:"container,omitempty"`
+	Reason     string    `json:"reason"`
+	LifetimeMS float64   `json:"lifetime_ms"`
+}
+
+// OffCPUReason is the off-CPU time spent in one task state, such as
+// sleeping or uninterruptible (D)
+type OffCPUReason struct {
+	State   string  `json:"state"`
+	Count   int     `json:"count"`
+	TotalMS float64 `json:"total_ms"`
+}
+
+// BlockingStack is a kernel and user stack that threads blocked in, ranked
+// by total off-CPU time. Frames are innermost first.
+type BlockingStack struct {
+	State       string        `json:"state"`
+	Count       int           `json:"count"`
+	TotalMS     float64       `json:"total_ms"`
+	MaxMS       float64       `json:"max_ms"`
+	Wakers      []TargetCount `json:"wakers,omitempty"`
+	KernelStack []string      `json:"kernel_stack,omitempty"`
+	UserStack   []string      `json:"user_stack,omitempty"`
+}
+
+// CPUUsage attributes CPU time to the processes seen during the run
+// CPUUsage is the on-CPU time of the traced processes, measured from
+// scheduler switches, and the CPU accounting of each container's cgroup.
+// Percentages are of a single CPU, so they exceed 100 on multiple cores.
+type CPUUsage struct {
+	PodProcesses           []ProcessCPU   `json:"pod_processes,omitempty"`
+	KernelProcesses        []ProcessCPU   `json:"kernel_processes,omitempty"`
+	KernelProcessesOmitted int            `json:"kernel_processes_omitted,omitempty"`
+	TotalPercent           float64        `json:"total_percent"`
+	TotalSeconds           float64        `json:"total_seconds"`
+	Containers             []ContainerCPU `json:"containers,omitempty"`
+}
+
+type ProcessCPU struct {
+	PID        uint32  `json:"pid"`
+	Name       string  `json:"name"`
+	Threads    int     `json:"threads"`
+	CPUPercent float64 `json:"cpu_percent"`
+	CPUSeconds float64 `json:"cpu_seconds"`
+}
+
+// ContainerCPU is a container's CPU usage and CFS throttling over the
+// collection period, from its cgroup's cpu.stat. LimitCores is 0 when the
+// container has no CPU limit.
+type ContainerCPU struct {
+	Container               string  `json:"container"`
+	CPUSeconds              float64 `json:"cpu_seconds"`
+	LimitCores              float64 `json:"limit_cores,omitempty"`
+	LimitUtilizationPercent float64 `json:"limit_utilization_percent,omitempty"`
+	Periods                 uint64  `json:"periods"`
+	ThrottledPeriods        uint64  `json:"throttled_periods"`
+	ThrottledPercent        float64 `json:"throttled_percent"`
+	ThrottledSeconds        float64 `json:"throttled_seconds"`
+}
+
+type ProcessActivity struct {
+	PID     uint32  `json:"pid"`
+	Name    string  `json:"name"`
+	Events  int     `json:"events"`
+	Percent float64 `json:"percent"`
+}
+
+type ContainerActivity struct {
+	Name    string  `json:"name"`
+	Events  int     `json:"events"`
+	Percent float64 `json:"percent"`
+}
+
+type TimelineBucket struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Events  int       `json:"events"`
+	Percent float64   `json:"percent"`
+}
+
+type Burst struct {
+	Time       time.Time `json:"time"`
+	Rate       float64   `json:"rate"`
+	Multiplier float64   `json:"multiplier"`
+}
+
+type ConnectionPattern struct {
+	Pattern       string  `json:"pattern"`
+	AvgRate       float64 `json:"avg_rate"`
+	PeakRate      float64 `json:"peak_rate"`
+	UniqueTargets int     `json:"unique_targets"`
+}
+
+// NetworkIOPattern is the TCP traffic moved by the pod's send and receive
+// calls. SendRecvRatio compares bytes sent to bytes received; throughput is in
+// bytes per second, the peak over one-second windows.
+type NetworkIOPattern struct {
+	SendRecvRatio   float64          `json:"send_recv_ratio"`
+	BytesSent       uint64           `json:"bytes_sent"`
+	BytesReceived   uint64           `json:"bytes_received"`
+	SendBytesPerSec float64          `json:"send_bytes_per_second"`
+	RecvBytesPerSec float64          `json:"recv_bytes_per_second"`
+	AvgThroughput   float64          `json:"avg_bytes_per_second"`
+	PeakThroughput  float64          `json:"peak_bytes_per_second"`
+	Peers           []PeerThroughput `json:"peers,omitempty"`
+}
+
+// PeerThroughput is the TCP traffic to and from one remote host, or
+// "unknown" when the endpoint was not recorded
+type PeerThroughput struct {
+	Peer            string  `json:"peer"`
+	Sends           int     `json:"sends"`
+	Receives        int     `json:"receives"`
+	BytesSent       uint64  `json:"bytes_sent"`
+	BytesReceived   uint64  `json:"bytes_received"`
+	SendBytesPerSec float64 `json:"send_bytes_per_second"`
+	RecvBytesPerSec float64 `json:"recv_bytes_per_second"`
+}
+
+// Issue is a potential problem found by one of the detectIssues rules
+type Issue struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// Render formats the report as text, JSON or YAML
+func (r *Report) Render(format string) (string, error) {
+	switch format {
+	case "", ReportFormatText:
+		return r.Text(), nil
+	case ReportFormatJSON:
+		data, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to encode report as JSON: %w", err)
+		}
+		return string(data) + "\n", nil
+	case ReportFormatYAML:
+		data, err := yaml.Marshal(r)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode report as YAML: %w", err)
+		}
+		return string(data), nil
+	default:
+		return "", fmt.Errorf("unknown report format %q (expected text, json or yaml)", format)
+	}
+}
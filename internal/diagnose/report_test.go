@@ -0,0 +1,726 @@
+package diagnose
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/podtrace/podtrace/internal/events"
+)
+
+func newTestDiagnostician(evs ...*events.Event) *Diagnostician {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	d := &Diagnostician{
+		startTime: start,
+		endTime:   start.Add(10 * time.Second),
+	}
+	for i, e := range evs {
+		if e.Timestamp == 0 {
+			e.Timestamp = uint64(start.Add(time.Duration(i) * time.Second).UnixNano())
+		}
+		d.AddEvent(e)
+	}
+	return d
+}
+
+func TestBuildReport(t *testing.T) {
+	d := newTestDiagnostician(
+		&events.Event{PID: 1, ProcessName: "app", Type: events.EventDNS, LatencyNS: 2e6, Target: "example.com"},
+		&events.Event{PID: 1, ProcessName: "app", Type: events.EventDNS, LatencyNS: 4e6, Target: "example.com", Error: -2},
+		&events.Event{PID: 1, ProcessName: "app", Type: events.EventConnect, LatencyNS: 1e6, Target: "10.0.0.1:00443", Error: -111},
+		&events.Event{PID: 1, ProcessName: "app", Type: events.EventDNSQuery, LatencyNS: 1e6, Target: "example.com", Details: "A"},
+		&events.Event{PID: 1, ProcessName: "app", Type: events.EventDNSQuery, LatencyNS: 1e6, Target: "example.com", Details: "AAAA", Error: 3},
+	)
+
+	report := d.BuildReport()
+
+	if report.Summary.TotalEvents != 5 {
+		t.Errorf("TotalEvents = %d, expected 5", report.Summary.TotalEvents)
+	}
+	if report.DNS == nil {
+		t.Fatal("expected DNS section")
+	}
+	if report.DNS.Lookups != 2 || report.DNS.Errors != 1 {
+		t.Errorf("DNS lookups/errors = %d/%d, expected 2/1", report.DNS.Lookups, report.DNS.Errors)
+	}
+	if report.DNS.Latency.MaxMS != 4 || report.DNS.Latency.AvgMS != 3 {
+		t.Errorf("DNS latency = %+v, expected avg 3ms and max 4ms", report.DNS.Latency)
+	}
+	if len(report.DNS.TopTargets) != 1 || report.DNS.TopTargets[0].Count != 2 {
+		t.Errorf("DNS top targets = %+v", report.DNS.TopTargets)
+	}
+	// queries on the wire are counted apart from the lookups that issued them
+	if q := report.DNSQueries; q == nil || q.Lookups != 2 || q.Errors != 1 || len(q.QueryTypes) != 2 {
+		t.Errorf("DNS queries = %+v", q)
+	}
+	if report.Connections == nil || len(report.Connections.ErrorBreakdown) != 1 {
+		t.Fatal("expected connection error breakdown")
+	}
+	if name := report.Connections.ErrorBreakdown[0].Name; name != "ECONNREFUSED" {
+		t.Errorf("error name = %q, expected ECONNREFUSED", name)
+	}
+	if report.TCP != nil || report.FileSystem != nil {
+		t.Error("expected no TCP or file system sections")
+	}
+	if len(report.Issues) != 1 || report.Issues[0].Kind != "connection_failures" {
+		t.Errorf("issues = %+v, expected one connection_failures issue", report.Issues)
+	}
+}
+
+func TestReportRender(t *testing.T) {
+	d := newTestDiagnostician(
+		&events.Event{PID: 1, ProcessName: "app", Type: events.EventDNS, LatencyNS: 2e6, Target: "example.com"},
+	)
+	report := d.BuildReport()
+
+	text, err := report.Render(ReportFormatText)
+	if err != nil {
+		t.Fatalf("text render failed: %v", err)
+	}
+	if text != d.GenerateReport() {
+		t.Error("text render should match GenerateReport")
+	}
+	if !strings.Contains(text, "DNS Statistics:") {
+		t.Error("text report should contain DNS Statistics")
+	}
+
+	out, err := report.Render(ReportFormatJSON)
+	if err != nil {
+		t.Fatalf("JSON render failed: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &decoded); err != nil {
+		t.Fatalf("JSON report is invalid: %v", err)
+	}
+	if _, ok := decoded["dns"]; !ok {
+		t.Error("JSON report should contain dns section")
+	}
+
+	out, err = report.Render(ReportFormatYAML)
+	if err != nil {
+		t.Fatalf("YAML render failed: %v", err)
+	}
+	if !strings.Contains(out, "dns:") || !strings.Contains(out, "p99_ms:") {
+		t.Errorf("YAML report missing expected keys:\n%s", out)
+	}
+
+	if _, err := report.Render("xml"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestEmptyReport(t *testing.T) {
+	d := newTestDiagnostician()
+	report := d.BuildReport()
+	if report.Text() != "No events collected during the diagnostic period.\n" {
+		t.Errorf("unexpected empty report text: %q", report.Text())
+	}
+	if _, err := report.Render(ReportFormatJSON); err != nil {
+		t.Errorf("empty report should render as JSON: %v", err)
+	}
+}
+
+func TestReportFromSamplesOnly(t *testing.T) {
+	report := newTestDiagnostician(
+		&events.Event{Type: events.EventSyscall, Container: "app", Target: "read",
+			Syscall: &events.SyscallStats{Count: 5, TotalNS: 5e6, Histogram: make([]uint64, 24)}},
+		&events.Event{Type: events.EventNetStat, NetStat: &events.NetStats{Namespace: 1}},
+		&events.Event{Type: events.EventNetStat, NetStat: &events.NetStats{Namespace: 1, ListenOverflows: 3, ListenDrops: 3}},
+	).BuildReport()
+
+	if report.Summary.TotalEvents != 0 || report.Summary.TotalSamples != 3 {
+		t.Errorf("summary = %+v", report.Summary)
+	}
+	if report.Syscalls == nil || report.Syscalls.Calls != 5 {
+		t.Errorf("syscalls = %+v", report.Syscalls)
+	}
+	if report.Inbound == nil || report.Inbound.ListenOverflows != 3 {
+		t.Errorf("inbound = %+v", report.Inbound)
+	}
+	if text := report.Text(); !strings.Contains(text, "Samples: 3") || !strings.Contains(text, "read") {
+		t.Errorf("report text is missing the sampled sections:\n%s", text)
+	}
+}
+
+func TestTCPRetransmitsByEndpoint(t *testing.T) {
+	var evs []*events.Event
+	for i := 0; i < 12; i++ {
+		evs = append(evs, &events.Event{Type: events.EventTCPRetransmit, Target: "10.0.0.1:00443", State: 1})
+	}
+	evs = append(evs,
+		&events.Event{Type: events.EventTCPRetransmit, Target: "10.0.0.2:00080", State: 1},
+		&events.Event{Type: events.EventTCPRecvReset, Target: "10.0.0.2:00080", State: 1},
+	)
+
+	report := newTestDiagnostician(evs...).BuildReport()
+
+	if report.TCP == nil {
+		t.Fatal("expected TCP section")
+	}
+	if report.TCP.Retransmits != 13 || report.TCP.ResetsReceived != 1 {
+		t.Errorf("retransmits/resets = %d/%d, expected 13/1", report.TCP.Retransmits, report.TCP.ResetsReceived)
+	}
+	endpoints := report.TCP.RetransmitsByEndpoint
+	if len(endpoints) != 2 || endpoints[0].Endpoint != "10.0.0.1:00443" || endpoints[0].RetransmitsPerSecond != 1.2 {
+		t.Errorf("endpoints = %+v", endpoints)
+	}
+	if len(report.Issues) != 1 || report.Issues[0].Kind != "tcp_retransmits" {
+		t.Errorf("issues = %+v, expected one tcp_retransmits issue", report.Issues)
+	}
+	if !strings.Contains(report.Text(), "Retransmits by endpoint:") {
+		t.Error("text report should list retransmits by endpoint")
+	}
+}
+
+func TestTCPSyscallLatencyAndNetworkRTT(t *testing.T) {
+	d := newTestDiagnostician(
+		&events.Event{PID: 1, Type: events.EventTCPRecv, LatencyNS: 500e6},
+		&events.Event{Type: events.EventTCPRTT, LatencyNS: 2e6, Target: "10.0.0.1:00443", Details: "10.0.0.9:40000",
+			TCPInfo: &events.TCPInfo{RTTVarUS: 500, SndCwnd: 10}},
+		&events.Event{Type: events.EventTCPRTT, LatencyNS: 4e6, Target: "10.0.0.1:00443", Details: "10.0.0.9:40000",
+			TCPInfo: &events.TCPInfo{RTTVarUS: 1500, SndCwnd: 4}},
+	)
+
+	tcp := d.BuildReport().TCP
+	if tcp == nil || tcp.NetworkRTT == nil {
+		t.Fatal("expected TCP section with network RTT")
+	}
+	if tcp.SyscallLatency.MaxMS != 500 {
+		t.Errorf("syscall latency max = %v, expected 500ms", tcp.SyscallLatency.MaxMS)
+	}
+	if tcp.NetworkRTT.AvgMS != 3 || tcp.RTTSamples != 2 || tcp.RTTConnections != 1 {
+		t.Errorf("network RTT = %+v, samples %d, connections %d", tcp.NetworkRTT, tcp.RTTSamples, tcp.RTTConnections)
+	}
+	if tcp.MaxRTTVarMS != 1.5 || tcp.MinCongestionWnd != 4 {
+		t.Errorf("max rttvar = %v, min cwnd = %d", tcp.MaxRTTVarMS, tcp.MinCongestionWnd)
+	}
+
+	text := tcp.text()
+	if !strings.Contains(text, "Syscall latency:") || !strings.Contains(text, "Network RTT (2 samples from 1 connections):") {
+		t.Errorf("unexpected TCP text:\n%s", text)
+	}
+}
+
+func TestFileSystemSlowestOps(t *testing.T) {
+	dev := uint32(8<<20 | 1)
+	report := newTestDiagnostician(
+		&events.Event{Type: events.EventRead, LatencyNS: 5e6, Target: "/var/lib/app/data.db", Details: "ext4",
+			FileInfo: &events.FileInfo{BytesRequested: 8192, BytesReturned: 4096, Device: dev}},
+		&events.Event{Type: events.EventWrite, LatencyNS: 40e6, Target: "/var/log/app.log", Details: "overlay",
+			FileInfo: &events.FileInfo{BytesRequested: 512, BytesReturned: 512, Device: dev}},
+		&events.Event{Type: events.EventFsync, LatencyNS: 20e6, Target: "/var/log/app.log", Details: "overlay",
+			FileInfo: &events.FileInfo{Device: dev}},
+	).BuildReport()
+
+	fs := report.FileSystem
+	if fs == nil {
+		t.Fatal("expected file system section")
+	}
+	if fs.BytesRead != 4096 || fs.BytesWritten != 512 {
+		t.Errorf("bytes read/written = %d/%d, expected 4096/512", fs.BytesRead, fs.BytesWritten)
+	}
+	if len(fs.TopFiles) != 2 || fs.TopFiles[0].Target != "/var/log/app.log" {
+		t.Errorf("top files = %+v", fs.TopFiles)
+	}
+	if len(fs.SlowestOps) != 3 || fs.SlowestOps[0].Op != "write" || fs.SlowestOps[0].Device != "8:1" {
+		t.Errorf("slowest ops = %+v", fs.SlowestOps)
+	}
+	if !strings.Contains(report.Text(), "read /var/lib/app/data.db (ext4 on 8:1): 5.00ms, 4096/8192 bytes") {
+		t.Errorf("text report missing slow read:\n%s", report.Text())
+	}
+}
+
+func TestTopBlockingStacks(t *testing.T) {
+	futex := &events.OffCPUInfo{
+		KernelStack: []string{"__schedule+0x2a", "schedule+0x4e", "futex_wait+0x11"},
+		UserStack:   []string{"pthread_mutex_lock+0x80", "handle_request+0x1c"},
+	}
+	disk := &events.OffCPUInfo{
+		KernelStack: []string{"__schedule+0x2a", "io_schedule+0x12", "folio_wait_bit+0x90"},
+	}
+	report := newTestDiagnostician(
+		&events.Event{Type: events.EventSchedSwitch, LatencyNS: 30e6, State: 1, Target: "worker", OffCPU: futex},
+		&events.Event{Type: events.EventSchedSwitch, LatencyNS: 20e6, State: 1, Target: "worker", OffCPU: futex},
+		&events.Event{Type: events.EventSchedSwitch, LatencyNS: 10e6, State: 2, OffCPU: disk},
+	).BuildReport()
+
+	cpu := report.CPU
+	if cpu == nil {
+		t.Fatal("expected CPU section")
+	}
+	if len(cpu.BlockReasons) != 2 || cpu.BlockReasons[0].State != "sleeping" || cpu.BlockReasons[0].TotalMS != 50 {
+		t.Errorf("block reasons = %+v", cpu.BlockReasons)
+	}
+	if len(cpu.BlockingStacks) != 2 {
+		t.Fatalf("got %d blocking stacks, expected 2", len(cpu.BlockingStacks))
+	}
+	top := cpu.BlockingStacks[0]
+	if top.Count != 2 || top.MaxMS != 30 || len(top.Wakers) != 1 || top.Wakers[0].Target != "worker" {
+		t.Errorf("top stack = %+v", top)
+	}
+	if text := report.Text(); !strings.Contains(text, "[u] pthread_mutex_lock+0x80") ||
+		!strings.Contains(text, "uninterruptible (D): 10.00ms (1 blocks)") {
+		t.Errorf("text report missing blocking stacks:\n%s", text)
+	}
+}
+
+func TestRunQueueLatencyAndStarvation(t *testing.T) {
+	var evs []*events.Event
+	for i := 0; i < 20; i++ {
+		evs = append(evs, &events.Event{Type: events.EventRunQueue, PID: 100, TID: 101, ProcessName: "api", LatencyNS: 15e6})
+	}
+	evs = append(evs, &events.Event{Type: events.EventRunQueue, PID: 200, TID: 200, ProcessName: "sidecar", LatencyNS: 2e6})
+
+	report := newTestDiagnostician(evs...).BuildReport()
+
+	runq := report.RunQueue
+	if runq == nil {
+		t.Fatal("expected run queue section")
+	}
+	if runq.Waits != 21 || runq.TotalWaitMS != 302 {
+		t.Errorf("waits = %d, total = %.2fms, expected 21 and 302ms", runq.Waits, runq.TotalWaitMS)
+	}
+	if len(runq.Processes) != 2 || runq.Processes[0].Name != "api" || runq.Processes[0].Waits != 20 {
+		t.Errorf("processes = %+v", runq.Processes)
+	}
+	if len(report.Issues) != 1 || report.Issues[0].Kind != "cpu_starvation" {
+		t.Errorf("issues = %+v, expected one cpu_starvation issue", report.Issues)
+	}
+	if !strings.Contains(report.Text(), "Run Queue Latency:") {
+		t.Error("text report should have a run queue section")
+	}
+}
+
+func TestProcessLifecycleAndCrashLoop(t *testing.T) {
+	exit := func(pid uint32, name string, code uint32) *events.Event {
+		return &events.Event{Type: events.EventProcessExit, PID: pid, ProcessName: name, Container: "app",
+			LatencyNS: 2e9, Process: &events.ProcessInfo{PPID: 1, ExitCode: code}}
+	}
+	evs := []*events.Event{
+		{Type: events.EventProcessExec, PID: 10, Target: "/usr/bin/worker", Process: &events.ProcessInfo{PPID: 1}},
+		{Type: events.EventProcessFork, PID: 1, Process: &events.ProcessInfo{ChildPID: 11}},
+		exit(10, "worker", 11),     // SIGSEGV
+		exit(11, "worker", 1<<8),   // exit status 1
+		exit(12, "worker", 11),     // SIGSEGV
+		exit(13, "migrate", 9),     // SIGKILL
+		exit(14, "healthcheck", 0), // clean exit
+	}
+
+	report := newTestDiagnostician(evs...).BuildReport()
+
+	lifecycle := report.Lifecycle
+	if lifecycle == nil {
+		t.Fatal("expected process lifecycle section")
+	}
+	if lifecycle.Execs != 1 || lifecycle.Forks != 1 || lifecycle.Exits != 5 || lifecycle.AbnormalExits != 4 {
+		t.Errorf("lifecycle = %+v", lifecycle)
+	}
+	if len(lifecycle.ExitReasons) == 0 || lifecycle.ExitReasons[0].Target != "killed by SIGSEGV" {
+		t.Errorf("exit reasons = %+v", lifecycle.ExitReasons)
+	}
+
+	if len(report.Issues) != 2 {
+		t.Fatalf("issues = %+v, expected a crash loop and an abnormal exit", report.Issues)
+	}
+	if report.Issues[0].Kind != "crash_loop" || !strings.Contains(report.Issues[0].Message, "worker in container app exited abnormally 3 times") {
+		t.Errorf("unexpected crash loop issue %+v", report.Issues[0])
+	}
+	if report.Issues[1].Kind != "abnormal_exit" || !strings.Contains(report.Issues[1].Message, "killed by SIGKILL") {
+		t.Errorf("unexpected abnormal exit issue %+v", report.Issues[1])
+	}
+	if !strings.Contains(report.Text(), "Process Lifecycle:") {
+		t.Error("text report should have a process lifecycle section")
+	}
+}
+
+func TestMemoryOOMAndPressure(t *testing.T) {
+	const mib = 1 << 20
+	evs := []*events.Event{
+		{Type: events.EventCgroupMemory, Container: "app", CgroupMemory: &events.CgroupMemory{
+			UsageBytes: 300 * mib, LimitBytes: 512 * mib, AnonBytes: 200 * mib, PressureSomeUSec: 1e6}},
+		{Type: events.EventCgroupMemory, Container: "app", CgroupMemory: &events.CgroupMemory{
+			UsageBytes: 500 * mib, LimitBytes: 512 * mib, AnonBytes: 480 * mib, Max: 40, OOM: 1, OOMKill: 1, PressureSomeUSec: 3e6}},
+		{Type: events.EventOOMKill, PID: 42, Target: "java", Container: "app", Details: "memcg", OOM: &events.OOMInfo{TriggerPID: 42}},
+		{Type: events.EventProcessExit, PID: 42, ProcessName: "java", Container: "app", Process: &events.ProcessInfo{ExitCode: 9}},
+		{Type: events.EventCgroupMemory, Container: "app", CgroupMemory: &events.CgroupMemory{
+			UsageBytes: 100 * mib, LimitBytes: 512 * mib, AnonBytes: 80 * mib, Max: 40, OOM: 1, OOMKill: 1, PressureSomeUSec: 4e6}},
+	}
+
+	report := newTestDiagnostician(evs...).BuildReport()
+
+	memory := report.Memory
+	if memory == nil || len(memory.OOMKills) != 1 || len(memory.Containers) != 1 {
+		t.Fatalf("memory = %+v, expected one OOM kill and one container", memory)
+	}
+	c := memory.Containers[0]
+	if c.PeakBytes != 500*mib || c.RSSPeakBytes != 480*mib || c.OOMKills != 1 || c.MaxEvents != 40 {
+		t.Errorf("container memory = %+v", c)
+	}
+	// 3s of stalls over the 4s between the first and last sample
+	if c.StallSomeSeconds != 3 || c.StallSomePercent != 75 {
+		t.Errorf("stalls = %.2fs (%.1f%%), expected 3s (75%%)", c.StallSomeSeconds, c.StallSomePercent)
+	}
+
+	kinds := make(map[string]int)
+	for _, issue := range report.Issues {
+		kinds[issue.Kind]++
+	}
+	if kinds["oom_kill"] != 1 || kinds["memory_limit"] != 1 || kinds["memory_pressure"] != 1 || kinds["abnormal_exit"] != 0 {
+		t.Errorf("issues = %+v", report.Issues)
+	}
+	if !strings.Contains(report.Text(), "Memory:") {
+		t.Error("text report should have a memory section")
+	}
+}
+
+func TestDiskIO(t *testing.T) {
+	dev := uint32(259<<20 | 0)
+	var evs []*events.Event
+	for i := 0; i < 10; i++ {
+		evs = append(evs, &events.Event{Type: events.EventBlockIO, LatencyNS: 62e6, Target: "nvme0n1",
+			BlockIO: &events.BlockIOInfo{QueueNS: 2e6, Bytes: 4096, Device: dev, Op: 1}})
+	}
+	evs = append(evs, &events.Event{Type: events.EventBlockIO, LatencyNS: 1e6, Target: "nvme0n1", Error: -5,
+		BlockIO: &events.BlockIOInfo{Bytes: 512, Device: dev, Op: 0}})
+
+	report := newTestDiagnostician(evs...).BuildReport()
+
+	if report.Disk == nil || len(report.Disk.Devices) != 1 {
+		t.Fatalf("disk = %+v, expected one device", report.Disk)
+	}
+	d := report.Disk.Devices[0]
+	if d.Device != "259:0" || d.Name != "nvme0n1" || d.Ops != 11 || d.Reads != 1 || d.Writes != 10 || d.Errors != 1 {
+		t.Errorf("device = %+v", d)
+	}
+	if d.WriteBytes != 40960 || d.IOPS != 1.1 {
+		t.Errorf("write bytes = %d, IOPS = %.2f, expected 40960 and 1.1", d.WriteBytes, d.IOPS)
+	}
+	if d.ServiceLatency.P95MS != 60 || d.QueueLatency.MaxMS != 2 {
+		t.Errorf("service = %+v, queue = %+v", d.ServiceLatency, d.QueueLatency)
+	}
+
+	kinds := make(map[string]int)
+	for _, issue := range report.Issues {
+		kinds[issue.Kind]++
+	}
+	if kinds["slow_disk"] != 1 || kinds["disk_errors"] != 1 {
+		t.Errorf("issues = %+v", report.Issues)
+	}
+	if !strings.Contains(report.Text(), "Disk I/O:") {
+		t.Error("text report should have a disk section")
+	}
+}
+
+func TestPageFaults(t *testing.T) {
+	var evs []*events.Event
+	for i := 0; i < 3; i++ {
+		evs = append(evs, &events.Event{Type: events.EventPageFaultCount, PID: 7, ProcessName: "java",
+			PageFaults: &events.PageFaultCount{Minor: 1000, Major: 10}})
+	}
+	for i := 0; i < 12; i++ {
+		evs = append(evs, &events.Event{Type: events.EventPageFault, PID: 7, ProcessName: "java", LatencyNS: 4e6,
+			Details: "major", Target: "/usr/lib/jvm/lib/server/libjvm.so", PageFault: &events.PageFaultInfo{Major: true}})
+	}
+	evs = append(evs, &events.Event{Type: events.EventPageFault, PID: 8, ProcessName: "sh", LatencyNS: 2e6,
+		Details: "minor", Target: "[heap]", PageFault: &events.PageFaultInfo{}})
+
+	report := newTestDiagnostician(evs...).BuildReport()
+
+	faults := report.PageFaults
+	if faults == nil {
+		t.Fatal("expected a page fault section")
+	}
+	if faults.Minor != 3000 || faults.Major != 30 || faults.TracedMajor != 12 || faults.SlowMinor != 1 {
+		t.Errorf("faults = %+v", faults)
+	}
+	if faults.MajorPerSecond != 3 || faults.MajorLatency.P95MS != 4 || faults.MajorTimeMS != 48 {
+		t.Errorf("major rate = %.1f/sec, latency = %+v, time = %.2fms", faults.MajorPerSecond, faults.MajorLatency, faults.MajorTimeMS)
+	}
+	if len(faults.Mappings) != 1 || faults.Mappings[0].Count != 12 {
+		t.Errorf("mappings = %+v", faults.Mappings)
+	}
+	if len(faults.Processes) != 2 || faults.Processes[0].PID != 7 || faults.Processes[0].Major != 30 {
+		t.Errorf("processes = %+v", faults.Processes)
+	}
+
+	found := false
+	for _, issue := range report.Issues {
+		found = found || issue.Kind == "major_faults"
+	}
+	if !found {
+		t.Errorf("issues = %+v, expected major_faults", report.Issues)
+	}
+	if !strings.Contains(report.Text(), "Page Faults:") {
+		t.Error("text report should have a page fault section")
+	}
+}
+
+func TestLockContention(t *testing.T) {
+	var evs []*events.Event
+	for i := 0; i < 60; i++ {
+		evs = append(evs, &events.Event{Type: events.EventFutexWait, PID: 7, TID: uint32(100 + i%4), ProcessName: "java",
+			LatencyNS: 20e6, Target: "lock-holder", Details: "worker",
+			Futex: &events.FutexInfo{Address: 0x7f00001000, WakerPID: 7, UserStack: []string{"pthread_mutex_lock", "Queue::take"}}})
+	}
+	evs = append(evs, &events.Event{Type: events.EventFutexWait, PID: 7, TID: 200, ProcessName: "java",
+		LatencyNS: 500e6, Error: -110, Details: "idle", Futex: &events.FutexInfo{Address: 0x7f00002000, Op: 9 | 128}})
+
+	report := newTestDiagnostician(evs...).BuildReport()
+
+	locks := report.LockContention
+	if locks == nil || locks.Waits != 61 || locks.Timeouts != 1 || len(locks.Futexes) != 2 {
+		t.Fatalf("lock contention = %+v", locks)
+	}
+	f := locks.Futexes[0]
+	if f.Address != "0x7f00001000" || f.Waits != 60 || f.TotalWaitMS != 1200 || f.P95MS != 20 {
+		t.Errorf("hottest futex = %+v", f)
+	}
+	if len(f.Wakers) != 1 || f.Wakers[0].Target != "lock-holder" || len(f.WaiterStack) != 2 {
+		t.Errorf("wakers = %+v, stack = %v", f.Wakers, f.WaiterStack)
+	}
+	if locks.Futexes[1].Op != "wait_bitset" || len(locks.Futexes[1].Wakers) != 0 {
+		t.Errorf("timed out futex = %+v", locks.Futexes[1])
+	}
+
+	contended := 0
+	for _, issue := range report.Issues {
+		if issue.Kind == "lock_contention" {
+			contended++
+		}
+	}
+	if contended != 1 {
+		t.Errorf("issues = %+v, expected one lock_contention", report.Issues)
+	}
+	if !strings.Contains(report.Text(), "Lock Contention:") {
+		t.Error("text report should have a lock contention section")
+	}
+}
+
+func TestSyscallSummary(t *testing.T) {
+	hist := func(slot int, n uint64) []uint64 {
+		h := make([]uint64, 24)
+		h[slot] = n
+		return h
+	}
+	report := newTestDiagnostician(
+		&events.Event{Type: events.EventConnect, PID: 1, LatencyNS: 1e6, Target: "10.0.0.1:443"},
+		&events.Event{Type: events.EventSyscall, Container: "app", Target: "read",
+			Syscall: &events.SyscallStats{Count: 90, TotalNS: 90e6, Histogram: hist(10, 90)}},
+		&events.Event{Type: events.EventSyscall, Container: "app", Target: "read", Error: -11,
+			Syscall: &events.SyscallStats{Count: 10, TotalNS: 1e5, Histogram: hist(1, 10)}},
+		&events.Event{Type: events.EventSyscall, Container: "app", Target: "openat", Error: -2,
+			Syscall: &events.SyscallStats{Count: 20, TotalNS: 2e5, Histogram: hist(2, 20)}},
+	).BuildReport()
+
+	s := report.Syscalls
+	if s == nil || s.Calls != 120 || s.Errors != 30 || len(s.Syscalls) != 2 {
+		t.Fatalf("syscalls = %+v", s)
+	}
+	read := s.Syscalls[0]
+	if read.Name != "read" || read.Calls != 100 || read.Errors != 10 || read.TotalTimeMS != 90.1 {
+		t.Errorf("top syscall = %+v", read)
+	}
+	// 90% of reads took 512-1024µs, the rest under 2µs
+	if read.P50MS != 1.024 || read.P99MS != 1.024 {
+		t.Errorf("read percentiles = %.3f/%.3f, expected 1.024ms", read.P50MS, read.P99MS)
+	}
+	if len(s.Failures) != 2 || s.Failures[0].Syscall != "openat" || s.Failures[0].Errno != "ENOENT" || s.Failures[1].Errno != "EAGAIN" {
+		t.Errorf("failures = %+v", s.Failures)
+	}
+	if !strings.Contains(report.Text(), "Syscalls:") {
+		t.Error("text report should have a syscall section")
+	}
+}
+
+func TestInboundConnections(t *testing.T) {
+	var evs []*events.Event
+	for i := 0; i < 4; i++ {
+		evs = append(evs, &events.Event{Type: events.EventAccept, PID: 9, ProcessName: "api",
+			Target: fmt.Sprintf("010.000.000.007:%05d", 40000+i), Details: "010.000.001.002:08080",
+			LatencyNS: uint64(i+1) * 1e6, Accept: &events.AcceptInfo{Backlog: uint32(i), MaxBacklog: 128}})
+	}
+	evs = append(evs, &events.Event{Type: events.EventAccept, PID: 9, ProcessName: "api",
+		Target: "010.000.000.008:40000", Details: "010.000.001.002:08080"})
+	evs = append(evs,
+		&events.Event{Type: events.EventNetStat, NetStat: &events.NetStats{Namespace: 1, ListenOverflows: 10, ListenDrops: 10}},
+		&events.Event{Type: events.EventNetStat, NetStat: &events.NetStats{Namespace: 1, ListenOverflows: 13, ListenDrops: 15}})
+
+	report := newTestDiagnostician(evs...).BuildReport()
+
+	inbound := report.Inbound
+	if inbound == nil || inbound.Accepts != 5 || inbound.QueuedAccepts != 4 || inbound.QueueWait.MaxMS != 4 {
+		t.Fatalf("inbound = %+v", inbound)
+	}
+	if len(inbound.TopClients) != 2 || inbound.TopClients[0] != (TargetCount{Target: "010.000.000.007", Count: 4}) {
+		t.Errorf("top clients = %+v", inbound.TopClients)
+	}
+	if len(inbound.LocalPorts) != 1 || inbound.LocalPorts[0].Target != "8080" {
+		t.Errorf("local ports = %+v", inbound.LocalPorts)
+	}
+	if inbound.ListenOverflows != 3 || inbound.ListenDrops != 5 || inbound.PeakBacklog != 3 || inbound.BacklogLimit != 128 {
+		t.Errorf("drops = %d/%d, backlog = %d/%d", inbound.ListenDrops, inbound.ListenOverflows, inbound.PeakBacklog, inbound.BacklogLimit)
+	}
+
+	drops := 0
+	for _, issue := range report.Issues {
+		if issue.Kind == "listen_drops" {
+			drops++
+		}
+	}
+	if drops != 1 {
+		t.Errorf("issues = %+v, expected one listen_drops", report.Issues)
+	}
+	if !strings.Contains(report.Text(), "Inbound Connections:") {
+		t.Error("text report should have an inbound connections section")
+	}
+}
+
+func TestTCPConnectionLifecycle(t *testing.T) {
+	var evs []*events.Event
+	for i := 0; i < 120; i++ {
+		evs = append(evs, &events.Event{Type: events.EventTCPConnection, PID: 9, ProcessName: "api",
+			Target: "010.000.002.005:06379", Details: "010.000.001.002:41000", LatencyNS: 5e6,
+			Connection: &events.ConnectionInfo{BytesSent: 100, BytesReceived: 200, ClosedBy: "local", End: "time_wait"}})
+	}
+	evs = append(evs,
+		&events.Event{Type: events.EventTCPConnection, PID: 9, ProcessName: "api",
+			Target: "010.000.000.007:51000", Details: "010.000.001.002:08080", LatencyNS: 4e9,
+			Connection: &events.ConnectionInfo{BytesSent: 1 << 20, BytesReceived: 4096, Passive: true, End: "reset_received"}},
+		&events.Event{Type: events.EventTCPConnection, PID: 9, ProcessName: "api",
+			Target: "010.000.000.007:51001", Details: "010.000.001.002:08080", LatencyNS: 2e9,
+			Connection: &events.ConnectionInfo{BytesSent: 10, BytesReceived: 10, Passive: true, ClosedBy: "remote", End: "closed"}})
+
+	report := newTestDiagnostician(evs...).BuildReport()
+
+	conns := report.TCPConnections
+	if conns == nil || conns.Closed != 122 || conns.Outbound != 120 || conns.Inbound != 2 || conns.ShortLived != 120 {
+		t.Fatalf("tcp connections = %+v", conns)
+	}
+	if conns.ClosedLocally != 120 || conns.ClosedRemotely != 1 || conns.Ends[0] != (TargetCount{Target: "time_wait", Count: 120}) {
+		t.Errorf("closed by local %d, remote %d, ends %+v", conns.ClosedLocally, conns.ClosedRemotely, conns.Ends)
+	}
+	top := conns.ByBytes[0]
+	if top.Peer != "010.000.000.007" || top.Direction != "inbound" || top.Connections != 2 || top.Resets != 1 {
+		t.Errorf("top peer by bytes = %+v", top)
+	}
+	if conns.ByDuration[0].MaxDurationMS != 4000 || len(conns.Churn) != 1 || conns.Churn[0].Peer != "010.000.002.005:06379" {
+		t.Errorf("by duration = %+v, churn = %+v", conns.ByDuration, conns.Churn)
+	}
+
+	churn := 0
+	for _, issue := range report.Issues {
+		if issue.Kind == "connection_churn" {
+			churn++
+		}
+	}
+	if churn != 1 {
+		t.Errorf("issues = %+v, expected one connection_churn", report.Issues)
+	}
+	if !strings.Contains(report.Text(), "Connections:\n") {
+		t.Error("text report should have a connections section")
+	}
+}
+
+func TestNetworkIOThroughput(t *testing.T) {
+	var evs []*events.Event
+	for i := 0; i < 10; i++ {
+		evs = append(evs,
+			&events.Event{Type: events.EventTCPSend, PID: 1, Target: "10.0.0.5:5432", Bytes: 1000},
+			&events.Event{Type: events.EventTCPRecv, PID: 1, Target: fmt.Sprintf("10.0.0.5:%d", 40000+i), Bytes: 4000})
+	}
+	evs = append(evs, &events.Event{Type: events.EventTCPRecv, PID: 1, Target: "10.0.0.6:6379", Error: -104})
+
+	report := newTestDiagnostician(evs...).BuildReport()
+
+	io := report.NetworkIO
+	if io == nil || io.BytesSent != 10000 || io.BytesReceived != 40000 || io.SendRecvRatio != 0.25 {
+		t.Fatalf("network io = %+v", io)
+	}
+	if io.AvgThroughput != 5000 || io.PeakThroughput != 4000 {
+		t.Errorf("throughput avg %.0f, peak %.0f", io.AvgThroughput, io.PeakThroughput)
+	}
+	if len(io.Peers) != 2 || io.Peers[0].Peer != "10.0.0.5" || io.Peers[0].RecvBytesPerSec != 4000 {
+		t.Errorf("peers = %+v", io.Peers)
+	}
+	if report.TCP == nil || report.TCP.Errors != 1 {
+		t.Errorf("tcp = %+v, expected one error", report.TCP)
+	}
+}
+
+func TestTCPLatencyByPeer(t *testing.T) {
+	var evs []*events.Event
+	for i := 0; i < 5; i++ {
+		evs = append(evs,
+			&events.Event{Type: events.EventTCPSend, PID: 1, Target: "010.000.000.005:05432", LatencyNS: 1e6},
+			&events.Event{Type: events.EventTCPRecv, PID: 1, Target: "fd00::7:06379", LatencyNS: 50e6})
+	}
+	evs = append(evs,
+		&events.Event{Type: events.EventTCPRecv, PID: 1, Target: "fd00::7:41022", LatencyNS: 1e6, Error: -104},
+		&events.Event{Type: events.EventTCPRTT, Target: "fd00::7:06379", LatencyNS: 20e6},
+		&events.Event{Type: events.EventTCPRTT, Target: "010.000.000.009:00443", LatencyNS: 5e6})
+
+	report := newTestDiagnostician(evs...).BuildReport()
+
+	peers := report.TCP.Peers
+	if len(peers) != 2 {
+		t.Fatalf("peers = %+v", peers)
+	}
+	slow := peers[0]
+	if slow.Peer != "fd00::7" || slow.Ops != 6 || slow.Errors != 1 || slow.Latency.P95MS != 50 {
+		t.Errorf("slowest peer = %+v", slow)
+	}
+	if slow.RTT == nil || slow.RTT.P50MS != 20 {
+		t.Errorf("slowest peer RTT = %+v", slow.RTT)
+	}
+	if peers[1].Peer != "010.000.000.005" || peers[1].RTT != nil {
+		t.Errorf("second peer = %+v", peers[1])
+	}
+	if text := report.Text(); !strings.Contains(text, "Latency by peer:") {
+		t.Errorf("report text is missing the peer latency:\n%s", text)
+	}
+}
+
+func TestUDPTraffic(t *testing.T) {
+	var evs []*events.Event
+	for i := 0; i < 4; i++ {
+		evs = append(evs,
+			&events.Event{Type: events.EventUDPSend, PID: 1, Target: "010.000.000.009:08125", Bytes: 200, LatencyNS: 1e5},
+			&events.Event{Type: events.EventUDPRecv, PID: 1, Target: "fd00::3:00443", Bytes: 1200, LatencyNS: 2e6})
+	}
+	evs = append(evs,
+		&events.Event{Type: events.EventUDPRecv, PID: 1, Error: -11},
+		&events.Event{Type: events.EventUDPSend, PID: 1, Target: "010.000.000.009:08125", Error: -111},
+		&events.Event{Type: events.EventUDPDrop, Details: "000.000.000.000:00514", State: 1},
+		&events.Event{Type: events.EventUDPDrop, Details: "000.000.000.000:00514", State: 1})
+
+	report := newTestDiagnostician(evs...).BuildReport()
+
+	udp := report.UDP
+	if udp == nil || udp.Sends != 5 || udp.Receives != 5 || udp.BytesSent != 800 || udp.BytesReceived != 4800 {
+		t.Fatalf("udp = %+v", udp)
+	}
+	if udp.Errors != 1 || len(udp.ErrorBreakdown) != 1 || udp.ErrorBreakdown[0].Name != "ECONNREFUSED" {
+		t.Errorf("errors = %d, breakdown %+v, expected one ECONNREFUSED", udp.Errors, udp.ErrorBreakdown)
+	}
+	if len(udp.Peers) != 3 || udp.Peers[0].Peer != "fd00::3:00443" || udp.Peers[1].Errors != 1 {
+		t.Errorf("peers = %+v", udp.Peers)
+	}
+	if udp.Drops != 2 || udp.DropReasons[0].Target != "rcvbuf" || udp.DroppingSockets[0].Target != "000.000.000.000:00514" {
+		t.Errorf("drops = %d, reasons %+v, sockets %+v", udp.Drops, udp.DropReasons, udp.DroppingSockets)
+	}
+
+	found := false
+	for _, issue := range report.Issues {
+		if issue.Kind == "udp_drops" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("issues = %+v, expected udp_drops", report.Issues)
+	}
+	if text := report.Text(); !strings.Contains(text, "UDP:") || !strings.Contains(text, "Drops: 2") {
+		t.Errorf("report text is missing the UDP section:\n%s", text)
+	}
+}
@@ -0,0 +1,80 @@
+package diagnose
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/podtrace/podtrace/internal/events"
+)
+
+const (
+	// minStarvationSamples is how many run-queue waits are needed before the
+	// CPU starvation rule fires
+	minStarvationSamples = 10
+	// starvationP95MS is the P95 run-queue latency considered CPU starvation
+	starvationP95MS = 10.0
+)
+
+func analyzeRunQueue(runqEvents []*events.Event, duration time.Duration) *RunQueueStats {
+	stats := &RunQueueStats{
+		Waits:     len(runqEvents),
+		PerSecond: perSecond(len(runqEvents), duration),
+		Latency:   latencyStats(runqEvents),
+	}
+
+	byPID := make(map[uint32]*ProcessRunQueue)
+	for _, e := range runqEvents {
+		waitMS := float64(e.LatencyNS) / 1e6
+		stats.TotalWaitMS += waitMS
+
+		proc, ok := byPID[e.PID]
+		if !ok {
+			proc = &ProcessRunQueue{PID: e.PID, Name: e.ProcessName}
+			byPID[e.PID] = proc
+		}
+		proc.Waits++
+		proc.TotalWaitMS += waitMS
+		if waitMS > proc.MaxMS {
+			proc.MaxMS = waitMS
+		}
+		if proc.Name == "" {
+			proc.Name = e.ProcessName
+		}
+	}
+
+	for _, proc := range byPID {
+		if proc.Name == "" {
+			proc.Name = "unknown"
+		}
+		stats.Processes = append(stats.Processes, *proc)
+	}
+	sort.Slice(stats.Processes, func(i, j int) bool {
+		return stats.Processes[i].TotalWaitMS > stats.Processes[j].TotalWaitMS
+	})
+	if len(stats.Processes) > maxTopEntries {
+		stats.Processes = stats.Processes[:maxTopEntries]
+	}
+
+	return stats
+}
+
+func (s *RunQueueStats) text() string {
+	var report string
+	report += fmt.Sprintf("Run Queue Latency:\n")
+	report += fmt.Sprintf("  Waits for a CPU (>100µs): %d (%.1f/sec)\n", s.Waits, s.PerSecond)
+	report += fmt.Sprintf("  Total wait time: %.2fms\n", s.TotalWaitMS)
+	report += latencyText(s.Latency, "wait")
+	if len(s.Processes) > 0 {
+		report += fmt.Sprintf("  Top waiting processes:\n")
+		for i, proc := range s.Processes {
+			if i >= 5 {
+				break
+			}
+			report += fmt.Sprintf("    - PID %d (%s): %.2fms total, %d waits, max %.2fms\n",
+				proc.PID, proc.Name, proc.TotalWaitMS, proc.Waits, proc.MaxMS)
+		}
+	}
+	report += "\n"
+	return report
+}
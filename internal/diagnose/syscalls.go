@@ -0,0 +1,141 @@
+package diagnose
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/podtrace/podtrace/internal/events"
+)
+
+// analyzeSyscalls adds up the system call samples of all containers, like
+// strace -c for the whole pod
+func analyzeSyscalls(samples []*events.Event, duration time.Duration) *SyscallSummary {
+	type syscallTotals struct {
+		usage     *SyscallUsage
+		totalNS   uint64
+		histogram []uint64
+	}
+
+	summary := &SyscallSummary{}
+	bySyscall := make(map[string]*syscallTotals)
+	failures := make(map[[2]string]int)
+	var totalNS uint64
+	for _, e := range samples {
+		s := e.Syscall
+		if s == nil || s.Count == 0 {
+			continue
+		}
+		t, ok := bySyscall[e.Target]
+		if !ok {
+			t = &syscallTotals{usage: &SyscallUsage{Name: e.Target}}
+			bySyscall[e.Target] = t
+		}
+		t.usage.Calls += int(s.Count)
+		t.totalNS += s.TotalNS
+		if len(t.histogram) < len(s.Histogram) {
+			t.histogram = append(t.histogram, make([]uint64, len(s.Histogram)-len(t.histogram))...)
+		}
+		for i, n := range s.Histogram {
+			t.histogram[i] += n
+		}
+		summary.Calls += int(s.Count)
+		totalNS += s.TotalNS
+		if e.Error < 0 {
+			t.usage.Errors += int(s.Count)
+			summary.Errors += int(s.Count)
+			failures[[2]string{e.Target, events.ErrnoName(-e.Error)}] += int(s.Count)
+		}
+	}
+	if summary.Calls == 0 {
+		return nil
+	}
+
+	summary.PerSecond = perSecond(summary.Calls, duration)
+	summary.ErrorPercent = percentOf(summary.Errors, summary.Calls)
+	summary.TotalTimeMS = float64(totalNS) / 1e6
+
+	for _, t := range bySyscall {
+		u := t.usage
+		u.TotalTimeMS = float64(t.totalNS) / 1e6
+		u.TimePercent = float64(t.totalNS) * 100 / float64(max(totalNS, 1))
+		u.AvgUS = float64(t.totalNS) / 1e3 / float64(u.Calls)
+		u.P50MS = histogramPercentile(t.histogram, 50)
+		u.P95MS = histogramPercentile(t.histogram, 95)
+		u.P99MS = histogramPercentile(t.histogram, 99)
+		summary.Syscalls = append(summary.Syscalls, *u)
+	}
+	sort.Slice(summary.Syscalls, func(i, j int) bool {
+		a, b := summary.Syscalls[i], summary.Syscalls[j]
+		if a.TotalTimeMS != b.TotalTimeMS {
+			return a.TotalTimeMS > b.TotalTimeMS
+		}
+		return a.Name < b.Name
+	})
+	if len(summary.Syscalls) > maxTopEntries {
+		summary.Syscalls = summary.Syscalls[:maxTopEntries]
+	}
+
+	for key, count := range failures {
+		summary.Failures = append(summary.Failures, SyscallFailure{
+			Syscall:   key[0],
+			Errno:     key[1],
+			Count:     count,
+			PerSecond: perSecond(count, duration),
+		})
+	}
+	sort.Slice(summary.Failures, func(i, j int) bool {
+		a, b := summary.Failures[i], summary.Failures[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Syscall+a.Errno < b.Syscall+b.Errno
+	})
+	if len(summary.Failures) > maxTopEntries {
+		summary.Failures = summary.Failures[:maxTopEntries]
+	}
+	return summary
+}
+
+// histogramPercentile estimates a percentile in milliseconds from a log2
+// microsecond histogram as the upper bound of the slot it falls in
+func histogramPercentile(histogram []uint64, p float64) float64 {
+	var total uint64
+	for _, n := range histogram {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(float64(total) * p / 100))
+	var seen uint64
+	for i, n := range histogram {
+		seen += n
+		if seen >= rank {
+			return math.Exp2(float64(i)) / 1000
+		}
+	}
+	return math.Exp2(float64(len(histogram)-1)) / 1000
+}
+
+func (s *SyscallSummary) text() string {
+	var report string
+	report += fmt.Sprintf("Syscalls:\n")
+	report += fmt.Sprintf("  Calls: %d (%.1f/sec), %d failed (%.1f%%)\n", s.Calls, s.PerSecond, s.Errors, s.ErrorPercent)
+	report += fmt.Sprintf("  Total time in syscalls: %.2fms\n", s.TotalTimeMS)
+	report += fmt.Sprintf("  %6s %11s %11s %9s %9s %-16s %s\n", "% time", "seconds", "usecs/call", "calls", "errors", "syscall", "p95")
+	for _, u := range s.Syscalls {
+		report += fmt.Sprintf("  %6.2f %11.6f %11.0f %9d %9d %-16s <%.3fms\n",
+			u.TimePercent, u.TotalTimeMS/1000, u.AvgUS, u.Calls, u.Errors, u.Name, u.P95MS)
+	}
+	if len(s.Failures) > 0 {
+		report += fmt.Sprintf("  Top failing syscalls:\n")
+		for _, f := range s.Failures {
+			report += fmt.Sprintf("    - %s: %s (%d, %.1f/sec)\n", f.Syscall, f.Errno, f.Count, f.PerSecond)
+		}
+	}
+	report += "\n"
+	return report
+}
@@ -0,0 +1,419 @@
+package diagnose
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Text renders the report in the human-readable format printed by podtrace
+func (r *Report) Text() string {
+	if r.Summary.TotalEvents == 0 && r.Summary.TotalSamples == 0 {
+		return "No events collected during the diagnostic period.\n"
+	}
+
+	duration := r.EndTime.Sub(r.StartTime)
+
+	var report string
+	report += fmt.Sprintf("=== Diagnostic Report (collected over %v) ===\n\n", duration)
+	report += fmt.Sprintf("Summary:\n")
+	report += fmt.Sprintf("  Total events: %d\n", r.Summary.TotalEvents)
+	report += fmt.Sprintf("  Events per second: %.1f\n", r.Summary.EventsPerSecond)
+	if r.Summary.TotalSamples > 0 {
+		report += fmt.Sprintf("  Samples: %d\n", r.Summary.TotalSamples)
+	}
+	report += fmt.Sprintf("  Collection period: %v to %v\n\n", r.StartTime.Format("15:04:05"), r.EndTime.Format("15:04:05"))
+
+	if r.DNS != nil {
+		report += r.DNS.text("DNS Statistics", "lookups")
+	}
+	if r.DNSQueries != nil {
+		report += r.DNSQueries.text("DNS Queries", "queries")
+	}
+	if r.TCP != nil {
+		report += r.TCP.text()
+	}
+	if r.Connections != nil {
+		report += r.Connections.text()
+	}
+	if r.Inbound != nil {
+		report += r.Inbound.text()
+	}
+	if r.TCPConnections != nil {
+		report += r.TCPConnections.text()
+	}
+	if r.UDP != nil {
+		report += r.UDP.text()
+	}
+	if r.FileSystem != nil {
+		report += r.FileSystem.text()
+	}
+	if r.CPU != nil {
+		report += r.CPU.text()
+	}
+	if r.RunQueue != nil {
+		report += r.RunQueue.text()
+	}
+	if r.LockContention != nil {
+		report += r.LockContention.text()
+	}
+	if r.Syscalls != nil {
+		report += r.Syscalls.text()
+	}
+	if r.Memory != nil {
+		report += r.Memory.text()
+	}
+	if r.Disk != nil {
+		report += r.Disk.text()
+	}
+	if r.PageFaults != nil {
+		report += r.PageFaults.text()
+	}
+	if r.Lifecycle != nil {
+		report += r.Lifecycle.text()
+	}
+
+	if r.CPUUsage != nil {
+		report += r.CPUUsage.text(duration)
+	} else {
+		report += cpuUsageUnavailableText()
+	}
+
+	report += r.applicationTracingText()
+
+	if len(r.Issues) > 0 {
+		report += fmt.Sprintf("Potential Issues Detected:\n")
+		for _, issue := range r.Issues {
+			report += fmt.Sprintf("  %s\n", issue.Message)
+		}
+		report += "\n"
+	}
+
+	return report
+}
+
+func latencyText(stats LatencyStats, label string) string {
+	var report string
+	report += fmt.Sprintf("  Average %s: %.2fms\n", label, stats.AvgMS)
+	report += fmt.Sprintf("  Max %s: %.2fms\n", label, stats.MaxMS)
+	report += fmt.Sprintf("  Percentiles: P50=%.2fms, P95=%.2fms, P99=%.2fms\n", stats.P50MS, stats.P95MS, stats.P99MS)
+	return report
+}
+
+// indent shifts every line of a report fragment right by two spaces
+func indent(text string) string {
+	var report string
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if line != "" {
+			report += "  " + line
+		}
+	}
+	return report
+}
+
+func topTargetsText(header, unit string, targets []TargetCount) string {
+	if len(targets) == 0 {
+		return ""
+	}
+
+	report := fmt.Sprintf("  %s:\n", header)
+	for i, target := range targets {
+		if i >= 5 {
+			break
+		}
+		report += fmt.Sprintf("    - %s (%d %s)\n", target.Target, target.Count, unit)
+	}
+	return report
+}
+
+func errorBreakdownText(breakdown []ErrorCount) string {
+	if len(breakdown) == 0 {
+		return ""
+	}
+
+	report := fmt.Sprintf("  Error breakdown:\n")
+	for _, e := range breakdown {
+		if e.Name != "" {
+			report += fmt.Sprintf("    - Error %d (%s): %d occurrences\n", e.Code, e.Name, e.Count)
+		} else {
+			report += fmt.Sprintf("    - Error %d: %d occurrences\n", e.Code, e.Count)
+		}
+	}
+	return report
+}
+
+func (s *DNSStats) text(header, unit string) string {
+	var report string
+	report += fmt.Sprintf("%s:\n", header)
+	report += fmt.Sprintf("  Total %s: %d (%.1f/sec)\n", unit, s.Lookups, s.PerSecond)
+	report += latencyText(s.Latency, "latency")
+	report += fmt.Sprintf("  Errors: %d (%.1f%%)\n", s.Errors, s.ErrorPercent)
+	report += errorBreakdownText(s.ErrorBreakdown)
+	if len(s.QueryTypes) > 0 {
+		report += fmt.Sprintf("  Query types:")
+		for i, t := range s.QueryTypes {
+			if i > 0 {
+				report += ","
+			}
+			report += fmt.Sprintf(" %s (%d)", t.Target, t.Count)
+		}
+		report += "\n"
+	}
+	report += topTargetsText("Top targets", unit, s.TopTargets)
+	report += "\n"
+	return report
+}
+
+func (s *TCPStats) text() string {
+	var report string
+	report += fmt.Sprintf("TCP Statistics:\n")
+	if s.SendOps > 0 || s.RecvOps > 0 {
+		report += fmt.Sprintf("  Send operations: %d (%.1f/sec)\n", s.SendOps, s.SendPerSecond)
+		report += fmt.Sprintf("  Receive operations: %d (%.1f/sec)\n", s.RecvOps, s.RecvPerSecond)
+		report += fmt.Sprintf("  Syscall latency:\n")
+		report += indent(latencyText(s.SyscallLatency, "latency"))
+		report += fmt.Sprintf("    Latency spikes (>100ms): %d\n", s.SpikesOver100MS)
+		report += fmt.Sprintf("  Errors: %d (%.1f%%)\n", s.Errors, s.ErrorPercent)
+	}
+	if len(s.Peers) > 0 {
+		report += fmt.Sprintf("  Latency by peer:\n")
+		for i, p := range s.Peers {
+			if i >= 5 {
+				break
+			}
+			report += fmt.Sprintf("    - %s: %d ops, P50=%.2fms, P95=%.2fms, P99=%.2fms, %d errors",
+				p.Peer, p.Ops, p.Latency.P50MS, p.Latency.P95MS, p.Latency.P99MS, p.Errors)
+			if p.RTT != nil {
+				report += fmt.Sprintf(", RTT P50=%.2fms", p.RTT.P50MS)
+			}
+			report += "\n"
+		}
+	}
+	if s.NetworkRTT != nil {
+		report += fmt.Sprintf("  Network RTT (%d samples from %d connections):\n", s.RTTSamples, s.RTTConnections)
+		report += indent(latencyText(*s.NetworkRTT, "RTT"))
+		report += fmt.Sprintf("    Max RTT variance: %.2fms\n", s.MaxRTTVarMS)
+		if s.MinCongestionWnd > 0 {
+			report += fmt.Sprintf("    Min congestion window: %d segments\n", s.MinCongestionWnd)
+		}
+	}
+	if len(s.RetransmitsByEndpoint) > 0 {
+		report += fmt.Sprintf("  Retransmits: %d (%.1f/sec)\n", s.Retransmits, s.RetransmitsPerSecond)
+		report += fmt.Sprintf("  Resets: %d sent, %d received\n", s.ResetsSent, s.ResetsReceived)
+		report += fmt.Sprintf("  Retransmits by endpoint:\n")
+		for i, e := range s.RetransmitsByEndpoint {
+			if i >= 5 {
+				break
+			}
+			report += fmt.Sprintf("    - %s: %d retransmits (%.1f/sec), %d resets sent, %d resets received\n",
+				e.Endpoint, e.Retransmits, e.RetransmitsPerSecond, e.ResetsSent, e.ResetsReceived)
+		}
+	}
+	report += "\n"
+	return report
+}
+
+func (s *ConnectionStats) text() string {
+	var report string
+	report += fmt.Sprintf("Connection Statistics:\n")
+	report += fmt.Sprintf("  Total connections: %d (%.1f/sec)\n", s.Total, s.PerSecond)
+	report += latencyText(s.Latency, "latency")
+	report += fmt.Sprintf("  Failed connections: %d (%.1f%%)\n", s.Failed, s.FailedPercent)
+	report += errorBreakdownText(s.ErrorBreakdown)
+	report += topTargetsText("Top connection targets", "connections", s.TopTargets)
+	report += "\n"
+	return report
+}
+
+func (s *FileSystemStats) text() string {
+	var report string
+	report += fmt.Sprintf("File System Statistics:\n")
+	report += fmt.Sprintf("  Write operations: %d (%.1f/sec)\n", s.WriteOps, s.WritePerSecond)
+	report += fmt.Sprintf("  Read operations: %d (%.1f/sec)\n", s.ReadOps, s.ReadPerSecond)
+	report += fmt.Sprintf("  Fsync operations: %d (%.1f/sec)\n", s.FsyncOps, s.FsyncPerSecond)
+	report += latencyText(s.Latency, "latency")
+	report += fmt.Sprintf("  Slow operations (>10ms): %d\n", s.SlowOpsOver10MS)
+	if s.BytesRead > 0 || s.BytesWritten > 0 {
+		report += fmt.Sprintf("  Bytes read: %d, written: %d (slow operations only)\n", s.BytesRead, s.BytesWritten)
+	}
+	report += topTargetsText("Top accessed files", "operations", s.TopFiles)
+	if len(s.SlowestOps) > 0 {
+		report += fmt.Sprintf("  Slowest operations:\n")
+		for _, op := range s.SlowestOps {
+			report += fmt.Sprintf("    - %s %s: %.2fms%s\n", op.Op, op.fileText(), op.LatencyMS, op.resultText())
+		}
+	}
+	report += "\n"
+	return report
+}
+
+func (op FileOp) fileText() string {
+	path := op.Path
+	if path == "" {
+		path = "?"
+	}
+	if op.FSType == "" {
+		return path
+	}
+	return fmt.Sprintf("%s (%s on %s)", path, op.FSType, op.Device)
+}
+
+func (op FileOp) resultText() string {
+	if op.Error != "" {
+		return ", " + op.Error
+	}
+	if op.Op == "fsync" || op.BytesRequested == 0 {
+		return ""
+	}
+	return fmt.Sprintf(", %d/%d bytes", op.BytesReturned, op.BytesRequested)
+}
+
+func (s *CPUStats) text() string {
+	var report string
+	report += fmt.Sprintf("CPU Statistics:\n")
+	report += fmt.Sprintf("  Thread blocks (>1ms off-CPU): %d (%.1f/sec)\n", s.Switches, s.PerSecond)
+	report += latencyText(s.BlockTime, "block time")
+	report += offCPUReasonsText(s.BlockReasons)
+	report += blockingStacksText(s.BlockingStacks)
+	report += "\n"
+	return report
+}
+
+func (u *CPUUsage) text(duration time.Duration) string {
+	var report string
+	report += fmt.Sprintf("CPU Usage by Process:\n")
+
+	durationSec := duration.Seconds()
+
+	if len(u.PodProcesses) > 0 {
+		report += fmt.Sprintf("  Pod Processes:\n")
+		for _, p := range u.PodProcesses {
+			report += fmt.Sprintf("    PID %d (%s):      %5.1f%% CPU (%.2fs / %.2fs, %d threads)\n",
+				p.PID, p.Name, p.CPUPercent, p.CPUSeconds, durationSec, p.Threads)
+		}
+		report += "\n"
+	}
+
+	if len(u.KernelProcesses) > 0 {
+		report += fmt.Sprintf("  System/Kernel Processes:\n")
+		for _, p := range u.KernelProcesses {
+			report += fmt.Sprintf("    PID %d (%s):      %5.1f%% CPU (%.2fs / %.2fs, %d threads)\n",
+				p.PID, p.Name, p.CPUPercent, p.CPUSeconds, durationSec, p.Threads)
+		}
+		if u.KernelProcessesOmitted > 0 {
+			report += fmt.Sprintf("    ... and %d more system processes\n", u.KernelProcessesOmitted)
+		}
+		report += "\n"
+	}
+
+	report += fmt.Sprintf("  Total CPU usage: %.1f%% of one CPU (%.2fs / %.2fs)\n",
+		u.TotalPercent, u.TotalSeconds, durationSec)
+
+	if len(u.Containers) > 0 {
+		report += fmt.Sprintf("  Container CPU (cgroup):\n")
+		for _, c := range u.Containers {
+			limit := "no limit"
+			if c.LimitCores > 0 {
+				limit = fmt.Sprintf("limit %.2f cores (%.1f%% used)", c.LimitCores, c.LimitUtilizationPercent)
+			}
+			report += fmt.Sprintf("    - %s: %.2fs CPU, %s\n", c.Container, c.CPUSeconds, limit)
+			if c.Periods > 0 {
+				report += fmt.Sprintf("      Throttled %d/%d periods (%.1f%%, %.2fs)\n",
+					c.ThrottledPeriods, c.Periods, c.ThrottledPercent, c.ThrottledSeconds)
+			}
+		}
+	}
+	report += "\n"
+
+	return report
+}
+
+func (r *Report) applicationTracingText() string {
+	var report string
+
+	if len(r.Processes) > 0 {
+		report += fmt.Sprintf("Process Activity:\n")
+		report += fmt.Sprintf("  Active processes: %d\n", len(r.Processes))
+		report += fmt.Sprintf("  Top active processes:\n")
+		for i, p := range r.Processes {
+			if i >= 5 {
+				break
+			}
+			report += fmt.Sprintf("    - PID %d (%s): %d events (%.1f%%)\n",
+				p.PID, p.Name, p.Events, p.Percent)
+		}
+		report += "\n"
+	}
+
+	if len(r.Containers) > 0 {
+		report += fmt.Sprintf("Container Activity:\n")
+		report += fmt.Sprintf("  Active containers: %d\n", len(r.Containers))
+		report += fmt.Sprintf("  Events by container:\n")
+		for _, c := range r.Containers {
+			report += fmt.Sprintf("    - %s: %d events (%.1f%%)\n",
+				c.Name, c.Events, c.Percent)
+		}
+		report += "\n"
+	}
+
+	if len(r.Timeline) > 0 {
+		report += fmt.Sprintf("Activity Timeline:\n")
+		report += fmt.Sprintf("  Activity distribution:\n")
+		for _, bucket := range r.Timeline {
+			report += fmt.Sprintf("    - %s-%s: %d events (%.1f%%)\n",
+				bucket.Start.Format("15:04:05"), bucket.End.Format("15:04:05"), bucket.Events, bucket.Percent)
+		}
+		report += "\n"
+	}
+
+	if len(r.Bursts) > 0 {
+		report += fmt.Sprintf("Activity Bursts:\n")
+		report += fmt.Sprintf("  Detected %d burst period(s):\n", len(r.Bursts))
+		for i, burst := range r.Bursts {
+			if i >= 3 {
+				break
+			}
+			report += fmt.Sprintf("    - %s: %.1f events/sec (%.1fx normal rate)\n",
+				burst.Time.Format("15:04:05"), burst.Rate, burst.Multiplier)
+		}
+		report += "\n"
+	}
+
+	if p := r.ConnectionPattern; p != nil {
+		report += fmt.Sprintf("Connection Patterns:\n")
+		report += fmt.Sprintf("  Pattern: %s\n", p.Pattern)
+		report += fmt.Sprintf("  Average rate: %.1f connections/sec\n", p.AvgRate)
+		if p.PeakRate > 0 {
+			report += fmt.Sprintf("  Peak rate: %.1f connections/sec\n", p.PeakRate)
+		}
+		if p.UniqueTargets > 0 {
+			report += fmt.Sprintf("  Unique targets: %d\n", p.UniqueTargets)
+		}
+		report += "\n"
+	}
+
+	if io := r.NetworkIO; io != nil {
+		report += fmt.Sprintf("Network I/O Pattern:\n")
+		report += fmt.Sprintf("  Send/Receive ratio: %.2f:1 (bytes)\n", io.SendRecvRatio)
+		report += fmt.Sprintf("  Sent: %s (%s/sec), received: %s (%s/sec)\n",
+			formatBytes(float64(io.BytesSent)), formatBytes(io.SendBytesPerSec),
+			formatBytes(float64(io.BytesReceived)), formatBytes(io.RecvBytesPerSec))
+		report += fmt.Sprintf("  Average throughput: %s/sec\n", formatBytes(io.AvgThroughput))
+		if io.PeakThroughput > 0 {
+			report += fmt.Sprintf("  Peak throughput: %s/sec\n", formatBytes(io.PeakThroughput))
+		}
+		if len(io.Peers) > 0 {
+			report += fmt.Sprintf("  Throughput by peer:\n")
+			for i, p := range io.Peers {
+				if i >= 5 {
+					break
+				}
+				report += fmt.Sprintf("    - %s: sent %s/sec, received %s/sec (%d sends, %d receives)\n",
+					p.Peer, formatBytes(p.SendBytesPerSec), formatBytes(p.RecvBytesPerSec), p.Sends, p.Receives)
+			}
+		}
+		report += "\n"
+	}
+
+	return report
+}
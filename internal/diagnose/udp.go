@@ -0,0 +1,137 @@
+package diagnose
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/podtrace/podtrace/internal/events"
+)
+
+func analyzeUDP(sendEvents, recvEvents, dropEvents []*events.Event, duration time.Duration) *UDPStats {
+	stats := &UDPStats{
+		Sends:             len(sendEvents),
+		SendsPerSecond:    perSecond(len(sendEvents), duration),
+		Receives:          len(recvEvents),
+		ReceivesPerSecond: perSecond(len(recvEvents), duration),
+		SendLatency:       latencyStats(sendEvents),
+		ReceiveLatency:    latencyStats(recvEvents),
+		Drops:             len(dropEvents),
+		DropsPerSecond:    perSecond(len(dropEvents), duration),
+	}
+
+	errorMap := make(map[int32]int)
+	byPeer := make(map[string]*PeerUDP)
+	for _, e := range append(append([]*events.Event{}, sendEvents...), recvEvents...) {
+		peer := e.Target
+		if peer == "" {
+			peer = "unknown"
+		}
+		p, ok := byPeer[peer]
+		if !ok {
+			p = &PeerUDP{Peer: peer}
+			byPeer[peer] = p
+		}
+
+		// EAGAIN is how non-blocking sockets report an empty receive queue
+		failed := e.Error < 0 && e.Error != -11
+		if failed {
+			stats.Errors++
+			p.Errors++
+			errorMap[e.Error]++
+		}
+		if e.Type == events.EventUDPSend {
+			p.Sends++
+			if !failed {
+				stats.BytesSent += e.Bytes
+				p.BytesSent += e.Bytes
+			}
+		} else {
+			p.Receives++
+			if !failed {
+				stats.BytesReceived += e.Bytes
+				p.BytesReceived += e.Bytes
+			}
+		}
+	}
+	stats.ErrorPercent = percentOf(stats.Errors, stats.Sends+stats.Receives)
+	stats.ErrorBreakdown = errorBreakdown(errorMap, connectErrorName)
+
+	peers := make([]PeerUDP, 0, len(byPeer))
+	for _, p := range byPeer {
+		peers = append(peers, *p)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		bytesI := peers[i].BytesSent + peers[i].BytesReceived
+		bytesJ := peers[j].BytesSent + peers[j].BytesReceived
+		if bytesI != bytesJ {
+			return bytesI > bytesJ
+		}
+		return peers[i].Peer < peers[j].Peer
+	})
+	if len(peers) > maxTopEntries {
+		peers = peers[:maxTopEntries]
+	}
+	stats.Peers = peers
+
+	reasons := make(map[string]int)
+	sockets := make(map[string]int)
+	for _, e := range dropEvents {
+		reasons[events.UDPDropReasonName(e.State)]++
+		sockets[e.Details]++
+	}
+	stats.DropReasons = topTargets(reasons)
+	stats.DroppingSockets = topTargets(sockets)
+	return stats
+}
+
+// udpIssues reports datagrams dropped before they reached the pod's sockets,
+// which senders never learn about
+func udpIssues(stats *UDPStats) []Issue {
+	if stats == nil || stats.Drops == 0 {
+		return nil
+	}
+
+	message := fmt.Sprintf("UDP drops: %d datagrams (%.1f/sec) dropped on receive", stats.Drops, stats.DropsPerSecond)
+	if len(stats.DroppingSockets) > 0 {
+		top := stats.DroppingSockets[0]
+		message += fmt.Sprintf(", %d of them for %s", top.Count, top.Target)
+	}
+	if len(stats.DropReasons) > 0 && stats.DropReasons[0].Target == "rcvbuf" {
+		message += "; the socket receive buffer was full, consider reading faster or raising SO_RCVBUF (net.core.rmem_max)"
+	}
+	return []Issue{{Kind: "udp_drops", Message: message}}
+}
+
+func (s *UDPStats) text() string {
+	var report string
+	report += fmt.Sprintf("UDP:\n")
+	report += fmt.Sprintf("  Sends: %d (%.1f/sec), %s\n", s.Sends, s.SendsPerSecond, formatBytes(float64(s.BytesSent)))
+	report += fmt.Sprintf("  Receives: %d (%.1f/sec), %s\n", s.Receives, s.ReceivesPerSecond, formatBytes(float64(s.BytesReceived)))
+	if s.Sends > 0 {
+		report += fmt.Sprintf("  Send latency: avg %.2fms, P50=%.2fms, P95=%.2fms, P99=%.2fms, max %.2fms\n",
+			s.SendLatency.AvgMS, s.SendLatency.P50MS, s.SendLatency.P95MS, s.SendLatency.P99MS, s.SendLatency.MaxMS)
+	}
+	if s.Receives > 0 {
+		report += fmt.Sprintf("  Receive latency: avg %.2fms, P50=%.2fms, P95=%.2fms, P99=%.2fms, max %.2fms\n",
+			s.ReceiveLatency.AvgMS, s.ReceiveLatency.P50MS, s.ReceiveLatency.P95MS, s.ReceiveLatency.P99MS, s.ReceiveLatency.MaxMS)
+	}
+	report += fmt.Sprintf("  Errors: %d (%.1f%%)\n", s.Errors, s.ErrorPercent)
+	report += errorBreakdownText(s.ErrorBreakdown)
+	if s.Drops > 0 {
+		report += fmt.Sprintf("  Drops: %d (%.1f/sec), reasons: %s\n", s.Drops, s.DropsPerSecond, targetList(s.DropReasons))
+		report += topTargetsText("Dropping sockets", "drops", s.DroppingSockets)
+	}
+	if len(s.Peers) > 0 {
+		report += fmt.Sprintf("  Top peers:\n")
+		for i, p := range s.Peers {
+			if i >= 5 {
+				break
+			}
+			report += fmt.Sprintf("    - %s: %d sends (%s), %d receives (%s), %d errors\n", p.Peer,
+				p.Sends, formatBytes(float64(p.BytesSent)), p.Receives, formatBytes(float64(p.BytesReceived)), p.Errors)
+		}
+	}
+	report += "\n"
+	return report
+}
@@ -0,0 +1,238 @@
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/features"
+	"golang.org/x/sys/unix"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// kernelCgroupFilterSupported reports whether the running kernel provides
+// bpf_get_current_cgroup_id to kprobe programs
+func kernelCgroupFilterSupported() error {
+	return features.HaveProgramHelper(ebpf.Kprobe, asm.FnGetCurrentCgroupId)
+}
+
+// stubCgroupIDHelper replaces every bpf_get_current_cgroup_id call in spec
+// with a cgroup ID of 0, so that the programs still load on kernels without
+// the helper. Filtering then falls back to userspace.
+func stubCgroupIDHelper(spec *ebpf.CollectionSpec) {
+	for _, prog := range spec.Programs {
+		for i, ins := range prog.Instructions {
+			if ins.IsBuiltinCall() && ins.Constant == int64(asm.FnGetCurrentCgroupId) {
+				prog.Instructions[i] = asm.Mov.Imm(asm.R0, 0).WithMetadata(ins.Metadata)
+			}
+		}
+	}
+}
+
+// resolveCgroupIDs returns the cgroup v2 IDs of cgroupPath and all of its descendants
+func resolveCgroupIDs(cgroupPath string) ([]uint64, error) {
+	fullPath := filepath.Join(cgroupRoot, normalizeCgroupPath(cgroupPath))
+
+	var statfs unix.Statfs_t
+	if err := unix.Statfs(fullPath, &statfs); err != nil {
+		return nil, fmt.Errorf("failed to stat cgroup %s: %w", fullPath, err)
+	}
+	if statfs.Type != unix.CGROUP2_SUPER_MAGIC {
+		return nil, fmt.Errorf("%s is not on a cgroup v2 hierarchy", fullPath)
+	}
+
+	return collectCgroupIDs(fullPath)
+}
+
+// collectCgroupIDs walks a cgroup directory tree and returns the inode number
+// of every directory, which on cgroup v2 is the ID reported by
+// bpf_get_current_cgroup_id
+func collectCgroupIDs(root string) ([]uint64, error) {
+	var ids []uint64
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+
+		var st unix.Stat_t
+		if err := unix.Stat(path, &st); err != nil {
+			return nil
+		}
+		ids = append(ids, st.Ino)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk cgroup %s: %w", root, err)
+	}
+
+	return ids, nil
+}
+
+// cgroupRescanInterval is how often the target cgroups are walked for child
+// cgroups created or removed since the last scan. Only descendants of the
+// paths resolved at attach time are found: a restarted container gets a new
+// cgroup elsewhere and is no longer traced.
+const cgroupRescanInterval = 5 * time.Second
+
+// cgroupFilter maps the cgroup IDs of the traced containers and their
+// descendants to container names, and keeps the target_cgroups map in sync
+// with them as cgroups come and go
+type cgroupFilter struct {
+	targets     *ebpf.Map
+	cgroupPaths map[string]string
+
+	mu   sync.RWMutex
+	ids  map[uint64]string
+	stop chan struct{}
+	done chan struct{}
+}
+
+// enableKernelCgroupFilter loads the IDs of every target cgroup and its
+// descendants into the target_cgroups map, switches the eBPF programs over
+// to in-kernel filtering and keeps the map up to date in the background
+func (t *Tracer) enableKernelCgroupFilter(cgroupPaths map[string]string) (*cgroupFilter, error) {
+	if err := kernelCgroupFilterSupported(); err != nil {
+		return nil, err
+	}
+
+	targets := t.collection.Maps["target_cgroups"]
+	enabled := t.collection.Maps["cgroup_filter_enabled"]
+	if targets == nil || enabled == nil {
+		return nil, fmt.Errorf("cgroup filter maps not found in eBPF object")
+	}
+
+	f := newCgroupFilter(targets, cgroupPaths)
+	ids, err := f.resolve()
+	if err != nil {
+		return nil, err
+	}
+	if err := f.sync(ids); err != nil {
+		return nil, err
+	}
+
+	if err := enabled.Put(uint32(0), uint32(1)); err != nil {
+		return nil, fmt.Errorf("failed to enable cgroup filter: %w", err)
+	}
+
+	f.start()
+	return f, nil
+}
+
+// watchCgroups tracks the IDs of the target cgroups without filtering in the
+// kernel, so that events without a PID can still be attributed. Cgroups that
+// cannot be resolved, e.g. on cgroup v1, are left out.
+func watchCgroups(cgroupPaths map[string]string) *cgroupFilter {
+	f := newCgroupFilter(nil, cgroupPaths)
+	ids, _ := f.resolve()
+	f.sync(ids)
+	f.start()
+	return f
+}
+
+// newCgroupFilter returns a filter for cgroupPaths that updates targets, if
+// not nil, as cgroups come and go
+func newCgroupFilter(targets *ebpf.Map, cgroupPaths map[string]string) *cgroupFilter {
+	return &cgroupFilter{
+		targets:     targets,
+		cgroupPaths: cgroupPaths,
+		ids:         make(map[uint64]string),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+func (f *cgroupFilter) start() {
+	go func() {
+		defer close(f.done)
+		ticker := time.NewTicker(cgroupRescanInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				// a container whose cgroup is gone has no IDs until it
+				// comes back, so a partial result is still applied
+				ids, _ := f.resolve()
+				if err := f.sync(ids); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: failed to update cgroup filter: %v\n", err)
+				}
+			case <-f.stop:
+				return
+			}
+		}
+	}()
+}
+
+// resolve returns the container name for the ID of every target cgroup and
+// its descendants. On error the IDs of the other containers are still returned.
+func (f *cgroupFilter) resolve() (map[uint64]string, error) {
+	var firstErr error
+	ids := make(map[uint64]string)
+	for container, cgroupPath := range f.cgroupPaths {
+		resolved, err := resolveCgroupIDs(cgroupPath)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		for _, id := range resolved {
+			ids[id] = container
+		}
+	}
+	return ids, firstErr
+}
+
+// sync adds the new IDs to the target_cgroups map and removes the IDs of
+// cgroups that no longer exist
+func (f *cgroupFilter) sync(ids map[uint64]string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for id := range ids {
+		if _, ok := f.ids[id]; ok || f.targets == nil {
+			continue
+		}
+		if err := f.targets.Put(id, uint8(1)); err != nil {
+			return fmt.Errorf("failed to add cgroup %d to filter: %w", id, err)
+		}
+	}
+	for id := range f.ids {
+		if _, ok := ids[id]; ok || f.targets == nil {
+			continue
+		}
+		if err := f.targets.Delete(id); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+			return fmt.Errorf("failed to remove cgroup %d from filter: %w", id, err)
+		}
+	}
+
+	f.ids = ids
+	return nil
+}
+
+// container returns the name of the traced container a cgroup ID belongs to
+func (f *cgroupFilter) container(id uint64) (string, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	name, ok := f.ids[id]
+	return name, ok
+}
+
+// close stops rescanning the target cgroups
+func (f *cgroupFilter) close() {
+	close(f.stop)
+	<-f.done
+}
@@ -0,0 +1,107 @@
+package ebpf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+)
+
+func TestCollectCgroupIDs(t *testing.T) {
+	root := t.TempDir()
+	child := filepath.Join(root, "child")
+	if err := os.Mkdir(child, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "cgroup.procs"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ids, err := collectCgroupIDs(root)
+	if err != nil {
+		t.Fatalf("collectCgroupIDs returned error: %v", err)
+	}
+	if len(ids) != 2 {
+		t.Fatalf("expected 2 cgroup IDs (root and child), got %d", len(ids))
+	}
+	if ids[0] == ids[1] {
+		t.Error("expected distinct IDs for distinct directories")
+	}
+
+	if _, err := collectCgroupIDs(filepath.Join(root, "missing")); err == nil {
+		t.Error("expected error for missing cgroup directory")
+	}
+}
+
+func TestExtractCgroupPathFromProc(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected string
+	}{
+		{"0::/kubepods.slice/pod1/cri-containerd-abc.scope", "/kubepods.slice/pod1/cri-containerd-abc.scope"},
+		{"12:memory:/kubepods/pod1/abc\n1:name=systemd:/kubepods/pod1/abc", "/kubepods/pod1/abc"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		result := extractCgroupPathFromProc(tt.content)
+		if result != tt.expected {
+			t.Errorf("extractCgroupPathFromProc(%q) = %q, expected %q", tt.content, result, tt.expected)
+		}
+	}
+}
+
+func TestNormalizeCgroupPath(t *testing.T) {
+	tests := map[string]string{
+		"/sys/fs/cgroup/kubepods.slice/": "/kubepods.slice",
+		"kubepods.slice/pod1":            "/kubepods.slice/pod1",
+		"/kubepods.slice":                "/kubepods.slice",
+	}
+
+	for input, expected := range tests {
+		if result := normalizeCgroupPath(input); result != expected {
+			t.Errorf("normalizeCgroupPath(%q) = %q, expected %q", input, result, expected)
+		}
+	}
+}
+
+func TestCgroupFilterSync(t *testing.T) {
+	f := &cgroupFilter{ids: make(map[uint64]string)}
+
+	if err := f.sync(map[uint64]string{1: "app", 2: "app"}); err != nil {
+		t.Fatal(err)
+	}
+	// the container restarted: cgroup 2 is gone and cgroup 3 replaced it
+	if err := f.sync(map[uint64]string{1: "app", 3: "app"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if name, ok := f.container(3); !ok || name != "app" {
+		t.Errorf("container(3) = %q, %v, expected app", name, ok)
+	}
+	if _, ok := f.container(2); ok {
+		t.Error("expected removed cgroup 2 to be forgotten")
+	}
+}
+
+func TestStubCgroupIDHelper(t *testing.T) {
+	spec := &ebpf.CollectionSpec{Programs: map[string]*ebpf.ProgramSpec{
+		"prog": {Instructions: asm.Instructions{
+			asm.FnGetCurrentCgroupId.Call(),
+			asm.FnKtimeGetNs.Call(),
+			asm.Return(),
+		}},
+	}}
+
+	stubCgroupIDHelper(spec)
+
+	insns := spec.Programs["prog"].Instructions
+	if insns[0].IsBuiltinCall() || insns[0].OpCode != asm.Mov.Op(asm.ImmSource) || insns[0].Dst != asm.R0 || insns[0].Constant != 0 {
+		t.Errorf("cgroup ID helper call not replaced: %v", insns[0])
+	}
+	if !insns[1].IsBuiltinCall() {
+		t.Errorf("other helper calls must be kept: %v", insns[1])
+	}
+}
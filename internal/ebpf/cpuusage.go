@@ -0,0 +1,451 @@
+package ebpf
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cilium/ebpf"
+
+	"github.com/podtrace/podtrace/internal/events"
+)
+
+// sampleInterval is how often on-CPU time, page fault and system call counts,
+// cgroup CPU and memory counters and network namespace counters are turned
+// into events
+const sampleInterval = time.Second
+
+// oncpuTime mirrors struct oncpu_time in the BPF program
+type oncpuTime struct {
+	NS       uint64
+	CgroupID uint64
+	PID      uint32
+	_        uint32
+}
+
+// faultCount mirrors struct fault_count in the BPF program
+type faultCount struct {
+	Minor    uint64
+	Major    uint64
+	CgroupID uint64
+}
+
+// syscallHistSlots mirrors SYSCALL_HIST_SLOTS in the BPF program
+const syscallHistSlots = 24
+
+// syscallKey mirrors struct syscall_key in the BPF program
+type syscallKey struct {
+	CgroupID uint64
+	Nr       uint32
+	Err      int32
+}
+
+// syscallStat mirrors struct syscall_stat in the BPF program
+type syscallStat struct {
+	Count     uint64
+	TotalNS   uint64
+	Histogram [syscallHistSlots]uint64
+}
+
+// sampler periodically emits the on-CPU time accumulated per thread by the
+// sched_switch program, the page faults counted per process by the
+// handle_mm_fault probe, the system calls counted per cgroup by the
+// raw_syscalls programs, the CPU and memory counters of each traced
+// container's cgroup and the TCP counters of their network namespaces
+type sampler struct {
+	oncpu       *ebpf.Map
+	faults      *ebpf.Map
+	syscalls    *ebpf.Map
+	cgroupPaths map[string]string
+	container   func(*events.Event) (string, bool)
+
+	last         map[uint32]uint64
+	lastFaults   map[uint32]faultCount
+	lastSyscalls map[syscallKey]syscallStat
+	stop         chan struct{}
+	done         chan struct{}
+}
+
+// newSampler reads the counters from the maps of the eBPF collection
+func newSampler(maps map[string]*ebpf.Map, cgroupPaths map[string]string, container func(*events.Event) (string, bool)) *sampler {
+	return &sampler{
+		oncpu:        maps["oncpu_threads"],
+		faults:       maps["page_fault_counts"],
+		syscalls:     maps["syscall_stats"],
+		cgroupPaths:  cgroupPaths,
+		container:    container,
+		last:         make(map[uint32]uint64),
+		lastFaults:   make(map[uint32]faultCount),
+		lastSyscalls: make(map[syscallKey]syscallStat),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+}
+
+// start samples every sampleInterval until close is called
+func (s *sampler) start(eventChan chan<- *events.Event) {
+	// the first pass only records a baseline for threads that ran,
+	// processes that faulted and system calls made before tracing started
+	s.sampleThreads(nil)
+	s.samplePageFaults(nil)
+	s.sampleSyscalls(nil)
+
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(sampleInterval)
+		defer ticker.Stop()
+
+		s.sampleCgroups(eventChan)
+		s.sampleNetStats(eventChan)
+		for {
+			select {
+			case <-ticker.C:
+				s.sampleThreads(eventChan)
+				s.samplePageFaults(eventChan)
+				s.sampleSyscalls(eventChan)
+				s.sampleCgroups(eventChan)
+				s.sampleNetStats(eventChan)
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (s *sampler) close() {
+	close(s.stop)
+	<-s.done
+}
+
+// sampleThreads emits one event per thread that ran since the previous
+// sample, or only updates the baseline if eventChan is nil
+func (s *sampler) sampleThreads(eventChan chan<- *events.Event) {
+	if s.oncpu == nil {
+		return
+	}
+
+	now := uint64(time.Now().UnixNano())
+	seen := make(map[uint32]bool)
+
+	var tid uint32
+	var value oncpuTime
+	iter := s.oncpu.Iterate()
+	for iter.Next(&tid, &value) {
+		seen[tid] = true
+		delta := value.NS - s.last[tid]
+		if value.NS < s.last[tid] {
+			// the thread ID was reused after its entry was evicted
+			delta = value.NS
+		}
+		s.last[tid] = value.NS
+		if eventChan == nil || delta == 0 {
+			continue
+		}
+
+		event := &events.Event{
+			Timestamp: now,
+			PID:       value.PID,
+			TID:       tid,
+			CgroupID:  value.CgroupID,
+			Type:      events.EventCPUTime,
+			LatencyNS: delta,
+		}
+		container, ok := s.container(event)
+		if !ok {
+			continue
+		}
+		event.Container = container
+		event.ProcessName = getProcessNameQuick(event.PID)
+		if !s.send(eventChan, event) {
+			return
+		}
+	}
+
+	for tid := range s.last {
+		if !seen[tid] {
+			delete(s.last, tid)
+		}
+	}
+}
+
+// samplePageFaults emits one event per process that faulted since the
+// previous sample, or only updates the baseline if eventChan is nil
+func (s *sampler) samplePageFaults(eventChan chan<- *events.Event) {
+	if s.faults == nil {
+		return
+	}
+
+	now := uint64(time.Now().UnixNano())
+	seen := make(map[uint32]bool)
+
+	var pid uint32
+	var value faultCount
+	iter := s.faults.Iterate()
+	for iter.Next(&pid, &value) {
+		seen[pid] = true
+		last := s.lastFaults[pid]
+		if value.Minor < last.Minor || value.Major < last.Major {
+			// the PID was reused after its entry was evicted
+			last = faultCount{}
+		}
+		s.lastFaults[pid] = value
+		delta := events.PageFaultCount{Minor: value.Minor - last.Minor, Major: value.Major - last.Major}
+		if eventChan == nil || delta.Minor+delta.Major == 0 {
+			continue
+		}
+
+		event := &events.Event{
+			Timestamp:  now,
+			PID:        pid,
+			CgroupID:   value.CgroupID,
+			Type:       events.EventPageFaultCount,
+			PageFaults: &delta,
+		}
+		container, ok := s.container(event)
+		if !ok {
+			continue
+		}
+		event.Container = container
+		event.ProcessName = getProcessNameQuick(event.PID)
+		if !s.send(eventChan, event) {
+			return
+		}
+	}
+
+	for pid := range s.lastFaults {
+		if !seen[pid] {
+			delete(s.lastFaults, pid)
+		}
+	}
+}
+
+// sampleSyscalls emits one event per cgroup, system call and errno with
+// calls since the previous sample, or only updates the baseline if eventChan
+// is nil
+func (s *sampler) sampleSyscalls(eventChan chan<- *events.Event) {
+	if s.syscalls == nil {
+		return
+	}
+
+	now := uint64(time.Now().UnixNano())
+	seen := make(map[syscallKey]bool)
+
+	var key syscallKey
+	var value syscallStat
+	iter := s.syscalls.Iterate()
+	for iter.Next(&key, &value) {
+		seen[key] = true
+		last := s.lastSyscalls[key]
+		if value.Count < last.Count {
+			// the entry was evicted and added again
+			last = syscallStat{}
+		}
+		s.lastSyscalls[key] = value
+		if eventChan == nil || value.Count == last.Count {
+			continue
+		}
+
+		stats := &events.SyscallStats{
+			Nr:        key.Nr,
+			Count:     value.Count - last.Count,
+			TotalNS:   value.TotalNS - last.TotalNS,
+			Histogram: make([]uint64, syscallHistSlots),
+		}
+		for i := range value.Histogram {
+			stats.Histogram[i] = value.Histogram[i] - last.Histogram[i]
+		}
+		event := &events.Event{
+			Timestamp: now,
+			CgroupID:  key.CgroupID,
+			Type:      events.EventSyscall,
+			Error:     -key.Err,
+			Target:    syscallName(key.Nr),
+			Syscall:   stats,
+		}
+		container, ok := s.container(event)
+		if !ok {
+			continue
+		}
+		event.Container = container
+		if !s.send(eventChan, event) {
+			return
+		}
+	}
+
+	for key := range s.lastSyscalls {
+		if !seen[key] {
+			delete(s.lastSyscalls, key)
+		}
+	}
+}
+
+// syscallName returns the name of a system call, e.g. "openat"
+func syscallName(nr uint32) string {
+	if name, ok := syscallNames[nr]; ok {
+		return name
+	}
+	return fmt.Sprintf("syscall_%d", nr)
+}
+
+// sampleCgroups emits the CPU and memory counters of every container
+func (s *sampler) sampleCgroups(eventChan chan<- *events.Event) {
+	now := uint64(time.Now().UnixNano())
+	for container, cgroupPath := range s.cgroupPaths {
+		cgroupPath = normalizeCgroupPath(cgroupPath)
+		if stat, ok := readCgroupCPU(cgroupPath); ok {
+			event := &events.Event{
+				Timestamp: now,
+				Type:      events.EventCgroupCPU,
+				Container: container,
+				CgroupCPU: stat,
+			}
+			if !s.send(eventChan, event) {
+				return
+			}
+		}
+		if memory, ok := readCgroupMemory(cgroupPath); ok {
+			event := &events.Event{
+				Timestamp:    now,
+				Type:         events.EventCgroupMemory,
+				Container:    container,
+				CgroupMemory: memory,
+			}
+			if !s.send(eventChan, event) {
+				return
+			}
+		}
+	}
+}
+
+// sampleNetStats emits the TCP counters of every network namespace the
+// containers live in, once per namespace
+func (s *sampler) sampleNetStats(eventChan chan<- *events.Event) {
+	now := uint64(time.Now().UnixNano())
+	containers := make([]string, 0, len(s.cgroupPaths))
+	for container := range s.cgroupPaths {
+		containers = append(containers, container)
+	}
+	sort.Strings(containers)
+
+	seen := make(map[uint64]bool)
+	for _, container := range containers {
+		stats, ok := readNetStat(normalizeCgroupPath(s.cgroupPaths[container]))
+		if !ok || seen[stats.Namespace] {
+			continue
+		}
+		seen[stats.Namespace] = true
+		event := &events.Event{
+			Timestamp: now,
+			Type:      events.EventNetStat,
+			Container: container,
+			NetStat:   stats,
+		}
+		if !s.send(eventChan, event) {
+			return
+		}
+	}
+}
+
+// send delivers an event unless the sampler is being closed, so that close
+// does not hang on a consumer that stopped reading
+func (s *sampler) send(eventChan chan<- *events.Event, event *events.Event) bool {
+	select {
+	case eventChan <- event:
+		return true
+	case <-s.stop:
+		return false
+	}
+}
+
+// readCgroupCPU reads CPU usage and throttling counters from the cgroup v2
+// cpu.stat and cpu.max files, falling back to the cgroup v1 cpu and cpuacct
+// controllers
+func readCgroupCPU(cgroupPath string) (*events.CgroupCPU, bool) {
+	dir := filepath.Join(cgroupRoot, cgroupPath)
+	if stat, err := readKeyValueFile(filepath.Join(dir, "cpu.stat")); err == nil {
+		if _, ok := stat["usage_usec"]; ok {
+			cpu := &events.CgroupCPU{
+				UsageUSec:     stat["usage_usec"],
+				NrPeriods:     stat["nr_periods"],
+				NrThrottled:   stat["nr_throttled"],
+				ThrottledUSec: stat["throttled_usec"],
+			}
+			if data, err := os.ReadFile(filepath.Join(dir, "cpu.max")); err == nil {
+				cpu.QuotaUSec, cpu.PeriodUSec = parseCPUMax(string(data))
+			}
+			return cpu, true
+		}
+	}
+
+	dir = filepath.Join(cgroupRoot, "cpu,cpuacct", cgroupPath)
+	stat, err := readKeyValueFile(filepath.Join(dir, "cpu.stat"))
+	if err != nil {
+		return nil, false
+	}
+	cpu := &events.CgroupCPU{
+		NrPeriods:     stat["nr_periods"],
+		NrThrottled:   stat["nr_throttled"],
+		ThrottledUSec: stat["throttled_time"] / 1000,
+	}
+	if usage, err := readUintFile(filepath.Join(dir, "cpuacct.usage")); err == nil {
+		cpu.UsageUSec = usage / 1000
+	}
+	quota, err := os.ReadFile(filepath.Join(dir, "cpu.cfs_quota_us"))
+	if err == nil {
+		if q, err := strconv.ParseInt(strings.TrimSpace(string(quota)), 10, 64); err == nil && q > 0 {
+			cpu.QuotaUSec = uint64(q)
+			cpu.PeriodUSec, _ = readUintFile(filepath.Join(dir, "cpu.cfs_period_us"))
+		}
+	}
+	return cpu, true
+}
+
+// parseCPUMax parses cgroup v2 cpu.max content such as "50000 100000" or
+// "max 100000". The quota is 0 when unlimited.
+func parseCPUMax(content string) (quota, period uint64) {
+	fields := strings.Fields(content)
+	if len(fields) != 2 {
+		return 0, 0
+	}
+	period, _ = strconv.ParseUint(fields[1], 10, 64)
+	if fields[0] == "max" {
+		return 0, period
+	}
+	quota, _ = strconv.ParseUint(fields[0], 10, 64)
+	return quota, period
+}
+
+// readKeyValueFile parses files of "key value" lines such as cpu.stat
+func readKeyValueFile(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = v
+		}
+	}
+	return values, scanner.Err()
+}
+
+func readUintFile(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
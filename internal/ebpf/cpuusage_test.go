@@ -0,0 +1,22 @@
+package ebpf
+
+import "testing"
+
+func TestParseCPUMax(t *testing.T) {
+	tests := []struct {
+		content string
+		quota   uint64
+		period  uint64
+	}{
+		{"50000 100000\n", 50000, 100000},
+		{"max 100000\n", 0, 100000},
+		{"", 0, 0},
+	}
+
+	for _, tt := range tests {
+		quota, period := parseCPUMax(tt.content)
+		if quota != tt.quota || period != tt.period {
+			t.Errorf("parseCPUMax(%q) = %d, %d, expected %d, %d", tt.content, quota, period, tt.quota, tt.period)
+		}
+	}
+}
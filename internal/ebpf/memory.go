@@ -0,0 +1,98 @@
+package ebpf
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/podtrace/podtrace/internal/events"
+)
+
+// unlimitedMemoryV1 is the smallest cgroup v1 memory limit treated as no
+// limit; the kernel reports PAGE_COUNTER_MAX rounded to pages
+const unlimitedMemoryV1 = 1 << 62
+
+// readCgroupMemory reads memory usage from the cgroup v2 memory controller,
+// along with its memory.events counters and memory.pressure stall times,
+// falling back to the cgroup v1 memory controller
+func readCgroupMemory(cgroupPath string) (*events.CgroupMemory, bool) {
+	dir := filepath.Join(cgroupRoot, cgroupPath)
+	if usage, err := readUintFile(filepath.Join(dir, "memory.current")); err == nil {
+		memory := &events.CgroupMemory{UsageBytes: usage}
+		if data, err := os.ReadFile(filepath.Join(dir, "memory.max")); err == nil {
+			memory.LimitBytes, _ = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		}
+		if stat, err := readKeyValueFile(filepath.Join(dir, "memory.stat")); err == nil {
+			memory.AnonBytes = stat["anon"]
+			memory.FileBytes = stat["file"]
+		}
+		if counters, err := readKeyValueFile(filepath.Join(dir, "memory.events")); err == nil {
+			memory.High = counters["high"]
+			memory.Max = counters["max"]
+			memory.OOM = counters["oom"]
+			memory.OOMKill = counters["oom_kill"]
+		}
+		if data, err := os.ReadFile(filepath.Join(dir, "memory.pressure")); err == nil {
+			parsePressure(string(data), memory)
+		}
+		return memory, true
+	}
+
+	dir = filepath.Join(cgroupRoot, "memory", cgroupPath)
+	usage, err := readUintFile(filepath.Join(dir, "memory.usage_in_bytes"))
+	if err != nil {
+		return nil, false
+	}
+	memory := &events.CgroupMemory{UsageBytes: usage}
+	if limit, err := readUintFile(filepath.Join(dir, "memory.limit_in_bytes")); err == nil && limit < unlimitedMemoryV1 {
+		memory.LimitBytes = limit
+	}
+	if stat, err := readKeyValueFile(filepath.Join(dir, "memory.stat")); err == nil {
+		memory.AnonBytes = stat["rss"]
+		memory.FileBytes = stat["cache"]
+	}
+	// failcnt counts allocations that hit the limit, the closest to v2's max
+	memory.Max, _ = readUintFile(filepath.Join(dir, "memory.failcnt"))
+	if control, err := readKeyValueFile(filepath.Join(dir, "memory.oom_control")); err == nil {
+		memory.OOMKill = control["oom_kill"]
+	}
+	return memory, true
+}
+
+// parsePressure parses PSI content such as
+//
+//	some avg10=1.50 avg60=0.80 avg300=0.20 total=123456
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=4567
+//
+// into the pressure fields of memory
+func parsePressure(content string, memory *events.CgroupMemory) {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		var avg10 float64
+		var total uint64
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			switch key {
+			case "avg10":
+				avg10, _ = strconv.ParseFloat(value, 64)
+			case "total":
+				total, _ = strconv.ParseUint(value, 10, 64)
+			}
+		}
+		switch fields[0] {
+		case "some":
+			memory.PressureSomeAvg10, memory.PressureSomeUSec = avg10, total
+		case "full":
+			memory.PressureFullAvg10, memory.PressureFullUSec = avg10, total
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package ebpf
+
+import (
+	"testing"
+
+	"github.com/podtrace/podtrace/internal/events"
+)
+
+func TestParsePressure(t *testing.T) {
+	content := "some avg10=12.50 avg60=3.00 avg300=1.00 total=1234567\n" +
+		"full avg10=2.25 avg60=0.50 avg300=0.10 total=4567\n"
+
+	var memory events.CgroupMemory
+	parsePressure(content, &memory)
+	if memory.PressureSomeAvg10 != 12.5 || memory.PressureSomeUSec != 1234567 {
+		t.Errorf("some = %.2f, %d", memory.PressureSomeAvg10, memory.PressureSomeUSec)
+	}
+	if memory.PressureFullAvg10 != 2.25 || memory.PressureFullUSec != 4567 {
+		t.Errorf("full = %.2f, %d", memory.PressureFullAvg10, memory.PressureFullUSec)
+	}
+}
@@ -0,0 +1,96 @@
+package ebpf
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/podtrace/podtrace/internal/events"
+)
+
+// readNetStat reads the TCP listen counters of the network namespace that the
+// processes of a cgroup live in. Pods share one namespace between their
+// containers, so the namespace's inode is returned with the counters.
+func readNetStat(cgroupPath string) (*events.NetStats, bool) {
+	pid, ok := firstCgroupPID(cgroupPath)
+	if !ok {
+		return nil, false
+	}
+
+	var st unix.Stat_t
+	if err := unix.Stat(fmt.Sprintf("/proc/%d/ns/net", pid), &st); err != nil {
+		return nil, false
+	}
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/net/netstat", pid))
+	if err != nil {
+		return nil, false
+	}
+	tcpExt := parseNetStat(string(data))["TcpExt"]
+	if tcpExt == nil {
+		return nil, false
+	}
+	return &events.NetStats{
+		Namespace:       st.Ino,
+		ListenOverflows: tcpExt["ListenOverflows"],
+		ListenDrops:     tcpExt["ListenDrops"],
+	}, true
+}
+
+// firstCgroupPID returns a process of the cgroup v2 cgroup, or of the cgroup
+// v1 memory controller's
+func firstCgroupPID(cgroupPath string) (uint32, bool) {
+	for _, dir := range []string{
+		filepath.Join(cgroupRoot, cgroupPath),
+		filepath.Join(cgroupRoot, "memory", cgroupPath),
+	} {
+		if pids := cgroupPIDs(dir); len(pids) > 0 {
+			return pids[0], true
+		}
+	}
+	return 0, false
+}
+
+// parseNetStat parses /proc/net/netstat and /proc/net/snmp content, where
+// each protocol has a line of counter names followed by a line of values:
+//
+//	TcpExt: SyncookiesSent SyncookiesRecv ... ListenOverflows ListenDrops
+//	TcpExt: 0 0 ... 12 12
+//
+// into counters by protocol and name
+func parseNetStat(content string) map[string]map[string]uint64 {
+	stats := make(map[string]map[string]uint64)
+	var names []string
+	var proto string
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		prefix, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if prefix != proto || names == nil {
+			proto, names = prefix, fields
+			continue
+		}
+
+		counters := make(map[string]uint64)
+		for i, field := range fields {
+			if i >= len(names) {
+				break
+			}
+			if v, err := strconv.ParseUint(field, 10, 64); err == nil {
+				counters[names[i]] = v
+			}
+		}
+		stats[proto] = counters
+		names = nil
+	}
+	return stats
+}
@@ -0,0 +1,21 @@
+package ebpf
+
+import "testing"
+
+func TestParseNetStat(t *testing.T) {
+	content := "TcpExt: SyncookiesSent ListenOverflows ListenDrops\n" +
+		"TcpExt: 1 12 14\n" +
+		"IpExt: InNoRoutes InTruncatedPkts\n" +
+		"IpExt: 0 3\n"
+
+	stats := parseNetStat(content)
+	if got := stats["TcpExt"]["ListenOverflows"]; got != 12 {
+		t.Errorf("expected 12 listen overflows, got %d", got)
+	}
+	if got := stats["TcpExt"]["ListenDrops"]; got != 14 {
+		t.Errorf("expected 14 listen drops, got %d", got)
+	}
+	if got := stats["IpExt"]["InTruncatedPkts"]; got != 3 {
+		t.Errorf("expected 3 truncated packets, got %d", got)
+	}
+}
@@ -0,0 +1,201 @@
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"golang.org/x/sys/unix"
+
+	"github.com/podtrace/podtrace/internal/events"
+	"github.com/podtrace/podtrace/internal/profile"
+)
+
+// DefaultProfileFrequency is the default number of CPU samples per second
+// and CPU. An odd rate avoids sampling in lockstep with periodic work.
+const DefaultProfileFrequency = 99
+
+// profileKey mirrors struct profile_key in the BPF program
+type profileKey struct {
+	CgroupID      uint64
+	PID           uint32
+	KernelStackID int32
+	UserStackID   int32
+	_             uint32
+}
+
+// cpuProfiler holds the per-CPU clock events the perf_event program is
+// attached to
+type cpuProfiler struct {
+	fds       []int
+	links     []link.Link
+	frequency uint64
+	start     time.Time
+}
+
+// StartProfiling starts sampling the stacks of the traced processes at
+// frequency Hz on every online CPU, until StopProfiling is called
+func (t *Tracer) StartProfiling(frequency uint64) error {
+	if t.profiler != nil {
+		return errors.New("profiling already started")
+	}
+	prog := t.collection.Programs["perf_event_profile"]
+	counts := t.collection.Maps["profile_counts"]
+	if prog == nil || counts == nil {
+		return errors.New("eBPF program has no profiler, rebuild it with 'make build'")
+	}
+	if frequency == 0 {
+		frequency = DefaultProfileFrequency
+	}
+
+	cpus, err := onlineCPUs("/sys/devices/system/cpu/online")
+	if err != nil {
+		return fmt.Errorf("failed to list online CPUs: %w", err)
+	}
+
+	// drop the counts of a previous profile
+	var key profileKey
+	var keys []profileKey
+	var value uint64
+	iter := counts.Iterate()
+	for iter.Next(&key, &value) {
+		keys = append(keys, key)
+	}
+	for _, k := range keys {
+		counts.Delete(&k)
+	}
+
+	p := &cpuProfiler{frequency: frequency, start: time.Now()}
+	for _, cpu := range cpus {
+		fd, err := unix.PerfEventOpen(&unix.PerfEventAttr{
+			Type:   unix.PERF_TYPE_SOFTWARE,
+			Config: unix.PERF_COUNT_SW_CPU_CLOCK,
+			Size:   uint32(unsafe.Sizeof(unix.PerfEventAttr{})),
+			Sample: frequency,
+			Bits:   unix.PerfBitFreq,
+		}, -1, cpu, -1, unix.PERF_FLAG_FD_CLOEXEC)
+		if err != nil {
+			p.close()
+			return fmt.Errorf("failed to open perf event on CPU %d: %w", cpu, err)
+		}
+		p.fds = append(p.fds, fd)
+
+		if err := p.attach(fd, prog); err != nil {
+			p.close()
+			return fmt.Errorf("failed to attach profiler on CPU %d: %w", cpu, err)
+		}
+	}
+
+	t.profiler = p
+	return nil
+}
+
+// attach runs prog on every sample of the perf event, with a BPF link when
+// the kernel supports it (5.15+) and the perf ioctls otherwise
+func (p *cpuProfiler) attach(fd int, prog *ebpf.Program) error {
+	l, err := link.AttachRawLink(link.RawLinkOptions{
+		Target:  fd,
+		Program: prog,
+		Attach:  ebpf.AttachPerfEvent,
+	})
+	if err == nil {
+		p.links = append(p.links, l)
+		return nil
+	}
+
+	if err := unix.IoctlSetInt(fd, unix.PERF_EVENT_IOC_SET_BPF, prog.FD()); err != nil {
+		return err
+	}
+	return unix.IoctlSetInt(fd, unix.PERF_EVENT_IOC_ENABLE, 0)
+}
+
+func (p *cpuProfiler) close() {
+	for _, l := range p.links {
+		l.Close()
+	}
+	for _, fd := range p.fds {
+		unix.Close(fd)
+	}
+}
+
+// StopProfiling stops sampling and returns the symbolized profile of the
+// traced processes
+func (t *Tracer) StopProfiling() (*profile.Profile, error) {
+	p := t.profiler
+	if p == nil {
+		return nil, errors.New("profiling not started")
+	}
+	p.close()
+	t.profiler = nil
+
+	result := &profile.Profile{
+		Frequency: p.frequency,
+		Start:     p.start,
+		Duration:  time.Since(p.start),
+	}
+
+	symbols := newSymbolizer(t.collection.Maps["profile_stacks"])
+	var key profileKey
+	var count uint64
+	iter := t.collection.Maps["profile_counts"].Iterate()
+	for iter.Next(&key, &count) {
+		container, ok := t.containerForEvent(&events.Event{PID: key.PID, CgroupID: key.CgroupID})
+		if !ok {
+			continue
+		}
+		kernel, user := symbols.frames(key.PID, key.KernelStackID, key.UserStackID)
+		result.Samples = append(result.Samples, profile.Sample{
+			PID:         key.PID,
+			Process:     getProcessNameQuick(key.PID),
+			Container:   container,
+			KernelStack: kernel,
+			UserStack:   user,
+			Count:       count,
+		})
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read profile counts: %w", err)
+	}
+
+	return result, nil
+}
+
+// onlineCPUs returns the CPUs listed in a sysfs CPU list file
+func onlineCPUs(path string) ([]int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseCPUList(strings.TrimSpace(string(data)))
+}
+
+// parseCPUList parses a CPU list such as "0-3,6,8-9"
+func parseCPUList(list string) ([]int, error) {
+	var cpus []int
+	for _, part := range strings.Split(list, ",") {
+		if part == "" {
+			continue
+		}
+		first, last, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(first)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CPU list %q", list)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(last); err != nil || end < start {
+				return nil, fmt.Errorf("invalid CPU list %q", list)
+			}
+		}
+		for cpu := start; cpu <= end; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
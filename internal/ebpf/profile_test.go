@@ -0,0 +1,31 @@
+package ebpf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCPUList(t *testing.T) {
+	tests := []struct {
+		list     string
+		expected []int
+	}{
+		{"0", []int{0}},
+		{"0-3", []int{0, 1, 2, 3}},
+		{"0-1,4,6-7", []int{0, 1, 4, 6, 7}},
+	}
+
+	for _, tt := range tests {
+		cpus, err := parseCPUList(tt.list)
+		if err != nil {
+			t.Fatalf("parseCPUList(%q) failed: %v", tt.list, err)
+		}
+		if !reflect.DeepEqual(cpus, tt.expected) {
+			t.Errorf("parseCPUList(%q) = %v, expected %v", tt.list, cpus, tt.expected)
+		}
+	}
+
+	if _, err := parseCPUList("3-1"); err == nil {
+		t.Error("expected an error for a reversed range")
+	}
+}
@@ -0,0 +1,373 @@
+package ebpf
+
+import (
+	"bufio"
+	"container/list"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cilium/ebpf"
+	"golang.org/x/sys/unix"
+
+	"github.com/podtrace/podtrace/internal/events"
+)
+
+// maxStackDepth matches MAX_STACK_DEPTH in the BPF program
+const maxStackDepth = 127
+
+// maxCachedProcs bounds the number of processes whose memory maps are cached
+const maxCachedProcs = 1024
+
+// maxCachedFiles bounds the number of ELF files whose symbols are cached
+const maxCachedFiles = 256
+
+type symbol struct {
+	addr uint64
+	name string
+}
+
+// symbolTable is a list of symbols sorted by address
+type symbolTable []symbol
+
+func (t symbolTable) lookup(addr uint64) (symbol, bool) {
+	i := sort.Search(len(t), func(i int) bool { return t[i].addr > addr })
+	if i == 0 {
+		return symbol{}, false
+	}
+	return t[i-1], true
+}
+
+// mapping is an executable region of a process's address space
+type mapping struct {
+	start  uint64
+	end    uint64
+	offset uint64
+	file   fileID
+	path   string
+}
+
+// elfFile holds the function symbols of a mapped file and the load segments
+// used to translate file offsets into symbol addresses
+type elfFile struct {
+	symbols symbolTable
+	loads   []elf.ProgHeader
+}
+
+// symbolizer resolves stack IDs from a stack trace map into function
+// names, using /proc/kallsyms for kernel frames and the ELF symbol tables of
+// the files in /proc/<pid>/maps for user frames
+type symbolizer struct {
+	stacks *ebpf.Map
+
+	mu    sync.Mutex
+	procs map[uint32][]mapping
+	files *fileCache
+}
+
+func newSymbolizer(stacks *ebpf.Map) *symbolizer {
+	return &symbolizer{
+		stacks: stacks,
+		procs:  make(map[uint32][]mapping),
+		files:  newFileCache(maxCachedFiles),
+	}
+}
+
+// fileCache is a least recently used cache of ELF files. Files are keyed by
+// device and inode, so a library is parsed once however many processes map
+// it.
+type fileCache struct {
+	capacity int
+	order    *list.List // most recently used first
+	entries  map[fileID]*list.Element
+}
+
+type fileCacheEntry struct {
+	id   fileID
+	file *elfFile
+}
+
+func newFileCache(capacity int) *fileCache {
+	return &fileCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[fileID]*list.Element),
+	}
+}
+
+func (c *fileCache) get(id fileID) (*elfFile, bool) {
+	el, ok := c.entries[id]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*fileCacheEntry).file, true
+}
+
+func (c *fileCache) add(id fileID, f *elfFile) {
+	if el, ok := c.entries[id]; ok {
+		el.Value.(*fileCacheEntry).file = f
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[id] = c.order.PushFront(&fileCacheEntry{id: id, file: f})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*fileCacheEntry).id)
+	}
+}
+
+// kernelSymbols is the kernel symbol table, read on first use
+var kernelSymbols = sync.OnceValue(func() symbolTable {
+	return loadKallsyms("/proc/kallsyms")
+})
+
+// resolve fills in the stacks of an off-CPU or futex event
+func (s *symbolizer) resolve(e *events.Event) {
+	if s == nil {
+		return
+	}
+	if e.OffCPU != nil {
+		e.OffCPU.KernelStack, e.OffCPU.UserStack = s.frames(e.PID, e.OffCPU.KernelStackID, e.OffCPU.UserStackID)
+	}
+	if e.Futex != nil {
+		_, e.Futex.UserStack = s.frames(e.PID, -1, e.Futex.UserStackID)
+	}
+}
+
+// frames symbolizes the kernel and user stacks with the given IDs, taken in
+// process pid. Negative IDs yield no frames.
+func (s *symbolizer) frames(pid uint32, kernelStackID, userStackID int32) (kernel, user []string) {
+	if s.stacks == nil {
+		return nil, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// stack IDs are reused once the map fills up, so frames are not cached
+	// by ID
+	if kernelStackID >= 0 {
+		if addrs := s.stack(kernelStackID); addrs != nil {
+			kernel = s.kernelFrames(addrs)
+		}
+	}
+
+	// user stacks are symbolized every time since the same addresses mean
+	// different things in different processes
+	if userStackID >= 0 {
+		if addrs := s.stack(userStackID); addrs != nil {
+			user = s.userFrames(pid, addrs)
+		}
+	}
+
+	return kernel, user
+}
+
+func (s *symbolizer) stack(id int32) []uint64 {
+	var raw [maxStackDepth]uint64
+	if err := s.stacks.Lookup(uint32(id), &raw); err != nil {
+		return nil
+	}
+	for i, addr := range raw {
+		if addr == 0 {
+			return raw[:i]
+		}
+	}
+	return raw[:]
+}
+
+func (s *symbolizer) kernelFrames(addrs []uint64) []string {
+	table := kernelSymbols()
+
+	frames := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		if sym, ok := table.lookup(addr); ok {
+			frames = append(frames, formatFrame(sym, addr))
+		} else {
+			frames = append(frames, fmt.Sprintf("0x%x", addr))
+		}
+	}
+	return frames
+}
+
+func (s *symbolizer) userFrames(pid uint32, addrs []uint64) []string {
+	frames := make([]string, 0, len(addrs))
+	maps := s.procMaps(pid, false)
+	for _, addr := range addrs {
+		m, ok := findMapping(maps, addr)
+		if !ok {
+			// the process may have mapped new libraries since it was cached
+			maps = s.procMaps(pid, true)
+			m, ok = findMapping(maps, addr)
+		}
+		if !ok {
+			frames = append(frames, fmt.Sprintf("0x%x", addr))
+			continue
+		}
+		frames = append(frames, s.userFrame(pid, m, addr))
+	}
+	return frames
+}
+
+func (s *symbolizer) userFrame(pid uint32, m mapping, addr uint64) string {
+	f, ok := s.files.get(m.file)
+	if !ok {
+		var err error
+		f, err = loadELFFile(fmt.Sprintf("/proc/%d/root%s", pid, m.path))
+		// a file that cannot be opened may still be readable through
+		// another process, so only keep files that were read or are not ELF
+		if err == nil || errors.As(err, new(*elf.FormatError)) {
+			s.files.add(m.file, f)
+		}
+	}
+
+	fileOffset := addr - m.start + m.offset
+	if f != nil {
+		for _, load := range f.loads {
+			if fileOffset < load.Off || fileOffset >= load.Off+load.Filesz {
+				continue
+			}
+			vaddr := fileOffset - load.Off + load.Vaddr
+			if sym, ok := f.symbols.lookup(vaddr); ok {
+				return formatFrame(sym, vaddr)
+			}
+			break
+		}
+	}
+	return fmt.Sprintf("0x%x (%s)", fileOffset, filepath.Base(m.path))
+}
+
+func (s *symbolizer) procMaps(pid uint32, refresh bool) []mapping {
+	if maps, ok := s.procs[pid]; ok && !refresh {
+		return maps
+	}
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/maps", pid))
+	if err != nil {
+		return nil
+	}
+	if len(s.procs) >= maxCachedProcs {
+		s.procs = make(map[uint32][]mapping)
+	}
+	maps := parseExecMappings(string(data))
+	s.procs[pid] = maps
+	return maps
+}
+
+func findMapping(maps []mapping, addr uint64) (mapping, bool) {
+	for _, m := range maps {
+		if addr >= m.start && addr < m.end {
+			return m, true
+		}
+	}
+	return mapping{}, false
+}
+
+func formatFrame(sym symbol, addr uint64) string {
+	if addr == sym.addr {
+		return sym.name
+	}
+	return fmt.Sprintf("%s+0x%x", sym.name, addr-sym.addr)
+}
+
+// parseExecMappings returns the file-backed executable mappings in
+// /proc/<pid>/maps content
+func parseExecMappings(maps string) []mapping {
+	var result []mapping
+	for _, line := range strings.Split(maps, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 6 || !strings.Contains(fields[1], "x") || !strings.HasPrefix(fields[5], "/") {
+			continue
+		}
+		bounds := strings.SplitN(fields[0], "-", 2)
+		if len(bounds) != 2 {
+			continue
+		}
+		start, err1 := strconv.ParseUint(bounds[0], 16, 64)
+		end, err2 := strconv.ParseUint(bounds[1], 16, 64)
+		offset, err3 := strconv.ParseUint(fields[2], 16, 64)
+		ino, err4 := strconv.ParseUint(fields[4], 10, 64)
+		major, minor, ok := strings.Cut(fields[3], ":")
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil || !ok {
+			continue
+		}
+		devMajor, err1 := strconv.ParseUint(major, 16, 32)
+		devMinor, err2 := strconv.ParseUint(minor, 16, 32)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		result = append(result, mapping{
+			start:  start,
+			end:    end,
+			offset: offset,
+			file:   fileID{dev: unix.Mkdev(uint32(devMajor), uint32(devMinor)), ino: ino},
+			path:   fields[5],
+		})
+	}
+	return result
+}
+
+// loadKallsyms reads the kernel's text symbols. Addresses read as zero
+// without CAP_SYSLOG, in which case the table is empty.
+func loadKallsyms(path string) symbolTable {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var table symbolTable
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		if kind := fields[1]; kind != "t" && kind != "T" && kind != "w" && kind != "W" {
+			continue
+		}
+		addr, err := strconv.ParseUint(fields[0], 16, 64)
+		if err != nil || addr == 0 {
+			continue
+		}
+		table = append(table, symbol{addr: addr, name: fields[2]})
+	}
+
+	sort.Slice(table, func(i, j int) bool { return table[i].addr < table[j].addr })
+	return table
+}
+
+// loadELFFile reads the function symbols and load segments of an ELF file
+func loadELFFile(path string) (*elfFile, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	result := &elfFile{}
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_LOAD && prog.Flags&elf.PF_X != 0 {
+			result.loads = append(result.loads, prog.ProgHeader)
+		}
+	}
+
+	symbols, _ := f.Symbols()
+	dynamic, _ := f.DynamicSymbols()
+	for _, sym := range append(symbols, dynamic...) {
+		if elf.ST_TYPE(sym.Info) != elf.STT_FUNC || sym.Value == 0 {
+			continue
+		}
+		result.symbols = append(result.symbols, symbol{addr: sym.Value, name: sym.Name})
+	}
+	sort.Slice(result.symbols, func(i, j int) bool { return result.symbols[i].addr < result.symbols[j].addr })
+
+	return result, nil
+}
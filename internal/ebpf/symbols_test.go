@@ -0,0 +1,85 @@
+package ebpf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestParseExecMappings(t *testing.T) {
+	maps := `55d0c0a00000-55d0c0a21000 r--p 00000000 fd:01 1234 /usr/bin/app
+55d0c0a21000-55d0c0b00000 r-xp 00021000 fd:01 1234 /usr/bin/app
+7f1c2a000000-7f1c2a022000 r-xp 00028000 fd:01 5678 /lib/x86_64-linux-gnu/libc.so.6
+7ffd4a000000-7ffd4a021000 rw-p 00000000 00:00 0 [stack]
+7ffd4a1fe000-7ffd4a200000 r-xp 00000000 00:00 0 [vdso]
+`
+	got := parseExecMappings(maps)
+	if len(got) != 2 {
+		t.Fatalf("got %d mappings, expected 2: %+v", len(got), got)
+	}
+	want := mapping{start: 0x55d0c0a21000, end: 0x55d0c0b00000, offset: 0x21000,
+		file: fileID{dev: unix.Mkdev(0xfd, 0x01), ino: 1234}, path: "/usr/bin/app"}
+	if got[0] != want {
+		t.Errorf("got %+v, expected %+v", got[0], want)
+	}
+	if m, ok := findMapping(got, 0x7f1c2a000100); !ok || m.path != "/lib/x86_64-linux-gnu/libc.so.6" {
+		t.Errorf("findMapping = %+v, %v", m, ok)
+	}
+}
+
+func TestLoadKallsyms(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kallsyms")
+	content := `ffffffff81000000 T _stext
+ffffffff81001000 t __schedule
+ffffffff81002000 D some_data
+ffffffff81003000 T futex_wait [futex]
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	table := loadKallsyms(path)
+	if len(table) != 3 {
+		t.Fatalf("got %d symbols, expected 3", len(table))
+	}
+
+	tests := []struct {
+		addr uint64
+		want string
+	}{
+		{0xffffffff81001000, "__schedule"},
+		{0xffffffff81001234, "__schedule+0x234"},
+		{0xffffffff81003010, "futex_wait+0x10"},
+	}
+	for _, tt := range tests {
+		sym, ok := table.lookup(tt.addr)
+		if !ok {
+			t.Errorf("lookup(0x%x) found nothing", tt.addr)
+			continue
+		}
+		if got := formatFrame(sym, tt.addr); got != tt.want {
+			t.Errorf("lookup(0x%x) = %q, expected %q", tt.addr, got, tt.want)
+		}
+	}
+	if _, ok := table.lookup(0xffffffff80000000); ok {
+		t.Error("address below the first symbol should not resolve")
+	}
+}
+
+func TestFileCacheEviction(t *testing.T) {
+	c := newFileCache(2)
+	a, b, d := fileID{ino: 1}, fileID{ino: 2}, fileID{ino: 3}
+	c.add(a, &elfFile{})
+	c.add(b, &elfFile{})
+	c.get(a)
+	c.add(d, &elfFile{})
+
+	if _, ok := c.get(b); ok {
+		t.Error("least recently used file was not evicted")
+	}
+	if _, ok := c.get(a); !ok {
+		t.Error("recently used file was evicted")
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !amd64
+
+package ebpf
+
+// syscallNames is empty on architectures the eBPF program is not built for
+var syscallNames = map[uint32]string{}
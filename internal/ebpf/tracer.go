@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/link"
@@ -20,10 +22,18 @@ import (
 )
 
 type Tracer struct {
-	collection *ebpf.Collection
-	links      []link.Link
-	reader     *ringbuf.Reader
-	cgroupPath string
+	collection     *ebpf.Collection
+	links          []link.Link
+	reader         *ringbuf.Reader
+	cgroupPaths    map[string]string
+	cgroups        *cgroupFilter
+	kernelFiltered bool
+	clockOffset    uint64
+	uprobes        *libcUprobes
+	hostUprobes    []link.Link
+	symbols        *symbolizer
+	sampler        *sampler
+	profiler       *cpuProfiler
 }
 
 // NewTracer creates a new eBPF tracer
@@ -61,6 +71,11 @@ func NewTracer() (*Tracer, error) {
 		return nil, fmt.Errorf("failed to load eBPF spec: %w", err)
 	}
 
+	if err := kernelCgroupFilterSupported(); err != nil {
+		fmt.Fprintf(os.Stderr, "Note: bpf_get_current_cgroup_id unavailable, events carry no cgroup ID: %v\n", err)
+		stubCgroupIDHelper(spec)
+	}
+
 	coll, err := ebpf.NewCollection(spec)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create eBPF collection: %w", err)
@@ -82,39 +97,135 @@ func NewTracer() (*Tracer, error) {
 	}
 
 	return &Tracer{
-		collection: coll,
-		links:      links,
-		reader:     rd,
+		collection:  coll,
+		links:       links,
+		reader:      rd,
+		clockOffset: monotonicToWallOffset(),
+		symbols:     newSymbolizer(coll.Maps["stack_traces"]),
 	}, nil
 }
 
-// AttachToCgroup stores the cgroup path for userspace filtering
-func (t *Tracer) AttachToCgroup(cgroupPath string) error {
-	t.cgroupPath = cgroupPath
+// AttachToCgroups restricts tracing to the given cgroups, keyed by container
+// name. Events are filtered in the kernel by cgroup ID when possible, otherwise
+// in userspace via /proc.
+func (t *Tracer) AttachToCgroups(cgroupPaths map[string]string) error {
+	t.cgroupPaths = cgroupPaths
+	t.kernelFiltered = false
+	t.detachUprobes()
+	t.closeCgroupFilter()
+
+	if len(cgroupPaths) == 0 {
+		t.attachHostLibc()
+		return nil
+	}
+
+	t.uprobes = newLibcUprobes(t.collection, cgroupPaths)
+	t.uprobes.start()
+
+	cgroups, err := t.enableKernelCgroupFilter(cgroupPaths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Note: kernel-side cgroup filtering unavailable, filtering in userspace: %v\n", err)
+		t.cgroups = watchCgroups(cgroupPaths)
+		return nil
+	}
+
+	t.cgroups = cgroups
+	t.kernelFiltered = true
 	return nil
 }
 
-// isPIDInCgroup checks if a PID belongs to the target cgroup
-func (t *Tracer) isPIDInCgroup(pid uint32) bool {
-	if t.cgroupPath == "" {
-		return true
+// EnableLockStacks records the user stack of every traced futex wait, so
+// that lock contention can be attributed to code
+func (t *Tracer) EnableLockStacks() error {
+	enabled := t.collection.Maps["futex_stacks_enabled"]
+	if enabled == nil {
+		return fmt.Errorf("eBPF program has no lock contention tracking, rebuild it with 'make build'")
+	}
+	return enabled.Put(uint32(0), uint32(1))
+}
+
+// attachHostLibc attaches the getaddrinfo uprobes to the host's libc, which
+// is only useful when tracing without a target pod
+func (t *Tracer) attachHostLibc() {
+	libcPath := findLibcPath()
+	if libcPath == "" {
+		fmt.Fprintf(os.Stderr, "Note: DNS tracking unavailable (libc path not found)\n")
+		return
+	}
+
+	links, err := attachGetaddrinfo(t.collection, libcPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Note: DNS tracking (uprobe) unavailable: %v\n", err)
+		return
+	}
+	t.hostUprobes = links
+}
+
+func (t *Tracer) detachUprobes() {
+	if t.uprobes != nil {
+		t.uprobes.close()
+		t.uprobes = nil
+	}
+	for _, l := range t.hostUprobes {
+		l.Close()
+	}
+	t.hostUprobes = nil
+}
+
+func (t *Tracer) closeCgroupFilter() {
+	if t.cgroups != nil {
+		t.cgroups.close()
+		t.cgroups = nil
+	}
+}
+
+// containerForEvent returns the name of the traced container an event came
+// from, and false if the event is outside the target cgroups
+func (t *Tracer) containerForEvent(event *events.Event) (string, bool) {
+	if t.kernelFiltered {
+		name, _ := t.cgroups.container(event.CgroupID)
+		return name, true
+	}
+	if event.PID == 0 && t.cgroups != nil {
+		// events from softirq or writeback context belong to no process,
+		// only to the cgroup of the socket or inode they concern
+		return t.cgroups.container(event.CgroupID)
+	}
+	return t.containerForPID(event.PID)
+}
+
+// containerForPID returns the name of the traced container a PID belongs to,
+// and false if the PID is outside the target cgroups
+func (t *Tracer) containerForPID(pid uint32) (string, bool) {
+	if len(t.cgroupPaths) == 0 {
+		return "", true
 	}
 
 	cgroupFile := fmt.Sprintf("/proc/%d/cgroup", pid)
 	data, err := os.ReadFile(cgroupFile)
 	if err != nil {
-		return false
+		return "", false
 	}
 
 	cgroupContent := strings.TrimSpace(string(data))
 	pidCgroupPath := extractCgroupPathFromProc(cgroupContent)
 	if pidCgroupPath == "" {
-		return false
+		return "", false
 	}
 
-	normalizedTarget := normalizeCgroupPath(t.cgroupPath)
 	normalizedPID := normalizeCgroupPath(pidCgroupPath)
+	for container, cgroupPath := range t.cgroupPaths {
+		if cgroupPathMatches(normalizeCgroupPath(cgroupPath), normalizedPID) {
+			return container, true
+		}
+	}
+
+	return "", false
+}
 
+// cgroupPathMatches checks if a PID's cgroup is the target cgroup, one of its
+// descendants or one of its ancestors
+func cgroupPathMatches(normalizedTarget, normalizedPID string) bool {
 	if normalizedPID == normalizedTarget {
 		return true
 	}
@@ -160,9 +271,30 @@ func extractCgroupPathFromProc(cgroupContent string) string {
 	return ""
 }
 
+// symbolizeQueueSize bounds the events read from the ring buffer that wait
+// for the symbolizer, so that a slow stack does not stall the reader
+const symbolizeQueueSize = 4096
+
 // Start begins collecting events and sends them to the event channel
 func (t *Tracer) Start(eventChan chan<- *events.Event) error {
+	t.sampler = newSampler(t.collection.Maps, t.cgroupPaths, t.containerForEvent)
+	t.sampler.start(eventChan)
+
+	// symbolization reads ELF files and /proc/<pid>/maps, which is too slow
+	// for the ring buffer reader. Every event passes through the same queue
+	// so that they stay in order.
+	symbolize := make(chan *events.Event, symbolizeQueueSize)
+	go func() {
+		for event := range symbolize {
+			if event.Type == events.EventSchedSwitch || event.Type == events.EventFutexWait {
+				t.symbols.resolve(event)
+			}
+			eventChan <- event
+		}
+	}()
+
 	go func() {
+		defer close(symbolize)
 		for {
 			record, err := t.reader.Read()
 			if err != nil {
@@ -174,25 +306,63 @@ func (t *Tracer) Start(eventChan chan<- *events.Event) error {
 			}
 
 			event := parseEvent(record.RawSample)
-			if event != nil {
-				event.ProcessName = getProcessNameQuick(event.PID)
+			if event == nil {
+				continue
+			}
 
-				if t.isPIDInCgroup(event.PID) {
-					eventChan <- event
-				}
+			if event.PID == 0 && event.TID != 0 {
+				event.PID = threadGroupID(event.TID)
 			}
+
+			container, ok := t.containerForEvent(event)
+			if !ok {
+				continue
+			}
+
+			trackProcessName(event)
+
+			event.Timestamp += t.clockOffset
+			event.Container = container
+			event.ProcessName = getProcessNameQuick(event.PID)
+			if event.Type == events.EventProcessExit {
+				forgetProcessName(event.PID)
+			}
+			symbolize <- event
 		}
 	}()
 
 	return nil
 }
 
+// monotonicToWallOffset returns the offset that converts bpf_ktime_get_ns
+// timestamps (CLOCK_MONOTONIC) into nanoseconds since the Unix epoch
+func monotonicToWallOffset() uint64 {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		return 0
+	}
+	return uint64(time.Now().UnixNano() - ts.Nano())
+}
+
 // Stop the tracer and cleans up resources
 func (t *Tracer) Stop() error {
 	if t.reader != nil {
 		t.reader.Close()
 	}
 
+	t.detachUprobes()
+	t.closeCgroupFilter()
+
+	if t.profiler != nil {
+		t.profiler.close()
+		t.profiler = nil
+	}
+
+	if t.sampler != nil {
+		t.sampler.close()
+		t.sampler = nil
+	}
+
 	for _, l := range t.links {
 		l.Close()
 	}
@@ -214,24 +384,144 @@ func parseEvent(data []byte) *events.Event {
 		PID       uint32
 		Type      uint32
 		LatencyNS uint64
+		CgroupID  uint64
 		Error     int32
+		State     uint32
+		Bytes     uint64
 		Target    [64]byte
 		Details   [64]byte
+		Info      [32]byte
 	}
 
 	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &e); err != nil {
 		return nil
 	}
 
-	return &events.Event{
+	event := &events.Event{
 		Timestamp: e.Timestamp,
 		PID:       e.PID,
 		Type:      events.EventType(e.Type),
 		LatencyNS: e.LatencyNS,
+		CgroupID:  e.CgroupID,
 		Error:     e.Error,
+		State:     e.State,
+		Bytes:     e.Bytes,
 		Target:    string(bytes.TrimRight(e.Target[:], "\x00")),
 		Details:   string(bytes.TrimRight(e.Details[:], "\x00")),
 	}
+
+	switch event.Type {
+	case events.EventTCPRTT:
+		event.TCPInfo = &events.TCPInfo{
+			RTTVarUS:     binary.LittleEndian.Uint32(e.Info[0:4]),
+			SndCwnd:      binary.LittleEndian.Uint32(e.Info[4:8]),
+			TotalRetrans: binary.LittleEndian.Uint32(e.Info[8:12]),
+		}
+	case events.EventSchedSwitch:
+		event.TID = binary.LittleEndian.Uint32(e.Info[8:12])
+		event.OffCPU = &events.OffCPUInfo{
+			KernelStackID: int32(binary.LittleEndian.Uint32(e.Info[0:4])),
+			UserStackID:   int32(binary.LittleEndian.Uint32(e.Info[4:8])),
+			WakerPID:      binary.LittleEndian.Uint32(e.Info[12:16]),
+		}
+	case events.EventRunQueue:
+		event.TID = binary.LittleEndian.Uint32(e.Info[8:12])
+	case events.EventRead, events.EventWrite, events.EventFsync:
+		event.FileInfo = &events.FileInfo{
+			BytesRequested: binary.LittleEndian.Uint64(e.Info[0:8]),
+			BytesReturned:  binary.LittleEndian.Uint64(e.Info[8:16]),
+			Inode:          binary.LittleEndian.Uint64(e.Info[16:24]),
+			Device:         binary.LittleEndian.Uint32(e.Info[24:28]),
+		}
+	case events.EventProcessExec, events.EventProcessFork, events.EventProcessExit:
+		event.Process = &events.ProcessInfo{
+			PPID:     binary.LittleEndian.Uint32(e.Info[0:4]),
+			ExitCode: binary.LittleEndian.Uint32(e.Info[4:8]),
+			ChildPID: binary.LittleEndian.Uint32(e.Info[8:12]),
+		}
+	case events.EventOOMKill:
+		event.OOM = &events.OOMInfo{
+			TotalPages: binary.LittleEndian.Uint64(e.Info[0:8]),
+			Points:     int64(binary.LittleEndian.Uint64(e.Info[8:16])),
+			TriggerPID: binary.LittleEndian.Uint32(e.Info[16:20]),
+		}
+	case events.EventBlockIO:
+		event.BlockIO = &events.BlockIOInfo{
+			Sector:  binary.LittleEndian.Uint64(e.Info[0:8]),
+			QueueNS: binary.LittleEndian.Uint64(e.Info[8:16]),
+			Bytes:   binary.LittleEndian.Uint32(e.Info[16:20]),
+			Device:  binary.LittleEndian.Uint32(e.Info[20:24]),
+			Op:      binary.LittleEndian.Uint32(e.Info[24:28]),
+		}
+	case events.EventPageFault:
+		event.PageFault = &events.PageFaultInfo{
+			Address: binary.LittleEndian.Uint64(e.Info[0:8]),
+			Offset:  binary.LittleEndian.Uint64(e.Info[8:16]),
+			Write:   binary.LittleEndian.Uint32(e.Info[16:20]) != 0,
+			Major:   event.Details == "major",
+		}
+	case events.EventFutexWait:
+		event.TID = binary.LittleEndian.Uint32(e.Info[12:16])
+		event.Futex = &events.FutexInfo{
+			Address:     binary.LittleEndian.Uint64(e.Info[0:8]),
+			Op:          binary.LittleEndian.Uint32(e.Info[20:24]),
+			WakerPID:    binary.LittleEndian.Uint32(e.Info[16:20]),
+			UserStackID: int32(binary.LittleEndian.Uint32(e.Info[8:12])),
+		}
+	case events.EventAccept:
+		event.Accept = &events.AcceptInfo{
+			Backlog:    binary.LittleEndian.Uint32(e.Info[0:4]),
+			MaxBacklog: binary.LittleEndian.Uint32(e.Info[4:8]),
+		}
+	case events.EventTCPConnection:
+		event.Connection = parseConnection(binary.LittleEndian.Uint64(e.Info[0:8]),
+			binary.LittleEndian.Uint64(e.Info[8:16]), binary.LittleEndian.Uint32(e.Info[16:20]), e.State)
+	}
+
+	return event
+}
+
+// flags of struct tcp_conn in the BPF program
+const (
+	connPassive       = 0x1
+	connLocalClose    = 0x2
+	connRemoteClose   = 0x4
+	connResetSent     = 0x8
+	connResetReceived = 0x10
+)
+
+// parseConnection decodes how a TCP connection ended from the flags recorded
+// over its lifetime and the state it closed from
+func parseConnection(sent, received uint64, flags, state uint32) *events.ConnectionInfo {
+	conn := &events.ConnectionInfo{
+		BytesSent:     sent,
+		BytesReceived: received,
+		Passive:       flags&connPassive != 0,
+	}
+	switch {
+	case flags&connLocalClose != 0:
+		conn.ClosedBy = "local"
+	case flags&connRemoteClose != 0:
+		conn.ClosedBy = "remote"
+	}
+
+	switch {
+	case flags&connResetReceived != 0:
+		conn.End = "reset_received"
+	case flags&connResetSent != 0:
+		conn.End = "reset_sent"
+	case state == 2 || state == 3: // SYN_SENT, SYN_RECV
+		conn.End = "failed"
+	case state == 5 || state == 6 || state == 11: // FIN_WAIT2, TIME_WAIT, CLOSING
+		conn.End = "time_wait"
+	case state == 9: // LAST_ACK
+		conn.End = "closed"
+	default:
+		// closed without a RST from ESTABLISHED, FIN_WAIT1 or CLOSE_WAIT,
+		// e.g. after a retransmission or keepalive timeout
+		conn.End = "aborted"
+	}
+	return conn
 }
 
 // attachProbes attaches all kprobes to the kernel
@@ -280,6 +570,37 @@ func attachProbes(coll *ebpf.Collection) ([]link.Link, error) {
 		links = append(links, l)
 	}
 
+	dnsProbes := map[string]string{
+		"kprobe_ip_send_skb":     "ip_send_skb",
+		"kprobe_ip6_send_skb":    "ip6_send_skb",
+		"kprobe_skb_consume_udp": "skb_consume_udp",
+	}
+
+	for progName, symbol := range dnsProbes {
+		prog := coll.Programs[progName]
+		if prog == nil {
+			continue
+		}
+
+		l, err := link.Kprobe(symbol, prog, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Note: DNS packet tracing via %s unavailable: %v\n", symbol, err)
+			continue
+		}
+		links = append(links, l)
+	}
+
+	links = append(links, attachTCPTracepoints(coll)...)
+
+	if prog := coll.Programs["kprobe_tcp_rcv_established"]; prog != nil {
+		l, err := link.Kprobe("tcp_rcv_established", prog, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Note: TCP RTT sampling unavailable: %v\n", err)
+		} else {
+			links = append(links, l)
+		}
+	}
+
 	if tracepointProg := coll.Programs["tracepoint_sched_switch"]; tracepointProg != nil {
 		tp, err := link.Tracepoint("sched", "sched_switch", tracepointProg, nil)
 		if err != nil {
@@ -291,36 +612,304 @@ func attachProbes(coll *ebpf.Collection) ([]link.Link, error) {
 		}
 	}
 
-	libcPath := findLibcPath()
-	if libcPath != "" {
-		uprobe, err := link.OpenExecutable(libcPath)
-		if err == nil {
-			if uprobeProg := coll.Programs["uprobe_getaddrinfo"]; uprobeProg != nil {
-				l, err := uprobe.Uprobe("getaddrinfo", uprobeProg, nil)
-				if err == nil {
-					links = append(links, l)
-				} else {
-					fmt.Fprintf(os.Stderr, "Note: DNS tracking (uprobe) unavailable: %v\n", err)
-				}
-			}
-			if uretprobeProg := coll.Programs["uretprobe_getaddrinfo"]; uretprobeProg != nil {
-				l, err := uprobe.Uretprobe("getaddrinfo", uretprobeProg, nil)
-				if err == nil {
-					links = append(links, l)
-				} else {
-					fmt.Fprintf(os.Stderr, "Note: DNS tracking (uretprobe) unavailable: %v\n", err)
-				}
-			}
+	lifecycle := map[string]string{
+		"tracepoint_sched_process_exec": "sched_process_exec",
+		"tracepoint_sched_process_exit": "sched_process_exit",
+	}
+	for progName, name := range lifecycle {
+		prog := coll.Programs[progName]
+		if prog == nil {
+			continue
+		}
+		tp, err := link.Tracepoint("sched", name, prog, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Note: process lifecycle tracking via %s unavailable: %v\n", name, err)
+			continue
+		}
+		links = append(links, tp)
+	}
+	if prog := coll.Programs["tp_btf_sched_process_fork"]; prog != nil {
+		l, err := link.AttachTracing(link.TracingOptions{Program: prog})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Note: process fork tracking unavailable: %v\n", err)
 		} else {
-			fmt.Fprintf(os.Stderr, "Note: DNS tracking unavailable (libc not found)\n")
+			links = append(links, l)
 		}
-	} else {
-		fmt.Fprintf(os.Stderr, "Note: DNS tracking unavailable (libc path not found)\n")
+	}
+
+	links = append(links, attachOOMProbe(coll)...)
+
+	futex := map[string]string{
+		"tracepoint_sys_enter_futex": "sys_enter_futex",
+		"tracepoint_sys_exit_futex":  "sys_exit_futex",
+	}
+	for progName, name := range futex {
+		prog := coll.Programs[progName]
+		if prog == nil {
+			continue
+		}
+		tp, err := link.Tracepoint("syscalls", name, prog, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Note: lock contention tracking via %s unavailable: %v\n", name, err)
+			continue
+		}
+		links = append(links, tp)
+	}
+
+	rawSyscalls := map[string]string{
+		"tracepoint_sys_enter": "sys_enter",
+		"tracepoint_sys_exit":  "sys_exit",
+	}
+	for progName, name := range rawSyscalls {
+		prog := coll.Programs[progName]
+		if prog == nil {
+			continue
+		}
+		tp, err := link.Tracepoint("raw_syscalls", name, prog, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Note: syscall summary via %s unavailable: %v\n", name, err)
+			continue
+		}
+		links = append(links, tp)
+	}
+
+	faultProbes := map[string]string{
+		"kprobe_handle_mm_fault":    "handle_mm_fault",
+		"kretprobe_handle_mm_fault": "handle_mm_fault",
+	}
+	for progName, symbol := range faultProbes {
+		prog := coll.Programs[progName]
+		if prog == nil {
+			continue
+		}
+		var l link.Link
+		var err error
+		if strings.HasPrefix(progName, "kretprobe_") {
+			l, err = link.Kretprobe(symbol, prog, nil)
+		} else {
+			l, err = link.Kprobe(symbol, prog, nil)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Note: page fault tracking unavailable: %v\n", err)
+			continue
+		}
+		links = append(links, l)
+	}
+
+	for _, progName := range []string{"tp_btf_block_rq_insert", "tp_btf_block_rq_issue", "tp_btf_block_rq_complete"} {
+		prog := coll.Programs[progName]
+		if prog == nil {
+			continue
+		}
+		l, err := link.AttachTracing(link.TracingOptions{Program: prog})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Note: block I/O tracking via %s unavailable: %v\n", strings.TrimPrefix(progName, "tp_btf_"), err)
+			continue
+		}
+		links = append(links, l)
+	}
+
+	links = append(links, attachAcceptProbes(coll)...)
+	links = append(links, attachUDPProbes(coll)...)
+
+	wakeups := map[string]string{
+		"tracepoint_sched_wakeup":     "sched_wakeup",
+		"tracepoint_sched_wakeup_new": "sched_wakeup_new",
+	}
+	for progName, name := range wakeups {
+		prog := coll.Programs[progName]
+		if prog == nil {
+			continue
+		}
+		tp, err := link.Tracepoint("sched", name, prog, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Note: wakeup and run-queue tracking via %s unavailable: %v\n", name, err)
+			continue
+		}
+		links = append(links, tp)
 	}
 
 	return links, nil
 }
 
+// attachOOMProbe attaches the OOM kill probe, falling back to the mark_victim
+// tracepoint when oom_kill_process cannot be probed
+func attachOOMProbe(coll *ebpf.Collection) []link.Link {
+	var err error
+	if prog := coll.Programs["kprobe_oom_kill_process"]; prog != nil {
+		var l link.Link
+		if l, err = link.Kprobe("oom_kill_process", prog, nil); err == nil {
+			return []link.Link{l}
+		}
+	}
+	if prog := coll.Programs["tracepoint_mark_victim"]; prog != nil {
+		var l link.Link
+		if l, err = link.Tracepoint("oom", "mark_victim", prog, nil); err == nil {
+			return []link.Link{l}
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Note: OOM kill tracking unavailable: %v\n", err)
+	}
+	return nil
+}
+
+// attachTCPTracepoints attaches the retransmit and reset probes. Failures are
+// not fatal since the tcp tracepoints are missing on some kernels.
+func attachTCPTracepoints(coll *ebpf.Collection) []link.Link {
+	var links []link.Link
+
+	if prog := coll.Programs["tracepoint_tcp_retransmit_skb"]; prog != nil {
+		l, err := link.Tracepoint("tcp", "tcp_retransmit_skb", prog, nil)
+		if err != nil {
+			if kprobeProg := coll.Programs["kprobe_tcp_retransmit_skb"]; kprobeProg != nil {
+				l, err = link.Kprobe("tcp_retransmit_skb", kprobeProg, nil)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Note: TCP retransmit tracking unavailable: %v\n", err)
+		} else {
+			links = append(links, l)
+		}
+	}
+
+	resets := map[string]string{
+		"tracepoint_tcp_send_reset":    "tcp_send_reset",
+		"tracepoint_tcp_receive_reset": "tcp_receive_reset",
+	}
+	for progName, name := range resets {
+		prog := coll.Programs[progName]
+		if prog == nil {
+			continue
+		}
+		l, err := link.Tracepoint("tcp", name, prog, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Note: TCP reset tracking via %s unavailable: %v\n", name, err)
+			continue
+		}
+		links = append(links, l)
+	}
+
+	return links
+}
+
+// attachAcceptProbes attaches the inet_csk_accept probes and the
+// inet_sock_set_state tracepoint that follows connections from open to close
+// and times the accept queue. Accepts are still reported without the
+// tracepoint, only without their queue wait.
+func attachAcceptProbes(coll *ebpf.Collection) []link.Link {
+	var links []link.Link
+
+	if prog := coll.Programs["tracepoint_inet_sock_set_state"]; prog != nil {
+		l, err := link.Tracepoint("sock", "inet_sock_set_state", prog, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Note: TCP socket state tracking unavailable: %v\n", err)
+		} else {
+			links = append(links, l)
+			links = append(links, attachTCPCloseProbes(coll)...)
+		}
+	}
+
+	kprobe, kretprobe := coll.Programs["kprobe_inet_csk_accept"], coll.Programs["kretprobe_inet_csk_accept"]
+	if kprobe == nil || kretprobe == nil {
+		return links
+	}
+	entry, err := link.Kprobe("inet_csk_accept", kprobe, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Note: inbound connection tracking unavailable: %v\n", err)
+		return links
+	}
+	ret, err := link.Kretprobe("inet_csk_accept", kretprobe, nil)
+	if err != nil {
+		entry.Close()
+		fmt.Fprintf(os.Stderr, "Note: inbound connection tracking unavailable: %v\n", err)
+		return links
+	}
+	return append(links, entry, ret)
+}
+
+// attachTCPCloseProbes attaches the probes that tell an abortive close, which
+// sends a RST after the connection moved to CLOSE, from a timeout. Without
+// them abortive closes are reported as aborted.
+func attachTCPCloseProbes(coll *ebpf.Collection) []link.Link {
+	reset, destroy := coll.Programs["kprobe_tcp_send_active_reset"], coll.Programs["kprobe_tcp_v4_destroy_sock"]
+	deferred := coll.Maps["tcp_close_deferred"]
+	if reset == nil || destroy == nil || deferred == nil {
+		return nil
+	}
+
+	resetLink, err := link.Kprobe("tcp_send_active_reset", reset, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Note: TCP abortive close tracking unavailable: %v\n", err)
+		return nil
+	}
+	destroyLink, err := link.Kprobe("tcp_v4_destroy_sock", destroy, nil)
+	if err != nil {
+		resetLink.Close()
+		fmt.Fprintf(os.Stderr, "Note: TCP abortive close tracking unavailable: %v\n", err)
+		return nil
+	}
+	if err := deferred.Put(uint32(0), uint32(1)); err != nil {
+		resetLink.Close()
+		destroyLink.Close()
+		fmt.Fprintf(os.Stderr, "Note: TCP abortive close tracking unavailable: %v\n", err)
+		return nil
+	}
+	return []link.Link{resetLink, destroyLink}
+}
+
+// attachUDPProbes attaches the UDP send/receive probes and the drop tracking,
+// which needs both the udp_queue_rcv_skb probes and the skb:kfree_skb
+// tracepoint. Each probe is optional, e.g. the IPv6 ones are missing on
+// kernels built without IPv6.
+func attachUDPProbes(coll *ebpf.Collection) []link.Link {
+	var links []link.Link
+
+	attachPair := func(symbol, kprobeName, kretprobeName, what string) bool {
+		kprobe, kretprobe := coll.Programs[kprobeName], coll.Programs[kretprobeName]
+		if kprobe == nil || kretprobe == nil {
+			return false
+		}
+		entry, err := link.Kprobe(symbol, kprobe, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Note: %s via %s unavailable: %v\n", what, symbol, err)
+			return false
+		}
+		ret, err := link.Kretprobe(symbol, kretprobe, nil)
+		if err != nil {
+			entry.Close()
+			fmt.Fprintf(os.Stderr, "Note: %s via %s unavailable: %v\n", what, symbol, err)
+			return false
+		}
+		links = append(links, entry, ret)
+		return true
+	}
+
+	for _, symbol := range []string{"udp_sendmsg", "udpv6_sendmsg", "udp_recvmsg", "udpv6_recvmsg"} {
+		attachPair(symbol, "kprobe_"+symbol, "kretprobe_"+symbol, "UDP tracing")
+	}
+
+	prog := coll.Programs["tracepoint_kfree_skb"]
+	if prog == nil {
+		return links
+	}
+	queued := false
+	for _, symbol := range []string{"udp_queue_rcv_skb", "udpv6_queue_rcv_skb"} {
+		if attachPair(symbol, "kprobe_"+symbol, "kretprobe_"+symbol, "UDP drop tracking") {
+			queued = true
+		}
+	}
+	if !queued {
+		return links
+	}
+	l, err := link.Tracepoint("skb", "kfree_skb", prog, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Note: UDP drop tracking unavailable: %v\n", err)
+		return links
+	}
+	return append(links, l)
+}
+
 func findLibcPath() string {
 	libcPaths := []string{
 		"/lib/x86_64-linux-gnu/libc.so.6",
@@ -343,7 +932,65 @@ func findLibcPath() string {
 var processNameCache = make(map[uint32]string)
 var processNameCacheMutex = &sync.Mutex{}
 
+// threadGroupID returns the process ID of a thread from /proc/<tid>/status,
+// or 0 if the thread is gone
+func threadGroupID(tid uint32) uint32 {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", tid))
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(line, "Tgid:"); ok {
+			if tgid, err := strconv.ParseUint(strings.TrimSpace(value), 10, 32); err == nil {
+				return uint32(tgid)
+			}
+		}
+	}
+	return 0
+}
+
+// trackProcessName keeps the process name cache in step with exec and fork
+// events, so that names survive short-lived processes and are not carried
+// over to a reused PID
+func trackProcessName(event *events.Event) {
+	switch event.Type {
+	case events.EventProcessExec:
+		name := event.Target
+		if idx := strings.LastIndex(name, "/"); idx >= 0 {
+			name = name[idx+1:]
+		}
+		if name == "" {
+			name = event.Details
+		}
+		setProcessName(event.PID, name)
+	case events.EventProcessFork:
+		if event.Process != nil {
+			setProcessName(event.Process.ChildPID, getProcessNameQuick(event.PID))
+		}
+	}
+}
+
+func setProcessName(pid uint32, name string) {
+	processNameCacheMutex.Lock()
+	processNameCache[pid] = name
+	processNameCacheMutex.Unlock()
+}
+
+// forgetProcessName drops an exited process from the cache before its PID
+// can be reused
+func forgetProcessName(pid uint32) {
+	processNameCacheMutex.Lock()
+	delete(processNameCache, pid)
+	processNameCacheMutex.Unlock()
+}
+
+// getProcessNameQuick returns the name of a process, or "" for PID 0, which
+// marks events that happened outside of any process
 func getProcessNameQuick(pid uint32) string {
+	if pid == 0 {
+		return ""
+	}
+
 	processNameCacheMutex.Lock()
 	if name, ok := processNameCache[pid]; ok {
 		processNameCacheMutex.Unlock()
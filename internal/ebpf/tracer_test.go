@@ -0,0 +1,47 @@
+package ebpf
+
+import (
+	"testing"
+
+	"github.com/podtrace/podtrace/internal/events"
+)
+
+func TestParseConnectionEnd(t *testing.T) {
+	tests := []struct {
+		flags, state uint32
+		end          string
+	}{
+		{connLocalClose, 5, "time_wait"},         // FIN_WAIT2
+		{connRemoteClose, 9, "closed"},           // LAST_ACK
+		{connResetSent, 1, "reset_sent"},         // abortive close from ESTABLISHED
+		{0, 1, "aborted"},                        // retransmission timeout
+		{connRemoteClose, 8, "aborted"},          // keepalive timeout in CLOSE_WAIT
+		{connResetReceived, 1, "reset_received"}, // peer reset
+		{0, 2, "failed"},                         // SYN_SENT
+		{0, 7, "aborted"},
+	}
+	for _, tt := range tests {
+		if got := parseConnection(0, 0, tt.flags, tt.state).End; got != tt.end {
+			t.Errorf("flags %#x, state %d: end = %q, expected %q", tt.flags, tt.state, got, tt.end)
+		}
+	}
+}
+
+func TestContainerForEventWithoutPID(t *testing.T) {
+	cgroups := newCgroupFilter(nil, nil)
+	cgroups.sync(map[uint64]string{42: "app"})
+	tracer := &Tracer{cgroupPaths: map[string]string{"app": "/kubepods/pod1/app"}, cgroups: cgroups}
+
+	// a UDP drop in softirq context, filtered in userspace
+	container, ok := tracer.containerForEvent(&events.Event{Type: events.EventUDPDrop, CgroupID: 42})
+	if !ok || container != "app" {
+		t.Errorf("containerForEvent = %q, %v, expected app", container, ok)
+	}
+	if _, ok := tracer.containerForEvent(&events.Event{Type: events.EventUDPDrop, CgroupID: 7}); ok {
+		t.Error("expected an event from another cgroup to be dropped")
+	}
+
+	if name := getProcessNameQuick(0); name != "" {
+		t.Errorf("getProcessNameQuick(0) = %q, expected no name", name)
+	}
+}
@@ -0,0 +1,214 @@
+package ebpf
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"golang.org/x/sys/unix"
+)
+
+// uprobeRescanInterval is how often the target cgroups are checked for
+// processes using a C library that has no uprobes yet
+const uprobeRescanInterval = 5 * time.Second
+
+// libcPattern matches glibc and musl C libraries as mapped in /proc/<pid>/maps
+var libcPattern = regexp.MustCompile(`/(libc\.so\.6|libc-[0-9.]+\.so|ld-musl-[^/]+\.so\.1|libc\.musl-[^/]+\.so\.1)$`)
+
+// fileID identifies a library by device and inode, since the same file is
+// reachable through the /proc/<pid>/root of every process sharing the image
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// libcUprobes attaches the getaddrinfo uprobes to the C libraries used by the
+// processes of the traced containers, rather than to the host's libc
+type libcUprobes struct {
+	coll        *ebpf.Collection
+	cgroupPaths map[string]string
+
+	mu       sync.Mutex
+	attached map[fileID][]link.Link
+	failed   map[fileID]bool
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newLibcUprobes(coll *ebpf.Collection, cgroupPaths map[string]string) *libcUprobes {
+	return &libcUprobes{
+		coll:        coll,
+		cgroupPaths: cgroupPaths,
+		attached:    make(map[fileID][]link.Link),
+		failed:      make(map[fileID]bool),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// start attaches to the libraries in use now and keeps rescanning in the
+// background until close is called
+func (u *libcUprobes) start() {
+	if u.scan() == 0 {
+		fmt.Fprintf(os.Stderr, "Note: no glibc or musl libc found in the pod yet, getaddrinfo tracing will start when one appears\n")
+	}
+
+	go func() {
+		defer close(u.done)
+		ticker := time.NewTicker(uprobeRescanInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				u.scan()
+			case <-u.stop:
+				return
+			}
+		}
+	}()
+}
+
+// scan attaches uprobes to every C library mapped by a process in the target
+// cgroups that is not attached yet, and returns the number of attached libraries
+func (u *libcUprobes) scan() int {
+	for _, cgroupPath := range u.cgroupPaths {
+		for _, pid := range cgroupPIDs(filepath.Join(cgroupRoot, normalizeCgroupPath(cgroupPath))) {
+			maps, err := os.ReadFile(fmt.Sprintf("/proc/%d/maps", pid))
+			if err != nil {
+				continue
+			}
+			for _, lib := range libcPathsFromMaps(string(maps)) {
+				u.attach(fmt.Sprintf("/proc/%d/root%s", pid, lib))
+			}
+		}
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return len(u.attached)
+}
+
+func (u *libcUprobes) attach(path string) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return
+	}
+	id := fileID{dev: st.Dev, ino: st.Ino}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if _, ok := u.attached[id]; ok || u.failed[id] {
+		return
+	}
+
+	links, err := attachGetaddrinfo(u.coll, path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Note: DNS tracking (uprobe) unavailable for %s: %v\n", path, err)
+		u.failed[id] = true
+		return
+	}
+	u.attached[id] = links
+}
+
+// close stops rescanning and detaches all uprobes
+func (u *libcUprobes) close() {
+	close(u.stop)
+	<-u.done
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, links := range u.attached {
+		for _, l := range links {
+			l.Close()
+		}
+	}
+	u.attached = nil
+}
+
+// attachGetaddrinfo attaches the getaddrinfo uprobe and uretprobe to the C
+// library at path
+func attachGetaddrinfo(coll *ebpf.Collection, path string) ([]link.Link, error) {
+	ex, err := link.OpenExecutable(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var links []link.Link
+	if prog := coll.Programs["uprobe_getaddrinfo"]; prog != nil {
+		l, err := ex.Uprobe("getaddrinfo", prog, nil)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	if prog := coll.Programs["uretprobe_getaddrinfo"]; prog != nil {
+		l, err := ex.Uretprobe("getaddrinfo", prog, nil)
+		if err != nil {
+			for _, existing := range links {
+				existing.Close()
+			}
+			return nil, err
+		}
+		links = append(links, l)
+	}
+
+	return links, nil
+}
+
+// cgroupPIDs returns the PIDs of all processes in a cgroup and its descendants
+func cgroupPIDs(root string) []uint32 {
+	var pids []uint32
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+
+		f, err := os.Open(filepath.Join(path, "cgroup.procs"))
+		if err != nil {
+			return nil
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if pid, err := strconv.ParseUint(strings.TrimSpace(scanner.Text()), 10, 32); err == nil {
+				pids = append(pids, uint32(pid))
+			}
+		}
+		return nil
+	})
+	return pids
+}
+
+// libcPathsFromMaps returns the distinct C library paths in /proc/<pid>/maps
+// content. Paths are relative to the process's root directory.
+func libcPathsFromMaps(maps string) []string {
+	var paths []string
+	seen := make(map[string]bool)
+
+	for _, line := range strings.Split(maps, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 6 {
+			continue
+		}
+		path := fields[5]
+		if seen[path] || !libcPattern.MatchString(path) {
+			continue
+		}
+		seen[path] = true
+		paths = append(paths, path)
+	}
+
+	return paths
+}
@@ -0,0 +1,48 @@
+package ebpf
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLibcPathsFromMaps(t *testing.T) {
+	maps := `5581e0a00000-5581e0a02000 r--p 00000000 00:2a 1234 /usr/sbin/nginx
+7f2a1c000000-7f2a1c028000 r--p 00000000 00:2a 5678 /lib/x86_64-linux-gnu/libc.so.6
+7f2a1c028000-7f2a1c1bd000 r-xp 00028000 00:2a 5678 /lib/x86_64-linux-gnu/libc.so.6
+7f2a1c200000-7f2a1c210000 r--p 00000000 00:2a 9999 /lib/x86_64-linux-gnu/libcrypt.so.1
+7f3b00000000-7f3b00014000 r-xp 00000000 00:2b 4321 /lib/ld-musl-x86_64.so.1
+7f4c00000000-7f4c00001000 r-xp 00000000 00:2c 1111 /usr/lib/libc-2.17.so
+7ffd5c000000-7ffd5c021000 rw-p 00000000 00:00 0 [stack]
+7ffd5c100000-7ffd5c101000 r-xp 00000000 00:00 0
+`
+
+	expected := []string{
+		"/lib/x86_64-linux-gnu/libc.so.6",
+		"/lib/ld-musl-x86_64.so.1",
+		"/usr/lib/libc-2.17.so",
+	}
+	if got := libcPathsFromMaps(maps); !reflect.DeepEqual(got, expected) {
+		t.Errorf("libcPathsFromMaps() = %v, expected %v", got, expected)
+	}
+}
+
+func TestCgroupPIDs(t *testing.T) {
+	root := t.TempDir()
+	child := filepath.Join(root, "child")
+	if err := os.Mkdir(child, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "cgroup.procs"), []byte("10\n11\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(child, "cgroup.procs"), []byte("12\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []uint32{10, 11, 12}
+	if got := cgroupPIDs(root); !reflect.DeepEqual(got, expected) {
+		t.Errorf("cgroupPIDs() = %v, expected %v", got, expected)
+	}
+}
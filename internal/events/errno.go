@@ -0,0 +1,84 @@
+package events
+
+import (
+	"fmt"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// getaddrinfo error codes as returned by glibc
+var eaiNames = map[int32]string{
+	-1:  "EAI_BADFLAGS",
+	-2:  "EAI_NONAME",
+	-3:  "EAI_AGAIN",
+	-4:  "EAI_FAIL",
+	-5:  "EAI_NODATA",
+	-6:  "EAI_FAMILY",
+	-7:  "EAI_SOCKTYPE",
+	-8:  "EAI_SERVICE",
+	-9:  "EAI_ADDRFAMILY",
+	-10: "EAI_MEMORY",
+	-11: "EAI_SYSTEM",
+	-12: "EAI_OVERFLOW",
+}
+
+// DNS response codes (RFC 1035 and RFC 6895) reported by packet-level tracing
+var rcodeNames = map[int32]string{
+	1:  "FORMERR",
+	2:  "SERVFAIL",
+	3:  "NXDOMAIN",
+	4:  "NOTIMP",
+	5:  "REFUSED",
+	6:  "YXDOMAIN",
+	7:  "YXRRSET",
+	8:  "NXRRSET",
+	9:  "NOTAUTH",
+	10: "NOTZONE",
+}
+
+// ErrorName returns the symbolic name of the event's error code, such as
+// ECONNREFUSED, EAI_NONAME or NXDOMAIN, or "" if the event did not fail
+func (e *Event) ErrorName() string {
+	if e.Type == EventDNS || e.Type == EventDNSQuery {
+		return DNSErrorName(e.Error)
+	}
+	if e.Error >= 0 {
+		return ""
+	}
+	return ErrnoName(-e.Error)
+}
+
+// DNSErrorName returns the name of a DNS event's error code. Negative codes
+// come from getaddrinfo, positive ones are response codes seen on the wire.
+func DNSErrorName(code int32) string {
+	switch {
+	case code < 0:
+		if name, ok := eaiNames[code]; ok {
+			return name
+		}
+		return fmt.Sprintf("EAI_%d", -code)
+	case code > 0:
+		if name, ok := rcodeNames[code]; ok {
+			return name
+		}
+		return fmt.Sprintf("RCODE%d", code)
+	}
+	return ""
+}
+
+// ErrnoName returns the symbolic name of a positive errno value
+func ErrnoName(errno int32) string {
+	if name := unix.ErrnoName(syscall.Errno(errno)); name != "" {
+		return name
+	}
+	return fmt.Sprintf("errno %d", errno)
+}
+
+// SignalName returns the name of a signal, e.g. "SIGKILL"
+func SignalName(sig int) string {
+	if name := unix.SignalName(syscall.Signal(sig)); name != "" {
+		return name
+	}
+	return fmt.Sprintf("signal %d", sig)
+}
@@ -2,31 +2,462 @@ package events
 
 import (
 	"fmt"
+	"strings"
 	"time"
 )
 
 type EventType uint32
 
+// Event types. Fields that are not described here are documented on the
+// info struct the event type carries.
 const (
+	// EventDNS is a getaddrinfo call: Target is the name looked up and Error
+	// a negative EAI code on failure
 	EventDNS EventType = iota
 	EventConnect
+	// EventTCPSend and EventTCPRecv carry the bytes the call moved in Bytes;
+	// Error is only set when the call failed
 	EventTCPSend
 	EventTCPRecv
+	// EventWrite, EventRead and EventFsync carry FileInfo
 	EventWrite
 	EventRead
 	EventFsync
+	// EventSchedSwitch carries OffCPUInfo
 	EventSchedSwitch
+	// EventTCPRetransmit, EventTCPSendReset and EventTCPRecvReset carry the
+	// socket's TCP state in State. EventTCPRTT carries the smoothed RTT in
+	// LatencyNS and the rest of the estimator state in TCPInfo.
+	EventTCPRetransmit
+	EventTCPSendReset
+	EventTCPRecvReset
+	EventTCPRTT
+	// EventRunQueue is how long a runnable thread, in TID, waited for a CPU
+	EventRunQueue
+	// EventCPUTime is a sample of a thread's on-CPU time since the previous
+	// sample, in LatencyNS
+	EventCPUTime
+	EventCgroupCPU
+	// EventProcessExec, EventProcessFork and EventProcessExit carry
+	// ProcessInfo
+	EventProcessExec
+	EventProcessFork
+	EventProcessExit
+	EventOOMKill
+	EventCgroupMemory
+	EventBlockIO
+	EventPageFault
+	EventPageFaultCount
+	EventFutexWait
+	EventSyscall
+	EventAccept
+	EventNetStat
+	EventTCPConnection
+	// EventUDPSend and EventUDPRecv carry the bytes the call moved in Bytes.
+	// On unconnected sockets Target is the datagram's destination or source.
+	EventUDPSend
+	EventUDPRecv
+	// EventUDPDrop is a datagram the kernel discarded before it reached a
+	// socket's receive queue. Target is only set for connected sockets and
+	// State is the drop reason.
+	EventUDPDrop
+	// EventDNSQuery is a single query seen on port 53, so one getaddrinfo
+	// call may issue several. Target is the query name, Details the record
+	// type and Error the response code.
+	EventDNSQuery
 )
 
+// String returns the lowercase name of the event type, e.g. "tcp_send"
+func (t EventType) String() string {
+	switch t {
+	case EventDNS:
+		return "dns"
+	case EventConnect:
+		return "connect"
+	case EventTCPSend:
+		return "tcp_send"
+	case EventTCPRecv:
+		return "tcp_recv"
+	case EventWrite:
+		return "write"
+	case EventRead:
+		return "read"
+	case EventFsync:
+		return "fsync"
+	case EventSchedSwitch:
+		return "sched_switch"
+	case EventTCPRetransmit:
+		return "tcp_retransmit"
+	case EventTCPSendReset:
+		return "tcp_send_reset"
+	case EventTCPRecvReset:
+		return "tcp_recv_reset"
+	case EventTCPRTT:
+		return "tcp_rtt"
+	case EventRunQueue:
+		return "runq_latency"
+	case EventCPUTime:
+		return "cpu_time"
+	case EventCgroupCPU:
+		return "cgroup_cpu"
+	case EventProcessExec:
+		return "process_exec"
+	case EventProcessFork:
+		return "process_fork"
+	case EventProcessExit:
+		return "process_exit"
+	case EventOOMKill:
+		return "oom_kill"
+	case EventCgroupMemory:
+		return "cgroup_memory"
+	case EventBlockIO:
+		return "block_io"
+	case EventPageFault:
+		return "page_fault"
+	case EventPageFaultCount:
+		return "page_fault_count"
+	case EventFutexWait:
+		return "futex_wait"
+	case EventSyscall:
+		return "syscall"
+	case EventAccept:
+		return "accept"
+	case EventNetStat:
+		return "netstat"
+	case EventTCPConnection:
+		return "tcp_connection"
+	case EventUDPSend:
+		return "udp_send"
+	case EventUDPRecv:
+		return "udp_recv"
+	case EventUDPDrop:
+		return "udp_drop"
+	case EventDNSQuery:
+		return "dns_query"
+	default:
+		return "unknown"
+	}
+}
+
+// IsSample reports whether events of this type are periodic samples taken by
+// the tracer rather than traced operations
+func (t EventType) IsSample() bool {
+	switch t {
+	case EventCPUTime, EventCgroupCPU, EventCgroupMemory, EventPageFaultCount, EventSyscall, EventNetStat:
+		return true
+	}
+	return false
+}
+
+// Event is a single traced operation or periodic sample. Timestamp is
+// wall-clock time in nanoseconds since the Unix epoch, LatencyNS how long the
+// operation took and Error its negative errno, or 0 on success. Network
+// events carry the remote endpoint in Target and the local one in Details.
+// PID is 0 for work the kernel did outside of any process, e.g. in softirq
+// or writeback context. What the other fields hold depends on the event
+// type, see the event type constants and the info structs.
 type Event struct {
-	Timestamp   uint64
-	PID         uint32
-	ProcessName string
-	Type        EventType
-	LatencyNS   uint64
-	Error       int32
-	Target      string
-	Details     string
+	Timestamp    uint64
+	PID          uint32
+	TID          uint32
+	ProcessName  string
+	Container    string
+	CgroupID     uint64
+	Type         EventType
+	LatencyNS    uint64
+	Error        int32
+	State        uint32
+	Bytes        uint64
+	Target       string
+	Details      string
+	TCPInfo      *TCPInfo
+	FileInfo     *FileInfo
+	OffCPU       *OffCPUInfo
+	CgroupCPU    *CgroupCPU
+	Process      *ProcessInfo
+	OOM          *OOMInfo
+	CgroupMemory *CgroupMemory
+	BlockIO      *BlockIOInfo
+	PageFault    *PageFaultInfo
+	PageFaults   *PageFaultCount
+	Futex        *FutexInfo
+	Syscall      *SyscallStats
+	Accept       *AcceptInfo
+	NetStat      *NetStats
+	Connection   *ConnectionInfo
+}
+
+// TCPInfo is the congestion state of a connection when its RTT was sampled
+type TCPInfo struct {
+	RTTVarUS     uint32
+	SndCwnd      uint32
+	TotalRetrans uint32
+}
+
+// FileInfo identifies the file behind a read, write or fsync and how much
+// data the operation moved. Device uses the kernel's internal dev_t encoding.
+// The event's Target is the file's path as seen by the process (prefixed
+// with "..." when its leading components did not fit) and Details the
+// filesystem type.
+type FileInfo struct {
+	BytesRequested uint64
+	BytesReturned  uint64
+	Inode          uint64
+	Device         uint32
+}
+
+// DeviceString returns the device as "major:minor"
+func (f *FileInfo) DeviceString() string {
+	return sprintf("%d:%d", f.Device>>20, f.Device&0xfffff)
+}
+
+// OffCPUInfo describes where a thread blocked. Stack IDs are negative when
+// the kernel could not record the stack; the stacks hold symbolized frames,
+// innermost first. The sched_switch event's LatencyNS is how long the thread
+// in TID was blocked until it was woken up, State the task state it was
+// switched out in, Target the command name of the task that woke it and
+// Details its own command name.
+type OffCPUInfo struct {
+	WakerPID      uint32
+	KernelStackID int32
+	UserStackID   int32
+	KernelStack   []string
+	UserStack     []string
+}
+
+// CgroupCPU holds a cgroup's cumulative CPU usage and CFS bandwidth
+// counters from cpu.stat. QuotaUSec is 0 when the cgroup has no CPU limit.
+type CgroupCPU struct {
+	UsageUSec     uint64
+	NrPeriods     uint64
+	NrThrottled   uint64
+	ThrottledUSec uint64
+	QuotaUSec     uint64
+	PeriodUSec    uint64
+}
+
+// OOMInfo is how the OOM killer chose its victim: the pages it could use,
+// the victim's badness score and the process whose allocation failed.
+// TotalPages and Points are 0 when only the victim's PID is known. The OOM
+// kill event's PID is the victim, Target its command name and Details
+// "memcg" for an OOM within a cgroup's memory limit or "global" when the
+// node ran out of memory.
+type OOMInfo struct {
+	TotalPages uint64
+	Points     int64
+	TriggerPID uint32
+}
+
+// CgroupMemory holds a cgroup's memory usage and its cumulative
+// memory.events counters and pressure stall times. LimitBytes is 0 when the
+// cgroup has no memory limit; the pressure fields are 0 without PSI.
+type CgroupMemory struct {
+	UsageBytes        uint64
+	LimitBytes        uint64
+	AnonBytes         uint64
+	FileBytes         uint64
+	High              uint64
+	Max               uint64
+	OOM               uint64
+	OOMKill           uint64
+	PressureSomeUSec  uint64
+	PressureFullUSec  uint64
+	PressureSomeAvg10 float64
+	PressureFullAvg10 float64
+}
+
+// BlockIOInfo describes a block device request. QueueNS is the part of the
+// event's latency spent in the I/O scheduler; Op is the kernel's REQ_OP_*
+// value and Device uses the same encoding as FileInfo. The event's Target is
+// the disk name; its PID is 0 when the request was submitted on the
+// cgroup's behalf, e.g. by writeback.
+type BlockIOInfo struct {
+	Sector  uint64
+	QueueNS uint64
+	Bytes   uint32
+	Device  uint32
+	Op      uint32
+}
+
+// ServiceNS returns how long the device took to complete the request
+func (b *BlockIOInfo) ServiceNS(latencyNS uint64) uint64 {
+	if latencyNS < b.QueueNS {
+		return 0
+	}
+	return latencyNS - b.QueueNS
+}
+
+// DeviceString returns the device as "major:minor"
+func (b *BlockIOInfo) DeviceString() string {
+	return sprintf("%d:%d", b.Device>>20, b.Device&0xfffff)
+}
+
+// OpName returns the name of the request's operation, e.g. "read"
+func (b *BlockIOInfo) OpName() string {
+	switch b.Op {
+	case 0:
+		return "read"
+	case 1:
+		return "write"
+	case 2:
+		return "flush"
+	case 3:
+		return "discard"
+	case 5:
+		return "secure_erase"
+	case 9:
+		return "write_zeroes"
+	default:
+		return sprintf("op_%d", b.Op)
+	}
+}
+
+// PageFaultInfo is where a page fault happened. Offset is the offset of
+// Address within the mapped file, and 0 for anonymous memory. Page fault
+// events are major faults, and minor faults slower than 1ms, in user mode.
+// LatencyNS is how long the kernel took to resolve the fault, Details
+// "major" or "minor" and Target the faulting address's mapping: the file's
+// path, or "[heap]", "[stack]" or "[anon]".
+type PageFaultInfo struct {
+	Address uint64
+	Offset  uint64
+	Write   bool
+	Major   bool
+}
+
+// PageFaultCount is the number of page faults a process took since the
+// previous sample
+type PageFaultCount struct {
+	Minor uint64
+	Major uint64
+}
+
+// FutexInfo is the futex a thread waited on for at least 100µs, i.e. a
+// contended lock or a condition variable. Address is the lock word's address
+// in the waiting process; Op is the futex(2) operation including the
+// FUTEX_PRIVATE_FLAG and FUTEX_CLOCK_REALTIME flags. WakerPID is the process
+// that woke the thread, if any. UserStackID is negative when the stack was
+// not recorded; UserStack holds its symbolized frames, innermost first. The
+// event's TID is the waiting thread, Details its command name and Target the
+// command name of the waker.
+type FutexInfo struct {
+	Address     uint64
+	Op          uint32
+	WakerPID    uint32
+	UserStackID int32
+	UserStack   []string
+}
+
+// OpName returns the name of the futex operation, e.g. "wait_bitset"
+func (f *FutexInfo) OpName() string {
+	switch f.Op & 0x7f {
+	case 0:
+		return "wait"
+	case 6:
+		return "lock_pi"
+	case 9:
+		return "wait_bitset"
+	case 11:
+		return "wait_requeue_pi"
+	case 13:
+		return "lock_pi2"
+	default:
+		return sprintf("op_%d", f.Op&0x7f)
+	}
+}
+
+// SyscallStats counts the calls a container made to a system call since the
+// previous sample and how long they took. Histogram[0] counts calls under
+// 1µs, Histogram[i] calls of [2^(i-1), 2^i) µs and the last slot everything
+// slower. The event's Target is the system call's name and Error the errno
+// the counted calls failed with, or 0 for successful calls.
+type SyscallStats struct {
+	Nr        uint32
+	Count     uint64
+	TotalNS   uint64
+	Histogram []uint64
+}
+
+// AcceptInfo is the state of a listening socket's accept queue after a
+// connection was taken off it. The accept event's LatencyNS is how long the
+// connection waited in the queue after its handshake completed, or 0 when
+// the handshake was not seen.
+type AcceptInfo struct {
+	Backlog    uint32
+	MaxBacklog uint32
+}
+
+// NetStats holds cumulative counters of a network namespace from
+// /proc/net/netstat. ListenOverflows counts handshakes dropped because an
+// accept queue was full, ListenDrops every connection request dropped by a
+// listener, including the overflows.
+type NetStats struct {
+	Namespace       uint64
+	ListenOverflows uint64
+	ListenDrops     uint64
+}
+
+// ConnectionInfo describes a TCP connection that closed. The event's
+// LatencyNS is how long it was open and State the TCP state it closed from;
+// connections opened before tracing started are not reported. BytesSent
+// counts the bytes the peer acknowledged. ClosedBy is "local" or "remote"
+// for the side that sent the first FIN, or empty if neither did. End is one
+// of "time_wait" (closed locally first), "closed" (closed by the peer
+// first), "reset_sent", "reset_received", "failed" (before the handshake
+// completed) or "aborted" (closed without a RST, e.g. after a retransmission
+// or keepalive timeout).
+type ConnectionInfo struct {
+	BytesSent     uint64
+	BytesReceived uint64
+	Passive       bool
+	ClosedBy      string
+	End           string
+}
+
+// ProcessInfo is the parent of a process and, for exits, its exit code in
+// wait(2) status form. ChildPID is set on fork events. Exec events carry the
+// executed file in Target and the new command name in Details, fork events
+// the child's command name in Target, and exit events the command name in
+// Details and how long the process lived in LatencyNS.
+type ProcessInfo struct {
+	PPID     uint32
+	ChildPID uint32
+	ExitCode uint32
+}
+
+// ExitStatus returns the status a process passed to exit(), or 0 if it was
+// killed by a signal
+func (p *ProcessInfo) ExitStatus() int {
+	return int(p.ExitCode>>8) & 0xff
+}
+
+// Signal returns the signal that killed a process, or 0 if it exited
+func (p *ProcessInfo) Signal() int {
+	return int(p.ExitCode & 0x7f)
+}
+
+// CoreDumped reports whether the killed process dumped core
+func (p *ProcessInfo) CoreDumped() bool {
+	return p.ExitCode&0x80 != 0
+}
+
+// Abnormal reports whether a process was killed or exited with a non-zero
+// status
+func (p *ProcessInfo) Abnormal() bool {
+	return p.Signal() != 0 || p.ExitStatus() != 0
+}
+
+// ExitReason describes how a process ended, e.g. "exit status 1" or
+// "killed by SIGSEGV (core dumped)"
+func (p *ProcessInfo) ExitReason() string {
+	if sig := p.Signal(); sig != 0 {
+		reason := "killed by " + SignalName(sig)
+		if p.CoreDumped() {
+			reason += " (core dumped)"
+		}
+		return reason
+	}
+	return sprintf("exit status %d", p.ExitStatus())
 }
 
 func (e *Event) Latency() time.Duration {
@@ -39,18 +470,36 @@ func (e *Event) TimestampTime() time.Time {
 
 func (e *Event) TypeString() string {
 	switch e.Type {
-	case EventDNS:
+	case EventDNS, EventDNSQuery:
 		return "DNS"
 	case EventConnect:
 		return "NET"
 	case EventTCPSend, EventTCPRecv:
 		return "NET"
+	case EventTCPRetransmit, EventTCPSendReset, EventTCPRecvReset, EventTCPRTT:
+		return "NET"
+	case EventAccept, EventNetStat, EventTCPConnection:
+		return "NET"
+	case EventUDPSend, EventUDPRecv, EventUDPDrop:
+		return "NET"
 	case EventWrite, EventRead:
 		return "FS"
 	case EventFsync:
 		return "FS"
-	case EventSchedSwitch:
+	case EventSchedSwitch, EventRunQueue, EventCPUTime, EventCgroupCPU:
 		return "CPU"
+	case EventProcessExec, EventProcessFork, EventProcessExit:
+		return "PROC"
+	case EventOOMKill, EventCgroupMemory:
+		return "MEM"
+	case EventBlockIO:
+		return "DISK"
+	case EventPageFault, EventPageFaultCount:
+		return "FAULT"
+	case EventFutexWait:
+		return "LOCK"
+	case EventSyscall:
+		return "SYSCALL"
 	default:
 		return "UNKNOWN"
 	}
@@ -60,11 +509,8 @@ func (e *Event) FormatMessage() string {
 	latencyMs := float64(e.LatencyNS) / 1e6
 
 	switch e.Type {
-	case EventDNS:
-		if e.Error != 0 {
-			return sprintf("[DNS] lookup %s failed: error %d", e.Target, e.Error)
-		}
-		return sprintf("[DNS] lookup %s took %.2fms", e.Target, latencyMs)
+	case EventDNS, EventDNSQuery:
+		return e.formatDNSMessage(latencyMs)
 
 	case EventConnect:
 		target := e.Target
@@ -81,45 +527,111 @@ func (e *Event) FormatMessage() string {
 
 	case EventTCPSend:
 		if e.Error < 0 && e.Error != -11 {
-			return sprintf("[NET] TCP send error: %d", e.Error)
+			return sprintf("[NET] TCP send error%s: %d", peerSuffix(e.Target), e.Error)
 		}
 		if latencyMs > 100 {
-			return sprintf("[NET] TCP send latency spike: %.2fms", latencyMs)
+			return sprintf("[NET] TCP send latency spike%s: %.2fms", peerSuffix(e.Target), latencyMs)
 		}
 		return ""
 
 	case EventTCPRecv:
 		if e.Error < 0 && e.Error != -11 {
-			return sprintf("[NET] TCP recv error: %d", e.Error)
+			return sprintf("[NET] TCP recv error%s: %d", peerSuffix(e.Target), e.Error)
 		}
 		if latencyMs > 100 {
-			return sprintf("[NET] TCP recv RTT spike: %.2fms", latencyMs)
+			return sprintf("[NET] TCP recv latency spike%s: %.2fms", peerSuffix(e.Target), latencyMs)
 		}
 		return ""
 
-	case EventWrite:
-		target := e.Target
-		if target == "" || target == "?" {
-			target = "file"
+	case EventTCPRetransmit:
+		return sprintf("[NET] TCP retransmit to %s (%s)", e.Target, e.StateName())
+
+	case EventTCPSendReset:
+		return sprintf("[NET] TCP reset sent to %s (%s)", e.Target, e.StateName())
+
+	case EventTCPRecvReset:
+		return sprintf("[NET] TCP reset received from %s (%s)", e.Target, e.StateName())
+
+	case EventTCPRTT:
+		if latencyMs > 100 {
+			return sprintf("[NET] TCP RTT to %s: %.2fms", e.Target, latencyMs)
 		}
-		return sprintf("[FS] write() to %s took %.2fms", target, latencyMs)
+		return ""
+
+	case EventWrite:
+		return e.formatFileMessage("write() to", latencyMs)
 
 	case EventRead:
-		target := e.Target
-		if target == "" || target == "?" {
-			target = "file"
-		}
-		return sprintf("[FS] read() from %s took %.2fms", target, latencyMs)
+		return e.formatFileMessage("read() from", latencyMs)
 
 	case EventFsync:
-		target := e.Target
-		if target == "" {
-			target = "file"
-		}
-		return sprintf("[FS] fsync() to %s took %.2fms", target, latencyMs)
+		return e.formatFileMessage("fsync() to", latencyMs)
 
 	case EventSchedSwitch:
-		return sprintf("[CPU] thread blocked %.2fms", latencyMs)
+		return e.formatOffCPUMessage(latencyMs)
+
+	case EventRunQueue:
+		if latencyMs > 10 {
+			return sprintf("[CPU] thread %d waited %.2fms for a CPU", e.TID, latencyMs)
+		}
+		return ""
+
+	case EventCPUTime, EventCgroupCPU:
+		return ""
+
+	case EventProcessExec, EventProcessFork:
+		return ""
+
+	case EventProcessExit:
+		if e.Process != nil && e.Process.Abnormal() {
+			return e.formatProcessMessage()
+		}
+		return ""
+
+	case EventOOMKill:
+		return e.formatOOMMessage()
+
+	case EventCgroupMemory:
+		return ""
+
+	case EventBlockIO:
+		if e.Error < 0 || latencyMs > 50 {
+			return e.formatBlockIOMessage(latencyMs)
+		}
+		return ""
+
+	case EventPageFault:
+		if latencyMs > 10 {
+			return e.formatPageFaultMessage(latencyMs)
+		}
+		return ""
+
+	case EventFutexWait:
+		if latencyMs > 100 {
+			return e.formatFutexMessage(latencyMs)
+		}
+		return ""
+
+	case EventAccept:
+		if latencyMs > 100 {
+			return e.formatAcceptMessage(latencyMs)
+		}
+		return ""
+
+	case EventTCPConnection:
+		if e.Connection != nil && e.Connection.End != "time_wait" && e.Connection.End != "closed" {
+			return e.formatConnectionMessage()
+		}
+		return ""
+
+	case EventUDPSend, EventUDPRecv:
+		return e.formatUDPMessage(latencyMs, 100)
+
+	case EventUDPDrop:
+		return e.formatUDPDropMessage()
+
+	case EventPageFaultCount, EventSyscall, EventNetStat:
+		return ""
 
 	default:
 		return sprintf("[UNKNOWN] event type %d", e.Type)
@@ -130,11 +642,8 @@ func (e *Event) FormatRealtimeMessage() string {
 	latencyMs := float64(e.LatencyNS) / 1e6
 
 	switch e.Type {
-	case EventDNS:
-		if e.Error != 0 {
-			return sprintf("[DNS] lookup %s failed: error %d", e.Target, e.Error)
-		}
-		return sprintf("[DNS] lookup %s took %.2fms", e.Target, latencyMs)
+	case EventDNS, EventDNSQuery:
+		return e.formatDNSMessage(latencyMs)
 
 	case EventConnect:
 		target := e.Target
@@ -160,39 +669,409 @@ func (e *Event) FormatRealtimeMessage() string {
 			return sprintf("[NET] TCP recv error: %d", e.Error)
 		}
 		if latencyMs > 10 {
-			return sprintf("[NET] TCP recv RTT: %.2fms", latencyMs)
+			return sprintf("[NET] TCP recv latency: %.2fms", latencyMs)
 		}
 		return ""
 
-	case EventWrite:
-		target := e.Target
-		if target == "" || target == "?" {
-			target = "file"
+	case EventTCPRetransmit:
+		return sprintf("[NET] TCP retransmit to %s (%s)", e.Target, e.StateName())
+
+	case EventTCPSendReset:
+		return sprintf("[NET] TCP reset sent to %s (%s)", e.Target, e.StateName())
+
+	case EventTCPRecvReset:
+		return sprintf("[NET] TCP reset received from %s (%s)", e.Target, e.StateName())
+
+	case EventTCPRTT:
+		if e.TCPInfo == nil {
+			return sprintf("[NET] TCP RTT to %s: %.2fms", e.Target, latencyMs)
 		}
-		return sprintf("[FS] write() to %s took %.2fms", target, latencyMs)
+		return sprintf("[NET] TCP RTT to %s: %.2fms (rttvar %.2fms, cwnd %d)",
+			e.Target, latencyMs, float64(e.TCPInfo.RTTVarUS)/1e3, e.TCPInfo.SndCwnd)
+
+	case EventWrite:
+		return e.formatFileMessage("write() to", latencyMs)
 
 	case EventRead:
-		target := e.Target
-		if target == "" || target == "?" {
-			target = "file"
-		}
-		return sprintf("[FS] read() from %s took %.2fms", target, latencyMs)
+		return e.formatFileMessage("read() from", latencyMs)
 
 	case EventFsync:
-		target := e.Target
-		if target == "" {
-			target = "file"
-		}
-		return sprintf("[FS] fsync() to %s took %.2fms", target, latencyMs)
+		return e.formatFileMessage("fsync() to", latencyMs)
 
 	case EventSchedSwitch:
-		return sprintf("[CPU] thread blocked %.2fms", latencyMs)
+		return e.formatOffCPUMessage(latencyMs)
+
+	case EventRunQueue:
+		if latencyMs > 1 {
+			return sprintf("[CPU] thread %d waited %.2fms for a CPU", e.TID, latencyMs)
+		}
+		return ""
+
+	case EventCPUTime, EventCgroupCPU:
+		return ""
+
+	case EventProcessExec, EventProcessFork, EventProcessExit:
+		return e.formatProcessMessage()
+
+	case EventOOMKill:
+		return e.formatOOMMessage()
+
+	case EventCgroupMemory:
+		return ""
+
+	case EventBlockIO:
+		if e.Error < 0 || latencyMs > 10 {
+			return e.formatBlockIOMessage(latencyMs)
+		}
+		return ""
+
+	case EventPageFault:
+		return e.formatPageFaultMessage(latencyMs)
+
+	case EventFutexWait:
+		if latencyMs > 1 {
+			return e.formatFutexMessage(latencyMs)
+		}
+		return ""
+
+	case EventAccept:
+		return e.formatAcceptMessage(latencyMs)
+
+	case EventTCPConnection:
+		return e.formatConnectionMessage()
+
+	case EventUDPSend, EventUDPRecv:
+		return e.formatUDPMessage(latencyMs, 10)
+
+	case EventUDPDrop:
+		return e.formatUDPDropMessage()
+
+	case EventPageFaultCount, EventSyscall, EventNetStat:
+		return ""
 
 	default:
 		return sprintf("[UNKNOWN] event type %d", e.Type)
 	}
 }
 
+// formatAcceptMessage describes an accepted connection, e.g.
+// "[NET] accepted 10.0.0.7:51234 on 10.0.1.2:8080 after 1.20ms in accept queue (backlog 3/128)"
+func (e *Event) formatAcceptMessage(latencyMs float64) string {
+	msg := sprintf("[NET] accepted %s on %s", e.Target, e.Details)
+	if e.LatencyNS > 0 {
+		msg += sprintf(" after %.2fms in accept queue", latencyMs)
+	}
+	if e.Accept != nil && e.Accept.MaxBacklog > 0 {
+		msg += sprintf(" (backlog %d/%d)", e.Accept.Backlog, e.Accept.MaxBacklog)
+	}
+	return msg
+}
+
+// formatConnectionMessage describes a closed connection, e.g.
+// "[NET] connection to 10.0.0.7:443 closed after 1.25s, sent 512 bytes, received 2048 bytes (reset_received)"
+func (e *Event) formatConnectionMessage() string {
+	if e.Connection == nil {
+		return sprintf("[NET] connection to %s closed after %v", e.Target, e.Latency().Round(time.Millisecond))
+	}
+	direction := "to"
+	if e.Connection.Passive {
+		direction = "from"
+	}
+	msg := sprintf("[NET] connection %s %s closed after %v, sent %d bytes, received %d bytes", direction, e.Target,
+		e.Latency().Round(time.Millisecond), e.Connection.BytesSent, e.Connection.BytesReceived)
+	if e.Connection.ClosedBy != "" {
+		msg += ", closed by " + e.Connection.ClosedBy
+	}
+	return msg + sprintf(" (%s)", e.Connection.End)
+}
+
+// formatDNSMessage describes a getaddrinfo lookup or a query seen on the
+// wire, e.g. "[DNS] query example.com (AAAA) failed: NXDOMAIN"
+func (e *Event) formatDNSMessage(latencyMs float64) string {
+	op := "lookup"
+	if e.Type == EventDNSQuery {
+		op = "query"
+	}
+	target := e.Target
+	if e.Details != "" {
+		target = sprintf("%s (%s)", e.Target, e.Details)
+	}
+	if e.Error != 0 {
+		return sprintf("[DNS] %s %s failed: %s", op, target, e.ErrorName())
+	}
+	return sprintf("[DNS] %s %s took %.2fms", op, target, latencyMs)
+}
+
+// formatUDPMessage describes a failed UDP send or receive, or one slower than
+// thresholdMs, e.g. "[NET] UDP send to 10.0.0.9:8125 took 12.00ms, 512 bytes"
+func (e *Event) formatUDPMessage(latencyMs, thresholdMs float64) string {
+	op, peer := "send", ""
+	if e.Type == EventUDPRecv {
+		op = "recv"
+	}
+	if e.Target != "" {
+		if e.Type == EventUDPRecv {
+			peer = " from " + e.Target
+		} else {
+			peer = " to " + e.Target
+		}
+	}
+	if e.Error < 0 && e.Error != -11 {
+		return sprintf("[NET] UDP %s%s failed: %s", op, peer, e.ErrorName())
+	}
+	if latencyMs > thresholdMs {
+		return sprintf("[NET] UDP %s%s took %.2fms, %d bytes", op, peer, latencyMs, e.Bytes)
+	}
+	return ""
+}
+
+// formatUDPDropMessage describes a dropped datagram, e.g.
+// "[NET] UDP datagram for 10.0.1.2:8125 dropped: receive buffer full"
+func (e *Event) formatUDPDropMessage() string {
+	return sprintf("[NET] UDP datagram for %s dropped: %s", e.Details, UDPDropReasonDescription(e.State))
+}
+
+// formatBlockIOMessage describes a block request, e.g.
+// "[DISK] write of 4096 bytes to nvme0n1 took 12.00ms (queued 2.00ms)"
+func (e *Event) formatBlockIOMessage(latencyMs float64) string {
+	if e.BlockIO == nil {
+		return sprintf("[DISK] I/O to %s took %.2fms", e.Target, latencyMs)
+	}
+	device := e.Target
+	if device == "" {
+		device = e.BlockIO.DeviceString()
+	}
+	if e.Error < 0 {
+		return sprintf("[DISK] %s of %d bytes to %s failed after %.2fms: %s", e.BlockIO.OpName(),
+			e.BlockIO.Bytes, device, latencyMs, e.ErrorName())
+	}
+	return sprintf("[DISK] %s of %d bytes to %s took %.2fms (queued %.2fms)", e.BlockIO.OpName(),
+		e.BlockIO.Bytes, device, latencyMs, float64(e.BlockIO.QueueNS)/1e6)
+}
+
+// formatPageFaultMessage describes a page fault, e.g.
+// "[FAULT] major read fault in /usr/lib/libjvm.so+0x1a000 took 4.20ms"
+func (e *Event) formatPageFaultMessage(latencyMs float64) string {
+	where := e.Target
+	access := ""
+	if e.PageFault != nil {
+		if e.PageFault.Offset > 0 {
+			where = sprintf("%s+0x%x", e.Target, e.PageFault.Offset)
+		}
+		access = "read "
+		if e.PageFault.Write {
+			access = "write "
+		}
+	}
+	return sprintf("[FAULT] %s %sfault in %s took %.2fms", e.Details, access, where, latencyMs)
+}
+
+// formatFutexMessage describes a futex wait, e.g.
+// "[LOCK] thread 42 (worker) waited 3.10ms on futex 0x7f3a2c001f90, woken by java (PID 7)"
+func (e *Event) formatFutexMessage(latencyMs float64) string {
+	msg := sprintf("[LOCK] thread %d (%s) waited %.2fms", e.TID, e.Details, latencyMs)
+	if e.Futex != nil {
+		msg += sprintf(" on futex 0x%x", e.Futex.Address)
+	}
+	switch {
+	case e.Error == -110:
+		msg += ", timed out"
+	case e.Error < 0:
+		msg += ": " + e.ErrorName()
+	case e.Futex != nil && e.Futex.WakerPID != 0:
+		msg += sprintf(", woken by %s (PID %d)", e.Target, e.Futex.WakerPID)
+	}
+	if e.Futex != nil && len(e.Futex.UserStack) > 0 {
+		msg += " in " + e.Futex.UserStack[0]
+	}
+	return msg
+}
+
+// formatProcessMessage describes a process lifecycle event, e.g.
+// "[PROC] process 42 (worker) killed by SIGKILL after 3.20s"
+func (e *Event) formatProcessMessage() string {
+	if e.Process == nil {
+		return sprintf("[PROC] %s of process %d", e.Type, e.PID)
+	}
+	switch e.Type {
+	case EventProcessExec:
+		return sprintf("[PROC] process %d (parent %d) executed %s", e.PID, e.Process.PPID, e.Target)
+	case EventProcessFork:
+		return sprintf("[PROC] process %d (%s) forked child %d", e.PID, e.Target, e.Process.ChildPID)
+	default:
+		return sprintf("[PROC] process %d (%s) %s after %s", e.PID, e.Details, e.Process.ExitReason(),
+			e.Latency().Round(time.Millisecond))
+	}
+}
+
+// formatOOMMessage describes an OOM kill, e.g.
+// "[MEM] OOM killer (memcg) killed process 42 (java), triggered by process 57"
+func (e *Event) formatOOMMessage() string {
+	name := e.Target
+	if name == "" {
+		name = e.ProcessName
+	}
+	killer := "OOM killer"
+	if e.Details != "" {
+		killer = sprintf("OOM killer (%s)", e.Details)
+	}
+	msg := sprintf("[MEM] %s killed process %d (%s)", killer, e.PID, name)
+	if e.OOM != nil && e.OOM.TriggerPID != 0 && e.OOM.TriggerPID != e.PID {
+		msg += sprintf(", triggered by process %d", e.OOM.TriggerPID)
+	}
+	return msg
+}
+
+// formatFileMessage describes a file operation, e.g.
+// "[FS] read() from /var/lib/app/data.db (ext4) took 12.00ms, 4096/8192 bytes"
+func (e *Event) formatFileMessage(op string, latencyMs float64) string {
+	target := e.Target
+	if target == "" || target == "?" {
+		target = "file"
+	}
+	if e.Details != "" {
+		target = sprintf("%s (%s)", target, e.Details)
+	}
+	if e.Error < 0 {
+		return sprintf("[FS] %s %s failed after %.2fms: %s", op, target, latencyMs, e.ErrorName())
+	}
+	if e.FileInfo == nil || e.Type == EventFsync {
+		return sprintf("[FS] %s %s took %.2fms", op, target, latencyMs)
+	}
+	return sprintf("[FS] %s %s took %.2fms, %d/%d bytes", op, target, latencyMs,
+		e.FileInfo.BytesReturned, e.FileInfo.BytesRequested)
+}
+
+// formatOffCPUMessage describes a blocked thread, e.g.
+// "[CPU] thread 42 blocked 12.00ms (sleeping, woken by nginx) in futex_wait"
+func (e *Event) formatOffCPUMessage(latencyMs float64) string {
+	if e.OffCPU == nil {
+		return sprintf("[CPU] thread blocked %.2fms", latencyMs)
+	}
+
+	reason := e.StateName()
+	if e.Target != "" {
+		reason = sprintf("%s, woken by %s", reason, e.Target)
+	}
+	msg := sprintf("[CPU] thread %d blocked %.2fms (%s)", e.TID, latencyMs, reason)
+	if frame := e.OffCPU.blockingFrame(); frame != "" {
+		msg += " in " + frame
+	}
+	return msg
+}
+
+// blockingFrame returns the innermost frame that is not part of the
+// scheduler itself, preferring user code
+func (o *OffCPUInfo) blockingFrame() string {
+	if len(o.UserStack) > 0 {
+		return o.UserStack[0]
+	}
+	for _, frame := range o.KernelStack {
+		if !strings.HasPrefix(frame, "schedule") && !strings.HasPrefix(frame, "__schedule") {
+			return frame
+		}
+	}
+	return ""
+}
+
+// OffCPUStateName describes the state a task was switched out in, as
+// reported by the sched_switch tracepoint's prev_state
+func OffCPUStateName(state uint32) string {
+	switch {
+	case state == 0 || state&0x100 != 0: // TASK_RUNNING, or TASK_REPORT_MAX on 5.18+
+		return "preempted"
+	case state&0x1 != 0:
+		return "sleeping"
+	case state&0x2 != 0:
+		return "uninterruptible (D)"
+	case state&0x4 != 0:
+		return "stopped"
+	case state&0x8 != 0:
+		return "traced"
+	case state&0x80 != 0:
+		return "idle"
+	default:
+		return sprintf("state 0x%x", state)
+	}
+}
+
+// TCP states as numbered in include/net/tcp_states.h
+var tcpStateNames = map[uint32]string{
+	1:  "ESTABLISHED",
+	2:  "SYN_SENT",
+	3:  "SYN_RECV",
+	4:  "FIN_WAIT1",
+	5:  "FIN_WAIT2",
+	6:  "TIME_WAIT",
+	7:  "CLOSE",
+	8:  "CLOSE_WAIT",
+	9:  "LAST_ACK",
+	10: "LISTEN",
+	11: "CLOSING",
+	12: "NEW_SYN_RECV",
+}
+
+// StateName returns the name of the event's socket state, or "" for event
+// types that carry no state
+func (e *Event) StateName() string {
+	switch e.Type {
+	case EventTCPRetransmit, EventTCPSendReset, EventTCPRecvReset, EventTCPRTT, EventTCPConnection:
+		return TCPStateName(e.State)
+	case EventUDPDrop:
+		return UDPDropReasonName(e.State)
+	case EventSchedSwitch:
+		if e.OffCPU != nil {
+			return OffCPUStateName(e.State)
+		}
+	}
+	return ""
+}
+
+// TCPStateName returns the kernel name of a TCP state, e.g. "ESTABLISHED"
+func TCPStateName(state uint32) string {
+	if name, ok := tcpStateNames[state]; ok {
+		return name
+	}
+	return sprintf("STATE_%d", state)
+}
+
+// UDP drop reasons, as reported by the eBPF programs in the state of UDP drop
+// events
+var udpDropReasons = map[uint32]struct{ name, description string }{
+	0: {"unknown", "unknown reason"},
+	1: {"rcvbuf", "receive buffer full"},
+	2: {"proto_mem", "UDP memory limit reached"},
+	3: {"checksum", "bad checksum"},
+	4: {"filter", "rejected by socket filter or policy"},
+	5: {"other", "other reason"},
+}
+
+// UDPDropReasonName returns a short name for a UDP drop reason, e.g. "rcvbuf"
+func UDPDropReasonName(reason uint32) string {
+	if r, ok := udpDropReasons[reason]; ok {
+		return r.name
+	}
+	return sprintf("reason_%d", reason)
+}
+
+// UDPDropReasonDescription describes a UDP drop reason, e.g. "receive buffer
+// full"
+func UDPDropReasonDescription(reason uint32) string {
+	if r, ok := udpDropReasons[reason]; ok {
+		return r.description
+	}
+	return sprintf("reason %d", reason)
+}
+
 func sprintf(format string, args ...interface{}) string {
 	return fmt.Sprintf(format, args...)
 }
+
+// peerSuffix returns " to <peer>" for messages about calls on a socket whose
+// remote endpoint is known
+func peerSuffix(peer string) string {
+	if peer == "" {
+		return ""
+	}
+	return " to " + peer
+}
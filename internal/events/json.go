@@ -0,0 +1,261 @@
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// JSONEvent is the structured form of an Event written by the JSON output mode
+type JSONEvent struct {
+	Timestamp    string          `json:"timestamp"`
+	TimestampNS  uint64          `json:"timestamp_ns"`
+	Type         string          `json:"type"`
+	Category     string          `json:"category"`
+	PID          uint32          `json:"pid"`
+	TID          uint32          `json:"tid,omitempty"`
+	ProcessName  string          `json:"process_name,omitempty"`
+	Container    string          `json:"container,omitempty"`
+	LatencyMS    float64         `json:"latency_ms"`
+	Error        int32           `json:"error,omitempty"`
+	ErrorName    string          `json:"error_name,omitempty"`
+	State        string          `json:"state,omitempty"`
+	Bytes        uint64          `json:"bytes,omitempty"`
+	Target       string          `json:"target,omitempty"`
+	Details      string          `json:"details,omitempty"`
+	TCP          *TCPInfo        `json:"tcp,omitempty"`
+	File         *FileInfo       `json:"file,omitempty"`
+	OffCPU       *OffCPUInfo     `json:"off_cpu,omitempty"`
+	CgroupCPU    *CgroupCPU      `json:"cgroup_cpu,omitempty"`
+	Process      *ProcessInfo    `json:"process,omitempty"`
+	OOM          *OOMInfo        `json:"oom,omitempty"`
+	CgroupMemory *CgroupMemory   `json:"cgroup_memory,omitempty"`
+	BlockIO      *BlockIOInfo    `json:"block_io,omitempty"`
+	PageFault    *PageFaultInfo  `json:"page_fault,omitempty"`
+	PageFaults   *PageFaultCount `json:"page_faults,omitempty"`
+	Futex        *FutexInfo      `json:"futex,omitempty"`
+	Syscall      *SyscallStats   `json:"syscall,omitempty"`
+	Accept       *AcceptInfo     `json:"accept,omitempty"`
+	NetStat      *NetStats       `json:"netstat,omitempty"`
+	Connection   *ConnectionInfo `json:"connection,omitempty"`
+	Message      string          `json:"message,omitempty"`
+}
+
+// ToJSON converts the event to its structured JSON form
+func (e *Event) ToJSON() JSONEvent {
+	return JSONEvent{
+		Timestamp:    e.TimestampTime().Format(time.RFC3339Nano),
+		TimestampNS:  e.Timestamp,
+		Type:         e.Type.String(),
+		Category:     e.TypeString(),
+		PID:          e.PID,
+		TID:          e.TID,
+		ProcessName:  e.ProcessName,
+		Container:    e.Container,
+		LatencyMS:    float64(e.LatencyNS) / 1e6,
+		Error:        e.Error,
+		ErrorName:    e.ErrorName(),
+		State:        e.StateName(),
+		Bytes:        e.Bytes,
+		Target:       e.Target,
+		Details:      e.Details,
+		TCP:          e.TCPInfo,
+		File:         e.FileInfo,
+		OffCPU:       e.OffCPU,
+		CgroupCPU:    e.CgroupCPU,
+		Process:      e.Process,
+		OOM:          e.OOM,
+		CgroupMemory: e.CgroupMemory,
+		BlockIO:      e.BlockIO,
+		PageFault:    e.PageFault,
+		PageFaults:   e.PageFaults,
+		Futex:        e.Futex,
+		Syscall:      e.Syscall,
+		Accept:       e.Accept,
+		NetStat:      e.NetStat,
+		Connection:   e.Connection,
+		Message:      e.FormatRealtimeMessage(),
+	}
+}
+
+// MarshalJSON keeps TCPInfo's JSON keys in the snake_case used by JSONEvent
+func (i *TCPInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		RTTVarMS     float64 `json:"rttvar_ms"`
+		SndCwnd      uint32  `json:"snd_cwnd"`
+		TotalRetrans uint32  `json:"total_retrans"`
+	}{float64(i.RTTVarUS) / 1e3, i.SndCwnd, i.TotalRetrans})
+}
+
+// MarshalJSON keeps FileInfo's JSON keys in snake_case and the device in
+// major:minor form
+func (f *FileInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		BytesRequested uint64 `json:"bytes_requested"`
+		BytesReturned  uint64 `json:"bytes_returned"`
+		Inode          uint64 `json:"inode"`
+		Device         string `json:"device"`
+	}{f.BytesRequested, f.BytesReturned, f.Inode, f.DeviceString()})
+}
+
+// MarshalJSON leaves out OffCPUInfo's stack IDs, which are only meaningful
+// while the tracer is running
+func (o *OffCPUInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		WakerPID    uint32   `json:"waker_pid,omitempty"`
+		KernelStack []string `json:"kernel_stack,omitempty"`
+		UserStack   []string `json:"user_stack,omitempty"`
+	}{o.WakerPID, o.KernelStack, o.UserStack})
+}
+
+// MarshalJSON keeps CgroupCPU's JSON keys in the names used by cpu.stat
+func (c *CgroupCPU) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		UsageUSec     uint64 `json:"usage_usec"`
+		NrPeriods     uint64 `json:"nr_periods"`
+		NrThrottled   uint64 `json:"nr_throttled"`
+		ThrottledUSec uint64 `json:"throttled_usec"`
+		QuotaUSec     uint64 `json:"quota_usec,omitempty"`
+		PeriodUSec    uint64 `json:"period_usec,omitempty"`
+	}(*c))
+}
+
+// MarshalJSON decodes ProcessInfo's exit code into status and signal
+func (p *ProcessInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		PPID       uint32 `json:"ppid"`
+		ChildPID   uint32 `json:"child_pid,omitempty"`
+		ExitStatus int    `json:"exit_status,omitempty"`
+		Signal     string `json:"signal,omitempty"`
+		CoreDumped bool   `json:"core_dumped,omitempty"`
+	}{p.PPID, p.ChildPID, p.ExitStatus(), signalName(p.Signal()), p.CoreDumped()})
+}
+
+func signalName(sig int) string {
+	if sig == 0 {
+		return ""
+	}
+	return SignalName(sig)
+}
+
+// MarshalJSON keeps OOMInfo's JSON keys in snake_case
+func (o *OOMInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		TotalPages uint64 `json:"total_pages,omitempty"`
+		Points     int64  `json:"points,omitempty"`
+		TriggerPID uint32 `json:"trigger_pid,omitempty"`
+	}(*o))
+}
+
+// MarshalJSON keeps CgroupMemory's JSON keys in the names used by the memory
+// controller's files
+func (c *CgroupMemory) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		UsageBytes        uint64  `json:"current"`
+		LimitBytes        uint64  `json:"max,omitempty"`
+		AnonBytes         uint64  `json:"anon"`
+		FileBytes         uint64  `json:"file"`
+		High              uint64  `json:"events_high"`
+		Max               uint64  `json:"events_max"`
+		OOM               uint64  `json:"events_oom"`
+		OOMKill           uint64  `json:"events_oom_kill"`
+		PressureSomeUSec  uint64  `json:"pressure_some_total_usec,omitempty"`
+		PressureFullUSec  uint64  `json:"pressure_full_total_usec,omitempty"`
+		PressureSomeAvg10 float64 `json:"pressure_some_avg10,omitempty"`
+		PressureFullAvg10 float64 `json:"pressure_full_avg10,omitempty"`
+	}(*c))
+}
+
+// MarshalJSON names BlockIOInfo's operation and device and keeps its JSON
+// keys in snake_case
+func (b *BlockIOInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Op      string  `json:"op"`
+		Device  string  `json:"device"`
+		Sector  uint64  `json:"sector"`
+		Bytes   uint32  `json:"bytes"`
+		QueueMS float64 `json:"queue_ms"`
+	}{b.OpName(), b.DeviceString(), b.Sector, b.Bytes, float64(b.QueueNS) / 1e6})
+}
+
+// MarshalJSON formats PageFaultInfo's address in hex and keeps its JSON keys
+// in snake_case
+func (f *PageFaultInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Address string `json:"address"`
+		Offset  uint64 `json:"offset,omitempty"`
+		Write   bool   `json:"write"`
+		Major   bool   `json:"major"`
+	}{sprintf("0x%x", f.Address), f.Offset, f.Write, f.Major})
+}
+
+// MarshalJSON keeps PageFaultCount's JSON keys in snake_case
+func (c *PageFaultCount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Minor uint64 `json:"minor"`
+		Major uint64 `json:"major"`
+	}{c.Minor, c.Major})
+}
+
+// MarshalJSON formats FutexInfo's address in hex, names its operation and
+// leaves out the stack ID
+func (f *FutexInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Address   string   `json:"address"`
+		Op        string   `json:"op"`
+		WakerPID  uint32   `json:"waker_pid,omitempty"`
+		UserStack []string `json:"user_stack,omitempty"`
+	}{sprintf("0x%x", f.Address), f.OpName(), f.WakerPID, f.UserStack})
+}
+
+// MarshalJSON keeps SyscallStats' JSON keys in snake_case
+func (s *SyscallStats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Nr        uint32   `json:"nr"`
+		Count     uint64   `json:"count"`
+		TotalMS   float64  `json:"total_ms"`
+		Histogram []uint64 `json:"histogram_log2_us"`
+	}{s.Nr, s.Count, float64(s.TotalNS) / 1e6, s.Histogram})
+}
+
+// MarshalJSON keeps AcceptInfo's JSON keys in snake_case
+func (a *AcceptInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Backlog    uint32 `json:"backlog"`
+		MaxBacklog uint32 `json:"max_backlog"`
+	}(*a))
+}
+
+// MarshalJSON keeps NetStats' JSON keys in the names used by /proc/net/netstat
+func (n *NetStats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Namespace       uint64 `json:"netns"`
+		ListenOverflows uint64 `json:"ListenOverflows"`
+		ListenDrops     uint64 `json:"ListenDrops"`
+	}(*n))
+}
+
+// MarshalJSON keeps ConnectionInfo's JSON keys in snake_case
+func (c *ConnectionInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		BytesSent     uint64 `json:"bytes_sent"`
+		BytesReceived uint64 `json:"bytes_received"`
+		Passive       bool   `json:"passive"`
+		ClosedBy      string `json:"closed_by,omitempty"`
+		End           string `json:"end"`
+	}(*c))
+}
+
+// JSONWriter writes events as newline-delimited JSON
+type JSONWriter struct {
+	enc *json.Encoder
+}
+
+func NewJSONWriter(w io.Writer) *JSONWriter {
+	return &JSONWriter{enc: json.NewEncoder(w)}
+}
+
+// Write encodes a single event followed by a newline
+func (w *JSONWriter) Write(e *Event) error {
+	return w.enc.Encode(e.ToJSON())
+}
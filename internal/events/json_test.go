@@ -0,0 +1,123 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONWriter(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	e := &Event{
+		Timestamp:   uint64(ts.UnixNano()),
+		PID:         1234,
+		ProcessName: "curl",
+		Container:   "app",
+		Type:        EventConnect,
+		LatencyNS:   2500000,
+		Error:       -111,
+		Target:      "10.0.0.1:00080",
+	}
+
+	var buf bytes.Buffer
+	if err := NewJSONWriter(&buf).Write(e); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+
+	line := buf.String()
+	if !strings.HasSuffix(line, "\n") || strings.Count(line, "\n") != 1 {
+		t.Fatalf("expected exactly one newline-terminated line, got %q", line)
+	}
+
+	var decoded JSONEvent
+	if err := json.Unmarshal([]byte(line), &decoded); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+
+	if decoded.Type != "connect" {
+		t.Errorf("type = %q, expected connect", decoded.Type)
+	}
+	if decoded.Category != "NET" {
+		t.Errorf("category = %q, expected NET", decoded.Category)
+	}
+	if decoded.ErrorName != "ECONNREFUSED" {
+		t.Errorf("error_name = %q, expected ECONNREFUSED", decoded.ErrorName)
+	}
+	if decoded.LatencyMS != 2.5 {
+		t.Errorf("latency_ms = %v, expected 2.5", decoded.LatencyMS)
+	}
+	if decoded.Container != "app" {
+		t.Errorf("container = %q, expected app", decoded.Container)
+	}
+	parsed, err := time.Parse(time.RFC3339Nano, decoded.Timestamp)
+	if err != nil || !parsed.Equal(ts) {
+		t.Errorf("timestamp = %q, expected %s", decoded.Timestamp, ts.Format(time.RFC3339Nano))
+	}
+}
+
+func TestFutexJSON(t *testing.T) {
+	e := &Event{
+		Type:      EventFutexWait,
+		LatencyNS: 3e6,
+		Futex:     &FutexInfo{Address: 0x7f00001000, WakerPID: 7, UserStackID: 3, UserStack: []string{"pthread_mutex_lock"}},
+	}
+
+	var buf bytes.Buffer
+	if err := NewJSONWriter(&buf).Write(e); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+
+	line := buf.String()
+	if strings.Contains(line, "off_cpu") || strings.Contains(line, "stack_id") {
+		t.Errorf("futex event should carry its stack under futex only: %s", line)
+	}
+	if !strings.Contains(line, `"futex":{"address":"0x7f00001000","op":"wait","waker_pid":7,"user_stack":["pthread_mutex_lock"]}`) {
+		t.Errorf("unexpected futex JSON: %s", line)
+	}
+}
+
+func TestErrorName(t *testing.T) {
+	tests := []struct {
+		event    Event
+		expected string
+	}{
+		{Event{Type: EventConnect, Error: 0}, ""},
+		{Event{Type: EventTCPSend, Error: 512}, ""},
+		{Event{Type: EventTCPRecv, Error: -11}, "EAGAIN"},
+		{Event{Type: EventRead, Error: -2}, "ENOENT"},
+		{Event{Type: EventDNS, Error: -2}, "EAI_NONAME"},
+		{Event{Type: EventDNS, Error: -3}, "EAI_AGAIN"},
+		{Event{Type: EventDNS, Error: 3}, "NXDOMAIN"},
+		{Event{Type: EventDNS, Error: 15}, "RCODE15"},
+	}
+
+	for _, tt := range tests {
+		if result := tt.event.ErrorName(); result != tt.expected {
+			t.Errorf("ErrorName() for type %s error %d = %q, expected %q",
+				tt.event.Type, tt.event.Error, result, tt.expected)
+		}
+	}
+}
+
+func TestProcessExitReason(t *testing.T) {
+	tests := []struct {
+		exitCode uint32
+		abnormal bool
+		expected string
+	}{
+		{0, false, "exit status 0"},
+		{2 << 8, true, "exit status 2"},
+		{9, true, "killed by SIGKILL"},
+		{0x80 | 11, true, "killed by SIGSEGV (core dumped)"},
+	}
+
+	for _, tt := range tests {
+		info := &ProcessInfo{ExitCode: tt.exitCode}
+		if info.Abnormal() != tt.abnormal || info.ExitReason() != tt.expected {
+			t.Errorf("exit code 0x%x: abnormal = %v, reason = %q, expected %v, %q",
+				tt.exitCode, info.Abnormal(), info.ExitReason(), tt.abnormal, tt.expected)
+		}
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -71,46 +73,127 @@ func NewPodResolver() (*PodResolver, error) {
 	return &PodResolver{clientset: clientset}, nil
 }
 
-// ResolvePod resolves a pod name and namespace to container information
-func (r *PodResolver) ResolvePod(ctx context.Context, podName, namespace string) (*PodInfo, error) {
+// ResolvePod resolves a pod name and namespace to container information.
+// If containerNames is empty, every running container in the pod is resolved,
+// including init and ephemeral containers.
+func (r *PodResolver) ResolvePod(ctx context.Context, podName, namespace string, containerNames []string) (*PodInfo, error) {
 	pod, err := r.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get pod: %w", err)
 	}
 
-	if len(pod.Status.ContainerStatuses) == 0 {
+	statuses := make([]containerStatus, 0, len(pod.Status.ContainerStatuses))
+	for _, cs := range pod.Status.InitContainerStatuses {
+		statuses = append(statuses, containerStatus{status: cs, kind: ContainerKindInit})
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		statuses = append(statuses, containerStatus{status: cs, kind: ContainerKindRegular})
+	}
+	for _, cs := range pod.Status.EphemeralContainerStatuses {
+		statuses = append(statuses, containerStatus{status: cs, kind: ContainerKindEphemeral})
+	}
+
+	if len(statuses) == 0 {
 		return nil, fmt.Errorf("pod has no containers")
 	}
 
-	containerStatus := pod.Status.ContainerStatuses[0]
-	containerID := containerStatus.ContainerID
+	wanted := make(map[string]bool, len(containerNames))
+	for _, name := range containerNames {
+		wanted[name] = true
+	}
+
+	var containers []ContainerInfo
+	for _, cs := range statuses {
+		name := cs.status.Name
+		if len(wanted) > 0 && !wanted[name] {
+			continue
+		}
+		delete(wanted, name)
+
+		if cs.status.ContainerID == "" {
+			if len(containerNames) > 0 {
+				return nil, fmt.Errorf("container %s has not started", name)
+			}
+			continue
+		}
+
+		parts := strings.Split(cs.status.ContainerID, "://")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid container ID format: %s", cs.status.ContainerID)
+		}
+		shortID := parts[1]
+
+		cgroupPath, err := findCgroupPath(shortID)
+		if err != nil {
+			if len(containerNames) > 0 {
+				return nil, fmt.Errorf("failed to find cgroup path for container %s: %w", name, err)
+			}
+			// Completed init containers no longer have a cgroup
+			continue
+		}
+
+		containers = append(containers, ContainerInfo{
+			Name:        name,
+			Kind:        cs.kind,
+			ContainerID: shortID,
+			CgroupPath:  cgroupPath,
+		})
+	}
 
-	parts := strings.Split(containerID, "://")
-	if len(parts) != 2 {
-		return nil, fmt.Errorf("invalid container ID format: %s", containerID)
+	if len(wanted) > 0 {
+		missing := make([]string, 0, len(wanted))
+		for name := range wanted {
+			missing = append(missing, name)
+		}
+		sort.Strings(missing)
+		return nil, fmt.Errorf("container(s) %s not found in pod %s/%s", strings.Join(missing, ", "), namespace, podName)
 	}
-	shortID := parts[1]
 
-	cgroupPath, err := findCgroupPath(shortID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to find cgroup path: %w", err)
+	if len(containers) == 0 {
+		return nil, fmt.Errorf("no running containers found in pod %s/%s", namespace, podName)
 	}
 
 	return &PodInfo{
-		PodName:       podName,
-		Namespace:     namespace,
-		ContainerID:   shortID,
-		CgroupPath:    cgroupPath,
-		ContainerName: pod.Spec.Containers[0].Name,
+		PodName:    podName,
+		Namespace:  namespace,
+		Containers: containers,
 	}, nil
 }
 
+// ContainerKind distinguishes regular, init and ephemeral containers
+type ContainerKind string
+
+const (
+	ContainerKindRegular   ContainerKind = "container"
+	ContainerKindInit      ContainerKind = "init"
+	ContainerKindEphemeral ContainerKind = "ephemeral"
+)
+
+type containerStatus struct {
+	status corev1.ContainerStatus
+	kind   ContainerKind
+}
+
+type ContainerInfo struct {
+	Name        string
+	Kind        ContainerKind
+	ContainerID string
+	CgroupPath  string
+}
+
 type PodInfo struct {
-	PodName       string
-	Namespace     string
-	ContainerID   string
-	CgroupPath    string
-	ContainerName string
+	PodName    string
+	Namespace  string
+	Containers []ContainerInfo
+}
+
+// CgroupPaths returns the cgroup path of every resolved container, keyed by container name
+func (p *PodInfo) CgroupPaths() map[string]string {
+	paths := make(map[string]string, len(p.Containers))
+	for _, c := range p.Containers {
+		paths[c.Name] = c.CgroupPath
+	}
+	return paths
 }
 
 // findCgroupPath finds the cgroup path for a container ID
@@ -2,6 +2,8 @@ package metricsexporter
 
 import (
 	"net/http"
+	"strings"
+	"sync"
 
 	"github.com/podtrace/podtrace/internal/events"
 	"github.com/prometheus/client_golang/prometheus"
@@ -10,14 +12,32 @@ import (
 
 type EventType uint32
 
+// maxPeerLabels caps the distinct values of the peer label; further peers are
+// recorded as "other"
+const maxPeerLabels = 100
+
+var (
+	peerLabelsMu sync.Mutex
+	peerLabels   = make(map[string]bool)
+)
+
 var (
 	rttHistogram = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "podtrace_rtt_seconds",
-			Help:    "RTT observed by podtrace.",
+			Help:    "Smoothed TCP round-trip time reported by the kernel.",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 2, 20),
+		},
+		[]string{"type", "process_name", "container", "peer"},
+	)
+
+	tcpSyscallHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "podtrace_tcp_syscall_latency_seconds",
+			Help:    "Duration of TCP send/receive calls.",
 			Buckets: prometheus.ExponentialBuckets(0.0001, 2, 20),
 		},
-		[]string{"type", "process_name"},
+		[]string{"type", "process_name", "container", "peer"},
 	)
 
 	latencyHistogram = prometheus.NewHistogramVec(
@@ -26,7 +46,7 @@ var (
 			Help:    "Latency observed by podtrace.",
 			Buckets: prometheus.ExponentialBuckets(0.0001, 2, 20),
 		},
-		[]string{"type", "process_name"},
+		[]string{"type", "process_name", "container"},
 	)
 
 	dnsGauge = prometheus.NewGaugeVec(
@@ -34,7 +54,7 @@ var (
 			Name: "podtrace_dns_latency_seconds_gauge",
 			Help: "Latest DNS query latency per process.",
 		},
-		[]string{"type", "process_name"},
+		[]string{"type", "process_name", "container", "source"}, // source = getaddrinfo/wire
 	)
 	dnsHistogram = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
@@ -42,7 +62,7 @@ var (
 			Help:    "Distribution of DNS query latencies per process.",
 			Buckets: prometheus.ExponentialBuckets(0.0001, 2, 20),
 		},
-		[]string{"type", "process_name"},
+		[]string{"type", "process_name", "container", "source"},
 	)
 
 	fsGauge = prometheus.NewGaugeVec(
@@ -50,7 +70,7 @@ var (
 			Name: "podtrace_fs_latency_seconds_gauge",
 			Help: "Latest file system operation latency per process.",
 		},
-		[]string{"type", "process_name"}, // type = write/fsync
+		[]string{"type", "process_name", "container"}, // type = write/fsync
 	)
 	fsHistogram = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
@@ -58,7 +78,7 @@ var (
 			Help:    "Distribution of file system latencies per process and type.",
 			Buckets: prometheus.ExponentialBuckets(0.0001, 2, 20),
 		},
-		[]string{"type", "process_name"},
+		[]string{"type", "process_name", "container"},
 	)
 
 	cpuGauge = prometheus.NewGaugeVec(
@@ -66,7 +86,7 @@ var (
 			Name: "podtrace_cpu_block_seconds_gauge",
 			Help: "Latest CPU block time per process.",
 		},
-		[]string{"type", "process_name"},
+		[]string{"type", "process_name", "container"},
 	)
 	cpuHistogram = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
@@ -74,14 +94,67 @@ var (
 			Help:    "Distribution of CPU block times per process.",
 			Buckets: prometheus.ExponentialBuckets(0.0001, 2, 20),
 		},
-		[]string{"type", "process_name"},
+		[]string{"type", "process_name", "container"},
+	)
+	runQueueHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "podtrace_runqueue_latency_seconds",
+			Help:    "Time runnable threads waited for a CPU, from wakeup or preemption to running.",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 2, 20),
+		},
+		[]string{"type", "process_name", "container"},
+	)
+	blockQueueHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "podtrace_block_io_queue_seconds",
+			Help:    "Time block device requests waited in the I/O scheduler before being issued.",
+			Buckets: prometheus.ExponentialBuckets(0.00001, 2, 20),
+		},
+		[]string{"type", "process_name", "container", "device", "op"},
+	)
+	blockServiceHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "podtrace_block_io_service_seconds",
+			Help:    "Time block devices took to complete requests once issued.",
+			Buckets: prometheus.ExponentialBuckets(0.00001, 2, 20),
+		},
+		[]string{"type", "process_name", "container", "device", "op"},
+	)
+	blockBytesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "podtrace_block_io_bytes_total",
+			Help: "Bytes transferred by block device requests.",
+		},
+		[]string{"type", "process_name", "container", "device", "op"},
+	)
+	pageFaultHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "podtrace_page_fault_seconds",
+			Help:    "Time to resolve major page faults and minor faults slower than 1ms.",
+			Buckets: prometheus.ExponentialBuckets(0.00001, 2, 20),
+		},
+		[]string{"type", "process_name", "container", "kind"}, // kind = major/minor
+	)
+	pageFaultCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "podtrace_page_faults_total",
+			Help: "User page faults per process.",
+		},
+		[]string{"type", "process_name", "container", "kind"}, // kind = major/minor
 	)
 	rttGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "podtrace_rtt_latest_seconds",
-			Help: "Most recent RTT observed by podtrace.",
+			Help: "Most recent smoothed TCP round-trip time reported by the kernel.",
+		},
+		[]string{"type", "process_name", "container"},
+	)
+	tcpSyscallGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "podtrace_tcp_syscall_latency_latest_seconds",
+			Help: "Most recent TCP send/receive call duration.",
 		},
-		[]string{"type", "process_name"},
+		[]string{"type", "process_name", "container"},
 	)
 
 	latencyGauge = prometheus.NewGaugeVec(
@@ -89,7 +162,111 @@ var (
 			Name: "podtrace_latency_latest_seconds",
 			Help: "Most recent latency observed by podtrace.",
 		},
-		[]string{"type", "process_name"},
+		[]string{"type", "process_name", "container"},
+	)
+
+	tcpRetransmitCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "podtrace_tcp_retransmits_total",
+			Help: "TCP segments retransmitted per process.",
+		},
+		[]string{"type", "process_name", "container"},
+	)
+	tcpResetCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "podtrace_tcp_resets_total",
+			Help: "TCP resets sent or received per process.",
+		},
+		[]string{"type", "process_name", "container", "direction"},
+	)
+
+	acceptQueueHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "podtrace_accept_queue_seconds",
+			Help:    "Time accepted connections waited in their listener's accept queue.",
+			Buckets: prometheus.ExponentialBuckets(0.00001, 2, 20),
+		},
+		[]string{"type", "process_name", "container"},
+	)
+	listenDropsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "podtrace_tcp_listen_drops",
+			Help: "Cumulative connection requests dropped by listening sockets in the container's network namespace.",
+		},
+		[]string{"container", "kind"}, // kind = drops/overflows
+	)
+
+	udpLatencyHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "podtrace_udp_latency_seconds",
+			Help:    "Duration of UDP send/receive calls.",
+			Buckets: prometheus.ExponentialBuckets(0.00001, 2, 20),
+		},
+		[]string{"type", "process_name", "container", "op", "peer"}, // op = send/recv
+	)
+	udpBytesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "podtrace_udp_bytes_total",
+			Help: "Bytes moved by UDP send/receive calls.",
+		},
+		[]string{"type", "process_name", "container", "op"},
+	)
+	udpErrorCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "podtrace_udp_errors_total",
+			Help: "Failed UDP send/receive calls.",
+		},
+		[]string{"type", "process_name", "container", "op"},
+	)
+	udpDropCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "podtrace_udp_drops_total",
+			Help: "Datagrams dropped before reaching the container's UDP sockets.",
+		},
+		[]string{"container", "reason"},
+	)
+
+	oomKillCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "podtrace_oom_kills_total",
+			Help: "Processes killed by the OOM killer.",
+		},
+		[]string{"type", "process_name", "container", "constraint"},
+	)
+	memoryUsageGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "podtrace_memory_usage_bytes",
+			Help: "Memory charged to the container's cgroup.",
+		},
+		[]string{"container"},
+	)
+	memoryRSSGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "podtrace_memory_rss_bytes",
+			Help: "Anonymous (RSS) memory of the container's cgroup.",
+		},
+		[]string{"container"},
+	)
+	memoryLimitGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "podtrace_memory_limit_bytes",
+			Help: "Memory limit of the container's cgroup, 0 if unlimited.",
+		},
+		[]string{"container"},
+	)
+	memoryEventsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "podtrace_memory_events",
+			Help: "Cumulative memory.events counters of the container's cgroup.",
+		},
+		[]string{"container", "event"}, // event = high/max/oom/oom_kill
+	)
+	memoryPressureGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "podtrace_memory_pressure_ratio",
+			Help: "Share of the last 10s that tasks in the container were stalled on memory (PSI avg10).",
+		},
+		[]string{"container", "kind"}, // kind = some/full
 	)
 )
 
@@ -98,6 +275,8 @@ func init() {
 	prometheus.MustRegister(rttHistogram)
 	prometheus.MustRegister(latencyHistogram)
 	prometheus.MustRegister(rttGauge)
+	prometheus.MustRegister(tcpSyscallHistogram)
+	prometheus.MustRegister(tcpSyscallGauge)
 	prometheus.MustRegister(latencyGauge)
 	prometheus.MustRegister(dnsHistogram)
 	prometheus.MustRegister(fsHistogram)
@@ -105,73 +284,272 @@ func init() {
 	prometheus.MustRegister(dnsGauge)
 	prometheus.MustRegister(fsGauge)
 	prometheus.MustRegister(cpuGauge)
+	prometheus.MustRegister(runQueueHistogram)
+	prometheus.MustRegister(blockQueueHistogram)
+	prometheus.MustRegister(blockServiceHistogram)
+	prometheus.MustRegister(blockBytesCounter)
+	prometheus.MustRegister(pageFaultHistogram)
+	prometheus.MustRegister(pageFaultCounter)
+	prometheus.MustRegister(tcpRetransmitCounter)
+	prometheus.MustRegister(tcpResetCounter)
+	prometheus.MustRegister(acceptQueueHistogram)
+	prometheus.MustRegister(listenDropsGauge)
+	prometheus.MustRegister(udpLatencyHistogram)
+	prometheus.MustRegister(udpBytesCounter)
+	prometheus.MustRegister(udpErrorCounter)
+	prometheus.MustRegister(udpDropCounter)
+	prometheus.MustRegister(oomKillCounter)
+	prometheus.MustRegister(memoryUsageGauge)
+	prometheus.MustRegister(memoryRSSGauge)
+	prometheus.MustRegister(memoryLimitGauge)
+	prometheus.MustRegister(memoryEventsGauge)
+	prometheus.MustRegister(memoryPressureGauge)
 }
 
 func HandleEvents(ch <-chan *events.Event) {
 	for e := range ch {
-		if e == nil {
-			continue
-		}
-		switch e.Type {
-		case events.EventConnect:
-			ExportTCPMetric(e)
+		HandleEvent(e)
+	}
+}
+
+// HandleEvent exports the metrics for a single event
+func HandleEvent(e *events.Event) {
+	if e == nil {
+		return
+	}
+	switch e.Type {
+	case events.EventConnect:
+		ExportTCPMetric(e)
 
-		case events.EventTCPSend:
-			ExportRTTMetric(e)
+	case events.EventTCPSend, events.EventTCPRecv:
+		ExportTCPSyscallMetric(e)
 
-		case events.EventTCPRecv:
-			ExportRTTMetric(e)
+	case events.EventTCPRTT:
+		ExportRTTMetric(e)
 
-		case events.EventDNS:
-			ExportDNSMetric(e)
+	case events.EventDNS, events.EventDNSQuery:
+		ExportDNSMetric(e)
 
-		case events.EventWrite:
-			ExportFileSystemMetric(e)
+	case events.EventWrite:
+		ExportFileSystemMetric(e)
 
-		case events.EventFsync:
-			ExportFileSystemMetric(e)
+	case events.EventFsync:
+		ExportFileSystemMetric(e)
 
-		case events.EventSchedSwitch:
-			ExportSchedSwitchMetric(e)
-		}
+	case events.EventSchedSwitch:
+		ExportSchedSwitchMetric(e)
+
+	case events.EventRunQueue:
+		ExportRunQueueMetric(e)
+
+	case events.EventTCPRetransmit, events.EventTCPSendReset, events.EventTCPRecvReset:
+		ExportTCPLossMetric(e)
+
+	case events.EventAccept, events.EventNetStat:
+		ExportAcceptMetric(e)
+
+	case events.EventUDPSend, events.EventUDPRecv, events.EventUDPDrop:
+		ExportUDPMetric(e)
+
+	case events.EventOOMKill:
+		ExportOOMKillMetric(e)
+
+	case events.EventCgroupMemory:
+		ExportMemoryMetric(e)
+
+	case events.EventBlockIO:
+		ExportBlockIOMetric(e)
+
+	case events.EventPageFault, events.EventPageFaultCount:
+		ExportPageFaultMetric(e)
 	}
 }
 
+// ExportTCPSyscallMetric records how long a TCP send or receive call took,
+// which includes time spent waiting on the peer
+func ExportTCPSyscallMetric(e *events.Event) {
+	latencySec := float64(e.LatencyNS) / 1e9
+	tcpSyscallHistogram.WithLabelValues(e.TypeString(), e.ProcessName, e.Container, peerLabel(e.Target)).Observe(latencySec)
+	tcpSyscallGauge.WithLabelValues(e.TypeString(), e.ProcessName, e.Container).Set(latencySec)
+}
+
+// ExportRTTMetric records a kernel-reported smoothed RTT sample
 func ExportRTTMetric(e *events.Event) {
 	rttSec := float64(e.LatencyNS) / 1e9
-	rttHistogram.WithLabelValues(e.TypeString(), e.ProcessName).Observe(rttSec)
-	rttGauge.WithLabelValues(e.TypeString(), e.ProcessName).Set(rttSec)
+	rttHistogram.WithLabelValues(e.TypeString(), e.ProcessName, e.Container, peerLabel(e.Target)).Observe(rttSec)
+	rttGauge.WithLabelValues(e.TypeString(), e.ProcessName, e.Container).Set(rttSec)
+}
+
+// peerLabel returns the address of a remote endpoint for the peer label.
+// Ports are dropped since inbound connections come from ephemeral ports.
+func peerLabel(endpoint string) string {
+	if endpoint == "" {
+		return "unknown"
+	}
+	peer := endpoint
+	if i := strings.LastIndex(endpoint, ":"); i >= 0 {
+		peer = endpoint[:i]
+	}
+
+	peerLabelsMu.Lock()
+	defer peerLabelsMu.Unlock()
+	if !peerLabels[peer] {
+		if len(peerLabels) >= maxPeerLabels {
+			return "other"
+		}
+		peerLabels[peer] = true
+	}
+	return peer
 }
 
 func ExportTCPMetric(e *events.Event) {
 	latencySec := float64(e.LatencyNS) / 1e9
-	latencyHistogram.WithLabelValues(e.TypeString(), e.ProcessName).Observe(latencySec)
-	latencyGauge.WithLabelValues(e.TypeString(), e.ProcessName).Set(latencySec)
+	latencyHistogram.WithLabelValues(e.TypeString(), e.ProcessName, e.Container).Observe(latencySec)
+	latencyGauge.WithLabelValues(e.TypeString(), e.ProcessName, e.Container).Set(latencySec)
 }
 
 func ExportDNSMetric(e *events.Event) {
+	source := "getaddrinfo"
+	if e.Type == events.EventDNSQuery {
+		source = "wire"
+	}
 
 	latencySec := float64(e.LatencyNS) / 1e9
-	dnsGauge.WithLabelValues(e.TypeString(), e.ProcessName).Set(latencySec)
-	dnsHistogram.WithLabelValues(e.TypeString(), e.ProcessName).Observe(latencySec)
+	dnsGauge.WithLabelValues(e.TypeString(), e.ProcessName, e.Container, source).Set(latencySec)
+	dnsHistogram.WithLabelValues(e.TypeString(), e.ProcessName, e.Container, source).Observe(latencySec)
 }
 
 func ExportFileSystemMetric(e *events.Event) {
 
 	latencySec := float64(e.LatencyNS) / 1e9
-	fsGauge.WithLabelValues(e.TypeString(), e.ProcessName).Set(latencySec)
-	fsHistogram.WithLabelValues(e.TypeString(), e.ProcessName).Observe(latencySec)
+	fsGauge.WithLabelValues(e.TypeString(), e.ProcessName, e.Container).Set(latencySec)
+	fsHistogram.WithLabelValues(e.TypeString(), e.ProcessName, e.Container).Observe(latencySec)
 
 }
 
 func ExportSchedSwitchMetric(e *events.Event) {
 
 	blockSec := float64(e.LatencyNS) / 1e9
-	cpuGauge.WithLabelValues(e.TypeString(), e.ProcessName).Set(blockSec)
-	cpuHistogram.WithLabelValues(e.TypeString(), e.ProcessName).Observe(blockSec)
+	cpuGauge.WithLabelValues(e.TypeString(), e.ProcessName, e.Container).Set(blockSec)
+	cpuHistogram.WithLabelValues(e.TypeString(), e.ProcessName, e.Container).Observe(blockSec)
 
 }
 
+// ExportRunQueueMetric records how long a thread waited for a CPU
+func ExportRunQueueMetric(e *events.Event) {
+	waitSec := float64(e.LatencyNS) / 1e9
+	runQueueHistogram.WithLabelValues(e.TypeString(), e.ProcessName, e.Container).Observe(waitSec)
+}
+
+// ExportTCPLossMetric counts TCP retransmits and resets
+func ExportTCPLossMetric(e *events.Event) {
+	switch e.Type {
+	case events.EventTCPRetransmit:
+		tcpRetransmitCounter.WithLabelValues(e.TypeString(), e.ProcessName, e.Container).Inc()
+	case events.EventTCPSendReset:
+		tcpResetCounter.WithLabelValues(e.TypeString(), e.ProcessName, e.Container, "sent").Inc()
+	case events.EventTCPRecvReset:
+		tcpResetCounter.WithLabelValues(e.TypeString(), e.ProcessName, e.Container, "received").Inc()
+	}
+}
+
+// ExportAcceptMetric records how long an accepted connection was queued, or
+// sets the listen drop gauges from a netstat sample
+func ExportAcceptMetric(e *events.Event) {
+	if e.Type == events.EventAccept {
+		if e.LatencyNS > 0 {
+			acceptQueueHistogram.WithLabelValues(e.TypeString(), e.ProcessName, e.Container).Observe(float64(e.LatencyNS) / 1e9)
+		}
+		return
+	}
+	if e.NetStat == nil {
+		return
+	}
+	listenDropsGauge.WithLabelValues(e.Container, "drops").Set(float64(e.NetStat.ListenDrops))
+	listenDropsGauge.WithLabelValues(e.Container, "overflows").Set(float64(e.NetStat.ListenOverflows))
+}
+
+// ExportUDPMetric records the duration, bytes and failure of a UDP send or
+// receive call, or counts a dropped datagram
+func ExportUDPMetric(e *events.Event) {
+	if e.Type == events.EventUDPDrop {
+		udpDropCounter.WithLabelValues(e.Container, events.UDPDropReasonName(e.State)).Inc()
+		return
+	}
+
+	op := "send"
+	if e.Type == events.EventUDPRecv {
+		op = "recv"
+	}
+	if e.Error < 0 {
+		// EAGAIN only means a non-blocking socket had nothing to receive
+		if e.Error != -11 {
+			udpErrorCounter.WithLabelValues(e.TypeString(), e.ProcessName, e.Container, op).Inc()
+		}
+		return
+	}
+	udpLatencyHistogram.WithLabelValues(e.TypeString(), e.ProcessName, e.Container, op, peerLabel(e.Target)).Observe(float64(e.LatencyNS) / 1e9)
+	udpBytesCounter.WithLabelValues(e.TypeString(), e.ProcessName, e.Container, op).Add(float64(e.Bytes))
+}
+
+// ExportOOMKillMetric counts a process killed by the OOM killer
+func ExportOOMKillMetric(e *events.Event) {
+	name := e.ProcessName
+	if name == "" {
+		name = e.Target
+	}
+	oomKillCounter.WithLabelValues(e.TypeString(), name, e.Container, e.Details).Inc()
+}
+
+// ExportMemoryMetric sets the memory gauges of a container from a cgroup
+// memory sample
+func ExportMemoryMetric(e *events.Event) {
+	m := e.CgroupMemory
+	if m == nil {
+		return
+	}
+	memoryUsageGauge.WithLabelValues(e.Container).Set(float64(m.UsageBytes))
+	memoryRSSGauge.WithLabelValues(e.Container).Set(float64(m.AnonBytes))
+	memoryLimitGauge.WithLabelValues(e.Container).Set(float64(m.LimitBytes))
+	memoryEventsGauge.WithLabelValues(e.Container, "high").Set(float64(m.High))
+	memoryEventsGauge.WithLabelValues(e.Container, "max").Set(float64(m.Max))
+	memoryEventsGauge.WithLabelValues(e.Container, "oom").Set(float64(m.OOM))
+	memoryEventsGauge.WithLabelValues(e.Container, "oom_kill").Set(float64(m.OOMKill))
+	memoryPressureGauge.WithLabelValues(e.Container, "some").Set(m.PressureSomeAvg10 / 100)
+	memoryPressureGauge.WithLabelValues(e.Container, "full").Set(m.PressureFullAvg10 / 100)
+}
+
+// ExportBlockIOMetric records the queue and service time of a block device
+// request and the bytes it transferred
+func ExportBlockIOMetric(e *events.Event) {
+	b := e.BlockIO
+	if b == nil {
+		return
+	}
+	device := e.Target
+	if device == "" {
+		device = b.DeviceString()
+	}
+	labels := []string{e.TypeString(), e.ProcessName, e.Container, device, b.OpName()}
+	blockQueueHistogram.WithLabelValues(labels...).Observe(float64(b.QueueNS) / 1e9)
+	blockServiceHistogram.WithLabelValues(labels...).Observe(float64(b.ServiceNS(e.LatencyNS)) / 1e9)
+	blockBytesCounter.WithLabelValues(labels...).Add(float64(b.Bytes))
+}
+
+// ExportPageFaultMetric records how long a traced page fault took, or counts
+// the faults of a process from a page fault sample
+func ExportPageFaultMetric(e *events.Event) {
+	if e.Type == events.EventPageFault {
+		pageFaultHistogram.WithLabelValues(e.TypeString(), e.ProcessName, e.Container, e.Details).Observe(float64(e.LatencyNS) / 1e9)
+		return
+	}
+	if e.PageFaults == nil {
+		return
+	}
+	pageFaultCounter.WithLabelValues(e.TypeString(), e.ProcessName, e.Container, "minor").Add(float64(e.PageFaults.Minor))
+	pageFaultCounter.WithLabelValues(e.TypeString(), e.ProcessName, e.Container, "major").Add(float64(e.PageFaults.Major))
+}
+
 func StartServer() {
 	http.Handle("/metrics", promhttp.Handler())
 	go http.ListenAndServe(":3000", nil)
@@ -0,0 +1,153 @@
+// Package profile holds CPU profiles sampled by podtrace and writes them as
+// pprof protobuf and folded stacks
+package profile
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// Sample is a stack that was on-CPU in a process Count times. Frames are
+// innermost first and may carry a "+0x<offset>" suffix.
+type Sample struct {
+	PID         uint32
+	Process     string
+	Container   string
+	KernelStack []string
+	UserStack   []string
+	Count       uint64
+}
+
+// Profile is the result of sampling at Frequency Hz per CPU
+type Profile struct {
+	Samples   []Sample
+	Frequency uint64
+	Start     time.Time
+	Duration  time.Duration
+}
+
+// TotalSamples returns the number of samples taken in the traced processes
+func (p *Profile) TotalSamples() uint64 {
+	var total uint64
+	for _, s := range p.Samples {
+		total += s.Count
+	}
+	return total
+}
+
+// WriteFolded writes the profile in the folded format read by flamegraph.pl:
+// one line per stack, frames from the root separated by ";", followed by the
+// sample count. The container and process are the two root frames and kernel
+// frames are suffixed with "_[k]".
+func (p *Profile) WriteFolded(w io.Writer) error {
+	counts := make(map[string]uint64)
+	for _, s := range p.Samples {
+		frames := []string{containerName(s.Container), fmt.Sprintf("%s (%d)", processName(s.Process), s.PID)}
+		for i := len(s.UserStack) - 1; i >= 0; i-- {
+			frames = append(frames, functionName(s.UserStack[i]))
+		}
+		for i := len(s.KernelStack) - 1; i >= 0; i-- {
+			frames = append(frames, functionName(s.KernelStack[i])+"_[k]")
+		}
+		counts[strings.Join(frames, ";")] += s.Count
+	}
+
+	stacks := make([]string, 0, len(counts))
+	for stack := range counts {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+
+	for _, stack := range stacks {
+		if _, err := fmt.Fprintf(w, "%s %d\n", stack, counts[stack]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WritePprof writes the profile as gzipped pprof protobuf, for use with
+// go tool pprof. Samples are labeled with their process and container.
+func (p *Profile) WritePprof(w io.Writer) error {
+	period := int64(time.Second) / int64(max(p.Frequency, 1))
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "samples", Unit: "count"},
+			{Type: "cpu", Unit: "nanoseconds"},
+		},
+		PeriodType:    &profile.ValueType{Type: "cpu", Unit: "nanoseconds"},
+		Period:        period,
+		TimeNanos:     p.Start.UnixNano(),
+		DurationNanos: p.Duration.Nanoseconds(),
+	}
+
+	functions := make(map[string]*profile.Function)
+	locations := make(map[string]*profile.Location)
+	location := func(name, filename string) *profile.Location {
+		key := filename + "\x00" + name
+		if loc, ok := locations[key]; ok {
+			return loc
+		}
+		fn, ok := functions[key]
+		if !ok {
+			fn = &profile.Function{ID: uint64(len(functions) + 1), Name: name, SystemName: name, Filename: filename}
+			functions[key] = fn
+			prof.Function = append(prof.Function, fn)
+		}
+		loc := &profile.Location{ID: uint64(len(locations) + 1), Line: []profile.Line{{Function: fn}}}
+		locations[key] = loc
+		prof.Location = append(prof.Location, loc)
+		return loc
+	}
+
+	for _, s := range p.Samples {
+		sample := &profile.Sample{
+			Value: []int64{int64(s.Count), int64(s.Count) * period},
+			Label: map[string][]string{
+				"process":   {processName(s.Process)},
+				"container": {containerName(s.Container)},
+			},
+			NumLabel: map[string][]int64{"pid": {int64(s.PID)}},
+		}
+		for _, frame := range s.KernelStack {
+			sample.Location = append(sample.Location, location(functionName(frame), "[kernel]"))
+		}
+		for _, frame := range s.UserStack {
+			sample.Location = append(sample.Location, location(functionName(frame), ""))
+		}
+		prof.Sample = append(prof.Sample, sample)
+	}
+
+	if err := prof.CheckValid(); err != nil {
+		return fmt.Errorf("invalid profile: %w", err)
+	}
+	return prof.Write(w)
+}
+
+// functionName strips the offset from a symbolized frame, so that samples at
+// different instructions of a function are merged
+func functionName(frame string) string {
+	if i := strings.LastIndex(frame, "+0x"); i > 0 {
+		return frame[:i]
+	}
+	return frame
+}
+
+func processName(name string) string {
+	if name == "" {
+		return "unknown"
+	}
+	return name
+}
+
+func containerName(name string) string {
+	if name == "" {
+		return "host"
+	}
+	return name
+}
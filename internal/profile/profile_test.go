@@ -0,0 +1,71 @@
+package profile
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+func testProfile() *Profile {
+	return &Profile{
+		Frequency: 100,
+		Start:     time.Unix(1700000000, 0),
+		Duration:  10 * time.Second,
+		Samples: []Sample{
+			{PID: 42, Process: "app", Container: "web", KernelStack: []string{"copy_user+0x10", "vfs_read"}, UserStack: []string{"read+0x8", "main"}, Count: 3},
+			{PID: 42, Process: "app", Container: "web", KernelStack: []string{"copy_user+0x20", "vfs_read"}, UserStack: []string{"read+0x8", "main"}, Count: 2},
+			{PID: 7, Process: "sidecar", Container: "proxy", UserStack: []string{"loop"}, Count: 1},
+		},
+	}
+}
+
+func TestWriteFolded(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testProfile().WriteFolded(&buf); err != nil {
+		t.Fatalf("WriteFolded failed: %v", err)
+	}
+
+	expected := "proxy;sidecar (7);loop 1\n" +
+		"web;app (42);main;read;vfs_read_[k];copy_user_[k] 5\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected folded output:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestWritePprof(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testProfile().WritePprof(&buf); err != nil {
+		t.Fatalf("WritePprof failed: %v", err)
+	}
+
+	prof, err := profile.Parse(&buf)
+	if err != nil {
+		t.Fatalf("failed to parse written profile: %v", err)
+	}
+	if prof.Period != 10000000 {
+		t.Errorf("expected a 10ms period, got %d", prof.Period)
+	}
+	if len(prof.Sample) != 3 {
+		t.Fatalf("expected 3 samples, got %d", len(prof.Sample))
+	}
+
+	first := prof.Sample[0]
+	if first.Value[0] != 3 || first.Value[1] != 30000000 {
+		t.Errorf("unexpected sample values %v", first.Value)
+	}
+	if leaf := first.Location[0].Line[0].Function; leaf.Name != "copy_user" || leaf.Filename != "[kernel]" {
+		t.Errorf("expected kernel leaf frame copy_user, got %s in %s", leaf.Name, leaf.Filename)
+	}
+	if root := first.Location[len(first.Location)-1].Line[0].Function.Name; root != "main" {
+		t.Errorf("expected root frame main, got %s", root)
+	}
+	if first.Label["container"][0] != "web" || first.NumLabel["pid"][0] != 42 {
+		t.Errorf("unexpected labels %v %v", first.Label, first.NumLabel)
+	}
+	// the two stacks of pid 42 differ only in offsets and share locations
+	if first.Location[0] != prof.Sample[1].Location[0] {
+		t.Error("expected frames at different offsets of a function to share a location")
+	}
+}